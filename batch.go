@@ -0,0 +1,168 @@
+// Copyright (c) 2024 RoseLoverX
+
+package gogram
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/roj1512/gogram/internal/encoding/tl"
+	"github.com/roj1512/gogram/internal/mtproto/messages"
+	"github.com/roj1512/gogram/internal/mtproto/objects"
+	"github.com/roj1512/gogram/internal/utils"
+)
+
+// maxContainerSize is the most messages telegram accepts in a single msg_container
+const maxContainerSize = 1020
+
+// BatchError is returned by MakeBatchRequest when some of the requests failed,
+// the results of the others are still returned
+type BatchError struct {
+	// Errors holds the error of every request, nil for the ones that succeeded
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	failed, first := 0, error(nil)
+	for _, err := range e.Errors {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d of %d batched requests failed, first: %v", failed, len(e.Errors), first)
+}
+
+func (e *BatchError) Unwrap() []error {
+	return e.Errors
+}
+
+// MakeBatchRequest sends the requests packed in msg_containers, saving a round trip
+// per request, and returns their results in the order of the requests. When some
+// fail, the error is a *BatchError holding the error of each request.
+func (m *MTProto) MakeBatchRequest(ctx context.Context, requests []tl.Object) ([]any, error) {
+	results, errs := make([]any, len(requests)), make([]error, len(requests))
+	for start := 0; start < len(requests); start += maxContainerSize {
+		end := min(start+maxContainerSize, len(requests))
+		if err := m.batchRequest(ctx, requests[start:end], results[start:end], errs[start:end]); err != nil {
+			return nil, err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return results, &BatchError{Errors: errs}
+		}
+	}
+	return results, nil
+}
+
+func (m *MTProto) batchRequest(ctx context.Context, requests []tl.Object, results []any, errs []error) error {
+	if m.limiters != nil {
+		for _, request := range requests {
+			if err := m.limiters.wait(ctx, requestName(request)); err != nil {
+				return err
+			}
+		}
+	}
+	if !m.TcpActive() {
+		return errors.New("Can't make request. Connection is not established")
+	}
+	start := time.Now()
+	resps, msgIDs, err := m.sendContainer(requests)
+	if err != nil {
+		return err
+	}
+	var timeout <-chan time.Time
+	if m.requestTimeout > 0 {
+		timer := time.NewTimer(m.requestTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for i, resp := range resps {
+		var response tl.Object
+		select {
+		case response = <-resp:
+		case <-ctx.Done():
+			m.forgetRequests(msgIDs[i:])
+			return ctx.Err()
+		case <-timeout:
+			m.forgetRequests(msgIDs[i:])
+			return ErrRequestTimeout
+		}
+		results[i], errs[i] = m.handleResponse(ctx, requests[i], 0, response)
+		if m.metrics != nil {
+			m.metrics.ObserveRequest(requestName(requests[i]), time.Since(start), errs[i])
+		}
+	}
+	return nil
+}
+
+func (m *MTProto) forgetRequests(msgIDs []int64) {
+	for _, msgID := range msgIDs {
+		m.forgetRequest(int(msgID))
+	}
+}
+
+// sendContainer sends the requests in a single msg_container, returning the
+// response channel and message ID of each
+func (m *MTProto) sendContainer(requests []tl.Object) ([]chan tl.Object, []int64, error) {
+	if !m.encrypted {
+		return nil, nil, errors.New("containers need an encrypted connection")
+	}
+	container := make(objects.MessageContainer, len(requests))
+	resps, msgIDs := make([]chan tl.Object, len(requests)), make([]int64, len(requests))
+	forget := func() { m.forgetRequests(msgIDs) }
+	for i, request := range requests {
+		msg, err := tl.Marshal(request)
+		if err != nil {
+			forget()
+			return nil, nil, errors.Wrap(err, "marshaling request")
+		}
+		msgIDs[i] = m.nextMessageID()
+		resps[i] = m.getRespChannel()
+		if isNullableResponse(request) {
+			go func(resp chan tl.Object) { resp <- &objects.Null{} }(resps[i])
+		} else {
+			m.responseChannels.Add(int(msgIDs[i]), resps[i])
+		}
+		seqNo := m.UpdateSeqNo()
+		if MessageRequireToAck(request) {
+			seqNo |= 1
+		}
+		container[i] = &messages.Encrypted{Msg: msg, MsgID: msgIDs[i], SeqNo: seqNo}
+	}
+	msg, err := tl.Marshal(&container)
+	if err != nil {
+		forget()
+		return nil, nil, errors.Wrap(err, "marshaling container")
+	}
+	t := m.getTransport()
+	if t == nil {
+		forget()
+		return nil, nil, errors.New("transport is nil, please use SetTransport")
+	}
+	// the container is not content related, it doesn't take a seq_no of its own
+	data := &messages.Encrypted{Msg: msg, MsgID: m.nextMessageID(), AuthKeyHash: m.authKeyHash}
+	if err := t.WriteMsg(data, false, m.currentSeqNo()); err != nil {
+		forget()
+		return nil, nil, fmt.Errorf("writing message: %w", err)
+	}
+	return resps, msgIDs, nil
+}
+
+func (m *MTProto) nextMessageID() int64 {
+	m.lastMessageIDMutex.Lock()
+	defer m.lastMessageIDMutex.Unlock()
+	m.lastMessageID = utils.GenerateMessageId(m.lastMessageID)
+	return m.lastMessageID
+}
+
+func (m *MTProto) currentSeqNo() int32 {
+	m.seqNoMutex.Lock()
+	defer m.seqNoMutex.Unlock()
+	return m.seqNo
+}
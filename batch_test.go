@@ -0,0 +1,82 @@
+// Copyright (c) 2024 RoseLoverX
+
+package gogram
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/roj1512/gogram/internal/encoding/tl"
+	"github.com/roj1512/gogram/internal/mtproto/messages"
+	"github.com/roj1512/gogram/internal/mtproto/objects"
+	"github.com/roj1512/gogram/internal/utils"
+)
+
+// capturingTransport hands the messages written to it over to the test
+type capturingTransport struct {
+	written chan messages.Common
+}
+
+func (t capturingTransport) Close() error { return nil }
+func (t capturingTransport) WriteMsg(msg messages.Common, _ bool, _ int32) error {
+	t.written <- msg
+	return nil
+}
+func (t capturingTransport) ReadMsg() (messages.Common, error) { select {} }
+
+func TestMakeBatchRequest(t *testing.T) {
+	tr := capturingTransport{written: make(chan messages.Common, 1)}
+	m := &MTProto{
+		transport:        tr,
+		encrypted:        true,
+		responseChannels: utils.NewSyncIntObjectChan(),
+		expectedTypes:    utils.NewSyncIntReflectTypes(),
+		Logger:           utils.NewLogger("test").SetLevel("error"),
+	}
+	m.tcpActive.Store(true)
+	type result struct {
+		results []any
+		err     error
+	}
+	done := make(chan result)
+	go func() {
+		results, err := m.MakeBatchRequest(context.Background(), []tl.Object{
+			&objects.PingParams{PingID: 1},
+			&objects.PingParams{PingID: 2},
+		})
+		done <- result{results, err}
+	}()
+
+	obj, err := tl.DecodeUnknownObject((<-tr.written).GetMsg())
+	if err != nil {
+		t.Fatal(err)
+	}
+	container, ok := obj.(*objects.MessageContainer)
+	if !ok || len(*container) != 2 {
+		t.Fatalf("expected a container of 2 messages, got %T", obj)
+	}
+	// answered out of order, the second one failing
+	replies := []tl.Object{
+		&objects.RpcResult{ReqMsgID: (*container)[1].MsgID, Obj: &objects.RpcError{ErrorCode: 400, ErrorMessage: "PEER_ID_INVALID"}},
+		&objects.RpcResult{ReqMsgID: (*container)[0].MsgID, Obj: &objects.Pong{PingID: 1}},
+	}
+	for _, reply := range replies {
+		msg, err := tl.Marshal(reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.processResponse(&messages.Unencrypted{Msg: msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res := <-done
+	var batchErr *BatchError
+	if !errors.As(res.err, &batchErr) || batchErr.Errors[0] != nil || batchErr.Errors[1] == nil {
+		t.Fatalf("expected the second request to fail, got %v", res.err)
+	}
+	if pong, ok := res.results[0].(*objects.Pong); !ok || pong.PingID != 1 {
+		t.Errorf("expected the pong of the first request, got %#v", res.results[0])
+	}
+}
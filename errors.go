@@ -8,17 +8,53 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/roj1512/gogram/internal/mtproto/objects"
 )
 
-type ErrResponseCode struct {
+// RPCError is the error returned for an rpc_error sent by the server.
+// Message is the error name with parameters replaced by X (e.g FLOOD_WAIT_X),
+// and the server's message as is for errors without parameters.
+type RPCError struct {
 	Code           int
 	Message        string
 	Description    string
 	AdditionalInfo any // some errors has additional data like timeout seconds, dc id etc.
 }
 
+// Deprecated: use RPCError
+type ErrResponseCode = RPCError
+
+// IsFloodWait reports whether err is a FLOOD_WAIT_X (or SLOWMODE_WAIT_X) error, returning the wait
+func IsFloodWait(err error) (time.Duration, bool) {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return 0, false
+	}
+	switch rpcErr.Message {
+	case "FLOOD_WAIT_X", "FLOOD_TEST_PHONE_WAIT_X", "SLOWMODE_WAIT_X":
+		if seconds, ok := rpcErr.AdditionalInfo.(int); ok {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+// IsMigrate reports whether err is a *_MIGRATE_X error, returning the DC to migrate to
+func IsMigrate(err error) (int, bool) {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return 0, false
+	}
+	if strings.HasSuffix(rpcErr.Message, "_MIGRATE_X") {
+		dc, ok := rpcErr.AdditionalInfo.(int)
+		return dc, ok
+	}
+	return 0, false
+}
+
 func RpcErrorToNative(r *objects.RpcError) error {
 	nativeErrorName, additionalData := TryExpandError(r.ErrorMessage)
 
@@ -31,7 +67,7 @@ func RpcErrorToNative(r *objects.RpcError) error {
 		desc = fmt.Sprintf(desc, additionalData)
 	}
 
-	return &ErrResponseCode{
+	return &RPCError{
 		Code:           int(r.ErrorCode),
 		Message:        nativeErrorName,
 		Description:    desc,
@@ -99,7 +135,7 @@ func TryExpandError(errStr string) (nativeErrorName string, additionalData any)
 	return nativeErrorName, additionalData
 }
 
-func (e *ErrResponseCode) Error() string {
+func (e *RPCError) Error() string {
 	return fmt.Sprintf("[%s] %s (code %d)", e.Message, e.Description, e.Code)
 }
 
@@ -725,3 +761,15 @@ func (*errorSessionConfigsChanged) Error() string {
 func (*errorSessionConfigsChanged) CRC() uint32 {
 	return 0x00000000
 }
+
+type errorRequestAborted struct {
+	err error
+}
+
+func (e *errorRequestAborted) Error() string {
+	return "request aborted: " + e.err.Error()
+}
+
+func (*errorRequestAborted) CRC() uint32 {
+	return 0x00000000
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2024 RoseLoverX
+
+package gogram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/roj1512/gogram/internal/mtproto/objects"
+)
+
+func TestRPCErrorHelpers(t *testing.T) {
+	flood := errors.Wrap(RpcErrorToNative(&objects.RpcError{ErrorCode: 420, ErrorMessage: "FLOOD_WAIT_30"}), "sending request")
+	if wait, ok := IsFloodWait(flood); !ok || wait != 30*time.Second {
+		t.Errorf("IsFloodWait = %v, %v", wait, ok)
+	}
+	if _, ok := IsMigrate(flood); ok {
+		t.Error("flood wait reported as migrate")
+	}
+
+	migrate := RpcErrorToNative(&objects.RpcError{ErrorCode: 303, ErrorMessage: "PHONE_MIGRATE_4"})
+	if dc, ok := IsMigrate(migrate); !ok || dc != 4 {
+		t.Errorf("IsMigrate = %v, %v", dc, ok)
+	}
+
+	var rpcErr *RPCError
+	unknown := RpcErrorToNative(&objects.RpcError{ErrorCode: 400, ErrorMessage: "SOME_NEW_ERROR"})
+	if !errors.As(unknown, &rpcErr) || rpcErr.Code != 400 || rpcErr.Message != "SOME_NEW_ERROR" {
+		t.Errorf("unexpected error %#v", unknown)
+	}
+}
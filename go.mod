@@ -3,7 +3,6 @@ module github.com/roj1512/gogram
 go 1.21
 
 require (
-	github.com/roj1512/gogram v0.0.0-20240105072448-85dd90da6123
 	github.com/pkg/errors v0.9.1
 	golang.org/x/net v0.19.0
 )
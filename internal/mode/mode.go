@@ -50,10 +50,35 @@ func New(v Variant, conn io.ReadWriter) (Mode, error) {
 	return m, nil
 }
 
+// NewWithoutAnnouncement creates the mode without writing its announcement, for transports
+// which announce the mode themselves (e.g the obfuscated2 init of MTProxy connections)
+func NewWithoutAnnouncement(v Variant, conn io.ReadWriter) (Mode, error) {
+	if conn == nil {
+		return nil, ErrInterfaceIsNil
+	}
+	return initMode(v, conn)
+}
+
+// Tag returns the 4 byte protocol tag of the mode, as used in the obfuscated2 init
+func Tag(v Variant) ([]byte, error) {
+	switch v {
+	case Abridged:
+		return []byte{0xef, 0xef, 0xef, 0xef}, nil
+	case Intermediate:
+		return transportModeIntermediate[:], nil
+	case PaddedIntermediate:
+		return transportModePaddedIntermediate[:], nil
+	default:
+		return nil, ErrModeNotSupported
+	}
+}
+
 func initMode(v Variant, conn io.ReadWriter) (Mode, error) {
 	switch v {
-	case PaddedIntermediate, Full:
+	case Full:
 		panic("not supported yet")
+	case PaddedIntermediate:
+		return &paddedIntermediate{conn: conn}, nil
 	case Abridged:
 		return &abridged{conn: conn}, nil
 	case Intermediate:
@@ -102,6 +127,8 @@ func GetVariant(m Mode) (Variant, error) {
 		return Abridged, nil
 	case *intermediate:
 		return Intermediate, nil
+	case *paddedIntermediate:
+		return PaddedIntermediate, nil
 	default:
 		return Variant(0xff), errors.New("using custom mode, cant't detect")
 	}
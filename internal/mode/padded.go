@@ -0,0 +1,85 @@
+// Copyright (c) 2024 RoseLoverX
+
+package mode
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/roj1512/gogram/internal/encoding/tl"
+)
+
+// paddedIntermediate is the intermediate mode with 0-15 random bytes appended to each packet,
+// required by obfuscated MTProxy connections with dd/ee secrets
+// https://core.telegram.org/mtproto/mtproto-transports#padded-intermediate
+type paddedIntermediate struct {
+	conn io.ReadWriter
+}
+
+var _ Mode = (*paddedIntermediate)(nil)
+
+var transportModePaddedIntermediate = [...]byte{0xdd, 0xdd, 0xdd, 0xdd} // meta:immutable
+
+func (*paddedIntermediate) getModeAnnouncement() []byte {
+	return transportModePaddedIntermediate[:]
+}
+
+func (m *paddedIntermediate) WriteMsg(msg []byte) error {
+	padLen, err := rand.Int(rand.Reader, big.NewInt(16))
+	if err != nil {
+		return err
+	}
+	packet := make([]byte, tl.WordLen+len(msg)+int(padLen.Int64()))
+	binary.LittleEndian.PutUint32(packet, uint32(len(packet)-tl.WordLen))
+	copy(packet[tl.WordLen:], msg)
+	if _, err := rand.Read(packet[tl.WordLen+len(msg):]); err != nil {
+		return err
+	}
+	_, err = m.conn.Write(packet)
+	return err
+}
+
+func (m *paddedIntermediate) ReadMsg() ([]byte, error) {
+	sizeBuf := make([]byte, tl.WordLen)
+	if _, err := io.ReadFull(m.conn, sizeBuf); err != nil {
+		return nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(sizeBuf)
+	msg := make([]byte, int(size))
+	if _, err := io.ReadFull(m.conn, msg); err != nil {
+		return nil, err
+	}
+	return trimPadding(msg)
+}
+
+// trimPadding strips the random padding from a received packet,
+// using the size the message itself declares
+func trimPadding(msg []byte) ([]byte, error) {
+	const (
+		headerLen    = tl.LongLen + tl.LongLen + tl.WordLen // auth_key_id + msg_id + length
+		encHeaderLen = tl.LongLen + 16                      // auth_key_id + msg_key
+	)
+	switch {
+	case len(msg) < tl.LongLen:
+		// error code, 4 bytes
+		return msg[:len(msg)-len(msg)%tl.WordLen], nil
+	case binary.LittleEndian.Uint64(msg) == 0:
+		if len(msg) < headerLen {
+			return nil, fmt.Errorf("packet too short: %d bytes", len(msg))
+		}
+		size := headerLen + int(binary.LittleEndian.Uint32(msg[tl.LongLen+tl.LongLen:]))
+		if size > len(msg) {
+			return nil, fmt.Errorf("packet declares %d bytes, got %d", size, len(msg))
+		}
+		return msg[:size], nil
+	default:
+		if len(msg) < encHeaderLen {
+			return nil, fmt.Errorf("packet too short: %d bytes", len(msg))
+		}
+		return msg[:encHeaderLen+(len(msg)-encHeaderLen)/16*16], nil
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2024 RoseLoverX
+
+package session
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	encryptedKeyMagic = "GGE1"
+	passphraseSaltLen = 16
+	pbkdf2Iterations  = 100000
+)
+
+var ErrInvalidPassphrase = errors.New("failed to decrypt session: invalid passphrase or corrupted session")
+
+// encryptedSessionLoader wraps another loader, encrypting the auth key with AES-GCM
+// before it's stored, the key is derived from a passphrase with PBKDF2-SHA256.
+// Stored auth keys are laid out as: magic(4) | salt(16) | nonce(12) | ciphertext
+type encryptedSessionLoader struct {
+	SessionLoader
+	passphrase []byte
+
+	mu   sync.Mutex
+	salt []byte
+	key  []byte
+}
+
+var _ SessionLoader = (*encryptedSessionLoader)(nil)
+
+// NewEncrypted wraps loader so the auth key is encrypted at rest with the given passphrase
+func NewEncrypted(loader SessionLoader, passphrase string) SessionLoader {
+	return &encryptedSessionLoader{SessionLoader: loader, passphrase: []byte(passphrase)}
+}
+
+func (l *encryptedSessionLoader) Load() (*Session, error) {
+	s, err := l.SessionLoader.Load()
+	if err != nil || s == nil {
+		return s, err
+	}
+	if !bytes.HasPrefix(s.Key, []byte(encryptedKeyMagic)) {
+		// plaintext session from before the passphrase was set, encrypted on next store
+		return s, nil
+	}
+	data := s.Key[len(encryptedKeyMagic):]
+	if len(data) < passphraseSaltLen {
+		return nil, ErrInvalidPassphrase
+	}
+	salt := data[:passphraseSaltLen]
+	gcm, err := l.cipher(salt)
+	if err != nil {
+		return nil, err
+	}
+	data = data[passphraseSaltLen:]
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrInvalidPassphrase
+	}
+	key, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrInvalidPassphrase
+	}
+	decrypted := *s
+	decrypted.Key = key
+	return &decrypted, nil
+}
+
+func (l *encryptedSessionLoader) Store(s *Session) error {
+	l.mu.Lock()
+	if l.salt == nil {
+		l.salt = make([]byte, passphraseSaltLen)
+		if _, err := rand.Read(l.salt); err != nil {
+			l.mu.Unlock()
+			return errors.Wrap(err, "generating salt")
+		}
+	}
+	salt := l.salt
+	l.mu.Unlock()
+
+	gcm, err := l.cipher(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.Wrap(err, "generating nonce")
+	}
+	key := make([]byte, 0, len(encryptedKeyMagic)+len(salt)+len(nonce)+len(s.Key)+gcm.Overhead())
+	key = append(key, encryptedKeyMagic...)
+	key = append(key, salt...)
+	key = append(key, nonce...)
+	key = gcm.Seal(key, nonce, s.Key, nil)
+
+	encrypted := *s
+	encrypted.Key = key
+	return l.SessionLoader.Store(&encrypted)
+}
+
+// cipher returns the AES-GCM cipher for salt, caching the derived key
+func (l *encryptedSessionLoader) cipher(salt []byte) (cipher.AEAD, error) {
+	l.mu.Lock()
+	if l.key == nil || !bytes.Equal(l.salt, salt) {
+		l.salt = append([]byte(nil), salt...)
+		l.key = pbkdf2SHA256(l.passphrase, l.salt, pbkdf2Iterations, 32)
+	}
+	key := l.key
+	l.mu.Unlock()
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating cipher")
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 derives a key of keyLen bytes from password and salt (RFC 8018)
+func pbkdf2SHA256(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = u[:0]
+			u = prf.Sum(u)
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
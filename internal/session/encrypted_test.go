@@ -0,0 +1,34 @@
+package session
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// RFC 7914, section 11
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"
+	if got := hex.EncodeToString(pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)); got != want {
+		t.Errorf("pbkdf2SHA256 = %s, want %s", got, want)
+	}
+}
+
+func TestEncryptedSession(t *testing.T) {
+	inner := NewInMemory()
+	key := bytes.Repeat([]byte{7}, 256)
+	if err := NewEncrypted(inner, "secret").Store(&Session{Key: key, Hostname: "149.154.167.91:443"}); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := inner.Load(); bytes.Equal(stored.Key, key) {
+		t.Fatal("auth key stored in plaintext")
+	}
+
+	s, err := NewEncrypted(inner, "secret").Load()
+	if err != nil || !bytes.Equal(s.Key, key) {
+		t.Fatalf("load with correct passphrase: %v", err)
+	}
+	if _, err := NewEncrypted(inner, "wrong").Load(); err != ErrInvalidPassphrase {
+		t.Errorf("expected ErrInvalidPassphrase, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2024 RoseLoverX
+
+package session
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// sqliteSessionLoader stores sessions in a table of a SQLite database, keyed by name,
+// so a single database file can hold many sessions.
+// The database driver is up to the caller (e.g mattn/go-sqlite3 or modernc.org/sqlite).
+type sqliteSessionLoader struct {
+	db   *sql.DB
+	name string
+}
+
+var _ SessionLoader = (*sqliteSessionLoader)(nil)
+
+const sqliteSessionSchema = `CREATE TABLE IF NOT EXISTS gogram_sessions (
+	name     TEXT PRIMARY KEY,
+	key      BLOB NOT NULL,
+	hash     BLOB NOT NULL,
+	salt     INTEGER NOT NULL,
+	hostname TEXT NOT NULL,
+	app_id   INTEGER NOT NULL
+)`
+
+// NewSQLiteSession returns a SessionLoader backed by db, storing the session under name.
+// The sessions table is created if it doesn't exist.
+func NewSQLiteSession(db *sql.DB, name string) (SessionLoader, error) {
+	if db == nil {
+		return nil, errors.New("sqlite session: db is nil")
+	}
+	if _, err := db.Exec(sqliteSessionSchema); err != nil {
+		return nil, errors.Wrap(err, "creating sessions table")
+	}
+	return &sqliteSessionLoader{db: db, name: name}, nil
+}
+
+func (l *sqliteSessionLoader) Path() string {
+	return "sqlite:" + l.name
+}
+
+func (l *sqliteSessionLoader) Load() (*Session, error) {
+	s := new(Session)
+	err := l.db.QueryRow(
+		`SELECT key, hash, salt, hostname, app_id FROM gogram_sessions WHERE name = ?`, l.name,
+	).Scan(&s.Key, &s.Hash, &s.Salt, &s.Hostname, &s.AppID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// no session stored yet, same as a missing session file
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "loading session")
+	}
+	return s, nil
+}
+
+func (l *sqliteSessionLoader) Store(s *Session) error {
+	_, err := l.db.Exec(
+		`INSERT OR REPLACE INTO gogram_sessions (name, key, hash, salt, hostname, app_id) VALUES (?, ?, ?, ?, ?, ?)`,
+		l.name, s.Key, s.Hash, s.Salt, s.Hostname, s.AppID,
+	)
+	return errors.Wrap(err, "storing session")
+}
+
+func (l *sqliteSessionLoader) Delete() error {
+	_, err := l.db.Exec(`DELETE FROM gogram_sessions WHERE name = ?`, l.name)
+	return errors.Wrap(err, "deleting session")
+}
@@ -0,0 +1,180 @@
+package session
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fileDriver is a database/sql driver keeping the sessions table in a JSON file. It stands
+// in for a SQLite driver, which the module doesn't depend on, and only understands the
+// statements of sqliteSessionLoader.
+type fileDriver struct{}
+
+type fileRow struct {
+	Key      []byte
+	Hash     []byte
+	Salt     int64
+	Hostname string
+	AppID    int64
+}
+
+func init() {
+	sql.Register("gogram-file", fileDriver{})
+}
+
+func (fileDriver) Open(path string) (driver.Conn, error) {
+	return &fileConn{path: path}, nil
+}
+
+type fileConn struct{ path string }
+
+func (c *fileConn) Prepare(query string) (driver.Stmt, error) {
+	return &fileStmt{conn: c, query: query}, nil
+}
+
+func (c *fileConn) Close() error { return nil }
+
+func (c *fileConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (c *fileConn) load() (map[string]fileRow, error) {
+	rows := make(map[string]fileRow)
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return rows, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rows, json.Unmarshal(data, &rows)
+}
+
+func (c *fileConn) save(rows map[string]fileRow) error {
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0600)
+}
+
+type fileStmt struct {
+	conn  *fileConn
+	query string
+}
+
+func (s *fileStmt) Close() error  { return nil }
+func (s *fileStmt) NumInput() int { return strings.Count(s.query, "?") }
+
+func (s *fileStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rows, err := s.conn.load()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+	case strings.HasPrefix(s.query, "INSERT OR REPLACE"):
+		rows[args[0].(string)] = fileRow{
+			Key:      args[1].([]byte),
+			Hash:     args[2].([]byte),
+			Salt:     args[3].(int64),
+			Hostname: args[4].(string),
+			AppID:    args[5].(int64),
+		}
+	case strings.HasPrefix(s.query, "DELETE"):
+		delete(rows, args[0].(string))
+	default:
+		return nil, errors.New("unexpected statement: " + s.query)
+	}
+	return driver.RowsAffected(1), s.conn.save(rows)
+}
+
+func (s *fileStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "SELECT") {
+		return nil, errors.New("unexpected query: " + s.query)
+	}
+	rows, err := s.conn.load()
+	if err != nil {
+		return nil, err
+	}
+	row, ok := rows[args[0].(string)]
+	return &fileRows{row: row, done: !ok}, nil
+}
+
+type fileRows struct {
+	row  fileRow
+	done bool
+}
+
+func (r *fileRows) Columns() []string {
+	return []string{"key", "hash", "salt", "hostname", "app_id"}
+}
+
+func (r *fileRows) Close() error { return nil }
+
+func (r *fileRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0], dest[1], dest[2], dest[3], dest[4] = r.row.Key, r.row.Hash, r.row.Salt, r.row.Hostname, r.row.AppID
+	return nil
+}
+
+func TestSQLiteSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	open := func(name string) SessionLoader {
+		db, err := sql.Open("gogram-file", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		loader, err := NewSQLiteSession(db, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return loader
+	}
+	if _, err := NewSQLiteSession(nil, "main"); err == nil {
+		t.Error("a nil db was accepted")
+	}
+
+	loader := open("main")
+	if s, err := loader.Load(); s != nil || err != nil {
+		t.Fatalf("expected no session before Store, got %+v, %v", s, err)
+	}
+	want := &Session{Key: []byte{1, 2, 3}, Hash: []byte{4, 5}, Salt: -42, Hostname: "149.154.167.91:443", AppID: 12345}
+	if err := loader.Store(want); err != nil {
+		t.Fatal(err)
+	}
+
+	// the session outlives the connection, under its own name only
+	if s, err := open("main").Load(); err != nil || !reflect.DeepEqual(s, want) {
+		t.Fatalf("loaded %+v, %v, want %+v", s, err, want)
+	}
+	if s, _ := open("other").Load(); s != nil {
+		t.Errorf("another name loaded %+v", s)
+	}
+
+	want.Salt = 7
+	if err := loader.Store(want); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := loader.Load(); s == nil || s.Salt != 7 {
+		t.Errorf("Store didn't replace the session, loaded %+v", s)
+	}
+	if err := loader.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := loader.Load(); s != nil || err != nil {
+		t.Errorf("expected no session after Delete, got %+v, %v", s, err)
+	}
+}
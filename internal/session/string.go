@@ -4,10 +4,18 @@ package session
 
 import (
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"strings"
 )
 
+const (
+	// legacyStringPrefix marks the old "::" separated session strings
+	legacyStringPrefix = "1BvX"
+	// StringSessionVersion is the version byte of the current session string format
+	StringSessionVersion byte = 2
+)
+
 var (
 	ErrInvalidSession = errors.New("the session string is invalid/has been tampered with")
 )
@@ -19,6 +27,7 @@ type (
 		dcID        int
 		ipAddr      string
 		appID       int32
+		salt        int64
 	}
 )
 
@@ -32,6 +41,12 @@ func NewStringSession(authKey, authKeyHash []byte, dcID int, ipAddr string, appI
 	}
 }
 
+// WithSalt sets the server salt carried by the session string
+func (s *StringSession) WithSalt(salt int64) *StringSession {
+	s.salt = salt
+	return s
+}
+
 func NewEmptyStringSession() *StringSession {
 	return &StringSession{}
 }
@@ -56,20 +71,72 @@ func (s StringSession) AppID() int32 {
 	return s.appID
 }
 
+func (s StringSession) Salt() int64 {
+	return s.salt
+}
+
+// Encode packs the session into a versioned base64 string:
+//
+//	version(1) | dc_id(1) | app_id(4) | salt(8) | len(2) auth_key | len(1) auth_key_hash | len(1) hostname
 func (s *StringSession) Encode() string {
-	stringPrefix := "1BvX"
-	sessionContents := []string{
-		string(s.authKey),
-		string(s.authKeyHash),
-		s.ipAddr,
-		string(rune(s.dcID)),
-		string(rune(s.appID)),
-	}
-	return stringPrefix + base64.RawURLEncoding.EncodeToString([]byte(strings.Join(sessionContents, "::")))
+	buf := make([]byte, 0, 16+len(s.authKey)+len(s.authKeyHash)+len(s.ipAddr)+4)
+	buf = append(buf, StringSessionVersion, byte(s.dcID))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(s.appID))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(s.salt))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(s.authKey)))
+	buf = append(buf, s.authKey...)
+	buf = append(buf, byte(len(s.authKeyHash)))
+	buf = append(buf, s.authKeyHash...)
+	buf = append(buf, byte(len(s.ipAddr)))
+	buf = append(buf, s.ipAddr...)
+	return base64.RawURLEncoding.EncodeToString(buf)
 }
 
 func (s *StringSession) Decode(encoded string) error {
-	decoded, err := base64.RawURLEncoding.DecodeString(encoded[len("1BvX"):])
+	if strings.HasPrefix(encoded, legacyStringPrefix) {
+		return s.decodeLegacy(encoded)
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidSession
+	}
+	if len(data) < 16 {
+		return ErrInvalidSession
+	}
+	if data[0] != StringSessionVersion {
+		return errors.New("unsupported session string version")
+	}
+	s.dcID = int(data[1])
+	s.appID = int32(binary.LittleEndian.Uint32(data[2:6]))
+	s.salt = int64(binary.LittleEndian.Uint64(data[6:14]))
+	data = data[14:]
+
+	keyLen := int(binary.LittleEndian.Uint16(data[:2]))
+	data = data[2:]
+	if len(data) < keyLen+1 {
+		return ErrInvalidSession
+	}
+	s.authKey, data = data[:keyLen], data[keyLen:]
+
+	hashLen := int(data[0])
+	data = data[1:]
+	if len(data) < hashLen+1 {
+		return ErrInvalidSession
+	}
+	s.authKeyHash, data = data[:hashLen], data[hashLen:]
+
+	addrLen := int(data[0])
+	data = data[1:]
+	if len(data) != addrLen {
+		return ErrInvalidSession
+	}
+	s.ipAddr = string(data)
+	return nil
+}
+
+// decodeLegacy decodes session strings exported by older versions
+func (s *StringSession) decodeLegacy(encoded string) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded[len(legacyStringPrefix):])
 	if err != nil {
 		return err
 	}
@@ -86,10 +153,15 @@ func (s *StringSession) Decode(encoded string) error {
 			s.authKeyHash = []byte(v)
 		case 2:
 			s.ipAddr = v
-		case 3:
-			s.dcID = int(v[0])
-		case 4:
-			s.appID = int32(v[0])
+		case 3, 4:
+			if v == "" {
+				return ErrInvalidSession
+			}
+			if i == 3 {
+				s.dcID = int([]rune(v)[0])
+			} else {
+				s.appID = int32([]rune(v)[0])
+			}
 		}
 	}
 	return nil
@@ -0,0 +1,20 @@
+package session
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStringSessionRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{0x3a, 0xff, 0x00}, 86)
+	want := NewStringSession(key, []byte("12345678"), 5, "91.108.56.130:443", 2040001).WithSalt(-42)
+
+	got := NewEmptyStringSession()
+	if err := got.Decode(want.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.AuthKey(), key) || !bytes.Equal(got.AuthKeyHash(), want.AuthKeyHash()) ||
+		got.DcID() != 5 || got.IpAddr() != want.IpAddr() || got.AppID() != 2040001 || got.Salt() != -42 {
+		t.Errorf("round trip mismatch: got %+v, want %+v", got, want)
+	}
+}
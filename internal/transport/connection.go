@@ -14,7 +14,7 @@ import (
 
 type tcpConn struct {
 	cancelReader *CancelableReader
-	conn         *net.TCPConn
+	conn         net.Conn
 	timeout      time.Duration
 }
 
@@ -23,6 +23,8 @@ type TCPConnConfig struct {
 	Host    string
 	Timeout time.Duration
 	Socks   *url.URL
+	MTProxy *MTProxy
+	DC      int
 }
 
 func NewTCP(cfg TCPConnConfig) (Conn, error) {
@@ -52,7 +54,7 @@ func newSocksTCP(cfg TCPConnConfig) (Conn, error) {
 	}
 	return &tcpConn{
 		cancelReader: NewCancelableReader(cfg.Ctx, conn),
-		conn:         conn.(*net.TCPConn),
+		conn:         conn,
 		timeout:      cfg.Timeout,
 	}, nil
 }
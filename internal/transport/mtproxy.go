@@ -0,0 +1,335 @@
+// Copyright (c) 2024 RoseLoverX
+
+package transport
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/roj1512/gogram/internal/mode"
+)
+
+// MTProxy is an MTProto proxy server to connect through.
+//
+// Supported secret formats, as hex or url-safe base64:
+//   - 16 bytes (32 hex chars): obfuscated2 with the intermediate mode
+//   - "dd" + 16 bytes: obfuscated2 with the padded intermediate mode
+//   - "ee" + 16 bytes + domain: obfuscated2 wrapped in fake TLS, disguised as a connection to domain
+type MTProxy struct {
+	Host   string
+	Secret string
+}
+
+var ErrInvalidProxySecret = errors.New("invalid mtproxy secret")
+
+// Validate checks the proxy has a host and a well-formed secret
+func (p *MTProxy) Validate() error {
+	if p.Host == "" {
+		return errors.New("mtproxy: host is empty")
+	}
+	_, err := parseProxySecret(p.Secret)
+	return err
+}
+
+type proxySecret struct {
+	key     []byte
+	variant mode.Variant
+	fakeTLS bool
+	domain  string
+}
+
+func parseProxySecret(secret string) (*proxySecret, error) {
+	secret = strings.TrimSpace(secret)
+	raw, err := hex.DecodeString(secret)
+	if err != nil {
+		raw, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(secret, "="))
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidProxySecret, "secret is neither hex nor base64")
+		}
+	}
+	switch {
+	case len(raw) == 16:
+		return &proxySecret{key: raw, variant: mode.Intermediate}, nil
+	case len(raw) == 17 && raw[0] == 0xdd:
+		return &proxySecret{key: raw[1:], variant: mode.PaddedIntermediate}, nil
+	case len(raw) > 17 && raw[0] == 0xee:
+		return &proxySecret{key: raw[1:17], variant: mode.PaddedIntermediate, fakeTLS: true, domain: string(raw[17:])}, nil
+	default:
+		return nil, errors.Wrapf(ErrInvalidProxySecret, "unsupported secret of %d bytes", len(raw))
+	}
+}
+
+// obfuscatedConn encrypts the stream with the obfuscated2 protocol
+// https://core.telegram.org/mtproto/mtproto-transports#transport-obfuscation
+type obfuscatedConn struct {
+	Conn
+	encryptor cipher.Stream
+	decryptor cipher.Stream
+}
+
+func newObfuscatedConn(conn Conn, secret []byte, variant mode.Variant, dc int) (*obfuscatedConn, error) {
+	tag, err := mode.Tag(variant)
+	if err != nil {
+		return nil, err
+	}
+	init := make([]byte, 64)
+	for {
+		if _, err := rand.Read(init); err != nil {
+			return nil, err
+		}
+		if isValidObfuscatedInit(init) {
+			break
+		}
+	}
+	copy(init[56:60], tag)
+	binary.LittleEndian.PutUint16(init[60:62], uint16(int16(dc)))
+
+	reversed := make([]byte, 48)
+	for i := range reversed {
+		reversed[i] = init[55-i]
+	}
+	encryptor, err := obfuscatedCipher(init[8:40], init[40:56], secret)
+	if err != nil {
+		return nil, err
+	}
+	decryptor, err := obfuscatedCipher(reversed[:32], reversed[32:48], secret)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := make([]byte, 64)
+	encryptor.XORKeyStream(encrypted, init)
+	copy(init[56:], encrypted[56:])
+	if _, err := conn.Write(init); err != nil {
+		return nil, errors.Wrap(err, "sending obfuscated init")
+	}
+	return &obfuscatedConn{Conn: conn, encryptor: encryptor, decryptor: decryptor}, nil
+}
+
+func isValidObfuscatedInit(init []byte) bool {
+	if init[0] == 0xef {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(init[0:4]) {
+	case 0x44414548, 0x54534f50, 0x20544547, 0x4954504f, 0xdddddddd, 0xeeeeeeee, 0x02010316: // HEAD, POST, GET, OPTI, tags, tls
+		return false
+	}
+	return binary.LittleEndian.Uint32(init[4:8]) != 0
+}
+
+func obfuscatedCipher(key, iv, secret []byte) (cipher.Stream, error) {
+	if len(secret) > 0 {
+		sum := sha256.Sum256(append(append([]byte{}, key...), secret...))
+		key = sum[:]
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCTR(block, iv), nil
+}
+
+func (c *obfuscatedConn) Write(b []byte) (int, error) {
+	buf := make([]byte, len(b))
+	c.encryptor.XORKeyStream(buf, b)
+	return c.Conn.Write(buf)
+}
+
+func (c *obfuscatedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.decryptor.XORKeyStream(b[:n], b[:n])
+	}
+	return n, err
+}
+
+const (
+	tlsRecordHandshake    = 0x16
+	tlsRecordChangeCipher = 0x14
+	tlsRecordApplication  = 0x17
+	tlsMaxRecordPayload   = 16384
+	tlsHelloLen           = 517
+	tlsRandomOffset       = 11
+)
+
+var tlsChangeCipherSpec = []byte{tlsRecordChangeCipher, 0x03, 0x03, 0x00, 0x01, 0x01}
+
+// fakeTLSConn disguises the stream as a TLS 1.3 connection, for ee secrets
+type fakeTLSConn struct {
+	Conn
+	readBuf     bytes.Buffer
+	wroteHeader bool
+}
+
+func newFakeTLSConn(conn Conn, secret []byte, domain string) (*fakeTLSConn, error) {
+	hello := buildClientHello(domain)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(hello)
+	digest := mac.Sum(nil)
+	ts := binary.LittleEndian.Uint32(digest[28:]) ^ uint32(time.Now().Unix())
+	binary.LittleEndian.PutUint32(digest[28:], ts)
+	copy(hello[tlsRandomOffset:], digest)
+
+	if _, err := conn.Write(hello); err != nil {
+		return nil, errors.Wrap(err, "sending tls client hello")
+	}
+
+	// server hello, change cipher spec and the first application data record
+	var response []byte
+	for _, want := range []byte{tlsRecordHandshake, tlsRecordChangeCipher, tlsRecordApplication} {
+		header, payload, err := readTLSRecord(conn)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading tls server hello")
+		}
+		if header[0] != want {
+			return nil, errors.Errorf("faketls: unexpected record type 0x%x", header[0])
+		}
+		response = append(append(response, header...), payload...)
+	}
+	if len(response) < tlsRandomOffset+32 {
+		return nil, errors.New("faketls: server hello too short")
+	}
+	serverDigest := append([]byte{}, response[tlsRandomOffset:tlsRandomOffset+32]...)
+	copy(response[tlsRandomOffset:], make([]byte, 32))
+	mac = hmac.New(sha256.New, secret)
+	mac.Write(digest)
+	mac.Write(response)
+	if !hmac.Equal(mac.Sum(nil), serverDigest) {
+		return nil, errors.New("faketls: server digest mismatch, wrong secret")
+	}
+	return &fakeTLSConn{Conn: conn}, nil
+}
+
+func readTLSRecord(r io.Reader) ([]byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[3:5]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+	return header, payload, nil
+}
+
+func (c *fakeTLSConn) Write(b []byte) (int, error) {
+	var buf []byte
+	if !c.wroteHeader {
+		buf = append(buf, tlsChangeCipherSpec...)
+		c.wroteHeader = true
+	}
+	for rest := b; len(rest) > 0; {
+		n := min(len(rest), tlsMaxRecordPayload)
+		buf = append(buf, tlsRecordApplication, 0x03, 0x03, byte(n>>8), byte(n))
+		buf = append(buf, rest[:n]...)
+		rest = rest[n:]
+	}
+	if _, err := c.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *fakeTLSConn) Read(b []byte) (int, error) {
+	for c.readBuf.Len() == 0 {
+		header, payload, err := readTLSRecord(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		switch header[0] {
+		case tlsRecordApplication:
+			c.readBuf.Write(payload)
+		case tlsRecordChangeCipher:
+		default:
+			return 0, errors.Errorf("faketls: unexpected record type 0x%x", header[0])
+		}
+	}
+	return c.readBuf.Read(b)
+}
+
+// buildClientHello returns a TLS 1.3 client hello for domain padded to 517 bytes,
+// with the random left zeroed for the caller to fill with the hmac digest
+func buildClientHello(domain string) []byte {
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rand.Read(b)
+		return b
+	}
+	u16 := func(n int) []byte { return []byte{byte(n >> 8), byte(n)} }
+	ext := func(typ int, data []byte) []byte {
+		return append(append(u16(typ), u16(len(data))...), data...)
+	}
+
+	var exts []byte
+	serverName := append(append([]byte{0x00}, u16(len(domain))...), domain...)
+	exts = append(exts, ext(0x0000, append(u16(len(serverName)), serverName...))...)
+	exts = append(exts, ext(0x0017, nil)...)
+	exts = append(exts, ext(0xff01, []byte{0x00})...)
+	exts = append(exts, ext(0x000a, []byte{0x00, 0x06, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x18})...)
+	exts = append(exts, ext(0x000b, []byte{0x01, 0x00})...)
+	exts = append(exts, ext(0x0023, nil)...)
+	exts = append(exts, ext(0x0010, []byte{0x00, 0x0c, 0x02, 'h', '2', 0x08, 'h', 't', 't', 'p', '/', '1', '.', '1'})...)
+	exts = append(exts, ext(0x0005, []byte{0x01, 0x00, 0x00, 0x00, 0x00})...)
+	exts = append(exts, ext(0x000d, []byte{0x00, 0x10, 0x04, 0x03, 0x08, 0x04, 0x04, 0x01, 0x05, 0x03, 0x08, 0x05, 0x05, 0x01, 0x08, 0x06, 0x06, 0x01})...)
+	exts = append(exts, ext(0x0012, nil)...)
+	exts = append(exts, ext(0x0033, append([]byte{0x00, 0x24, 0x00, 0x1d, 0x00, 0x20}, random(32)...))...)
+	exts = append(exts, ext(0x002d, []byte{0x01, 0x01})...)
+	exts = append(exts, ext(0x002b, []byte{0x04, 0x03, 0x04, 0x03, 0x03})...)
+
+	var body []byte
+	body = append(body, 0x03, 0x03)
+	body = append(body, make([]byte, 32)...) // random, filled with the digest
+	body = append(body, 0x20)
+	body = append(body, random(32)...) // session id
+	ciphers := []byte{0x13, 0x01, 0x13, 0x02, 0x13, 0x03, 0xc0, 0x2b, 0xc0, 0x2f, 0xc0, 0x2c, 0xc0, 0x30, 0xcc, 0xa9, 0xcc, 0xa8, 0xc0, 0x13, 0xc0, 0x14, 0x00, 0x9c, 0x00, 0x9d, 0x00, 0x2f, 0x00, 0x35}
+	body = append(body, u16(len(ciphers))...)
+	body = append(body, ciphers...)
+	body = append(body, 0x01, 0x00) // compression methods
+
+	// record header(5) + handshake header(4) + body + extensions length(2) + extensions
+	if pad := tlsHelloLen - (5 + 4 + len(body) + 2 + len(exts)) - 4; pad >= 0 {
+		exts = append(exts, ext(0x0015, make([]byte, pad))...)
+	}
+	body = append(body, u16(len(exts))...)
+	body = append(body, exts...)
+
+	handshake := append([]byte{0x01, 0x00, byte(len(body) >> 8), byte(len(body))}, body...)
+	return append([]byte{tlsRecordHandshake, 0x03, 0x01, byte(len(handshake) >> 8), byte(len(handshake))}, handshake...)
+}
+
+// newMTProxyConn dials the proxy and sets up the obfuscated (and fake tls) stream
+func newMTProxyConn(cfg TCPConnConfig) (Conn, mode.Variant, error) {
+	secret, err := parseProxySecret(cfg.MTProxy.Secret)
+	if err != nil {
+		return nil, 0, err
+	}
+	proxyCfg := cfg
+	proxyCfg.Host = cfg.MTProxy.Host
+	proxyCfg.MTProxy = nil
+	conn, err := NewTCP(proxyCfg)
+	if err != nil {
+		return nil, 0, &ProxyError{Proxy: cfg.MTProxy.Host, Err: err}
+	}
+	if secret.fakeTLS {
+		conn, err = newFakeTLSConn(conn, secret.key, secret.domain)
+		if err != nil {
+			return nil, 0, &ProxyError{Proxy: cfg.MTProxy.Host, Err: err}
+		}
+	}
+	obfuscated, err := newObfuscatedConn(conn, secret.key, secret.variant, cfg.DC)
+	if err != nil {
+		return nil, 0, &ProxyError{Proxy: cfg.MTProxy.Host, Err: err}
+	}
+	return obfuscated, secret.variant, nil
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2024 RoseLoverX
+
+package transport
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/roj1512/gogram/internal/mode"
+)
+
+func TestParseProxySecret(t *testing.T) {
+	key := "0123456789abcdef0123456789abcdef"
+	domain := hex.EncodeToString([]byte("example.com"))
+
+	tests := []struct {
+		secret  string
+		variant mode.Variant
+		fakeTLS bool
+		domain  string
+	}{
+		{key, mode.Intermediate, false, ""},
+		{"dd" + key, mode.PaddedIntermediate, false, ""},
+		{"ee" + key + domain, mode.PaddedIntermediate, true, "example.com"},
+		{"7gEjRWeJq83vASNFZ4mrze9leGFtcGxlLmNvbQ", mode.PaddedIntermediate, true, "example.com"},
+	}
+	for _, tt := range tests {
+		s, err := parseProxySecret(tt.secret)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.secret, err)
+		}
+		if s.variant != tt.variant || s.fakeTLS != tt.fakeTLS || s.domain != tt.domain || hex.EncodeToString(s.key) != key {
+			t.Errorf("%s: got %+v", tt.secret, s)
+		}
+	}
+
+	for _, secret := range []string{"", "zz", "0123", "dd" + key + "00", "ff" + key} {
+		if _, err := parseProxySecret(secret); !errors.Is(err, ErrInvalidProxySecret) {
+			t.Errorf("%q: expected ErrInvalidProxySecret, got %v", secret, err)
+		}
+	}
+}
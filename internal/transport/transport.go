@@ -33,9 +33,16 @@ func NewTransport(m messages.MessageInformator, conn ConnConfig, modeVariant mod
 	}
 
 	var err error
+	announce := true
 	switch cfg := conn.(type) {
 	case TCPConnConfig:
-		t.conn, err = NewTCP(cfg)
+		if cfg.MTProxy != nil {
+			// the proxy secret decides the mode, its tag is sent in the obfuscated init
+			t.conn, modeVariant, err = newMTProxyConn(cfg)
+			announce = false
+		} else {
+			t.conn, err = NewTCP(cfg)
+		}
 	default:
 		return nil, fmt.Errorf("unsupported connection type %v", reflect.TypeOf(conn).String())
 	}
@@ -43,7 +50,11 @@ func NewTransport(m messages.MessageInformator, conn ConnConfig, modeVariant mod
 		return nil, errors.Wrap(err, "setup connection")
 	}
 
-	t.mode, err = mode.New(modeVariant, t.conn)
+	if announce {
+		t.mode, err = mode.New(modeVariant, t.conn)
+	} else {
+		t.mode, err = mode.NewWithoutAnnouncement(modeVariant, t.conn)
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, "setup mode")
 	}
@@ -3,17 +3,22 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"runtime"
 	"strings"
+	"sync/atomic"
 )
 
 const (
-	// DebugLevel is the lowest level of logging
-	DebugLevel = iota
-	// InfoLevel is the second lowest level of logging
+	// TraceLevel is the lowest level of logging, it adds every request and response
+	TraceLevel = iota
+	// DebugLevel is the second lowest level of logging
+	DebugLevel
+	// InfoLevel is the third lowest level of logging
 	InfoLevel
 	// WarnLevel is the third highest level of logging
 	WarnLevel
@@ -23,14 +28,18 @@ const (
 	NoLevel
 )
 
-// Logger is the logging struct.
+// Logger is the logging struct, safe to reconfigure while in use.
 type Logger struct {
-	Level  int
+	level  atomic.Int32
 	Prefix string
+	// slogger receives the log lines instead of the standard logger when set
+	slogger atomic.Pointer[slog.Logger]
 }
 
 func (l *Logger) Lev() string {
-	switch l.Level {
+	switch l.level.Load() {
+	case TraceLevel:
+		return "trace"
 	case DebugLevel:
 		return "debug"
 	case InfoLevel:
@@ -49,71 +58,94 @@ func (l *Logger) Lev() string {
 // SetLevelString sets the level string
 func (l *Logger) SetLevel(level string) *Logger {
 	switch level {
+	case "trace":
+		l.level.Store(TraceLevel)
 	case "debug":
-		l.Level = DebugLevel
+		l.level.Store(DebugLevel)
 	case "info":
-		l.Level = InfoLevel
+		l.level.Store(InfoLevel)
 	case "warn":
-		l.Level = WarnLevel
+		l.level.Store(WarnLevel)
 	case "error":
-		l.Level = ErrorLevel
+		l.level.Store(ErrorLevel)
 	case "disabled":
-		l.Level = NoLevel
+		l.level.Store(NoLevel)
 	default:
-		l.Level = InfoLevel
+		l.level.Store(InfoLevel)
 	}
 	return l
 }
 
+// SetHandler sends the log lines to h, with the prefix as the "logger" attribute,
+// nil restores the standard logger. The level of the logger still applies.
+func (l *Logger) SetHandler(h slog.Handler) *Logger {
+	if h == nil {
+		l.slogger.Store(nil)
+	} else {
+		l.slogger.Store(slog.New(h).With("logger", l.Prefix))
+	}
+	return l
+}
+
+// Handler returns the handler set with SetHandler, nil if none
+func (l *Logger) Handler() slog.Handler {
+	if s := l.slogger.Load(); s != nil {
+		return s.Handler()
+	}
+	return nil
+}
+
 // Log logs a message at the given level.
 func (l *Logger) Error(v ...any) {
-	if l.Level <= ErrorLevel {
-		if l.WinTerminal() {
-			log.Println(l.Prefix, "- Error -", getVariable(v...))
-		} else {
-			log.Println(l.Prefix, "-", string("\033[35m")+"Error"+string("\033[0m"), "-", getVariable(v...))
-		}
-	}
+	l.log(ErrorLevel, "Error", "\033[35m", v...)
 }
 
 func (l *Logger) Warn(v ...any) {
-	if l.Level <= WarnLevel {
-		if l.WinTerminal() {
-			log.Println(l.Prefix, "- Warn -", getVariable(v...))
-		} else {
-			log.Println(l.Prefix, "-", string("\033[33m")+"Warn"+string("\033[0m"), "-", getVariable(v...))
-		}
-	}
+	l.log(WarnLevel, "Warn", "\033[33m", v...)
 }
 
 func (l *Logger) Info(v ...any) {
-	if l.Level <= InfoLevel {
-		if l.WinTerminal() {
-			log.Println(l.Prefix, "-", "Info", "-", getVariable(v...))
-		} else {
-			log.Println(l.Prefix, "-", string("\033[31m")+"Info"+string("\033[0m"), "-", getVariable(v...))
-		}
-	}
+	l.log(InfoLevel, "Info", "\033[31m", v...)
 }
 
 func (l *Logger) Debug(v ...any) {
-	if l.Level <= DebugLevel {
-		if l.WinTerminal() {
-			log.Println(l.Prefix, "-", "Debug", "-", getVariable(v...))
-		} else {
-			log.Println(l.Prefix, "-", string("\033[32m")+"Debug"+string("\033[0m"), "-", getVariable(v...))
-		}
-	}
+	l.log(DebugLevel, "Debug", "\033[32m", v...)
 }
 
+func (l *Logger) Trace(v ...any) {
+	l.log(TraceLevel, "Trace", "\033[36m", v...)
+}
+
+// Panic logs whatever the level
 func (l *Logger) Panic(v ...any) {
+	l.log(NoLevel, "Panic", "\033[31m", v...)
+}
+
+func (l *Logger) log(level int32, name, color string, v ...any) {
+	if l == nil || l.level.Load() > level {
+		return // a nil logger logs nothing
+	}
+	msg := getVariable(v...)
+	if s := l.slogger.Load(); s != nil {
+		s.Log(context.Background(), slogLevels[level], msg)
+		return
+	}
 	if l.WinTerminal() {
-		log.Println(l.Prefix, "-", "Panic", "-", getVariable(v...))
+		log.Println(l.Prefix, "-", name, "-", msg)
 	} else {
-		log.Println(l.Prefix, "-", string("\033[31m")+"Panic"+string("\033[0m"), "-", getVariable(v...))
+		log.Println(l.Prefix, "-", color+name+"\033[0m", "-", msg)
 	}
 }
 
+var slogLevels = map[int32]slog.Level{
+	TraceLevel: slog.LevelDebug - 4,
+	DebugLevel: slog.LevelDebug,
+	InfoLevel:  slog.LevelInfo,
+	WarnLevel:  slog.LevelWarn,
+	ErrorLevel: slog.LevelError,
+	NoLevel:    slog.LevelError + 4,
+}
+
 func (l *Logger) WinTerminal() bool {
 	if runtime.GOOS == "windows" && os.Getenv("TERM_PROGRAM") != "vscode" {
 		return true
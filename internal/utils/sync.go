@@ -83,15 +83,21 @@ func (s *SyncIntObjectChan) Add(key int, value chan tl.Object) {
 }
 
 func (s *SyncIntObjectChan) Keys() []int {
-	keys := make([]int, 0, len(s.m))
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
+	keys := make([]int, 0, len(s.m))
 	for k := range s.m {
 		keys = append(keys, k)
 	}
 	return keys
 }
 
+func (s *SyncIntObjectChan) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.m)
+}
+
 func (s *SyncIntObjectChan) Delete(key int) bool {
 	s.mutex.Lock()
 	_, ok := s.m[key]
@@ -19,6 +19,26 @@ var (
 		4: "149.154.167.91:443",
 		5: "91.108.56.151:443",
 	}
+	// TestDcList are the addresses of the DCs of the test servers
+	TestDcList = map[int]string{
+		1: "149.154.175.10:443",
+		2: "149.154.167.40:443",
+		3: "149.154.175.117:443",
+	}
+	// DcListV6 are the IPv6 addresses of the DCs
+	DcListV6 = map[int]string{
+		1: "[2001:b28:f23d:f001::a]:443",
+		2: "[2001:67c:4e8:f002::a]:443",
+		3: "[2001:b28:f23d:f003::a]:443",
+		4: "[2001:67c:4e8:f004::a]:443",
+		5: "[2001:b28:f23f:f005::a]:443",
+	}
+	// TestDcListV6 are the IPv6 addresses of the DCs of the test servers
+	TestDcListV6 = map[int]string{
+		1: "[2001:b28:f23d:f001::e]:443",
+		2: "[2001:67c:4e8:f002::e]:443",
+		3: "[2001:b28:f23d:f003::e]:443",
+	}
 )
 
 type PingParams struct {
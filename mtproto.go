@@ -7,6 +7,7 @@ import (
 	"crypto/rsa"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -15,6 +16,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -29,16 +31,41 @@ import (
 
 const defaultTimeout = 65 * time.Second
 
+// defaultRequestTimeout is how long a request waits for its response unless Config.RequestTimeout is set
+const defaultRequestTimeout = 60 * time.Second
+
+const (
+	defaultReconnectBaseDelay = time.Second
+	defaultReconnectMaxDelay  = time.Minute
+)
+
+// ErrConnectionLost is returned by requests still waiting for a response when the
+// connection dropped, the request may or may not have reached telegram and can be retried
+var ErrConnectionLost = errors.New("connection lost before the response was received")
+
+// ErrDisconnected is returned by requests still waiting for a response when the client disconnected
+var ErrDisconnected = errors.New("disconnected before the response was received")
+
+// ErrRequestTimeout is returned by requests telegram did not answer within Config.RequestTimeout
+var ErrRequestTimeout = errors.New("request timed out waiting for a response")
+
 type MTProto struct {
 	Addr          string
 	appID         int32
 	socksProxy    *url.URL
+	mtProxy       *transport.MTProxy
+	testMode      bool
+	dcList        map[int]string
+	preferIPv6    bool
 	socksActive   bool
-	transport     transport.Transport
 	stopRoutines  context.CancelFunc
 	routineswg    sync.WaitGroup
 	memorySession bool
-	tcpActive     bool
+	tcpActive     atomic.Bool
+
+	// transport is replaced on reconnects and migrations while requests are sent
+	transportMutex sync.RWMutex
+	transport      transport.Transport
 
 	authKey []byte
 
@@ -67,6 +94,66 @@ type MTProto struct {
 	Logger *utils.Logger
 
 	serverRequestHandlers []func(i any) bool
+	migrateHandler        func(dc int) error
+	migrateMutex          sync.Mutex
+	floodWait             floodWaitConfig
+	state                 atomic.Int32
+	stateHandler          func(state ConnectionState)
+	reconnectHandler      func() error
+	reconnect             reconnectConfig
+	requestTimeout        time.Duration
+	metrics               Metrics
+	limiters              *rateLimiters
+	// lifetime is canceled by Terminate, stopping reconnection attempts
+	lifetime  context.Context
+	terminate context.CancelFunc
+	// newTransport dials the transport, newAuthKey creates the auth key of a new
+	// connection (makeAuthKey when nil), replaced in tests
+	newTransport func(ctx context.Context) (transport.Transport, error)
+	newAuthKey   func() error
+}
+
+// ConnectionState is the state of the connection to the telegram server
+type ConnectionState int32
+
+const (
+	Disconnected ConnectionState = iota
+	Connecting
+	Connected
+	Reconnecting
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case Disconnected:
+		return "Disconnected"
+	case Connecting:
+		return "Connecting"
+	case Connected:
+		return "Connected"
+	case Reconnecting:
+		return "Reconnecting"
+	}
+	return "ConnectionState(" + strconv.Itoa(int(s)) + ")"
+}
+
+type reconnectConfig struct {
+	base time.Duration
+	max  time.Duration
+}
+
+// Metrics observes the requests made, to export them to a monitoring system
+type Metrics interface {
+	// ObserveRequest is called once a request returned, method being the name of its
+	// type without the Params suffix (e.g. MessagesSendMessage). Flood waits that
+	// were waited out are reported to Config.OnFloodWait instead.
+	ObserveRequest(method string, dur time.Duration, err error)
+}
+
+type floodWaitConfig struct {
+	retry   bool
+	max     time.Duration
+	onFlood func(request string, wait time.Duration)
 }
 
 func (mtproto *MTProto) Pin(pinner *runtime.Pinner) {
@@ -82,16 +169,57 @@ type Config struct {
 	StringSession  string
 	SessionStorage session.SessionLoader
 	MemorySession  bool
-	AppID          int32
+	// SessionPassphrase encrypts the auth key at rest when set
+	SessionPassphrase string
+	AppID             int32
 
 	ServerHost string
 	PublicKey  *rsa.PublicKey
 	DataCenter int
 	LogLevel   string
+	// LogHandler receives the log lines instead of the standard logger when set
+	LogHandler slog.Handler
 	SocksProxy *url.URL
+	// MTProxy connects through an MTProto proxy, the secret selects the obfuscation
+	MTProxy *transport.MTProxy
+	// TestMode connects to the test servers, their DCs are used unless DCList is set
+	TestMode bool
+	// DCList overrides the addresses of some DCs, by DC ID, the others keep the address
+	// of the production or test servers
+	DCList map[int]string
+	// PreferIPv6 dials the IPv6 address of the DC first, falling back to IPv4 if it fails
+	PreferIPv6 bool
+
+	// DisableFloodWaitRetry returns FLOOD_WAIT_X errors to the caller, by default the
+	// request sleeps for the wait and is retried
+	DisableFloodWaitRetry bool
+	// MaxFloodWait is the longest wait retried, longer waits are returned as errors (zero means no limit)
+	MaxFloodWait time.Duration
+	// OnFloodWait is called with the request name and wait duration before sleeping
+	OnFloodWait func(request string, wait time.Duration)
+
+	// ReconnectBaseDelay is the first wait between reconnection attempts, doubled after every failure (default 1s)
+	ReconnectBaseDelay time.Duration
+	// ReconnectMaxDelay caps the wait between reconnection attempts (default 1m)
+	ReconnectMaxDelay time.Duration
+	// RequestTimeout is how long a request waits for its response, 60s when nil, zero
+	// (or negative) for no timeout
+	RequestTimeout *time.Duration
+	// Metrics observes every request made, none by default
+	Metrics Metrics
+	// RateLimit limits the requests sent, they wait for their turn before being sent (no limit by default)
+	RateLimit *RateLimit
+	// MethodRateLimits limits single methods, by name without the Params suffix (e.g. MessagesSendMessage),
+	// on top of RateLimit
+	MethodRateLimits map[string]RateLimit
 }
 
 func NewMTProto(c Config) (*MTProto, error) {
+	if c.MTProxy != nil {
+		if err := c.MTProxy.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	if c.SessionStorage == nil {
 		if c.MemorySession {
 			c.SessionStorage = session.NewInMemory()
@@ -99,8 +227,14 @@ func NewMTProto(c Config) (*MTProto, error) {
 			c.SessionStorage = session.NewFromFile(c.AuthKeyFile)
 		}
 	}
+	if c.SessionPassphrase != "" {
+		c.SessionStorage = session.NewEncrypted(c.SessionStorage, c.SessionPassphrase)
+	}
 
 	loaded, err := c.SessionStorage.Load()
+	if errors.Is(err, session.ErrInvalidPassphrase) {
+		return nil, err
+	}
 	if err != nil {
 		if !(strings.Contains(err.Error(), session.ErrFileNotExists) || strings.Contains(err.Error(), session.ErrPathNotFound)) {
 			// if the error is not because of file not found or path not found, return the error
@@ -113,6 +247,18 @@ func NewMTProto(c Config) (*MTProto, error) {
 		}
 	}
 
+	if c.ReconnectBaseDelay <= 0 {
+		c.ReconnectBaseDelay = defaultReconnectBaseDelay
+	}
+	if c.ReconnectMaxDelay <= 0 {
+		c.ReconnectMaxDelay = defaultReconnectMaxDelay
+	}
+	requestTimeout := defaultRequestTimeout
+	if c.RequestTimeout != nil {
+		requestTimeout = *c.RequestTimeout
+	}
+	lifetime, terminate := context.WithCancel(context.Background())
+
 	mtproto := &MTProto{
 		sessionStorage:        c.SessionStorage,
 		Addr:                  c.ServerHost,
@@ -123,10 +269,21 @@ func NewMTProto(c Config) (*MTProto, error) {
 		responseChannels:      utils.NewSyncIntObjectChan(),
 		expectedTypes:         utils.NewSyncIntReflectTypes(),
 		serverRequestHandlers: make([]func(i any) bool, 0),
-		Logger:                utils.NewLogger("gogram - mtproto").SetLevel(c.LogLevel),
+		Logger:                utils.NewLogger("gogram - mtproto").SetLevel(c.LogLevel).SetHandler(c.LogHandler),
 		memorySession:         c.MemorySession,
 		appID:                 c.AppID,
 		socksProxy:            c.SocksProxy,
+		mtProxy:               c.MTProxy,
+		testMode:              c.TestMode,
+		dcList:                dcList(c.TestMode, c.DCList),
+		preferIPv6:            c.PreferIPv6,
+		floodWait:             floodWaitConfig{retry: !c.DisableFloodWaitRetry, max: c.MaxFloodWait, onFlood: c.OnFloodWait},
+		reconnect:             reconnectConfig{base: c.ReconnectBaseDelay, max: max(c.ReconnectBaseDelay, c.ReconnectMaxDelay)},
+		requestTimeout:        requestTimeout,
+		metrics:               c.Metrics,
+		limiters:              newRateLimiters(c.RateLimit, c.MethodRateLimits),
+		lifetime:              lifetime,
+		terminate:             terminate,
 	}
 	if loaded != nil || c.StringSession != "" {
 		mtproto.encrypted = true
@@ -175,6 +332,9 @@ func (m *MTProto) ImportAuth(stringSession string) (bool, error) {
 		return false, err
 	}
 	m.authKey, m.authKeyHash, m.Addr, m.appID = sessionString.AuthKey(), sessionString.AuthKeyHash(), sessionString.IpAddr(), sessionString.AppID()
+	if sessionString.Salt() != 0 {
+		m.serverSalt = sessionString.Salt()
+	}
 	m.Logger.Debug("importing Auth from stringSession...")
 	if !m.memorySession {
 		if err := m.SaveSession(); err != nil {
@@ -184,8 +344,55 @@ func (m *MTProto) ImportAuth(stringSession string) (bool, error) {
 	return true, nil
 }
 
+// dcList returns the addresses of the DCs of the production or test servers, with
+// those of override replacing or adding to them
+func dcList(testMode bool, override map[int]string) map[int]string {
+	base := utils.DcList
+	if testMode {
+		base = utils.TestDcList
+	}
+	if len(override) == 0 {
+		return base
+	}
+	dcs := make(map[int]string, len(base)+len(override))
+	for dc, addr := range base {
+		dcs[dc] = addr
+	}
+	for dc, addr := range override {
+		dcs[dc] = addr
+	}
+	return dcs
+}
+
+// dialAddrs returns the addresses the connection to the DC is tried on in order, its
+// IPv6 address first when IPv6 is preferred and the address of the DC is a bundled one
+func (m *MTProto) dialAddrs() []string {
+	if m.preferIPv6 {
+		v4, v6 := utils.DcList, utils.DcListV6
+		if m.testMode {
+			v4, v6 = utils.TestDcList, utils.TestDcListV6
+		}
+		dc := m.GetDC()
+		if addr, ok := v6[dc]; ok && v4[dc] == m.Addr {
+			return []string{addr, m.Addr}
+		}
+	}
+	return []string{m.Addr}
+}
+
+// DCAddress returns the address of a DC, of the test servers in test mode
+func (m *MTProto) DCAddress(dc int) (string, bool) {
+	addr, ok := m.dcList[dc]
+	return addr, ok
+}
+
+// TestMode reports whether the connection is to the test servers
+func (m *MTProto) TestMode() bool {
+	return m.testMode
+}
+
 func (m *MTProto) GetDC() int {
-	for dc, addr := range utils.DcList {
+	for dc, addr := range m.dcList {
 		if addr == m.Addr {
 			return dc
 		}
@@ -198,27 +405,41 @@ func (m *MTProto) AppID() int32 {
 }
 
 func (m *MTProto) ReconnectToNewDC(dc int) (*MTProto, error) {
-	newAddr, isValid := utils.DcList[dc]
+	newAddr, isValid := m.DCAddress(dc)
 	if !isValid {
 		return nil, errors.New("invalid DC ID provided")
 	}
 	m.sessionStorage.Delete()
 	m.Logger.Debug("deleted old auth key file")
 	cfg := Config{
-		DataCenter:    dc,
-		PublicKey:     m.PublicKey,
-		ServerHost:    newAddr,
-		AuthKeyFile:   m.sessionStorage.Path(),
-		MemorySession: m.memorySession,
-		LogLevel:      m.Logger.Lev(),
-		SocksProxy:    m.socksProxy,
-		AppID:         m.appID,
+		DataCenter:     dc,
+		PublicKey:      m.PublicKey,
+		ServerHost:     newAddr,
+		AuthKeyFile:    m.sessionStorage.Path(),
+		SessionStorage: m.sessionStorage,
+		MemorySession:  m.memorySession,
+		LogLevel:       m.Logger.Lev(),
+		LogHandler:     m.Logger.Handler(),
+		SocksProxy:     m.socksProxy,
+		MTProxy:        m.mtProxy,
+		TestMode:       m.testMode,
+		DCList:         m.dcList,
+		PreferIPv6:     m.preferIPv6,
+		AppID:          m.appID,
 	}
 	sender, err := NewMTProto(cfg)
 	if err != nil {
 		return nil, errors.Wrap(err, "creating new MTProto")
 	}
 	sender.serverRequestHandlers = m.serverRequestHandlers
+	sender.migrateHandler = m.migrateHandler
+	sender.floodWait = m.floodWait
+	sender.stateHandler = m.stateHandler
+	sender.reconnectHandler = m.reconnectHandler
+	sender.reconnect = m.reconnect
+	sender.requestTimeout = m.requestTimeout
+	sender.metrics = m.metrics
+	sender.limiters = m.limiters
 	m.stopRoutines()
 	m.Logger.Info(fmt.Sprintf("user migrated to -> [DC %d]", dc))
 	m.Logger.Debug("reconnecting to new DC with new auth key")
@@ -230,17 +451,21 @@ func (m *MTProto) ReconnectToNewDC(dc int) (*MTProto, error) {
 }
 
 func (m *MTProto) ExportNewSender(dcID int, mem bool) (*MTProto, error) {
-	newAddr := utils.DcList[dcID]
+	newAddr, _ := m.DCAddress(dcID)
 	execWorkDir, err := os.Executable()
 	if err != nil {
 		return nil, errors.Wrap(err, "getting executable directory")
 	}
 	wd := filepath.Dir(execWorkDir)
-	cfg := Config{DataCenter: dcID, PublicKey: m.PublicKey, ServerHost: newAddr, AuthKeyFile: filepath.Join(wd, "exported_sender"), MemorySession: mem, LogLevel: m.Logger.Lev(), SocksProxy: m.socksProxy, AppID: m.appID}
+	cfg := Config{DataCenter: dcID, PublicKey: m.PublicKey, ServerHost: newAddr, AuthKeyFile: filepath.Join(wd, "exported_sender"), MemorySession: mem, LogLevel: m.Logger.Lev(), LogHandler: m.Logger.Handler(), SocksProxy: m.socksProxy, MTProxy: m.mtProxy, TestMode: m.testMode, DCList: m.dcList, PreferIPv6: m.preferIPv6, AppID: m.appID}
 	if dcID == m.GetDC() {
 		cfg.SessionStorage = m.sessionStorage
 	}
 	sender, _ := NewMTProto(cfg)
+	sender.floodWait = m.floodWait
+	sender.requestTimeout = m.requestTimeout
+	sender.metrics = m.metrics
+	sender.limiters = m.limiters
 	m.Logger.Info("exporting new sender for [DC " + strconv.Itoa(dcID) + "]")
 	err = sender.CreateConnection(true)
 	if err != nil {
@@ -253,16 +478,23 @@ func (m *MTProto) ExportNewSender(dcID int, mem bool) (*MTProto, error) {
 func (m *MTProto) CreateConnection(withLog bool) error {
 	ctx, cancelfunc := context.WithCancel(context.Background())
 	m.stopRoutines = cancelfunc
+	if m.ConnectionState() != Reconnecting {
+		m.setState(Connecting)
+	}
 	if withLog {
 		m.Logger.Info("Connecting to [" + m.Addr + "] - <TCPFull> ...")
 	}
 	err := m.connect(ctx)
 	if err != nil {
+		m.setState(Disconnected)
 		return err
 	}
-	m.tcpActive = true
+	m.tcpActive.Store(true)
+	m.setState(Connected)
 	if withLog {
-		if m.socksProxy != nil && m.socksProxy.Host != "" {
+		if m.mtProxy != nil {
+			m.Logger.Info("Connection to (" + m.mtProxy.Host + ")[" + m.Addr + "] - <MTProxy> established")
+		} else if m.socksProxy != nil && m.socksProxy.Host != "" {
 			m.Logger.Info("Connection to (" + m.socksProxy.Host + ")[" + m.Addr + "] - <TCPFull> established")
 		} else {
 			m.Logger.Info("Connection to [" + m.Addr + "] - <TCPFull> established")
@@ -271,8 +503,11 @@ func (m *MTProto) CreateConnection(withLog bool) error {
 	m.startReadingResponses(ctx)
 	if !m.encrypted {
 		m.Logger.Debug("authKey not found, creating new one")
-		err = m.makeAuthKey()
-		if err != nil {
+		newAuthKey := m.makeAuthKey
+		if m.newAuthKey != nil {
+			newAuthKey = m.newAuthKey
+		}
+		if err := newAuthKey(); err != nil {
 			return err
 		}
 		m.Logger.Debug("authKey created and saved")
@@ -282,30 +517,99 @@ func (m *MTProto) CreateConnection(withLog bool) error {
 }
 
 func (m *MTProto) connect(ctx context.Context) error {
-	var err error
-	m.transport, err = transport.NewTransport(
-		m,
-		transport.TCPConnConfig{
-			Ctx:     ctx,
-			Host:    m.Addr,
-			Timeout: defaultTimeout,
-			Socks:   m.socksProxy,
-		},
-		mode.Intermediate,
+	if m.newTransport != nil {
+		t, err := m.newTransport(ctx)
+		if err != nil {
+			return fmt.Errorf("creating transport: %w", err)
+		}
+		m.setTransport(t)
+		closeOnCancel(ctx, t)
+		return nil
+	}
+	dc := m.GetDC()
+	if m.testMode {
+		dc += 10000 // how proxies tell the test DCs from the production ones
+	}
+	var (
+		t   transport.Transport
+		err error
 	)
+	addrs := m.dialAddrs()
+	for i, addr := range addrs {
+		t, err = transport.NewTransport(
+			m,
+			transport.TCPConnConfig{
+				Ctx:     ctx,
+				Host:    addr,
+				Timeout: defaultTimeout,
+				Socks:   m.socksProxy,
+				MTProxy: m.mtProxy,
+				DC:      dc,
+			},
+			mode.Intermediate,
+		)
+		if err == nil {
+			break
+		}
+		if i < len(addrs)-1 {
+			m.Logger.Debug("dialing [" + addr + "] failed, trying [" + addrs[i+1] + "]: " + err.Error())
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("creating transport: %w", err)
 	}
-
-	closeOnCancel(ctx, m.transport)
+	m.setTransport(t)
+	closeOnCancel(ctx, t)
 	return nil
 }
 
-func (m *MTProto) makeRequest(data tl.Object, expectedTypes ...reflect.Type) (any, error) {
+func (m *MTProto) getTransport() transport.Transport {
+	m.transportMutex.RLock()
+	defer m.transportMutex.RUnlock()
+	return m.transport
+}
+
+func (m *MTProto) setTransport(t transport.Transport) {
+	m.transportMutex.Lock()
+	defer m.transportMutex.Unlock()
+	m.transport = t
+}
+
+func (m *MTProto) makeRequest(ctx context.Context, data tl.Object, expectedTypes ...reflect.Type) (any, error) {
+	if m.limiters != nil {
+		if err := m.limiters.wait(ctx, requestName(data)); err != nil {
+			return nil, err
+		}
+	}
+	if m.metrics == nil {
+		return m.invokeRequest(ctx, data, 0, expectedTypes...)
+	}
+	start := time.Now()
+	resp, err := m.invokeRequest(ctx, data, 0, expectedTypes...)
+	m.metrics.ObserveRequest(requestName(data), time.Since(start), err)
+	return resp, err
+}
+
+// requestName is the name of the type of a request without the Params suffix, e.g. MessagesSendMessage
+func requestName(data tl.Object) string {
+	t := reflect.TypeOf(data)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return strings.TrimSuffix(t.Name(), "Params")
+}
+
+// invokeRequest sends the request and waits for its response, or for ctx to be done,
+// migrations is the number of DC migrations this request already went through
+func (m *MTProto) invokeRequest(ctx context.Context, data tl.Object, migrations int, expectedTypes ...reflect.Type) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if !m.TcpActive() {
 		return nil, errors.New("Can't make request. Connection is not established")
 	}
-	resp, err := m.sendPacket(data, expectedTypes...)
+	m.Logger.Trace("RPC request: " + fmt.Sprintf("%T", data))
+	resp, msgID, err := m.sendPacket(data, expectedTypes...)
 	if err != nil {
 		if strings.Contains(err.Error(), "use of closed network connection") || strings.Contains(err.Error(), "transport is closed") {
 			m.Logger.Info("connection closed due to broken pipe, reconnecting to [" + m.Addr + "]" + " - <TCPFull> ...")
@@ -314,31 +618,170 @@ func (m *MTProto) makeRequest(data tl.Object, expectedTypes ...reflect.Type) (an
 				m.Logger.Error("reconnecting: " + err.Error())
 				return nil, errors.New("reconnecting: " + err.Error())
 			}
-			return m.makeRequest(data, expectedTypes...)
+			return m.invokeRequest(ctx, data, migrations, expectedTypes...)
 		}
 		return nil, errors.Wrap(err, "sending packet")
 	}
-	response := <-resp
+	var timeout <-chan time.Time
+	if m.requestTimeout > 0 {
+		timer := time.NewTimer(m.requestTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var response tl.Object
+	select {
+	case response = <-resp:
+	case <-ctx.Done():
+		m.forgetRequest(int(msgID))
+		return nil, ctx.Err()
+	case <-timeout:
+		// the response channel is buffered, a response arriving now is dropped without blocking the reader
+		m.forgetRequest(int(msgID))
+		return nil, ErrRequestTimeout
+	}
+	return m.handleResponse(ctx, data, migrations, response, expectedTypes...)
+}
+
+// handleResponse returns the result of a request from its response, retrying
+// the request when the response asks so (flood wait, migration, new salt)
+func (m *MTProto) handleResponse(ctx context.Context, data tl.Object, migrations int, response tl.Object, expectedTypes ...reflect.Type) (any, error) {
 	switch r := response.(type) {
 	case *objects.RpcError:
-		realErr := RpcErrorToNative(r).(*ErrResponseCode)
-		if strings.Contains(realErr.Message, "FLOOD_WAIT_") {
-			m.Logger.Info("Flood wait detected on '" + strings.ReplaceAll(reflect.TypeOf(data).Elem().Name(), "Params", "") + fmt.Sprintf("' request. sleeping for %s", (time.Duration(realErr.AdditionalInfo.(int))*time.Second).String()))
-			time.Sleep(time.Duration(realErr.AdditionalInfo.(int)) * time.Second)
-			return m.makeRequest(data, expectedTypes...)
+		realErr := RpcErrorToNative(r).(*RPCError)
+		if wait, ok := m.shouldRetryFlood(realErr); ok {
+			request := requestName(data)
+			m.Logger.Info("Flood wait detected on '" + request + fmt.Sprintf("' request. sleeping for %s", wait.String()))
+			if m.floodWait.onFlood != nil {
+				m.floodWait.onFlood(request, wait)
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			return m.invokeRequest(ctx, data, migrations, expectedTypes...)
+		}
+		if dc, ok := migrateDC(realErr); ok {
+			if migrations >= maxMigrations {
+				return nil, errors.Wrap(realErr, "too many DC migrations")
+			}
+			if err := m.migrateToDC(dc); err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("migrating to DC %d", dc))
+			}
+			return m.invokeRequest(ctx, data, migrations+1, expectedTypes...)
 		}
 		return nil, realErr
 
 	case *errorSessionConfigsChanged:
 		m.Logger.Debug("session configs changed, resending request")
-		return m.makeRequest(data, expectedTypes...)
+		return m.invokeRequest(ctx, data, migrations, expectedTypes...)
+
+	case *errorRequestAborted:
+		return nil, r.err
 	}
 
 	return tl.UnwrapNativeTypes(response), nil
 }
 
+// shouldRetryFlood reports whether a FLOOD_WAIT_X error should be waited out and retried
+func (m *MTProto) shouldRetryFlood(err *RPCError) (time.Duration, bool) {
+	if !m.floodWait.retry || !strings.Contains(err.Message, "FLOOD_WAIT_") {
+		return 0, false
+	}
+	seconds, ok := err.AdditionalInfo.(int)
+	if !ok {
+		return 0, false
+	}
+	wait := time.Duration(seconds) * time.Second
+	if m.floodWait.max > 0 && wait > m.floodWait.max {
+		return 0, false
+	}
+	return wait, true
+}
+
+// maxMigrations is the max number of DC migrations a single request can trigger
+const maxMigrations = 2
+
+// migrateDC returns the DC a *_MIGRATE_X error points to
+func migrateDC(err *RPCError) (int, bool) {
+	switch err.Message {
+	case "PHONE_MIGRATE_X", "USER_MIGRATE_X", "NETWORK_MIGRATE_X":
+		dc, ok := err.AdditionalInfo.(int)
+		return dc, ok
+	}
+	return 0, false
+}
+
+// SetMigrateHandler sets the function called after the connection migrated to another DC,
+// before the request that triggered the migration is replayed
+func (m *MTProto) SetMigrateHandler(handler func(dc int) error) {
+	m.migrateHandler = handler
+}
+
+// SetConnectionStateHandler sets the function called, from the connection goroutines,
+// whenever the connection state changes
+func (m *MTProto) SetConnectionStateHandler(handler func(state ConnectionState)) {
+	m.stateHandler = handler
+}
+
+// SetReconnectHandler sets the function called once the connection is re-established
+// after it dropped, to catch up on what was missed while disconnected
+func (m *MTProto) SetReconnectHandler(handler func() error) {
+	m.reconnectHandler = handler
+}
+
+// ConnectionState returns the current state of the connection
+func (m *MTProto) ConnectionState() ConnectionState {
+	return ConnectionState(m.state.Load())
+}
+
+func (m *MTProto) setState(state ConnectionState) {
+	if ConnectionState(m.state.Swap(int32(state))) == state {
+		return
+	}
+	m.Logger.Debug("connection state: " + state.String())
+	if m.stateHandler != nil {
+		m.stateHandler(state)
+	}
+}
+
+// migrateToDC moves the connection to the given DC in place, creating a new auth key there
+func (m *MTProto) migrateToDC(dc int) error {
+	m.migrateMutex.Lock()
+	defer m.migrateMutex.Unlock()
+	if m.GetDC() == dc && m.encrypted {
+		// another request already migrated us
+		return nil
+	}
+	newAddr, ok := m.DCAddress(dc)
+	if !ok {
+		return errors.New("invalid DC ID provided")
+	}
+	m.Logger.Info(fmt.Sprintf("migrating to -> [DC %d]", dc))
+	if err := m.Disconnect(); err != nil {
+		return errors.Wrap(err, "disconnecting")
+	}
+	m.AbortPending(errors.New("connection migrated to another DC"))
+	m.sessionStorage.Delete()
+
+	m.Addr = newAddr
+	m.authKey, m.authKeyHash, m.serverSalt, m.encrypted = nil, nil, 0, false
+	m.sessionId = utils.GenerateSessionID()
+	m.seqNoMutex.Lock()
+	m.seqNo = 0
+	m.seqNoMutex.Unlock()
+
+	if err := m.CreateConnection(true); err != nil {
+		return errors.Wrap(err, "creating connection")
+	}
+	if m.migrateHandler != nil {
+		return m.migrateHandler(dc)
+	}
+	return nil
+}
+
 func (m *MTProto) InvokeRequestWithoutUpdate(data tl.Object, expectedTypes ...reflect.Type) error {
-	_, err := m.sendPacket(data, expectedTypes...)
+	_, _, err := m.sendPacket(data, expectedTypes...)
 	if err != nil {
 		return errors.Wrap(err, "sending packet")
 	}
@@ -346,29 +789,89 @@ func (m *MTProto) InvokeRequestWithoutUpdate(data tl.Object, expectedTypes ...re
 }
 
 func (m *MTProto) TcpActive() bool {
-	return m.tcpActive
+	return m.tcpActive.Load()
 }
 
 func (m *MTProto) Disconnect() error {
-	m.stopRoutines()
-	m.tcpActive = false
+	if m.stopRoutines != nil {
+		m.stopRoutines()
+	}
+	m.tcpActive.Store(false)
+	m.setState(Disconnected)
 	// m.responseChannels.Close()
 	return nil
 }
 
 func (m *MTProto) Terminate() error {
-	m.stopRoutines()
+	if m.terminate != nil {
+		m.terminate()
+	}
+	if m.stopRoutines != nil { // never connected
+		m.stopRoutines()
+	}
 	m.responseChannels.Close()
 	m.Logger.Info("terminating connection to [" + m.Addr + "] - <TCPFull> ...")
-	m.tcpActive = false
+	m.tcpActive.Store(false)
+	m.setState(Disconnected)
 	return nil
 }
 
+// PendingRequests returns the message ids of requests still waiting for a response
+func (m *MTProto) PendingRequests() []int {
+	return m.responseChannels.Keys()
+}
+
+// DrainPending waits for all in-flight requests to receive their responses,
+// or for the context to expire. It returns the number of requests still pending
+// (abandoned) when it returns.
+func (m *MTProto) DrainPending(ctx context.Context) (int, error) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		pending := m.responseChannels.Len()
+		if pending == 0 {
+			return 0, nil
+		}
+		select {
+		case <-ctx.Done():
+			return pending, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// AbortPending fails all in-flight requests with the given error,
+// and clears the response-channel and expected-type maps.
+// It returns the number of requests aborted.
+func (m *MTProto) AbortPending(err error) int {
+	if err == nil {
+		err = errors.New("connection closed")
+	}
+	keys := m.responseChannels.Keys()
+	for _, k := range keys {
+		v, ok := m.responseChannels.Get(k)
+		m.responseChannels.Delete(k)
+		m.expectedTypes.Delete(k)
+		if !ok {
+			continue
+		}
+		go func(c chan tl.Object) {
+			// the waiter may be gone already (e.g InvokeRequestWithoutUpdate), don't block forever
+			select {
+			case c <- &errorRequestAborted{err}:
+			case <-time.After(10 * time.Second):
+			}
+		}(v)
+	}
+	return len(keys)
+}
+
 func (m *MTProto) Reconnect(WithLogs bool) error {
 	err := m.Disconnect()
 	if err != nil {
 		return errors.Wrap(err, "disconnecting")
 	}
+	m.setState(Reconnecting)
 	if WithLogs {
 		m.Logger.Info("Reconnecting to [" + m.Addr + "] - <TCPFull> ...")
 	}
@@ -400,59 +903,71 @@ func (m *MTProto) startReadingResponses(ctx context.Context) {
 			case <-ctx.Done():
 				return
 			default:
-				if !m.tcpActive {
+				if !m.tcpActive.Load() {
 					m.Logger.Warn("Connection is not established with, stopping Updates Queue")
 					return
 				}
 				err := m.readMsg()
 				switch err {
 				case nil:
+					continue
 				case context.Canceled:
 					return
-				case io.EOF:
-					err = m.Reconnect(false)
-					if err != nil {
-						m.Logger.Error(errors.Wrap(err, "reconnecting"))
-					}
+				}
+				if ctx.Err() != nil {
+					// disconnected on purpose, the read failed because the transport was closed
 					return
-
-				default:
-					if e, ok := err.(transport.ErrCode); ok {
-						if int(e) == 4294966892 {
-							err = m.makeAuthKey()
-							if err != nil {
-								m.Logger.Error(errors.Wrap(err, "making auth key"))
-							}
-						} else {
-							m.Logger.Error("Unhandled errorCode: " + fmt.Sprintf("%d", e))
-						}
-					}
-					if strings.Contains(err.Error(), "required to reconnect!") {
-						err = m.Reconnect(false)
-						if err != nil {
-							m.Logger.Error(errors.Wrap(err, "reconnecting error"))
-						}
-						return
-					} else {
-						err = m.Reconnect(false)
-						if err != nil {
-							m.Logger.Error(errors.Wrap(err, "reconnecting error"))
-						}
+				}
+				if e, ok := err.(transport.ErrCode); ok && int(e) == 4294966892 {
+					if err := m.makeAuthKey(); err != nil {
+						m.Logger.Error(errors.Wrap(err, "making auth key"))
 					}
 				}
+				m.Logger.Debug("reading message: " + err.Error())
+				m.reconnectWithBackoff()
+				return
 			}
 		}
 	}()
 }
 
+// reconnectWithBackoff re-establishes a dropped connection with the same auth key,
+// waiting twice as long after every failed attempt until Terminate is called.
+// Requests still waiting for a response fail with ErrConnectionLost.
+func (m *MTProto) reconnectWithBackoff() {
+	if n := m.AbortPending(ErrConnectionLost); n > 0 {
+		m.Logger.Debug(fmt.Sprintf("connection lost, failed %d pending requests", n))
+	}
+	delay := m.reconnect.base
+	for m.lifetime.Err() == nil {
+		err := m.Reconnect(false)
+		if err == nil {
+			break
+		}
+		m.Logger.Error(errors.Wrap(err, "reconnecting, retrying in "+delay.String()))
+		select {
+		case <-time.After(delay):
+		case <-m.lifetime.Done():
+			return
+		}
+		delay = min(2*delay, m.reconnect.max)
+	}
+	if m.reconnectHandler != nil && m.lifetime.Err() == nil {
+		if err := m.reconnectHandler(); err != nil {
+			m.Logger.Error(errors.Wrap(err, "after reconnecting"))
+		}
+	}
+}
+
 func (m *MTProto) readMsg() error {
-	if m.transport == nil {
+	t := m.getTransport()
+	if t == nil {
 		return errors.New("must setup connection before reading messages")
 	}
-	response, err := m.transport.ReadMsg()
+	response, err := t.ReadMsg()
 	if err != nil {
 		if e, ok := err.(transport.ErrCode); ok {
-			return &ErrResponseCode{Code: int(e)}
+			return &RPCError{Code: int(e)}
 		}
 		switch err {
 		case io.EOF, context.Canceled:
@@ -540,10 +1055,10 @@ messageTypeSwitching:
 		if v, ok := obj.(*objects.GzipPacked); ok {
 			obj = v.Obj
 		}
-		m.Logger.Debug("RPC response: " + fmt.Sprintf("%T", obj))
-		err := m.writeRPCResponse(int(message.ReqMsgID), obj)
-		if err != nil {
-			return errors.Wrap(err, "writing RPC response")
+		m.Logger.Trace("RPC response: " + fmt.Sprintf("%T", obj))
+		if err := m.writeRPCResponse(int(message.ReqMsgID), obj); err != nil {
+			// the request timed out or was canceled before its response arrived
+			m.Logger.Debug("dropping late RPC response: " + err.Error())
 		}
 
 	case *objects.GzipPacked:
@@ -0,0 +1,656 @@
+// Copyright (c) 2024 RoseLoverX
+
+package gogram
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/roj1512/gogram/internal/encoding/tl"
+	"github.com/roj1512/gogram/internal/mtproto/messages"
+	"github.com/roj1512/gogram/internal/mtproto/objects"
+	"github.com/roj1512/gogram/internal/session"
+	"github.com/roj1512/gogram/internal/transport"
+	"github.com/roj1512/gogram/internal/utils"
+)
+
+// silentTransport accepts every message and never answers
+type silentTransport struct{}
+
+func (silentTransport) Close() error                                { return nil }
+func (silentTransport) WriteMsg(messages.Common, bool, int32) error { return nil }
+func (silentTransport) ReadMsg() (messages.Common, error)           { select {} }
+
+func TestMakeRequestCtxCanceled(t *testing.T) {
+	m := &MTProto{
+		transport:        silentTransport{},
+		responseChannels: utils.NewSyncIntObjectChan(),
+		expectedTypes:    utils.NewSyncIntReflectTypes(),
+	}
+	m.tcpActive.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.MakeRequestCtx(ctx, &objects.PingParams{PingID: 1})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request didn't return after the context expired")
+	}
+	if n := m.responseChannels.Len(); n != 0 {
+		t.Fatalf("expected response channel to be cleaned up, %d left", n)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	m := &MTProto{
+		transport:        silentTransport{},
+		requestTimeout:   50 * time.Millisecond,
+		responseChannels: utils.NewSyncIntObjectChan(),
+		expectedTypes:    utils.NewSyncIntReflectTypes(),
+		Logger:           utils.NewLogger("test").SetLevel("error"),
+	}
+	m.tcpActive.Store(true)
+	_, err := m.MakeRequest(&objects.PingParams{PingID: 1})
+	if !errors.Is(err, ErrRequestTimeout) {
+		t.Fatalf("expected ErrRequestTimeout, got %v", err)
+	}
+	if n := m.responseChannels.Len(); n != 0 {
+		t.Fatalf("expected response channel to be cleaned up, %d left", n)
+	}
+
+	// the response arriving after the timeout is dropped
+	late, err := tl.Marshal(&objects.RpcResult{ReqMsgID: m.lastMessageID, Obj: &objects.Pong{PingID: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.processResponse(&messages.Unencrypted{Msg: late}); err != nil {
+		t.Errorf("late response: %v", err)
+	}
+}
+
+func TestRequestTimeoutConfig(t *testing.T) {
+	none := time.Duration(0)
+	short := time.Second
+	for _, tt := range []struct {
+		timeout *time.Duration
+		want    time.Duration
+	}{
+		{nil, defaultRequestTimeout},
+		{&none, 0},
+		{&short, time.Second},
+	} {
+		m, err := NewMTProto(Config{MemorySession: true, AppID: 1, LogLevel: "error", RequestTimeout: tt.timeout})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.requestTimeout != tt.want {
+			t.Errorf("RequestTimeout %v: got %s, want %s", tt.timeout, m.requestTimeout, tt.want)
+		}
+	}
+
+	// without a timeout the request waits for its context only
+	m := &MTProto{
+		transport:        silentTransport{},
+		responseChannels: utils.NewSyncIntObjectChan(),
+		expectedTypes:    utils.NewSyncIntReflectTypes(),
+		Logger:           utils.NewLogger("test").SetLevel("error"),
+	}
+	m.tcpActive.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := m.MakeRequestCtx(ctx, &objects.PingParams{PingID: 1}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the request to wait for its context, got %v", err)
+	}
+}
+
+func TestTraceLogsRequests(t *testing.T) {
+	var out bytes.Buffer
+	m := &MTProto{
+		transport:        silentTransport{},
+		requestTimeout:   10 * time.Millisecond,
+		responseChannels: utils.NewSyncIntObjectChan(),
+		expectedTypes:    utils.NewSyncIntReflectTypes(),
+		Logger:           utils.NewLogger("test").SetLevel("error").SetHandler(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug - 4})),
+	}
+	m.tcpActive.Store(true)
+	m.MakeRequest(&objects.PingParams{PingID: 1})
+	m.Logger.SetLevel("debug")
+	m.MakeRequest(&objects.PingParams{PingID: 2})
+	if strings.Contains(out.String(), "RPC request") {
+		t.Fatalf("request traced at debug level: %s", out.String())
+	}
+
+	m.Logger.SetLevel("trace")
+	m.MakeRequest(&objects.PingParams{PingID: 3})
+	if !strings.Contains(out.String(), "RPC request: *objects.PingParams") {
+		t.Errorf("request not traced at trace level: %s", out.String())
+	}
+}
+
+type recordingMetrics struct {
+	method string
+	err    error
+}
+
+func (r *recordingMetrics) ObserveRequest(method string, _ time.Duration, err error) {
+	r.method, r.err = method, err
+}
+
+func TestRequestMetrics(t *testing.T) {
+	metrics := &recordingMetrics{}
+	m := &MTProto{
+		transport:        silentTransport{},
+		requestTimeout:   10 * time.Millisecond,
+		responseChannels: utils.NewSyncIntObjectChan(),
+		expectedTypes:    utils.NewSyncIntReflectTypes(),
+		Logger:           utils.NewLogger("test").SetLevel("error"),
+		metrics:          metrics,
+	}
+	m.tcpActive.Store(true)
+	m.MakeRequest(&objects.PingParams{PingID: 1})
+	if metrics.method != "Ping" || !errors.Is(metrics.err, ErrRequestTimeout) {
+		t.Errorf("expected Ping to time out, observed %q with %v", metrics.method, metrics.err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{PerSecond: 20, Burst: 2})
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := limiter.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the burst goes at once, the two others wait 50ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("4 requests at 20/s with a burst of 2 took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		limiter.wait(ctx)
+	}
+	if err := limiter.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+}
+
+func TestConnectionStateHandler(t *testing.T) {
+	m := &MTProto{
+		stopRoutines:     func() {},
+		responseChannels: utils.NewSyncIntObjectChan(),
+		Logger:           utils.NewLogger("test").SetLevel("error"),
+	}
+	var states []ConnectionState
+	m.SetConnectionStateHandler(func(state ConnectionState) {
+		states = append(states, state)
+	})
+	m.setState(Connecting)
+	m.setState(Connected)
+	m.setState(Connected)
+	m.Disconnect()
+	m.Terminate()
+
+	want := []ConnectionState{Connecting, Connected, Disconnected}
+	if len(states) != len(want) {
+		t.Fatalf("states %v, want %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("states %v, want %v", states, want)
+		}
+	}
+	if m.ConnectionState() != Disconnected {
+		t.Errorf("state %v after Terminate", m.ConnectionState())
+	}
+}
+
+// droppingTransport fails reads with io.EOF once drop is closed
+type droppingTransport struct {
+	drop   chan struct{}
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newDroppingTransport() *droppingTransport {
+	return &droppingTransport{drop: make(chan struct{}), closed: make(chan struct{})}
+}
+
+func (t *droppingTransport) Close() error {
+	t.once.Do(func() { close(t.closed) })
+	return nil
+}
+
+func (t *droppingTransport) WriteMsg(messages.Common, bool, int32) error { return nil }
+
+func (t *droppingTransport) ReadMsg() (messages.Common, error) {
+	select {
+	case <-t.drop:
+		return nil, io.EOF
+	case <-t.closed:
+		return nil, context.Canceled
+	}
+}
+
+func TestReconnectWithBackoff(t *testing.T) {
+	lifetime, terminate := context.WithCancel(context.Background())
+	defer terminate()
+	first, second := newDroppingTransport(), newDroppingTransport()
+	var dials atomic.Int32
+	m := &MTProto{
+		encrypted:        true,
+		responseChannels: utils.NewSyncIntObjectChan(),
+		expectedTypes:    utils.NewSyncIntReflectTypes(),
+		Logger:           utils.NewLogger("test").SetLevel("error"),
+		reconnect:        reconnectConfig{base: time.Millisecond, max: 4 * time.Millisecond},
+		lifetime:         lifetime,
+		terminate:        terminate,
+	}
+	m.newTransport = func(context.Context) (transport.Transport, error) {
+		switch dials.Add(1) {
+		case 1:
+			return first, nil
+		case 2, 3:
+			return nil, errors.New("connection refused")
+		}
+		return second, nil
+	}
+	reconnected := make(chan struct{})
+	m.SetReconnectHandler(func() error {
+		close(reconnected)
+		return nil
+	})
+	if err := m.CreateConnection(false); err != nil {
+		t.Fatal(err)
+	}
+
+	pending := make(chan error, 1)
+	go func() {
+		_, err := m.MakeRequestCtx(context.Background(), &objects.PingParams{PingID: 1})
+		pending <- err
+	}()
+	for len(m.PendingRequests()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(first.drop)
+
+	select {
+	case err := <-pending:
+		if !errors.Is(err, ErrConnectionLost) {
+			t.Errorf("pending request failed with %v, want ErrConnectionLost", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pending request still waiting after the connection dropped")
+	}
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not reconnect")
+	}
+	if n := dials.Load(); n != 4 {
+		t.Errorf("dialed %d times, want 4", n)
+	}
+	if !m.TcpActive() || m.ConnectionState() != Connected {
+		t.Errorf("connection not active after reconnecting, state %v", m.ConnectionState())
+	}
+	m.Terminate()
+}
+
+func TestDialAddrs(t *testing.T) {
+	m := &MTProto{Addr: utils.DcList[2], dcList: dcList(false, nil)}
+	if addrs := m.dialAddrs(); len(addrs) != 1 || addrs[0] != utils.DcList[2] {
+		t.Errorf("IPv4: got %v", addrs)
+	}
+	m.preferIPv6 = true
+	if addrs := m.dialAddrs(); len(addrs) != 2 || addrs[0] != utils.DcListV6[2] || addrs[1] != utils.DcList[2] {
+		t.Errorf("IPv6 with IPv4 fallback: got %v", addrs)
+	}
+	m = &MTProto{Addr: utils.TestDcList[1], dcList: dcList(true, nil), testMode: true, preferIPv6: true}
+	if addrs := m.dialAddrs(); len(addrs) != 2 || addrs[0] != utils.TestDcListV6[1] {
+		t.Errorf("test servers over IPv6: got %v", addrs)
+	}
+	m = &MTProto{Addr: "10.0.0.1:443", dcList: dcList(false, map[int]string{2: "10.0.0.1:443"}), preferIPv6: true}
+	if addrs := m.dialAddrs(); len(addrs) != 1 || addrs[0] != "10.0.0.1:443" {
+		t.Errorf("overridden address: got %v", addrs)
+	}
+}
+
+func TestDCListOverride(t *testing.T) {
+	dcs := dcList(false, map[int]string{2: "10.0.0.1:443"})
+	if dcs[2] != "10.0.0.1:443" {
+		t.Errorf("expected DC 2 to be overridden, got %q", dcs[2])
+	}
+	for _, dc := range []int{1, 3, 4, 5} {
+		if dcs[dc] != utils.DcList[dc] {
+			t.Errorf("expected DC %d to keep its address, got %q", dc, dcs[dc])
+		}
+	}
+	if utils.DcList[2] == "10.0.0.1:443" {
+		t.Error("the override modified the bundled DC list")
+	}
+	if dcs := dcList(true, map[int]string{5: "10.0.0.5:443"}); dcs[1] != utils.TestDcList[1] || dcs[5] != "10.0.0.5:443" {
+		t.Errorf("expected the override added to the test DCs, got %v", dcs)
+	}
+}
+
+func TestFloodWaitRetry(t *testing.T) {
+	tr := capturingTransport{written: make(chan messages.Common, 1)}
+	var waited []string
+	m := &MTProto{
+		transport:        tr,
+		responseChannels: utils.NewSyncIntObjectChan(),
+		expectedTypes:    utils.NewSyncIntReflectTypes(),
+		Logger:           utils.NewLogger("test").SetLevel("error"),
+		floodWait: floodWaitConfig{retry: true, onFlood: func(request string, wait time.Duration) {
+			waited = append(waited, request+" "+wait.String())
+		}},
+	}
+	m.tcpActive.Store(true)
+	type result struct {
+		resp any
+		err  error
+	}
+	done := make(chan result)
+	go func() {
+		resp, err := m.MakeRequest(&objects.PingParams{PingID: 1})
+		done <- result{resp, err}
+	}()
+
+	replies := []tl.Object{&objects.RpcError{ErrorCode: 420, ErrorMessage: "FLOOD_WAIT_0"}, &objects.Pong{PingID: 1}}
+	for _, reply := range replies {
+		sent := <-tr.written
+		msg, err := tl.Marshal(&objects.RpcResult{ReqMsgID: int64(sent.GetMsgID()), Obj: reply})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.processResponse(&messages.Unencrypted{Msg: msg}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res := <-done
+	if pong, ok := res.resp.(*objects.Pong); !ok || res.err != nil || pong.PingID != 1 {
+		t.Fatalf("expected the retried request to succeed, got %#v, %v", res.resp, res.err)
+	}
+	if len(waited) != 1 || waited[0] != "Ping 0s" {
+		t.Errorf("expected OnFloodWait to be called once for Ping, got %v", waited)
+	}
+}
+
+func TestShouldRetryFlood(t *testing.T) {
+	flood := func(seconds int) *RPCError {
+		return &RPCError{Code: 420, Message: "FLOOD_WAIT_X", AdditionalInfo: seconds}
+	}
+	cases := []struct {
+		name  string
+		cfg   floodWaitConfig
+		err   *RPCError
+		wait  time.Duration
+		retry bool
+	}{
+		{"no limit", floodWaitConfig{retry: true}, flood(300), 300 * time.Second, true},
+		{"under the max", floodWaitConfig{retry: true, max: time.Minute}, flood(60), time.Minute, true},
+		{"over the max", floodWaitConfig{retry: true, max: time.Minute}, flood(61), 0, false},
+		{"disabled", floodWaitConfig{}, flood(1), 0, false},
+		{"other error", floodWaitConfig{retry: true}, &RPCError{Code: 400, Message: "PEER_ID_INVALID"}, 0, false},
+	}
+	for _, c := range cases {
+		m := &MTProto{floodWait: c.cfg}
+		if wait, retry := m.shouldRetryFlood(c.err); wait != c.wait || retry != c.retry {
+			t.Errorf("%s: got %s, %v, want %s, %v", c.name, wait, retry, c.wait, c.retry)
+		}
+	}
+}
+
+func TestFloodWaitRetryByDefault(t *testing.T) {
+	m, err := NewMTProto(Config{MemorySession: true, AppID: 1, LogLevel: "error"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.floodWait.retry {
+		t.Error("expected flood waits to be retried unless DisableFloodWaitRetry is set")
+	}
+}
+
+func TestAbortPending(t *testing.T) {
+	tr := capturingTransport{written: make(chan messages.Common, 2)}
+	m := &MTProto{
+		transport:        tr,
+		responseChannels: utils.NewSyncIntObjectChan(),
+		expectedTypes:    utils.NewSyncIntReflectTypes(),
+		Logger:           utils.NewLogger("test").SetLevel("error"),
+	}
+	m.tcpActive.Store(true)
+	errAborted := errors.New("aborted")
+	done := make(chan error, 2)
+	for i := int64(1); i <= 2; i++ {
+		go func(id int64) {
+			_, err := m.MakeRequest(&objects.PingParams{PingID: id})
+			done <- err
+		}(i)
+	}
+	// concurrent requests never share a msg_id, or one would take the other's response
+	if a, b := <-tr.written, <-tr.written; a.GetMsgID() == b.GetMsgID() {
+		t.Fatalf("both requests were sent as msg_id %d", a.GetMsgID())
+	}
+
+	if n := m.AbortPending(errAborted); n != 2 {
+		t.Errorf("aborted %d requests, want 2", n)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if !errors.Is(err, errAborted) {
+				t.Errorf("expected the abort error, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("an aborted request is still waiting")
+		}
+	}
+	if m.responseChannels.Len() != 0 || len(m.expectedTypes.Keys()) != 0 {
+		t.Error("the aborted requests were not forgotten")
+	}
+	if n := m.AbortPending(nil); n != 0 {
+		t.Errorf("aborted %d requests with none pending", n)
+	}
+}
+
+func TestDrainPending(t *testing.T) {
+	tr := capturingTransport{written: make(chan messages.Common, 1)}
+	m := &MTProto{
+		transport:        tr,
+		responseChannels: utils.NewSyncIntObjectChan(),
+		expectedTypes:    utils.NewSyncIntReflectTypes(),
+		Logger:           utils.NewLogger("test").SetLevel("error"),
+	}
+	m.tcpActive.Store(true)
+	go m.MakeRequest(&objects.PingParams{PingID: 1})
+	sent := <-tr.written
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if n, err := m.DrainPending(ctx); n != 1 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the request to be left pending, got %d, %v", n, err)
+	}
+
+	drained := make(chan int, 1)
+	go func() {
+		n, _ := m.DrainPending(context.Background())
+		drained <- n
+	}()
+	select {
+	case <-drained:
+		t.Fatal("DrainPending returned before the response")
+	case <-time.After(100 * time.Millisecond):
+	}
+	msg, err := tl.Marshal(&objects.RpcResult{ReqMsgID: int64(sent.GetMsgID()), Obj: &objects.Pong{PingID: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.processResponse(&messages.Unencrypted{Msg: msg}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case n := <-drained:
+		if n != 0 {
+			t.Errorf("%d requests left pending", n)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("DrainPending didn't return after the response")
+	}
+}
+
+func TestMigrateDC(t *testing.T) {
+	cases := []struct {
+		message string
+		dc      int
+		ok      bool
+	}{
+		{"PHONE_MIGRATE_5", 5, true},
+		{"USER_MIGRATE_3", 3, true},
+		{"NETWORK_MIGRATE_1", 1, true},
+		{"FILE_MIGRATE_2", 0, false}, // files are fetched from their DC, the connection stays
+		{"FLOOD_WAIT_3", 0, false},
+	}
+	for _, c := range cases {
+		err := RpcErrorToNative(&objects.RpcError{ErrorCode: 303, ErrorMessage: c.message}).(*RPCError)
+		if dc, ok := migrateDC(err); dc != c.dc || ok != c.ok {
+			t.Errorf("migrateDC(%s) = %d, %v, want %d, %v", c.message, dc, ok, c.dc, c.ok)
+		}
+	}
+	if dc, ok := IsMigrate(RpcErrorToNative(&objects.RpcError{ErrorCode: 303, ErrorMessage: "FILE_MIGRATE_2"})); dc != 2 || !ok {
+		t.Errorf("IsMigrate(FILE_MIGRATE_2) = %d, %v", dc, ok)
+	}
+}
+
+// newMigratingMTProto returns a connection to DC 2 whose transports write to tr, and whose
+// auth key creation on a new DC is counted in authKeys
+func newMigratingMTProto(t *testing.T, tr capturingTransport, authKeys *atomic.Int32) *MTProto {
+	t.Helper()
+	m := &MTProto{
+		Addr:             utils.DcList[2],
+		dcList:           dcList(false, nil),
+		encrypted:        true,
+		authKey:          make([]byte, 256),
+		sessionStorage:   session.NewInMemory(),
+		responseChannels: utils.NewSyncIntObjectChan(),
+		expectedTypes:    utils.NewSyncIntReflectTypes(),
+		Logger:           utils.NewLogger("test").SetLevel("error"),
+	}
+	m.newTransport = func(context.Context) (transport.Transport, error) {
+		return tr, nil
+	}
+	m.newAuthKey = func() error {
+		authKeys.Add(1)
+		m.authKey, m.encrypted = make([]byte, 256), true
+		return nil
+	}
+	if err := m.CreateConnection(false); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// answer replies to the next request written to tr
+func answer(t *testing.T, m *MTProto, tr capturingTransport, reply tl.Object) {
+	t.Helper()
+	var sent messages.Common
+	select {
+	case sent = <-tr.written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no request sent")
+	}
+	msg, err := tl.Marshal(&objects.RpcResult{ReqMsgID: int64(sent.GetMsgID()), Obj: reply})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.processResponse(&messages.Unencrypted{Msg: msg}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateRequest(t *testing.T) {
+	tr := capturingTransport{written: make(chan messages.Common, 1)}
+	var authKeys atomic.Int32
+	m := newMigratingMTProto(t, tr, &authKeys)
+	defer m.Terminate()
+	m.sessionStorage.Store(&session.Session{Key: m.authKey, Hostname: m.Addr})
+	var migrated []int
+	m.SetMigrateHandler(func(dc int) error {
+		migrated = append(migrated, dc)
+		return nil
+	})
+
+	type result struct {
+		resp any
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := m.MakeRequest(&objects.PingParams{PingID: 1})
+		done <- result{resp, err}
+	}()
+	answer(t, m, tr, &objects.RpcError{ErrorCode: 303, ErrorMessage: "USER_MIGRATE_3"})
+	// the request is sent again on the new DC
+	answer(t, m, tr, &objects.Pong{PingID: 1})
+
+	res := <-done
+	if pong, ok := res.resp.(*objects.Pong); !ok || res.err != nil || pong.PingID != 1 {
+		t.Fatalf("expected the replayed request to succeed, got %#v, %v", res.resp, res.err)
+	}
+	if m.GetDC() != 3 || m.Addr != utils.DcList[3] {
+		t.Errorf("connected to DC %d (%s), want DC 3", m.GetDC(), m.Addr)
+	}
+	if authKeys.Load() != 1 || len(migrated) != 1 || migrated[0] != 3 {
+		t.Errorf("created %d auth keys, migrate handler called with %v", authKeys.Load(), migrated)
+	}
+	if s, _ := m.sessionStorage.Load(); s != nil && s.Hostname == utils.DcList[2] {
+		t.Error("the session of the old DC was kept")
+	}
+}
+
+func TestMigrateRequestLimit(t *testing.T) {
+	tr := capturingTransport{written: make(chan messages.Common, 1)}
+	var authKeys atomic.Int32
+	m := newMigratingMTProto(t, tr, &authKeys)
+	defer m.Terminate()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.MakeRequest(&objects.PingParams{PingID: 1})
+		done <- err
+	}()
+	for _, message := range []string{"PHONE_MIGRATE_3", "PHONE_MIGRATE_1", "PHONE_MIGRATE_5"} {
+		answer(t, m, tr, &objects.RpcError{ErrorCode: 303, ErrorMessage: message})
+	}
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "too many DC migrations") {
+			t.Errorf("expected too many DC migrations, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request is still migrating")
+	}
+	if m.GetDC() != 1 || authKeys.Load() != maxMigrations {
+		t.Errorf("ended on DC %d after %d auth keys", m.GetDC(), authKeys.Load())
+	}
+}
@@ -3,6 +3,7 @@
 package gogram
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 
@@ -14,18 +15,15 @@ import (
 	"github.com/roj1512/gogram/internal/utils"
 )
 
-func (m *MTProto) sendPacket(request tl.Object, expectedTypes ...reflect.Type) (chan tl.Object, error) {
+func (m *MTProto) sendPacket(request tl.Object, expectedTypes ...reflect.Type) (chan tl.Object, int64, error) {
 	msg, err := tl.Marshal(request)
 	if err != nil {
-		return nil, errors.Wrap(err, "marshaling request")
+		return nil, 0, errors.Wrap(err, "marshaling request")
 	}
-	m.lastMessageIDMutex.Lock()
 	var (
 		data  messages.Common
-		msgID = utils.GenerateMessageId(m.lastMessageID)
+		msgID = m.nextMessageID()
 	)
-	m.lastMessageIDMutex.Unlock()
-	m.lastMessageID = msgID
 
 	// adding types for parser if required
 	if len(expectedTypes) > 0 {
@@ -56,14 +54,23 @@ func (m *MTProto) sendPacket(request tl.Object, expectedTypes ...reflect.Type) (
 	if !m.encrypted {
 		seqNo = 0
 	}
-	if m.transport == nil {
-		return nil, errors.New("transport is nil, please use SetTransport")
+	t := m.getTransport()
+	if t == nil {
+		m.forgetRequest(int(msgID))
+		return nil, 0, errors.New("transport is nil, please use SetTransport")
 	}
-	errorSendPacket := m.transport.WriteMsg(data, MessageRequireToAck(request), seqNo)
+	errorSendPacket := t.WriteMsg(data, MessageRequireToAck(request), seqNo)
 	if errorSendPacket != nil {
-		return nil, fmt.Errorf("writing message: %w", errorSendPacket)
+		m.forgetRequest(int(msgID))
+		return nil, 0, fmt.Errorf("writing message: %w", errorSendPacket)
 	}
-	return resp, nil
+	return resp, msgID, nil
+}
+
+// forgetRequest drops the response channel and decoder hints of a request nobody waits for anymore
+func (m *MTProto) forgetRequest(msgID int) {
+	m.responseChannels.Delete(msgID)
+	m.expectedTypes.Delete(msgID)
 }
 
 func (m *MTProto) writeRPCResponse(msgID int, data tl.Object) error {
@@ -81,7 +88,8 @@ func (m *MTProto) getRespChannel() chan tl.Object {
 	if m.serviceModeActivated {
 		return m.serviceChannel
 	}
-	return make(chan tl.Object)
+	// buffered, so a response arriving after the caller gave up doesn't block the reader
+	return make(chan tl.Object, 1)
 }
 
 func isNullableResponse(t tl.Object) bool {
@@ -126,14 +134,20 @@ func (m *MTProto) SetAuthKey(key []byte) {
 }
 
 func (m *MTProto) MakeRequest(msg tl.Object) (any, error) {
-	return m.makeRequest(msg)
+	return m.makeRequest(context.Background(), msg)
+}
+
+// MakeRequestCtx is MakeRequest bound to ctx, it returns ctx.Err() if ctx is done
+// before the response arrives
+func (m *MTProto) MakeRequestCtx(ctx context.Context, msg tl.Object) (any, error) {
+	return m.makeRequest(ctx, msg)
 }
 
 func (m *MTProto) MakeRequestWithHintToDecoder(msg tl.Object, expectedTypes ...reflect.Type) (any, error) {
 	if len(expectedTypes) == 0 {
 		return nil, errors.New("expected a few hints. If you don't need it, use m.MakeRequest")
 	}
-	return m.makeRequest(msg, expectedTypes...)
+	return m.makeRequest(context.Background(), msg, expectedTypes...)
 }
 
 func (m *MTProto) AddCustomServerRequestHandler(handler func(i any) bool) {
@@ -0,0 +1,92 @@
+// Copyright (c) 2024 RoseLoverX
+
+package gogram
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit limits the requests sent with a token bucket holding at most Burst
+// tokens and refilled with PerSecond tokens every second, each request taking one
+type RateLimit struct {
+	PerSecond float64
+	// Burst is the number of requests sent at once after being idle (default 1)
+	Burst int
+}
+
+type rateLimiter struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns nil, meaning no limit, when the rate is not positive
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.PerSecond <= 0 {
+		return nil
+	}
+	burst := float64(max(limit.Burst, 1))
+	return &rateLimiter{rate: limit.PerSecond, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait takes a token, waiting for one to be available or for ctx to be done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// the token is taken right away, the ones waiting next queue behind it
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.Lock()
+		l.tokens++
+		l.Unlock()
+		return ctx.Err()
+	}
+}
+
+// rateLimiters holds the global limiter and the ones of single methods
+type rateLimiters struct {
+	global  *rateLimiter
+	methods map[string]*rateLimiter
+}
+
+func newRateLimiters(global *RateLimit, methods map[string]RateLimit) *rateLimiters {
+	l := &rateLimiters{methods: make(map[string]*rateLimiter)}
+	if global != nil {
+		l.global = newRateLimiter(*global)
+	}
+	for method, limit := range methods {
+		if limiter := newRateLimiter(limit); limiter != nil {
+			l.methods[method] = limiter
+		}
+	}
+	return l
+}
+
+// wait waits on the limiter of the method, then on the global one
+func (l *rateLimiters) wait(ctx context.Context, method string) error {
+	if limiter, ok := l.methods[method]; ok {
+		if err := limiter.wait(ctx); err != nil {
+			return err
+		}
+	}
+	if l.global != nil {
+		return l.global.wait(ctx)
+	}
+	return nil
+}
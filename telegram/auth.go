@@ -3,6 +3,7 @@
 package telegram
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -11,8 +12,10 @@ import (
 	"fmt"
 	"hash"
 	"math/big"
+	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -110,17 +113,21 @@ func (c *Client) SendCode(phoneNumber string) (hash string, err error) {
 }
 
 type LoginOptions struct {
-	Password         string `json:"password,omitempty"`
-	Code             string `json:"code,omitempty"`
-	CodeHash         string `json:"code_hash,omitempty"`
-	CodeCallback     func() (string, error)
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+	CodeHash string `json:"code_hash,omitempty"`
+	// CodeCallback returns the login code, prompted on stdin when nil; "cancel" or "exit" aborts the login
+	CodeCallback func() (string, error)
+	// PasswordCallback returns the 2FA password, prompted on stdin when nil; "cancel" or "exit" aborts the login
 	PasswordCallback func() (string, error)
 	FirstName        string `json:"first_name,omitempty"`
 	LastName         string `json:"last_name,omitempty"`
 }
 
 // Authorize client with phone number, code and phone code hash,
-// If phone code hash is empty, it will be requested from telegram server
+// If phone code hash is empty, it will be requested from telegram server.
+// The code and the 2FA password, if enabled, are asked from the callbacks of the
+// options unless given, the session is saved once logged in.
 func (c *Client) Login(phoneNumber string, options ...*LoginOptions) (bool, error) {
 	if !c.IsConnected() {
 		if err := c.Connect(); err != nil {
@@ -130,121 +137,52 @@ func (c *Client) Login(phoneNumber string, options ...*LoginOptions) (bool, erro
 	if au, _ := c.IsAuthorized(); au {
 		return true, nil
 	}
-	var opts *LoginOptions
-	if len(options) > 0 {
-		opts = options[0]
-	}
-	if opts == nil {
-		opts = &LoginOptions{}
+	opts := getVariadic(options, &LoginOptions{}).(*LoginOptions)
+	if opts.CodeCallback == nil {
+		opts.CodeCallback = func() (string, error) {
+			fmt.Printf("Enter code: ")
+			var codeInput string
+			fmt.Scanln(&codeInput)
+			return codeInput, nil
+		}
 	}
-	var Auth AuthAuthorization
+	var auth AuthAuthorization
 	var err error
-	if opts.Code == "" {
+	if opts.Code != "" {
+		if opts.CodeHash == "" {
+			return false, errors.New("Code hash is empty, but code is not")
+		}
+		auth, err = c.AuthSignIn(phoneNumber, opts.CodeHash, opts.Code, nil)
+	} else {
 		hash, e := c.SendCode(phoneNumber)
 		if e != nil {
 			return false, e
 		}
 		opts.CodeHash = hash
-
-		if opts.CodeCallback == nil {
-			opts.CodeCallback = func() (string, error) {
-				fmt.Printf("Enter code: ")
-				var codeInput string
-				fmt.Scanln(&codeInput)
-				return codeInput, nil
-			}
-		}
-		if opts.PasswordCallback == nil {
-			opts.PasswordCallback = func() (string, error) {
-				fmt.Printf("Two-steps verification is enabled\n")
-				fmt.Printf("Enter password: ")
-				var passwordInput string
-				fmt.Scanln(&passwordInput)
-				return passwordInput, nil
-			}
-		}
-
-		for {
-			opts.Code, err = opts.CodeCallback()
-
-			if opts.Code != "" {
-				Auth, err = c.AuthSignIn(phoneNumber, opts.CodeHash, opts.Code, nil)
-				if err == nil {
-					break
-				}
-				if matchError(err, "The phone code entered was invalid") {
-					fmt.Println("The phone code entered was invalid, please try again!")
-					continue
-				} else if matchError(err, "Two-steps verification is enabled") || matchError(err, "2FA is enabled, use a password to login") { // TODO: Implement matchRPCError
-				acceptPasswordInput:
-					if opts.Password == "" {
-						for {
-							passwordInput, err := opts.PasswordCallback()
-							if err != nil {
-								return false, err
-							}
-							if passwordInput != "" {
-								opts.Password = passwordInput
-								break
-							} else if passwordInput == "cancel" || passwordInput == "exit" {
-								return false, nil
-							} else {
-								fmt.Println("Invalid password, try again")
-							}
-						}
-					}
-					AccPassword, err := c.AccountGetPassword()
-					if err != nil {
-						return false, err
-					}
-					inputPassword, err := GetInputCheckPassword(opts.Password, AccPassword)
-					if err != nil {
-						return false, err
-					}
-					_, err = c.AuthCheckPassword(inputPassword)
-					if err != nil {
-						if strings.Contains(err.Error(), "PASSWORD_HASH_INVALID") {
-							fmt.Println("Password is incorrect, please try again!")
-							goto acceptPasswordInput
-						}
-						return false, err
-					}
-					break
-				} else if matchError(err, "The code is valid but no user with the given number") {
-					return false, errors.New("Since Feb 2023, Telegram does not allow to create new accounts using ThirdParty Clients API. Please use Telegram app to create an account and then use this library to login.")
-					// c.AcceptTOS()
-					// _, err = c.AuthSignUp(phoneNumber, opts.CodeHash, opts.FirstName, opts.LastName)
-					// if err != nil {
-					// return false, err
-					// }
-				} else {
-					return false, err
-				}
-			} else if opts.Code == "cancel" || opts.Code == "exit" {
-				return false, fmt.Errorf("Login canceled")
-			} else {
-				if err, ok := err.(syscall.Errno); ok && err == syscall.EINTR {
-					return false, nil
-				}
-				fmt.Println("Invalid code, try again")
-			}
-		}
-	} else {
-		if opts.CodeHash == "" {
-			return false, errors.New("Code hash is empty, but code is not")
-		}
-		Auth, err = c.AuthSignIn(phoneNumber, opts.CodeHash, opts.Code, nil)
-		if err != nil {
-			return false, err
-		}
+		auth, err = c.signInWithCode(phoneNumber, opts)
 	}
-	switch auth := Auth.(type) {
+	if matchRPCError(err, "SESSION_PASSWORD_NEEDED") {
+		auth, err = c.signInWithPassword(opts)
+	}
+	if matchRPCError(err, "PHONE_NUMBER_UNOCCUPIED") {
+		return false, errors.New("Since Feb 2023, Telegram does not allow to create new accounts using ThirdParty Clients API. Please use Telegram app to create an account and then use this library to login.")
+	}
+	if err != nil {
+		return false, err
+	}
+	return c.completeLogin(auth)
+}
+
+// completeLogin caches the logged in user and saves the session
+func (c *Client) completeLogin(auth AuthAuthorization) (bool, error) {
+	switch auth := auth.(type) {
 	case *AuthAuthorizationSignUpRequired:
 		return false, errors.New("Since Feb 2023, Telegram does not allow to create new accounts using API. Please use Telegram app to create an account and then use this library to login.")
 	case *AuthAuthorizationObj:
 		switch u := auth.User.(type) {
 		case *UserObj:
 			c.clientData.botAcc = u.Bot
+			c.setMe(u)
 			go c.Cache.UpdateUser(u)
 		case *UserEmpty:
 			return false, errors.New("user is empty")
@@ -252,9 +190,94 @@ func (c *Client) Login(phoneNumber string, options ...*LoginOptions) (bool, erro
 	case nil:
 		return false, nil // doesnt mean error
 	}
+	if err := c.MTProto.SaveSession(); err != nil {
+		return false, errors.Wrap(err, "saving session")
+	}
+	if c.updates != nil {
+		// the state the updates missed from now on are recovered from
+		if _, err := c.UpdatesGetState(); err != nil {
+			c.Log.Debug("fetching the update state: ", err)
+		}
+	}
 	return true, nil
 }
 
+// signInWithCode asks for the login code until a valid one is entered
+func (c *Client) signInWithCode(phoneNumber string, opts *LoginOptions) (AuthAuthorization, error) {
+	for {
+		code, err := opts.CodeCallback()
+		if err != nil {
+			if err, ok := err.(syscall.Errno); ok && err == syscall.EINTR {
+				return nil, nil
+			}
+			return nil, err
+		}
+		code = strings.TrimSpace(code)
+		switch code {
+		case "":
+			fmt.Println("Invalid code, try again")
+			continue
+		case "cancel", "exit":
+			return nil, errors.New("Login canceled")
+		}
+		auth, err := c.AuthSignIn(phoneNumber, opts.CodeHash, code, nil)
+		if matchRPCError(err, "PHONE_CODE_INVALID") {
+			fmt.Println("The phone code entered was invalid, please try again!")
+			continue
+		}
+		return auth, err
+	}
+}
+
+// signInWithPassword checks the 2FA password with SRP, asking for it again when
+// wrong unless it was given in the options
+func (c *Client) signInWithPassword(opts *LoginOptions) (AuthAuthorization, error) {
+	passwordCallback := opts.PasswordCallback
+	if passwordCallback == nil {
+		passwordCallback = promptPassword
+	}
+	for {
+		password, asked := opts.Password, false
+		if password == "" {
+			input, err := passwordCallback()
+			if err != nil {
+				return nil, err
+			}
+			switch input {
+			case "":
+				fmt.Println("Invalid password, try again")
+				continue
+			case "cancel", "exit":
+				return nil, errors.New("Login canceled")
+			}
+			password, asked = input, true
+		}
+		accPassword, err := c.AccountGetPassword()
+		if err != nil {
+			return nil, err
+		}
+		inputPassword, err := GetInputCheckPassword(password, accPassword)
+		if err != nil {
+			return nil, err
+		}
+		auth, err := c.AuthCheckPassword(inputPassword)
+		if asked && matchRPCError(err, "PASSWORD_HASH_INVALID") {
+			fmt.Println("Password is incorrect, please try again!")
+			continue
+		}
+		return auth, err
+	}
+}
+
+// promptPassword asks for the 2FA password on stdin
+func promptPassword() (string, error) {
+	fmt.Printf("Two-steps verification is enabled\n")
+	fmt.Printf("Enter password: ")
+	var passwordInput string
+	fmt.Scanln(&passwordInput)
+	return passwordInput, nil
+}
+
 func (c *Client) AcceptTOS() (bool, error) {
 	tos, err := c.HelpGetTermsOfServiceUpdate()
 	if err != nil {
@@ -382,6 +405,8 @@ func (q *QrToken) Recreate() (*QrToken, error) {
 	return q, err
 }
 
+// Wait waits for the token to be accepted (10 minutes by default) and completes the
+// login, asking for the 2FA password on stdin if enabled
 func (q *QrToken) Wait(timeout ...int32) error {
 	const def int32 = 600 // 10 minutes
 	q.Timeout = getVariadic(timeout, def).(int32)
@@ -393,67 +418,139 @@ func (q *QrToken) Wait(timeout ...int32) error {
 	select {
 	case <-ch:
 		go q.client.removeHandle(ev)
-		resp, err := q.client.AuthExportLoginToken(q.client.AppID(), q.client.AppHash(), q.IgnoredIDs)
-		if err != nil {
-			return err
-		}
-	QrResponseSwitch:
-		switch req := resp.(type) {
-		case *AuthLoginTokenMigrateTo:
-			q.client.switchDC(int(req.DcID))
-			resp, err = q.client.AuthImportLoginToken(req.Token)
-			if err != nil {
-				return err
-			}
-			goto QrResponseSwitch
-		case *AuthLoginTokenSuccess:
-			switch u := req.Authorization.(type) {
-			case *AuthAuthorizationObj:
-				switch u := u.User.(type) {
-				case *UserObj:
-					// q.client.bot = u.Bot
-					q.client.Cache.UpdateUser(u)
-				case *UserEmpty:
-					return errors.New("authorization user is empty")
-				}
-			}
-		}
-		return nil
+		token, err := q.client.exportLoginToken(q.IgnoredIDs)
+		_, err = q.client.loginWithToken(token, err, &LoginOptions{})
+		return err
 	case <-time.After(time.Duration(q.Timeout) * time.Second):
 		go q.client.removeHandle(ev)
 		return errors.New("qr login timed out")
 	}
 }
 
+// QRLogin exports a login token to be scanned as a QR code from an app already logged
+// in, QrToken.Wait completes the login once it's accepted
 func (c *Client) QRLogin(IgnoreIDs ...int64) (*QrToken, error) {
-	// Get QR code
 	var ignoreIDs []int64
 	ignoreIDs = append(ignoreIDs, IgnoreIDs...)
-	qr, err := c.AuthExportLoginToken(c.AppID(), c.AppHash(), ignoreIDs)
+	token, err := c.exportLoginToken(ignoreIDs)
 	if err != nil {
 		return nil, err
 	}
-	var (
-		qrToken   []byte
-		expiresIn int32 = 60
-	)
-	switch qr := qr.(type) {
-	case *AuthLoginTokenMigrateTo:
-		c.switchDC(int(qr.DcID))
-		return c.QRLogin(IgnoreIDs...)
-	case *AuthLoginTokenObj:
-		qrToken = qr.Token
-		expiresIn = qr.Expires
-	}
-	// Get QR code URL
-	qrURL := base64.RawURLEncoding.EncodeToString(qrToken)
+	qr, ok := token.(*AuthLoginTokenObj)
+	if !ok {
+		return nil, fmt.Errorf("unexpected login token: %s", reflect.TypeOf(token))
+	}
+	return newQrToken(c, qr, ignoreIDs), nil
+}
+
+func newQrToken(c *Client, token *AuthLoginTokenObj, ignoreIDs []int64) *QrToken {
 	return &QrToken{
-		Token:      qrToken,
-		Url:        fmt.Sprintf("tg://login?token=%s", qrURL),
-		ExpiresIn:  expiresIn,
+		Token:      token.Token,
+		Url:        "tg://login?token=" + base64.RawURLEncoding.EncodeToString(token.Token),
+		ExpiresIn:  token.Expires,
 		client:     c,
 		IgnoredIDs: ignoreIDs,
-	}, nil
+	}
+}
+
+// exportLoginToken exports a login token, importing it on the DC of the account
+// that accepted it if it's another one
+func (c *Client) exportLoginToken(ignoreIDs []int64) (AuthLoginToken, error) {
+	token, err := c.AuthExportLoginToken(c.AppID(), c.AppHash(), ignoreIDs)
+	for err == nil {
+		migrate, ok := token.(*AuthLoginTokenMigrateTo)
+		if !ok {
+			break
+		}
+		if err := c.switchDC(int(migrate.DcID)); err != nil {
+			return nil, err
+		}
+		token, err = c.AuthImportLoginToken(migrate.Token)
+	}
+	return token, err
+}
+
+// loginWithToken completes the login with the result of exportLoginToken once the token
+// was accepted, signing in with the 2FA password like Login if enabled. It reports false
+// while the token wasn't accepted.
+func (c *Client) loginWithToken(token AuthLoginToken, err error, opts *LoginOptions) (bool, error) {
+	if matchRPCError(err, "SESSION_PASSWORD_NEEDED") {
+		auth, err := c.signInWithPassword(opts)
+		if err != nil {
+			return false, err
+		}
+		return c.completeLogin(auth)
+	}
+	if err != nil {
+		return false, err
+	}
+	if success, ok := token.(*AuthLoginTokenSuccess); ok {
+		return c.completeLogin(success.Authorization)
+	}
+	return false, nil
+}
+
+// LoginQR logs in by scanning a QR code from an app already logged in, like QRLogin and
+// QrToken.Wait in a loop: the tg://login URL to render as a QR code is sent on the first
+// channel, again each time the token expires. The second channel receives nil once logged
+// in, or the error the login failed with, both are closed afterwards. The 2FA password,
+// if enabled, is asked like in Login.
+func (c *Client) LoginQR(ctx context.Context, options ...*LoginOptions) (<-chan string, <-chan error) {
+	urls, errs := make(chan string), make(chan error, 1)
+	go func() {
+		defer close(urls)
+		defer close(errs)
+		if !c.IsConnected() {
+			if err := c.Connect(); err != nil {
+				errs <- err
+				return
+			}
+		}
+		if au, _ := c.IsAuthorized(); au {
+			errs <- nil
+			return
+		}
+		opts := getVariadic(options, &LoginOptions{}).(*LoginOptions)
+		errs <- c.loginQR(ctx, urls, opts, func() (AuthLoginToken, error) {
+			return c.exportLoginToken(nil)
+		})
+	}()
+	return urls, errs
+}
+
+// loginQR runs the loop of LoginQR, export exporting each login token
+func (c *Client) loginQR(ctx context.Context, urls chan<- string, opts *LoginOptions, export func() (AuthLoginToken, error)) error {
+	accepted := make(chan struct{}, 1)
+	h := c.AddRawHandler(&UpdateLoginToken{}, func(update Update, client *Client) error {
+		select {
+		case accepted <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	defer c.removeHandle(h)
+
+	for {
+		token, err := export()
+		if done, err := c.loginWithToken(token, err, opts); done || err != nil {
+			return err
+		}
+		obj, ok := token.(*AuthLoginTokenObj)
+		if !ok {
+			return fmt.Errorf("unexpected login token: %s", reflect.TypeOf(token))
+		}
+		select {
+		case urls <- newQrToken(c, obj, nil).URL():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case <-accepted:
+		case <-time.After(time.Until(time.Unix(int64(obj.Expires), 0))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 }
 
 // Logs out from the current account
@@ -591,7 +688,49 @@ func bigExp(x, y, m *big.Int) *big.Int {
 	return new(big.Int).Exp(x, y, m)
 }
 
-func dhHandshakeCheckConfigIsError(_ int32, _ []byte) bool {
+// safePrimes holds the p values already checked to be safe primes, the check being slow
+var safePrimes sync.Map
+
+// dhHandshakeCheckConfigIsError reports whether p is not a 2048 bit safe prime or g
+// does not generate a cyclic subgroup of prime order (p-1)/2, see
+// https://core.telegram.org/mtproto/auth_key#presenting-proof-of-work-server-authentication
+func dhHandshakeCheckConfigIsError(g int32, pBytes []byte) bool {
+	p := bytesToBig(pBytes)
+	if p.BitLen() != 2048 || !checkGenerator(g, p) {
+		return true
+	}
+	if _, ok := safePrimes.Load(string(pBytes)); ok {
+		return false
+	}
+	q := new(big.Int).Rsh(p, 1)
+	if !p.ProbablyPrime(30) || !q.ProbablyPrime(30) {
+		return true
+	}
+	safePrimes.Store(string(pBytes), true)
+	return false
+}
+
+func checkGenerator(g int32, p *big.Int) bool {
+	mod := func(m int64) int64 {
+		return new(big.Int).Mod(p, big.NewInt(m)).Int64()
+	}
+	switch g {
+	case 2:
+		return mod(8) == 7
+	case 3:
+		return mod(3) == 2
+	case 4:
+		return true
+	case 5:
+		r := mod(5)
+		return r == 1 || r == 4
+	case 6:
+		r := mod(24)
+		return r == 19 || r == 23
+	case 7:
+		r := mod(7)
+		return r == 3 || r == 5 || r == 6
+	}
 	return false
 }
 
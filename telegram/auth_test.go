@@ -0,0 +1,160 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// rfc3526Prime is the 2048 bit safe prime of RFC 3526, generated by 2
+var rfc3526Prime = strings.Join([]string{
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1",
+	"29024E088A67CC74020BBEA63B139B22514A08798E3404DD",
+	"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245",
+	"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED",
+	"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D",
+	"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F",
+	"83655D23DCA3AD961C62F356208552BB9ED529077096966D",
+	"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B",
+	"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9",
+	"DE2BCBF6955817183995497CEA956AE515D2261898FA0510",
+	"15728E5A8AACAA68FFFFFFFFFFFFFFFF",
+}, "")
+
+// TestSRPPassword checks the answer to the SRP challenge against the server side computation
+func TestSRPPassword(t *testing.T) {
+	pBytes, _ := hex.DecodeString(rfc3526Prime)
+	mp := &ModPow{Salt1: []byte("salt1"), Salt2: []byte("salt2"), G: 2, P: pBytes}
+	p, g := bytesToBig(pBytes), big.NewInt(2)
+
+	// the server stores v = g^x and sends B = k*v + g^b
+	v := bytesToBig(computeDigest(&PasswordKdfAlgoSHA256SHA256Pbkdf2Hmacsha512Iter100000SHA256ModPow{
+		Salt1: mp.Salt1, Salt2: mp.Salt2, G: mp.G, P: mp.P,
+	}, "hunter2"))
+	b := bytesToBig(bytes.Repeat([]byte{7}, 256))
+	k := bytesToBig(calcSHA256(pBytes, pad256(g.Bytes())))
+	srpB := pad256(new(big.Int).Mod(new(big.Int).Add(new(big.Int).Mul(k, v), bigExp(g, b, p)), p).Bytes())
+
+	expectedM1 := func(ga []byte) []byte {
+		u := bytesToBig(calcSHA256(ga, srpB))
+		s := bigExp(new(big.Int).Mul(bytesToBig(ga), bigExp(v, u, p)), b, p)
+		return calcSHA256(
+			BytesXor(calcSHA256(pBytes), calcSHA256(pad256(g.Bytes()))),
+			calcSHA256(mp.Salt1),
+			calcSHA256(mp.Salt2),
+			ga,
+			srpB,
+			calcSHA256(pad256(s.Bytes())),
+		)
+	}
+
+	answer, err := GetInputCheckPasswordAlgo("hunter2", srpB, mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(answer.M1, expectedM1(answer.GA)) {
+		t.Error("M1 of the right password does not match")
+	}
+	answer, err = GetInputCheckPasswordAlgo("hunter3", srpB, mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(answer.M1, expectedM1(answer.GA)) {
+		t.Error("M1 of a wrong password matches")
+	}
+}
+
+func TestDHConfigCheck(t *testing.T) {
+	pBytes, _ := hex.DecodeString(rfc3526Prime)
+	if dhHandshakeCheckConfigIsError(2, pBytes) {
+		t.Error("safe prime with generator 2 rejected")
+	}
+	if !dhHandshakeCheckConfigIsError(9, pBytes) {
+		t.Error("generator 9 accepted")
+	}
+	notPrime := append([]byte{}, pBytes...)
+	notPrime[255] -= 2
+	if !dhHandshakeCheckConfigIsError(4, notPrime) {
+		t.Error("composite p accepted")
+	}
+}
+
+func TestLoginQR(t *testing.T) {
+	client, err := NewClient(ClientConfig{AppID: 1, AppHash: "hash", MemorySession: true, LogLevel: LogError})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// two expired tokens, then the second one accepted
+	expired := int32(time.Now().Unix())
+	tokens := []AuthLoginToken{
+		&AuthLoginTokenObj{Token: []byte("a"), Expires: expired},
+		&AuthLoginTokenObj{Token: []byte("b"), Expires: expired},
+		&AuthLoginTokenSuccess{Authorization: &AuthAuthorizationObj{User: &UserObj{ID: 1}}},
+	}
+	export := func() (AuthLoginToken, error) {
+		token := tokens[0]
+		tokens = tokens[1:]
+		return token, nil
+	}
+	urls := make(chan string, 2)
+	if err := client.loginQR(context.Background(), urls, &LoginOptions{}, export); err != nil {
+		t.Fatal(err)
+	}
+	close(urls)
+	var got []string
+	for url := range urls {
+		got = append(got, url)
+	}
+	if len(got) != 2 || got[0] != "tg://login?token=YQ" || got[1] != "tg://login?token=Yg" {
+		t.Errorf("expected the URL of each token, got %v", got)
+	}
+}
+
+func TestLoginQRPassword(t *testing.T) {
+	client, err := NewClient(ClientConfig{AppID: 1, AppHash: "hash", MemorySession: true, LogLevel: LogError})
+	if err != nil {
+		t.Fatal(err)
+	}
+	export := func() (AuthLoginToken, error) {
+		return nil, &RPCError{Code: 401, Message: "SESSION_PASSWORD_NEEDED"}
+	}
+	asked := false
+	opts := &LoginOptions{PasswordCallback: func() (string, error) {
+		asked = true
+		return "cancel", nil
+	}}
+	err = client.loginQR(context.Background(), make(chan string), opts, export)
+	if !asked || err == nil || err.Error() != "Login canceled" {
+		t.Errorf("expected the 2FA password to be asked like in Login, got %v (asked: %v)", err, asked)
+	}
+}
+
+func TestLoginQRCanceled(t *testing.T) {
+	client, err := NewClient(ClientConfig{AppID: 1, AppHash: "hash", MemorySession: true, LogLevel: LogError})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	export := func() (AuthLoginToken, error) {
+		return &AuthLoginTokenObj{Token: []byte("a"), Expires: int32(time.Now().Add(time.Minute).Unix())}, nil
+	}
+	urls := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() { done <- client.loginQR(ctx, urls, &LoginOptions{}, export) }()
+	<-urls
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the login didn't stop with its context")
+	}
+}
@@ -4,6 +4,10 @@ package telegram
 
 import "github.com/pkg/errors"
 
+// ErrQueryIDInvalid is returned when answering a query that expired or was already answered,
+// telegram only accepts answers in the first seconds after the query
+var ErrQueryIDInvalid = errors.New("QUERY_ID_INVALID: the query expired or was already answered")
+
 type InlineSendOptions struct {
 	Gallery      bool   `json:"gallery,omitempty"`
 	NextOffset   string `json:"next_offset,omitempty"`
@@ -32,45 +36,148 @@ func (c *Client) AnswerInlineQuery(QueryID int64, Results []InputBotInlineResult
 	}
 	resp, err := c.MessagesSetInlineBotResults(request)
 	if err != nil {
-		return false, err
+		return false, queryIDInvalid(err)
 	}
 	return resp, nil
 }
 
 type CallbackOptions struct {
-	Alert     bool   `json:"alert,omitempty"`
-	CacheTime int32  `json:"cache_time,omitempty"`
-	URL       string `json:"url,omitempty"`
+	// Alert shows the text in an alert the user must close rather than a toast
+	Alert bool `json:"alert,omitempty"`
+	// CacheTime is for how many seconds clients may cache the answer
+	CacheTime int32 `json:"cache_time,omitempty"`
+	// URL is opened by the client, a game URL or a t.me link starting the bot
+	URL string `json:"url,omitempty"`
 }
 
+// AnswerCallbackQuery answers a callback query, showing Text to the user as a toast, an
+// alert or, with an empty Text, only stopping the loading spinner of the button.
+// Returns ErrQueryIDInvalid if the query expired.
+// This method is a wrapper for messages.setBotCallbackAnswer.
 func (c *Client) AnswerCallbackQuery(QueryID int64, Text string, Opts ...*CallbackOptions) (bool, error) {
 	options := getVariadic(Opts, &CallbackOptions{}).(*CallbackOptions)
-	request := &MessagesSetBotCallbackAnswerParams{
-		QueryID: QueryID,
-		Message: Text,
-		Alert:   options.Alert,
+	resp, err := c.MessagesSetBotCallbackAnswer(&MessagesSetBotCallbackAnswerParams{
+		QueryID:   QueryID,
+		Message:   Text,
+		Alert:     options.Alert,
+		URL:       options.URL,
+		CacheTime: options.CacheTime,
+	})
+	if err != nil {
+		return false, queryIDInvalid(err)
+	}
+	return resp, nil
+}
+
+// queryIDInvalid maps QUERY_ID_INVALID to ErrQueryIDInvalid
+func queryIDInvalid(err error) error {
+	if matchRPCError(err, "QUERY_ID_INVALID") {
+		return errors.Wrap(ErrQueryIDInvalid, err.Error())
+	}
+	return err
+}
+
+// BOT COMMANDS
+
+// CommandScopeType is the set of users a command list is shown to
+type CommandScopeType int
+
+const (
+	// ScopeDefault applies to every chat without a more specific command list
+	ScopeDefault CommandScopeType = iota
+	// ScopeUsers applies to every private chat
+	ScopeUsers
+	// ScopeChats applies to every group and supergroup
+	ScopeChats
+	// ScopeChatAdmins applies to the admins of every group and supergroup
+	ScopeChatAdmins
+	// ScopePeer applies to a single chat, CommandScope.Peer
+	ScopePeer
+	// ScopePeerAdmins applies to the admins of a single group, CommandScope.Peer
+	ScopePeerAdmins
+	// ScopePeerUser applies to a single member, CommandScope.User, of a group, CommandScope.Peer
+	ScopePeerUser
+)
+
+// CommandScope tells who a command list is for, a nil scope being ScopeDefault
+type CommandScope struct {
+	Type CommandScopeType
+	// Peer is the chat of the ScopePeer, ScopePeerAdmins and ScopePeerUser scopes
+	Peer interface{}
+	// User is the member of the ScopePeerUser scope
+	User interface{}
+}
+
+// botCommandScope resolves the peers of scope into a BotCommandScope
+func (c *Client) botCommandScope(scope *CommandScope) (BotCommandScope, error) {
+	if scope == nil {
+		return &BotCommandScopeDefault{}, nil
 	}
-	if options.URL != "" {
-		request.URL = options.URL
+	switch scope.Type {
+	case ScopeDefault:
+		return &BotCommandScopeDefault{}, nil
+	case ScopeUsers:
+		return &BotCommandScopeUsers{}, nil
+	case ScopeChats:
+		return &BotCommandScopeChats{}, nil
+	case ScopeChatAdmins:
+		return &BotCommandScopeChatAdmins{}, nil
 	}
-	if options.CacheTime != 0 {
-		request.CacheTime = options.CacheTime
+	peer, err := c.GetSendablePeer(scope.Peer)
+	if err != nil {
+		return nil, err
 	}
-	resp, err := c.MessagesSetBotCallbackAnswer(request)
+	switch scope.Type {
+	case ScopePeer:
+		return &BotCommandScopePeer{Peer: peer}, nil
+	case ScopePeerAdmins:
+		return &BotCommandScopePeerAdmins{Peer: peer}, nil
+	case ScopePeerUser:
+		u, err := c.GetSendablePeer(scope.User)
+		if err != nil {
+			return nil, err
+		}
+		user, err := inputUser(u)
+		if err != nil {
+			return nil, err
+		}
+		return &BotCommandScopePeerUser{Peer: peer, UserID: user}, nil
+	}
+	return nil, errors.Errorf("unknown command scope: %d", scope.Type)
+}
+
+// SetBotCommands sets the command list of the bot for the users of scope, speaking
+// langCode. An empty langCode (the default) applies to every user without a list of their language.
+// This method is a wrapper for bots.setBotCommands.
+func (c *Client) SetBotCommands(commands []*BotCommand, scope *CommandScope, langCode ...string) (bool, error) {
+	botScope, err := c.botCommandScope(scope)
 	if err != nil {
 		return false, err
 	}
-	return resp, nil
+	if commands == nil {
+		commands = []*BotCommand{}
+	}
+	return c.BotsSetBotCommands(botScope, getVariadic(langCode, "").(string), commands)
 }
 
-// BOT COMMANDS
+// GetBotCommands returns the command list of the bot for the users of scope, speaking langCode.
+// This method is a wrapper for bots.getBotCommands.
+func (c *Client) GetBotCommands(scope *CommandScope, langCode ...string) ([]*BotCommand, error) {
+	botScope, err := c.botCommandScope(scope)
+	if err != nil {
+		return nil, err
+	}
+	return c.BotsGetBotCommands(botScope, getVariadic(langCode, "").(string))
+}
 
-func (c *Client) SetBotCommands(commands []*BotCommand, scope *BotCommandScope, languageCode ...string) (bool, error) {
-	resp, err := c.BotsSetBotCommands(*scope, getVariadic(languageCode, "en").(string), commands)
+// ResetBotCommands removes the command list of the bot for the users of scope, speaking langCode.
+// This method is a wrapper for bots.resetBotCommands.
+func (c *Client) ResetBotCommands(scope *CommandScope, langCode ...string) (bool, error) {
+	botScope, err := c.botCommandScope(scope)
 	if err != nil {
 		return false, err
 	}
-	return resp, nil
+	return c.BotsResetBotCommands(botScope, getVariadic(langCode, "").(string))
 }
 
 func (c *Client) SetBotDefaultPrivileges(privileges *ChatAdminRights, ForChannels ...bool) (resp bool, err error) {
@@ -83,18 +190,47 @@ func (c *Client) SetBotDefaultPrivileges(privileges *ChatAdminRights, ForChannel
 	return
 }
 
-func (c *Client) SetChatMenuButton(userID int64, button *BotMenuButton) (bool, error) {
-	peer, err := c.GetSendablePeer(userID)
+// SetBotMenuButton sets the menu button of the bot in the private chat with userID, or
+// the default one of every chat when userID is nil. button is a *BotMenuButtonObj opening
+// a web app, &BotMenuButtonCommands{} listing the commands or &BotMenuButtonDefault{}.
+// This method is a wrapper for bots.setBotMenuButton.
+func (c *Client) SetBotMenuButton(userID interface{}, button BotMenuButton) (bool, error) {
+	user, err := c.menuButtonUser(userID)
 	if err != nil {
 		return false, err
 	}
-	peerUser, ok := peer.(*InputPeerUser)
-	if !ok {
-		return false, errors.New("invalid user")
+	return c.BotsSetBotMenuButton(user, button)
+}
+
+// GetBotMenuButton returns the menu button of the bot in the private chat with userID,
+// or the default one when userID is nil.
+// This method is a wrapper for bots.getBotMenuButton.
+func (c *Client) GetBotMenuButton(userID interface{}) (BotMenuButton, error) {
+	user, err := c.menuButtonUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return c.BotsGetBotMenuButton(user)
+}
+
+// SetChatMenuButton sets the menu button of the bot in the private chat with userID.
+//
+// Deprecated: use SetBotMenuButton.
+func (c *Client) SetChatMenuButton(userID int64, button *BotMenuButton) (bool, error) {
+	if button == nil {
+		return false, errors.New("button is nil")
 	}
-	resp, err := c.BotsSetBotMenuButton(&InputUserObj{AccessHash: peerUser.AccessHash, UserID: peerUser.UserID}, *button)
+	return c.SetBotMenuButton(userID, *button)
+}
+
+// menuButtonUser resolves the user of a menu button, nil meaning every user
+func (c *Client) menuButtonUser(userID interface{}) (InputUser, error) {
+	if userID == nil {
+		return &InputUserEmpty{}, nil
+	}
+	peer, err := c.GetSendablePeer(userID)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	return resp, nil
+	return inputUser(peer)
 }
@@ -0,0 +1,51 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestBotCommandScope(t *testing.T) {
+	c := &Client{Cache: NewCache()}
+	chat := &InputPeerChat{ChatID: 10}
+
+	tests := []struct {
+		scope *CommandScope
+		want  BotCommandScope
+	}{
+		{nil, &BotCommandScopeDefault{}},
+		{&CommandScope{Type: ScopeUsers}, &BotCommandScopeUsers{}},
+		{&CommandScope{Type: ScopeChatAdmins}, &BotCommandScopeChatAdmins{}},
+		{&CommandScope{Type: ScopePeer, Peer: chat}, &BotCommandScopePeer{Peer: chat}},
+		{&CommandScope{Type: ScopePeerUser, Peer: chat, User: &InputPeerSelf{}}, &BotCommandScopePeerUser{Peer: chat, UserID: &InputUserSelf{}}},
+	}
+	for _, tt := range tests {
+		got, err := c.botCommandScope(tt.scope)
+		if err != nil {
+			t.Fatalf("botCommandScope(%+v): %v", tt.scope, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("botCommandScope(%+v) = %#v, want %#v", tt.scope, got, tt.want)
+		}
+	}
+
+	if _, err := c.botCommandScope(&CommandScope{Type: ScopePeer}); err == nil {
+		t.Error("botCommandScope without a peer should fail")
+	}
+	if _, err := c.botCommandScope(&CommandScope{Type: ScopePeerUser, Peer: chat, User: chat}); err == nil {
+		t.Error("botCommandScope with a chat as the user should fail")
+	}
+}
+
+func TestQueryIDInvalid(t *testing.T) {
+	err := queryIDInvalid(&RPCError{Code: 400, Message: "QUERY_ID_INVALID"})
+	if !errors.Is(err, ErrQueryIDInvalid) {
+		t.Errorf("queryIDInvalid(QUERY_ID_INVALID) = %v, want ErrQueryIDInvalid", err)
+	}
+	other := &RPCError{Code: 400, Message: "MESSAGE_TOO_LONG"}
+	if err := queryIDInvalid(other); err != other {
+		t.Errorf("queryIDInvalid(MESSAGE_TOO_LONG) = %v, want it unchanged", err)
+	}
+}
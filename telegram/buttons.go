@@ -50,6 +50,16 @@ func (Button) WebView(Text string, URL string) *KeyboardButtonSimpleWebView {
 	return &KeyboardButtonSimpleWebView{Text: Text, URL: URL}
 }
 
+// WebApp opens a web app from an inline keyboard, WebView is its reply keyboard counterpart
+func (Button) WebApp(Text string, URL string) *KeyboardButtonWebView {
+	return &KeyboardButtonWebView{Text: Text, URL: URL}
+}
+
+// Text is a reply keyboard button sending its text when pressed
+func (Button) Text(Text string) *KeyboardButtonObj {
+	return &KeyboardButtonObj{Text: Text}
+}
+
 func (Button) Mention(Text string, UserID int64) *KeyboardButtonUserProfile {
 	return &KeyboardButtonUserProfile{Text: Text, UserID: UserID}
 }
@@ -66,6 +76,90 @@ func (Button) Clear() *ReplyKeyboardHide {
 	return &ReplyKeyboardHide{}
 }
 
+// InlineKeyboard builds the markup of an inline keyboard row by row:
+//
+//	markup := NewInlineKeyboard().
+//		Row(Button{}.URL("Docs", "https://..."), Button{}.Data("Refresh", "refresh")).
+//		Build()
+type InlineKeyboard struct {
+	rows []*KeyboardButtonRow
+}
+
+func NewInlineKeyboard() *InlineKeyboard {
+	return &InlineKeyboard{}
+}
+
+// Row adds a row of buttons, empty rows are skipped
+func (k *InlineKeyboard) Row(Buttons ...KeyboardButton) *InlineKeyboard {
+	if len(Buttons) > 0 {
+		k.rows = append(k.rows, &KeyboardButtonRow{Buttons: Buttons})
+	}
+	return k
+}
+
+// Build returns the markup to set as the ReplyMarkup of send and edit options
+func (k *InlineKeyboard) Build() *ReplyInlineMarkup {
+	return &ReplyInlineMarkup{Rows: k.rows}
+}
+
+// ReplyKeyboard builds the markup of a keyboard replacing the one of the user:
+//
+//	markup := NewReplyKeyboard().
+//		Row(Button{}.Text("Yes"), Button{}.Text("No")).
+//		Row(Button{}.RequestPhone("Share phone")).
+//		Resize().SingleUse().Build()
+type ReplyKeyboard struct {
+	markup ReplyKeyboardMarkup
+}
+
+func NewReplyKeyboard() *ReplyKeyboard {
+	return &ReplyKeyboard{}
+}
+
+// Row adds a row of buttons, empty rows are skipped
+func (k *ReplyKeyboard) Row(Buttons ...KeyboardButton) *ReplyKeyboard {
+	if len(Buttons) > 0 {
+		k.markup.Rows = append(k.markup.Rows, &KeyboardButtonRow{Buttons: Buttons})
+	}
+	return k
+}
+
+// Resize fits the keyboard to its buttons instead of the default keyboard height
+func (k *ReplyKeyboard) Resize() *ReplyKeyboard {
+	k.markup.Resize = true
+	return k
+}
+
+// SingleUse hides the keyboard once a button is pressed
+func (k *ReplyKeyboard) SingleUse() *ReplyKeyboard {
+	k.markup.SingleUse = true
+	return k
+}
+
+// Selective shows the keyboard only to the mentioned users and the sender of the replied message
+func (k *ReplyKeyboard) Selective() *ReplyKeyboard {
+	k.markup.Selective = true
+	return k
+}
+
+// Persistent keeps the keyboard shown while the user's keyboard is hidden
+func (k *ReplyKeyboard) Persistent() *ReplyKeyboard {
+	k.markup.Persistent = true
+	return k
+}
+
+// Placeholder sets the placeholder of the input field while the keyboard is shown
+func (k *ReplyKeyboard) Placeholder(text string) *ReplyKeyboard {
+	k.markup.Placeholder = text
+	return k
+}
+
+// Build returns the markup to set as the ReplyMarkup of send and edit options
+func (k *ReplyKeyboard) Build() *ReplyKeyboardMarkup {
+	markup := k.markup
+	return &markup
+}
+
 // message.Click() is a function that clicks a button in a message.
 //
 // It takes one optional argument, which can be either:
@@ -5,22 +5,24 @@ package telegram
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
-	"os/signal"
 	"runtime"
-	"strconv"
-	"strings"
 	"sync"
-	"syscall"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/roj1512/gogram/internal/utils"
 )
 
 const (
 	// CacheUpdateInterval is the interval in seconds at which the cache is updated
+	//
+	// Deprecated: unused, see ClientConfig.CacheFlushInterval
 	CacheUpdateInterval = 60
+	// DefaultCacheFlushInterval is the default interval at which the cache is flushed to disk
+	DefaultCacheFlushInterval = 80 * time.Second
+	// DefaultFullInfoTTL is how long UserFull and ChannelFull objects are cached unless ClientConfig.FullInfoTTL is set
+	DefaultFullInfoTTL = 5 * time.Minute
 )
 
 type CACHE struct {
@@ -30,78 +32,239 @@ type CACHE struct {
 	channels   map[int64]*Channel
 	InputPeers *InputPeerCache `json:"input_peers,omitempty"`
 	logger     *utils.Logger
+
+	flushInterval time.Duration
+	flushTimer    *time.Timer
+	store         CacheStore
+
+	entryTTL    time.Duration
+	lastUpdated map[cacheEntryKey]time.Time
+	sweepStop   chan struct{} // closed to stop the sweeper, nil when it isn't running
+
+	// userFulls and channelFulls hold the results of GetFullUser and GetFullChannel
+	// for fullTTL, or until an update about the user or channel arrives
+	userFulls    map[int64]*UserFull
+	channelFulls map[int64]*ChannelFull
+	fullTTL      time.Duration
+
+	// origins holds a message each user and channel only known from min objects was seen in
+	origins map[cacheEntryKey]messageOrigin
 }
 
+// cacheEntryKey identifies an object in the cache, ids of users, chats and channels may collide
+type cacheEntryKey struct {
+	kind byte
+	id   int64
+}
+
+const (
+	cacheEntryUser byte = iota
+	cacheEntryChat
+	cacheEntryChannel
+	cacheEntryUserFull
+	cacheEntryChannelFull
+)
+
+// Pin pins the cache and the users, chats and channels it holds at the time of the call.
+// The maps themselves can't be pinned, runtime.Pinner only takes pointers to Go objects
+// (and panics on maps), so they must not be handed to C; entries added after the call
+// are not pinned. Input peers are plain integers and need no pinning.
 func (cache *CACHE) Pin(pinner *runtime.Pinner) {
 	pinner.Pin(cache)
 	pinner.Pin(cache.RWMutex)
 	pinner.Pin(cache.logger)
 	pinner.Pin(cache.InputPeers)
+
+	cache.RLock()
+	defer cache.RUnlock()
+	for _, user := range cache.users {
+		pinner.Pin(user)
+	}
+	for _, chat := range cache.chats {
+		pinner.Pin(chat)
+	}
+	for _, channel := range cache.channels {
+		pinner.Pin(channel)
+	}
 }
 
 type InputPeerCache struct {
 	InputChannels map[int64]int64 `json:"channels,omitempty"`
 	InputUsers    map[int64]int64 `json:"users,omitempty"`
-	InputChats    map[int64]int64 `json:"chats,omitempty"`
+	// InputChats is the set of known basic groups, they have no access hash
+	InputChats map[int64]struct{} `json:"chats,omitempty"`
+}
+
+// UnmarshalJSON merges the peers of data into the cache, it also reads caches
+// written when chats were stored as a map of id to id
+func (p *InputPeerCache) UnmarshalJSON(data []byte) error {
+	var cache struct {
+		InputChannels map[int64]int64 `json:"channels,omitempty"`
+		InputUsers    map[int64]int64 `json:"users,omitempty"`
+		InputChats    json.RawMessage `json:"chats,omitempty"`
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return err
+	}
+	chats := make(map[int64]struct{})
+	if len(cache.InputChats) > 0 {
+		if err := json.Unmarshal(cache.InputChats, &chats); err != nil {
+			var legacy map[int64]int64
+			if err := json.Unmarshal(cache.InputChats, &legacy); err != nil {
+				return err
+			}
+			for id := range legacy {
+				chats[id] = struct{}{}
+			}
+		}
+	}
+	if p.InputChannels == nil {
+		p.InputChannels = make(map[int64]int64)
+	}
+	if p.InputUsers == nil {
+		p.InputUsers = make(map[int64]int64)
+	}
+	if p.InputChats == nil {
+		p.InputChats = make(map[int64]struct{})
+	}
+	for id, hash := range cache.InputChannels {
+		p.InputChannels[id] = hash
+	}
+	for id, hash := range cache.InputUsers {
+		p.InputUsers[id] = hash
+	}
+	for id := range chats {
+		p.InputChats[id] = struct{}{}
+	}
+	return nil
+}
+
+// CacheStore persists the marshalled cache, the default store of a client writes to the
+// file at ClientConfig.CachePath
+type CacheStore interface {
+	Save(data []byte) error
+	// Load returns the saved cache, or nil data if nothing was saved yet
+	Load() ([]byte, error)
+}
+
+// fileCacheStore is the default CacheStore, backed by a file on the local filesystem
+type fileCacheStore struct {
+	path string
 }
 
-func (c *CACHE) flushToFile() {
+// NewFileCacheStore returns a CacheStore that persists the cache to the file at path
+func NewFileCacheStore(path string) CacheStore {
+	return &fileCacheStore{path: path}
+}
+
+func (f *fileCacheStore) Save(data []byte) error {
+	file, err := os.Create(f.path)
+	if err != nil {
+		return errors.Wrap(err, "creating "+f.path)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return errors.Wrap(err, "writing "+f.path)
+	}
+	return errors.Wrap(file.Close(), "closing "+f.path)
+}
+
+func (f *fileCacheStore) Load() ([]byte, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// cache file doesn't exist, this is not an error
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "reading "+f.path)
+	}
+	return data, nil
+}
+
+// SetStore sets the backend the cache is persisted to
+func (c *CACHE) SetStore(store CacheStore) {
 	c.Lock()
 	defer c.Unlock()
+	c.store = store
+}
+
+func (c *CACHE) getStore() CacheStore {
+	if c.store == nil {
+		c.store = NewFileCacheStore("cache.journal")
+	}
+	return c.store
+}
+
+// Flush writes the cache to its store now, Client.Stop calls it before disconnecting
+func (c *CACHE) Flush() error {
+	c.Lock()
+	defer c.Unlock()
+	defer c.scheduleFlush()
 
 	data, err := json.Marshal(c)
 	if err != nil {
-		c.logger.Error("Error while marshalling cache: ", err)
-		return
+		return errors.Wrap(err, "marshalling cache")
 	}
+	return errors.Wrap(c.getStore().Save(data), "saving cache")
+}
 
-	file, err := os.Create("cache.journal")
-	if err != nil {
-		c.logger.Error("Error while creating cache.journal: ", err)
-		return
+func (c *CACHE) flush() {
+	if err := c.Flush(); err != nil {
+		c.logger.Error("Error while flushing cache: ", err)
 	}
+}
 
-	if _, err := io.WriteString(file, string(data)); err != nil {
-		c.logger.Error("Error while writing cache.journal: ", err)
-		return
+// stopFlushing stops the periodic flush, reporting whether the cache was being persisted
+func (c *CACHE) stopFlushing() bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.flushTimer == nil {
+		return false
 	}
-	if err := file.Close(); err != nil {
-		c.logger.Error("Error while closing cache.journal: ", err)
-		return
+	c.flushTimer.Stop()
+	c.flushTimer = nil
+	return true
+}
+
+// scheduleFlush re-arms the flush timer, callers must hold the lock
+func (c *CACHE) scheduleFlush() {
+	if c.flushTimer != nil {
+		c.flushTimer.Reset(c.getFlushInterval())
 	}
-	go time.AfterFunc(80*time.Second, c.flushToFile)
 }
 
-func (c *CACHE) loadFromFile() {
-	file, err := os.Open("cache.journal")
-	if err != nil {
-		if os.IsNotExist(err) {
-			// cache file doesn't exist, this is not an error
-			return
-		}
-		c.logger.Error("Error while opening cache.journal: ", err)
-		return
+func (c *CACHE) getFlushInterval() time.Duration {
+	if c.flushInterval <= 0 {
+		return DefaultCacheFlushInterval
 	}
-	defer file.Close()
+	return c.flushInterval
+}
 
-	stat, err := file.Stat()
+// SetFlushInterval sets the interval at which the cache is flushed to disk,
+// a running flush timer picks up the new interval immediately
+func (c *CACHE) SetFlushInterval(interval time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.flushInterval = interval
+	c.scheduleFlush()
+}
+
+func (c *CACHE) load() {
+	c.Lock()
+	defer c.Unlock()
+
+	data, err := c.getStore().Load()
 	if err != nil {
-		c.logger.Error("Error while getting cache.journal file info: ", err)
+		c.logger.Error("Error while loading cache: ", err)
 		return
 	}
-	if stat.Size() == 0 {
-		// empty cache file, nothing to load
-		return
-	}
-
-	data := make([]byte, stat.Size())
-	if _, err := io.ReadFull(file, data); err != nil {
-		c.logger.Error("Error while reading cache.journal: ", err)
+	if len(data) == 0 {
+		// empty cache, nothing to load
 		return
 	}
 
 	if err := json.Unmarshal(data, c); err != nil {
-		c.logger.Error("Error while unmarshalling cache.journal: ", err)
+		c.logger.Error("Error while unmarshalling cache: ", err)
 		return
 	}
 }
@@ -120,8 +283,6 @@ func (c *CACHE) ImportJSON(data []byte) error {
 	return json.Unmarshal(data, c.InputPeers)
 }
 
-var cache = NewCache()
-
 func NewCache() *CACHE {
 	c := &CACHE{
 		RWMutex:  &sync.RWMutex{},
@@ -131,9 +292,14 @@ func NewCache() *CACHE {
 		InputPeers: &InputPeerCache{
 			InputChannels: make(map[int64]int64),
 			InputUsers:    make(map[int64]int64),
-			InputChats:    make(map[int64]int64),
+			InputChats:    make(map[int64]struct{}),
 		},
-		logger: utils.NewLogger("cache").SetLevel(LIB_LOG_LEVEL),
+		logger:       utils.NewLogger("cache").SetLevel(LIB_LOG_LEVEL),
+		lastUpdated:  make(map[cacheEntryKey]time.Time),
+		userFulls:    make(map[int64]*UserFull),
+		channelFulls: make(map[int64]*ChannelFull),
+		fullTTL:      DefaultFullInfoTTL,
+		origins:      make(map[cacheEntryKey]messageOrigin),
 	}
 	c.logger.Debug("Cache initialized successfully")
 
@@ -141,66 +307,74 @@ func NewCache() *CACHE {
 }
 
 func (c *CACHE) startCacheFileUpdater() {
-	c.loadFromFile()
-	go c.writeOnKill()
-	go time.AfterFunc(80*time.Second, c.flushToFile)
+	c.load()
+	c.startFlushing()
 }
 
-func (c *CACHE) writeOnKill() {
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
-
-	sig := <-signals
-	c.logger.Debug("\nReceived signal: " + sig.String() + ", flushing cache to file and exiting...\n")
-	c.flushToFile()
+// startFlushing starts the periodic flush, unless it's running
+func (c *CACHE) startFlushing() {
+	c.Lock()
+	defer c.Unlock()
+	if c.flushTimer == nil {
+		c.flushTimer = time.AfterFunc(c.getFlushInterval(), c.flush)
+	}
 }
 
 func (c *CACHE) getUserPeer(userID int64) (InputUser, error) {
-	for userId, accessHash := range c.InputPeers.InputUsers {
-		if userId == userID {
-			return &InputUserObj{UserID: userId, AccessHash: accessHash}, nil
-		}
+	c.RLock()
+	defer c.RUnlock()
+	if peer, ok := c.peerFromMessage(cacheEntryKey{cacheEntryUser, userID}); ok {
+		return &InputUserFromMessage{Peer: peer.Peer, MsgID: peer.MsgID, UserID: userID}, nil
+	}
+	if accessHash, ok := c.InputPeers.InputUsers[userID]; ok {
+		return &InputUserObj{UserID: userID, AccessHash: accessHash}, nil
 	}
 	return nil, fmt.Errorf("no user with id %d or missing from cache", userID)
 }
 
 func (c *CACHE) getChannelPeer(channelID int64) (InputChannel, error) {
-	for channelId, channelHash := range c.InputPeers.InputChannels {
-		if channelId == channelID {
-			return &InputChannelObj{ChannelID: channelId, AccessHash: channelHash}, nil
-		}
+	c.RLock()
+	defer c.RUnlock()
+	if peer, ok := c.peerFromMessage(cacheEntryKey{cacheEntryChannel, channelID}); ok {
+		return &InputChannelFromMessage{Peer: peer.Peer, MsgID: peer.MsgID, ChannelID: channelID}, nil
+	}
+	if channelHash, ok := c.InputPeers.InputChannels[channelID]; ok {
+		return &InputChannelObj{ChannelID: channelID, AccessHash: channelHash}, nil
 	}
 	return nil, fmt.Errorf("no channel with id %d or missing from cache", channelID)
 }
 
 func (c *CACHE) GetInputPeer(peerID int64) (InputPeer, error) {
-	// if peerID is negative, it is a channel or a chat
-	if strings.HasPrefix(strconv.Itoa(int(peerID)), "-100") {
-		// remove -100 from peerID
-		peerIdStr := strconv.Itoa(int(peerID))
-		peerIdStr = strings.TrimPrefix(peerIdStr, "-100")
-		peerIdInt, err := strconv.Atoi(peerIdStr)
-		if err != nil {
-			return nil, err
-		}
-		peerID = int64(peerIdInt)
-	}
 	c.RLock()
 	defer c.RUnlock()
-	for userId, userHash := range c.InputPeers.InputUsers {
-		if userId == peerID {
-			return &InputPeerUser{userId, userHash}, nil
+	// negative ids are bot API style channel or chat ids
+	switch {
+	case IsChannelID(peerID):
+		channelID := PeerIDToChannelID(peerID)
+		if peer, ok := c.channelFromMessage(channelID); ok {
+			return peer, nil
 		}
-	}
-	for chatId := range c.InputPeers.InputChats {
-		if chatId == peerID {
-			return &InputPeerChat{ChatID: chatId}, nil
+		if channelHash, ok := c.InputPeers.InputChannels[channelID]; ok {
+			return &InputPeerChannel{channelID, channelHash}, nil
 		}
-	}
-	for channelId, channelHash := range c.InputPeers.InputChannels {
-		if channelId == peerID {
-			return &InputPeerChannel{channelId, channelHash}, nil
+		return nil, fmt.Errorf("there is no channel with id %d or missing from cache", channelID)
+	case IsChatID(peerID):
+		if _, ok := c.InputPeers.InputChats[-peerID]; ok {
+			return &InputPeerChat{ChatID: -peerID}, nil
 		}
+		return nil, fmt.Errorf("there is no chat with id %d or missing from cache", -peerID)
+	}
+	if peer, ok := c.userFromMessage(peerID); ok {
+		return peer, nil
+	}
+	if userHash, ok := c.InputPeers.InputUsers[peerID]; ok {
+		return &InputPeerUser{peerID, userHash}, nil
+	}
+	if _, ok := c.InputPeers.InputChats[peerID]; ok {
+		return &InputPeerChat{ChatID: peerID}, nil
+	}
+	if channelHash, ok := c.InputPeers.InputChannels[peerID]; ok {
+		return &InputPeerChannel{peerID, channelHash}, nil
 	}
 	return nil, fmt.Errorf("there is no peer with id %d or missing from cache", peerID)
 }
@@ -209,11 +383,10 @@ func (c *CACHE) GetInputPeer(peerID int64) (InputPeer, error) {
 
 func (c *Client) getUserFromCache(userID int64) (*UserObj, error) {
 	c.Cache.RLock()
-	defer c.Cache.RUnlock()
-	for _, user := range c.Cache.users {
-		if user.ID == userID {
-			return user, nil
-		}
+	user, ok := c.Cache.users[userID]
+	c.Cache.RUnlock()
+	if ok {
+		return user, nil
 	}
 	userPeer, err := c.Cache.getUserPeer(userID)
 	if err != nil {
@@ -226,21 +399,20 @@ func (c *Client) getUserFromCache(userID int64) (*UserObj, error) {
 	if len(users) == 0 {
 		return nil, fmt.Errorf("no user with id %d", userID)
 	}
-	user, ok := users[0].(*UserObj)
+	user, ok = users[0].(*UserObj)
 	if !ok {
 		return nil, fmt.Errorf("no user with id %d", userID)
 	}
+	c.Cache.UpdateUser(user)
 	return user, nil
 }
 
 func (c *Client) getChannelFromCache(channelID int64) (*Channel, error) {
 	c.Cache.RLock()
-	defer c.Cache.RUnlock()
-
-	for _, channel := range c.Cache.channels {
-		if channel.ID == channelID {
-			return channel, nil
-		}
+	channel, ok := c.Cache.channels[channelID]
+	c.Cache.RUnlock()
+	if ok {
+		return channel, nil
 	}
 	channelPeer, err := c.Cache.getChannelPeer(channelID)
 	if err != nil {
@@ -257,20 +429,20 @@ func (c *Client) getChannelFromCache(channelID int64) (*Channel, error) {
 	if len(channelsObj.Chats) == 0 {
 		return nil, fmt.Errorf("no channel with id %d or missing from cache", channelID)
 	}
-	channel, ok := channelsObj.Chats[0].(*Channel)
+	channel, ok = channelsObj.Chats[0].(*Channel)
 	if !ok {
 		return nil, fmt.Errorf("no channel with id %d or missing from cache", channelID)
 	}
+	c.Cache.UpdateChannel(channel)
 	return channel, nil
 }
 
 func (c *Client) getChatFromCache(chatID int64) (*ChatObj, error) {
 	c.Cache.RLock()
-	defer c.Cache.RUnlock()
-	for _, chat := range c.Cache.chats {
-		if chat.ID == chatID {
-			return chat, nil
-		}
+	chatObj, ok := c.Cache.chats[chatID]
+	c.Cache.RUnlock()
+	if ok {
+		return chatObj, nil
 	}
 	chat, err := c.MessagesGetChats([]int64{chatID})
 	if err != nil {
@@ -283,13 +455,47 @@ func (c *Client) getChatFromCache(chatID int64) (*ChatObj, error) {
 	if len(chatsObj.Chats) == 0 {
 		return nil, fmt.Errorf("no chat with id %d or missing from cache", chatID)
 	}
-	chatObj, ok := chatsObj.Chats[0].(*ChatObj)
+	chatObj, ok = chatsObj.Chats[0].(*ChatObj)
 	if !ok {
 		return nil, fmt.Errorf("no chat with id %d or missing from cache", chatID)
 	}
+	c.Cache.UpdateChat(chatObj)
 	return chatObj, nil
 }
 
+// GetInputPeer returns the InputPeer of a user, or of a chat or channel by its bot API
+// style (negative) ID. On a cache miss the peer is fetched from telegram and cached,
+// with a zero access hash that works for peers the account has seen; positive IDs
+// are fetched as users.
+func (c *Client) GetInputPeer(peerID int64) (InputPeer, error) {
+	peer, cacheErr := c.Cache.GetInputPeer(peerID)
+	if cacheErr == nil {
+		return peer, nil
+	}
+	switch {
+	case IsChannelID(peerID):
+		channelID := PeerIDToChannelID(peerID)
+		resp, err := c.ChannelsGetChannels([]InputChannel{&InputChannelObj{ChannelID: channelID}})
+		if err != nil {
+			return nil, errors.Wrap(err, cacheErr.Error())
+		}
+		if chats, ok := resp.(*MessagesChatsObj); ok {
+			c.Cache.UpdatePeersToCache(nil, chats.Chats)
+		}
+	case IsChatID(peerID):
+		if _, err := c.getChatFromCache(-peerID); err != nil {
+			return nil, errors.Wrap(err, cacheErr.Error())
+		}
+	default:
+		users, err := c.UsersGetUsers([]InputUser{&InputUserObj{UserID: peerID}})
+		if err != nil {
+			return nil, errors.Wrap(err, cacheErr.Error())
+		}
+		c.Cache.UpdatePeersToCache(users, nil)
+	}
+	return c.Cache.GetInputPeer(peerID)
+}
+
 // ----------------- Get User/Channel/Chat from cache -----------------
 
 func (c *Client) GetUser(userID int64) (*UserObj, error) {
@@ -321,48 +527,319 @@ func (c *Client) GetChat(chatID int64) (*ChatObj, error) {
 func (c *CACHE) UpdateUser(user *UserObj) {
 	c.Lock()
 	defer c.Unlock()
-
-	c.users[user.ID] = user
-	c.InputPeers.InputUsers[user.ID] = user.AccessHash
+	c.updateUser(user, time.Now())
 }
 
 func (c *CACHE) UpdateChannel(channel *Channel) {
 	c.Lock()
 	defer c.Unlock()
-
-	c.channels[channel.ID] = channel
-	c.InputPeers.InputChannels[channel.ID] = channel.AccessHash
+	c.updateChannel(channel, time.Now())
 }
 
 func (c *CACHE) UpdateChat(chat *ChatObj) {
 	c.Lock()
 	defer c.Unlock()
+	c.updateChat(chat, time.Now())
+}
+
+// updateUser, updateChannel and updateChat are called with the cache locked.
+// The access hash of a min user or channel only works in the context it was sent
+// in, it is only stored when none is known and doesn't replace a full object.
 
+func (c *CACHE) updateUser(user *UserObj, now time.Time) {
+	if user.Min {
+		if cached, ok := c.users[user.ID]; ok && !cached.Min {
+			return
+		}
+		if _, ok := c.InputPeers.InputUsers[user.ID]; !ok {
+			c.InputPeers.InputUsers[user.ID] = user.AccessHash
+		}
+	} else {
+		delete(c.origins, cacheEntryKey{cacheEntryUser, user.ID})
+		c.InputPeers.InputUsers[user.ID] = user.AccessHash
+	}
+	c.users[user.ID] = user
+	c.touch(cacheEntryKey{cacheEntryUser, user.ID}, now)
+}
+
+func (c *CACHE) updateChannel(channel *Channel, now time.Time) {
+	if channel.Min {
+		if cached, ok := c.channels[channel.ID]; ok && !cached.Min {
+			return
+		}
+		if _, ok := c.InputPeers.InputChannels[channel.ID]; !ok {
+			c.InputPeers.InputChannels[channel.ID] = channel.AccessHash
+		}
+	} else {
+		delete(c.origins, cacheEntryKey{cacheEntryChannel, channel.ID})
+		c.InputPeers.InputChannels[channel.ID] = channel.AccessHash
+	}
+	c.channels[channel.ID] = channel
+	c.touch(cacheEntryKey{cacheEntryChannel, channel.ID}, now)
+}
+
+func (c *CACHE) updateChat(chat *ChatObj, now time.Time) {
 	c.chats[chat.ID] = chat
-	c.InputPeers.InputChats[chat.ID] = chat.ID
+	c.touch(cacheEntryKey{cacheEntryChat, chat.ID}, now)
+	c.InputPeers.InputChats[chat.ID] = struct{}{}
+}
+
+// touch records when a user, chat or channel was updated, only needed to expire it
+func (c *CACHE) touch(key cacheEntryKey, now time.Time) {
+	if c.entryTTL > 0 {
+		c.lastUpdated[key] = now
+	}
+}
+
+// Len returns the number of user, chat and channel objects in the cache
+func (c *CACHE) Len() int {
+	c.RLock()
+	defer c.RUnlock()
+	return len(c.users) + len(c.chats) + len(c.channels)
+}
+
+// SetEntryTTL sets how long user, chat and channel objects are kept in the cache,
+// a background sweeper evicts them once expired. Input peers (access hashes) are never evicted.
+// A zero ttl disables eviction, the objects already cached expire a ttl after it's enabled.
+func (c *CACHE) SetEntryTTL(ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	expiring := c.entryTTL > 0
+	c.entryTTL = ttl
+	switch {
+	case ttl > 0 && !expiring:
+		now := time.Now()
+		for id := range c.users {
+			c.touch(cacheEntryKey{cacheEntryUser, id}, now)
+		}
+		for id := range c.chats {
+			c.touch(cacheEntryKey{cacheEntryChat, id}, now)
+		}
+		for id := range c.channels {
+			c.touch(cacheEntryKey{cacheEntryChannel, id}, now)
+		}
+	case ttl <= 0:
+		// only the full objects need their time without a ttl
+		for key := range c.lastUpdated {
+			if key.kind != cacheEntryUserFull && key.kind != cacheEntryChannelFull {
+				delete(c.lastUpdated, key)
+			}
+		}
+	}
+	c.runSweeper()
+}
+
+// runSweeper starts the sweeper when entries expire, unless it's running; callers must hold the lock
+func (c *CACHE) runSweeper() {
+	if c.entryTTL > 0 && c.sweepStop == nil {
+		c.sweepStop = make(chan struct{})
+		go c.sweepExpired(c.sweepStop)
+	}
+}
+
+// startSweeping restarts the sweeper stopped by stopSweeping, when entries expire
+func (c *CACHE) startSweeping() {
+	c.Lock()
+	defer c.Unlock()
+	c.runSweeper()
+}
+
+// stopSweeping stops the sweeper, reporting whether it was running
+func (c *CACHE) stopSweeping() bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.sweepStop == nil {
+		return false
+	}
+	close(c.sweepStop)
+	c.sweepStop = nil
+	return true
+}
+
+func (c *CACHE) sweepExpired(stop chan struct{}) {
+	for {
+		c.Lock()
+		ttl := c.entryTTL
+		if ttl <= 0 {
+			if c.sweepStop == stop {
+				c.sweepStop = nil
+			}
+			c.Unlock()
+			return
+		}
+		c.Unlock()
+		timer := time.NewTimer(max(ttl/2, time.Second))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		c.evictExpired(time.Now())
+	}
+}
+
+// evictExpired removes users, chats and channels last updated more than entryTTL before
+// now, and UserFull and ChannelFull objects older than fullTTL
+func (c *CACHE) evictExpired(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	if c.entryTTL <= 0 {
+		return
+	}
+	var evicted int
+	for key, updated := range c.lastUpdated {
+		ttl := c.entryTTL
+		if key.kind == cacheEntryUserFull || key.kind == cacheEntryChannelFull {
+			ttl = c.fullTTL
+		}
+		if now.Sub(updated) < ttl {
+			continue
+		}
+		switch key.kind {
+		case cacheEntryUser:
+			delete(c.users, key.id)
+		case cacheEntryChat:
+			delete(c.chats, key.id)
+		case cacheEntryChannel:
+			delete(c.channels, key.id)
+		case cacheEntryUserFull:
+			delete(c.userFulls, key.id)
+		case cacheEntryChannelFull:
+			delete(c.channelFulls, key.id)
+		}
+		delete(c.lastUpdated, key)
+		evicted++
+	}
+	if evicted > 0 {
+		c.logger.Debug(fmt.Sprintf("evicted %d expired entries from cache", evicted))
+	}
+}
+
+// SetFullInfoTTL sets how long UserFull and ChannelFull objects are cached, zero disables caching them
+func (c *CACHE) SetFullInfoTTL(ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.fullTTL = ttl
+}
+
+// fullFresh reports whether the full object of key was cached less than fullTTL before now,
+// forgetting it otherwise; called with the cache locked
+func (c *CACHE) fullFresh(key cacheEntryKey, now time.Time) bool {
+	updated, ok := c.lastUpdated[key]
+	if ok && now.Sub(updated) < c.fullTTL {
+		return true
+	}
+	c.forgetFull(key)
+	return false
+}
+
+func (c *CACHE) forgetFull(key cacheEntryKey) {
+	switch key.kind {
+	case cacheEntryUserFull:
+		delete(c.userFulls, key.id)
+	case cacheEntryChannelFull:
+		delete(c.channelFulls, key.id)
+	}
+	delete(c.lastUpdated, key)
+}
+
+func (c *CACHE) getUserFull(userID int64, now time.Time) (*UserFull, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if !c.fullFresh(cacheEntryKey{cacheEntryUserFull, userID}, now) {
+		return nil, false
+	}
+	full, ok := c.userFulls[userID]
+	return full, ok
+}
+
+func (c *CACHE) setUserFull(full *UserFull, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	if c.fullTTL <= 0 {
+		return
+	}
+	c.userFulls[full.ID] = full
+	c.lastUpdated[cacheEntryKey{cacheEntryUserFull, full.ID}] = now
+}
+
+func (c *CACHE) getChannelFull(channelID int64, now time.Time) (*ChannelFull, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if !c.fullFresh(cacheEntryKey{cacheEntryChannelFull, channelID}, now) {
+		return nil, false
+	}
+	full, ok := c.channelFulls[channelID]
+	return full, ok
 }
 
+func (c *CACHE) setChannelFull(full *ChannelFull, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	if c.fullTTL <= 0 {
+		return
+	}
+	c.channelFulls[full.ID] = full
+	c.lastUpdated[cacheEntryKey{cacheEntryChannelFull, full.ID}] = now
+}
+
+// invalidateFull forgets the cached UserFull or ChannelFull an update is about
+func (c *CACHE) invalidateFull(update Update) {
+	var key cacheEntryKey
+	switch u := update.(type) {
+	case *UpdateChannel:
+		key = cacheEntryKey{cacheEntryChannelFull, u.ChannelID}
+	case *UpdatePinnedChannelMessages:
+		key = cacheEntryKey{cacheEntryChannelFull, u.ChannelID}
+	case *UpdateChannelAvailableMessages:
+		key = cacheEntryKey{cacheEntryChannelFull, u.ChannelID}
+	case *UpdateUser:
+		key = cacheEntryKey{cacheEntryUserFull, u.UserID}
+	case *UpdateUserName:
+		key = cacheEntryKey{cacheEntryUserFull, u.UserID}
+	case *UpdateUserEmojiStatus:
+		key = cacheEntryKey{cacheEntryUserFull, u.UserID}
+	case *UpdatePinnedMessages:
+		user, ok := u.Peer.(*PeerUser)
+		if !ok {
+			return
+		}
+		key = cacheEntryKey{cacheEntryUserFull, user.UserID}
+	default:
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.forgetFull(key)
+}
+
+// UpdatePeersToCache caches the users and chats of a response, taking the lock once for all of them
 func (cache *CACHE) UpdatePeersToCache(u []User, c []Chat) {
+	if len(u) == 0 && len(c) == 0 {
+		return
+	}
+	cache.Lock()
+	defer cache.Unlock()
+	now := time.Now()
 	for _, user := range u {
-		us, ok := user.(*UserObj)
-		if ok {
-			cache.UpdateUser(us)
+		if us, ok := user.(*UserObj); ok {
+			cache.updateUser(us, now)
 		}
 	}
 	for _, chat := range c {
-		ch, ok := chat.(*ChatObj)
-		if ok {
-			cache.UpdateChat(ch)
-		} else {
-			channel, ok := chat.(*Channel)
-			if ok {
-				cache.UpdateChannel(channel)
-			}
+		switch ch := chat.(type) {
+		case *ChatObj:
+			cache.updateChat(ch, now)
+		case *Channel:
+			cache.updateChannel(ch, now)
 		}
 	}
 }
 
 func (c *Client) GetPeerUser(userID int64) (*InputPeerUser, error) {
+	c.Cache.RLock()
+	defer c.Cache.RUnlock()
 	if peer, ok := c.Cache.InputPeers.InputUsers[userID]; ok {
 		return &InputPeerUser{UserID: userID, AccessHash: peer}, nil
 	}
@@ -370,7 +847,8 @@ func (c *Client) GetPeerUser(userID int64) (*InputPeerUser, error) {
 }
 
 func (c *Client) GetPeerChannel(channelID int64) (*InputPeerChannel, error) {
-
+	c.Cache.RLock()
+	defer c.Cache.RUnlock()
 	if peer, ok := c.Cache.InputPeers.InputChannels[channelID]; ok {
 		return &InputPeerChannel{ChannelID: channelID, AccessHash: peer}, nil
 	}
@@ -0,0 +1,284 @@
+package telegram
+
+import (
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func BenchmarkGetInputPeer(b *testing.B) {
+	c := NewCache()
+	for i := int64(1); i <= 100000; i++ {
+		c.InputPeers.InputUsers[i] = i
+		c.InputPeers.InputChannels[i+200000] = i
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.GetInputPeer(int64(i%100000) + 200001); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCacheStoreIsolation(t *testing.T) {
+	dir := t.TempDir()
+	first, second := NewCache(), NewCache()
+	first.SetStore(NewFileCacheStore(filepath.Join(dir, "first.journal")))
+	second.SetStore(NewFileCacheStore(filepath.Join(dir, "second.journal")))
+
+	first.UpdateUser(&UserObj{ID: 1, AccessHash: 11})
+	second.UpdateUser(&UserObj{ID: 2, AccessHash: 22})
+	first.flush()
+	second.flush()
+
+	loaded := NewCache()
+	loaded.SetStore(NewFileCacheStore(filepath.Join(dir, "first.journal")))
+	loaded.load()
+	if _, err := loaded.GetInputPeer(1); err != nil {
+		t.Errorf("expected user 1 in first cache: %v", err)
+	}
+	if _, err := loaded.GetInputPeer(2); err == nil {
+		t.Error("user 2 leaked into first cache")
+	}
+}
+
+func TestDefaultCachePath(t *testing.T) {
+	dir := t.TempDir()
+	path := func(config ClientConfig) string {
+		config.AppID, config.AppHash, config.MemorySession, config.LogLevel, config.EnableCache = 1, "hash", true, LogError, true
+		c, err := NewClient(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Stop()
+		return c.Cache.getStore().(*fileCacheStore).path
+	}
+	first := path(ClientConfig{Session: filepath.Join(dir, "first.session")})
+	if want := filepath.Join(dir, "cache_1_first.journal"); first != want {
+		t.Errorf("got %q, want %q", first, want)
+	}
+	// two sessions in one directory, or two string sessions, don't share a cache
+	if second := path(ClientConfig{Session: filepath.Join(dir, "second.session")}); second == first {
+		t.Error("two sessions share the cache file")
+	}
+	c := &Client{}
+	session := filepath.Join(dir, "session.session")
+	a, b := c.defaultCachePath(ClientConfig{Session: session, StringSession: "a"}), c.defaultCachePath(ClientConfig{Session: session, StringSession: "b"})
+	if a == b {
+		t.Errorf("two string sessions share the cache file %q", a)
+	}
+}
+
+func TestCacheEntryTTL(t *testing.T) {
+	c := NewCache()
+	c.entryTTL = time.Minute
+	c.UpdateUser(&UserObj{ID: 1, AccessHash: 11})
+	c.UpdateChannel(&Channel{ID: 2, AccessHash: 22})
+	if c.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", c.Len())
+	}
+
+	c.evictExpired(time.Now().Add(2 * time.Minute))
+	if c.Len() != 0 {
+		t.Errorf("expected expired entries to be evicted, got %d", c.Len())
+	}
+	if _, err := c.GetInputPeer(1); err != nil {
+		t.Errorf("input peer should survive eviction: %v", err)
+	}
+
+	// without a ttl the update times aren't kept
+	c = NewCache()
+	c.UpdateUser(&UserObj{ID: 1, AccessHash: 11})
+	if len(c.lastUpdated) != 0 {
+		t.Fatalf("kept %d update times without a ttl", len(c.lastUpdated))
+	}
+	c.SetEntryTTL(time.Minute)
+	defer c.stopSweeping()
+	c.evictExpired(time.Now().Add(2 * time.Minute))
+	if c.Len() != 0 {
+		t.Error("a user cached before the ttl was set didn't expire")
+	}
+	c.UpdateUser(&UserObj{ID: 1, AccessHash: 11})
+	c.SetEntryTTL(0)
+	if len(c.lastUpdated) != 0 {
+		t.Errorf("kept %d update times after disabling the ttl", len(c.lastUpdated))
+	}
+}
+
+func TestCacheSweeperStop(t *testing.T) {
+	c := NewCache()
+	c.SetEntryTTL(time.Minute)
+	stop := c.sweepStop
+	if stop == nil {
+		t.Fatal("the sweeper wasn't started")
+	}
+	if !c.stopSweeping() {
+		t.Fatal("expected the sweeper to be running")
+	}
+	select {
+	case <-stop:
+	default:
+		t.Error("the stop channel of the sweeper wasn't closed")
+	}
+	if c.stopSweeping() {
+		t.Error("the sweeper was stopped twice")
+	}
+
+	client, err := NewClient(ClientConfig{AppID: 1, AppHash: "hash", MemorySession: true, LogLevel: LogError, CacheEntryTTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Cache.sweepStop == nil {
+		t.Fatal("the sweeper of the client wasn't started")
+	}
+	client.Stop()
+	if client.Cache.sweepStop != nil {
+		t.Error("Stop didn't stop the sweeper")
+	}
+}
+
+func TestCacheFullObjects(t *testing.T) {
+	c := NewCache()
+	now := time.Now()
+	c.setUserFull(&UserFull{ID: 1, About: "bio"}, now)
+	c.setChannelFull(&ChannelFull{ID: 2, About: "about"}, now)
+
+	if full, ok := c.getUserFull(1, now.Add(time.Minute)); !ok || full.About != "bio" {
+		t.Errorf("expected cached user full, got %v", full)
+	}
+	if _, ok := c.getUserFull(1, now.Add(DefaultFullInfoTTL)); ok {
+		t.Error("user full should expire after the ttl")
+	}
+
+	c.invalidateFull(&UpdateChannel{ChannelID: 2})
+	if _, ok := c.getChannelFull(2, now); ok {
+		t.Error("channel full should be dropped on UpdateChannel")
+	}
+}
+
+func TestCachedChatInputPeer(t *testing.T) {
+	c := NewCache()
+	c.UpdateChat(&ChatObj{ID: 42, Title: "group"})
+	c.UpdateUser(&UserObj{ID: 42, AccessHash: 7})
+
+	peer, err := c.GetInputPeer(-42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chat, ok := peer.(*InputPeerChat); !ok || chat.ChatID != 42 {
+		t.Errorf("got %#v, want the chat", peer)
+	}
+	if _, err := c.GetInputPeer(-43); err == nil {
+		t.Error("expected an error for an unknown chat")
+	}
+
+	// caches written before chats became a set stored the chat id as its value
+	legacy := NewCache()
+	if err := legacy.ImportJSON([]byte(`{"users":{"1":11},"chats":{"42":42}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if peer, err := legacy.GetInputPeer(-42); err != nil || peer.(*InputPeerChat).ChatID != 42 {
+		t.Errorf("legacy chat: got %v, %v", peer, err)
+	}
+	if peer, err := legacy.GetInputPeer(1); err != nil || peer.(*InputPeerUser).AccessHash != 11 {
+		t.Errorf("legacy user: got %v, %v", peer, err)
+	}
+}
+
+// run with -race
+func TestCacheConcurrentAccess(t *testing.T) {
+	c := &Client{Cache: NewCache()}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := int64(0); i < 500; i++ {
+				id := int64(w)*1000 + i
+				c.Cache.UpdatePeersToCache([]User{&UserObj{ID: id, AccessHash: id}}, []Chat{&Channel{ID: id, AccessHash: id}, &ChatObj{ID: id}})
+				c.Cache.UpdateUser(&UserObj{ID: id + 500, AccessHash: id})
+			}
+		}(w)
+		go func(w int) {
+			defer wg.Done()
+			for i := int64(0); i < 500; i++ {
+				id := int64(w)*1000 + i
+				c.GetPeerUser(id)
+				c.GetPeerChannel(id)
+				c.Cache.GetInputPeer(id)
+				c.Cache.getUserPeer(id)
+				c.Cache.getChannelPeer(id)
+				if i%100 == 0 {
+					c.Cache.ExportJSON()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if peer, err := c.GetPeerChannel(3499); err != nil || peer.AccessHash != 3499 {
+		t.Errorf("got %v, %v", peer, err)
+	}
+}
+
+func TestCachePin(t *testing.T) {
+	c := NewCache()
+	c.UpdatePeersToCache([]User{&UserObj{ID: 1, AccessHash: 2}}, []Chat{&ChatObj{ID: 3}, &Channel{ID: 4, AccessHash: 5}})
+
+	var pinner runtime.Pinner
+	defer pinner.Unpin()
+	c.Pin(&pinner)
+	if peer, err := c.GetInputPeer(1); err != nil || peer.(*InputPeerUser).AccessHash != 2 {
+		t.Errorf("got %v, %v after pinning", peer, err)
+	}
+}
+
+func TestCacheFlushOnStop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.journal")
+	c := NewCache()
+	c.SetStore(NewFileCacheStore(path))
+	c.startCacheFileUpdater()
+	c.UpdateUser(&UserObj{ID: 7, AccessHash: 77})
+
+	if !c.stopFlushing() {
+		t.Fatal("expected the cache to be flushing")
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if c.stopFlushing() {
+		t.Error("flush timer restarted after stopping")
+	}
+
+	loaded := NewCache()
+	loaded.SetStore(NewFileCacheStore(path))
+	loaded.load()
+	if _, err := loaded.GetInputPeer(7); err != nil {
+		t.Errorf("expected user 7 after the final flush: %v", err)
+	}
+}
+
+func TestCacheMinPeers(t *testing.T) {
+	c := NewCache()
+	c.UpdatePeersToCache(
+		[]User{&UserObj{ID: 1, AccessHash: 11, FirstName: "full"}},
+		[]Chat{&Channel{ID: 2, AccessHash: 22}},
+	)
+	c.UpdatePeersToCache(
+		[]User{&UserObj{ID: 1, AccessHash: 99, Min: true}, &UserObj{ID: 3, AccessHash: 33, Min: true}},
+		[]Chat{&Channel{ID: 2, AccessHash: 99, Min: true}},
+	)
+	if hash := c.InputPeers.InputUsers[1]; hash != 11 {
+		t.Errorf("full user hash replaced by a min one: %d", hash)
+	}
+	if hash := c.InputPeers.InputChannels[2]; hash != 22 {
+		t.Errorf("full channel hash replaced by a min one: %d", hash)
+	}
+	if c.users[1].FirstName != "full" {
+		t.Error("full user replaced by a min one")
+	}
+	if hash := c.InputPeers.InputUsers[3]; hash != 33 {
+		t.Errorf("min hash of an unknown user not stored: %d", hash)
+	}
+}
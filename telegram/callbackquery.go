@@ -23,12 +23,10 @@ type (
 	}
 )
 
+// Answer answers the query, see AnswerCallbackQuery. Every callback query should be
+// answered, even with an empty Text, or the button keeps loading for the user.
 func (b *CallbackQuery) Answer(Text string, options ...*CallbackOptions) (bool, error) {
-	var opts CallbackOptions
-	if len(options) > 0 {
-		opts = *options[0]
-	}
-	return b.Client.AnswerCallbackQuery(b.QueryID, Text, &opts)
+	return b.Client.AnswerCallbackQuery(b.QueryID, Text, options...)
 }
 
 func (b *CallbackQuery) GetMessage() (*NewMessage, error) {
@@ -125,6 +123,12 @@ func (b *CallbackQuery) Edit(Text interface{}, options ...*SendOptions) (*NewMes
 	return b.Client.EditMessage(b.Peer, b.MessageID, Text, &opts)
 }
 
+// EditReplyMarkup replaces the inline keyboard of the message with the pressed button, nil removes it
+func (b *CallbackQuery) EditReplyMarkup(markup ReplyMarkup) error {
+	_, err := b.Client.EditReplyMarkup(b.Peer, b.MessageID, markup)
+	return err
+}
+
 func (b *CallbackQuery) Delete() (*MessagesAffectedMessages, error) {
 	return b.Client.DeleteMessages(b.Peer, []int32{b.MessageID})
 }
@@ -168,7 +172,7 @@ func (b *CallbackQuery) ForwardTo(ChatID int64, options ...*ForwardOptions) (*Ne
 	if len(options) > 0 {
 		opts = *options[0]
 	}
-	m, err := b.Client.Forward(b.Peer, ChatID, []int32{b.MessageID}, &opts)
+	m, err := b.Client.Forward(ChatID, b.Peer, []int32{b.MessageID}, &opts)
 	if err != nil {
 		return nil, err
 	}
@@ -195,12 +199,10 @@ type InlineCallbackQuery struct {
 	GameShortName  string
 }
 
+// Answer answers the query, see AnswerCallbackQuery. Every callback query should be
+// answered, even with an empty Text, or the button keeps loading for the user.
 func (b *InlineCallbackQuery) Answer(Text string, options ...*CallbackOptions) (bool, error) {
-	var opts CallbackOptions
-	if len(options) > 0 {
-		opts = *options[0]
-	}
-	return b.Client.AnswerCallbackQuery(b.QueryID, Text, &opts)
+	return b.Client.AnswerCallbackQuery(b.QueryID, Text, options...)
 }
 
 func (b *InlineCallbackQuery) ShortName() string {
@@ -233,6 +235,12 @@ func (b *InlineCallbackQuery) Edit(Text interface{}, options ...*SendOptions) (*
 	return b.Client.EditMessage(b.MsgID, 0, Text, &opts)
 }
 
+// EditReplyMarkup replaces the inline keyboard of the inline message with the pressed button, nil removes it
+func (b *InlineCallbackQuery) EditReplyMarkup(markup ReplyMarkup) error {
+	_, err := b.Client.EditReplyMarkup(b.MsgID, 0, markup)
+	return err
+}
+
 func (b *InlineCallbackQuery) ChatType() string {
 	if b.ChatInstance == int64(InlineQueryPeerTypePm) || b.ChatInstance == int64(InlineQueryPeerTypeSameBotPm) {
 		return EntityUser
@@ -3,6 +3,9 @@
 package telegram
 
 import (
+	"strings"
+	"time"
+
 	"github.com/pkg/errors"
 )
 
@@ -33,83 +36,277 @@ func (c *Client) GetChatPhotos(chatID interface{}, limit ...int32) ([]Photo, err
 	return photos, nil
 }
 
-// GetChatPhoto returns the current chat photo
+// GetChatPhoto returns the current photo of a chat or channel, *PhotoEmpty if it has none
 //
 //	Params:
 //	 - chatID: chat id
 func (c *Client) GetChatPhoto(chatID interface{}) (Photo, error) {
-	photos, err := c.GetChatPhotos(chatID)
+	peer, err := c.GetSendablePeer(chatID)
 	if err != nil {
-		return &PhotoObj{}, err
+		return nil, err
+	}
+	var photo Photo
+	switch p := peer.(type) {
+	case *InputPeerChannel:
+		full, err := c.GetFullChannel(chatID)
+		if err != nil {
+			return nil, err
+		}
+		photo = full.ChatPhoto
+	case *InputPeerChat:
+		full, err := c.MessagesGetFullChat(p.ChatID)
+		if err != nil {
+			return nil, err
+		}
+		c.Cache.UpdatePeersToCache(full.Users, full.Chats)
+		if chatFull, ok := full.FullChat.(*ChatFullObj); ok {
+			photo = chatFull.ChatPhoto
+		}
+	default:
+		return nil, errors.New("peer is not a chat or channel")
 	}
-	if len(photos) > 0 {
-		return photos[0], nil
+	if photo == nil {
+		return &PhotoEmpty{}, nil
 	}
-	return &PhotoObj{}, nil // GetFullChannel TODO
+	return photo, nil
 }
 
-// JoinChannel joins a channel or chat by its username or id
-//
-//	Params:
-//	- Channel: the username or id of the channel or chat
-func (c *Client) JoinChannel(Channel interface{}) error {
-	switch p := Channel.(type) {
-	case string:
-		if TG_JOIN_RE.MatchString(p) {
-			_, err := c.MessagesImportChatInvite(TG_JOIN_RE.FindStringSubmatch(p)[2])
-			if err != nil {
-				return err
-			}
-		}
+// DownloadChatPhoto downloads the current photo of a chat or channel, returning the path
+// it was saved to. Returns ErrNoDownloadableMedia if the chat has no photo.
+func (c *Client) DownloadChatPhoto(chatID interface{}, opts ...*DownloadOptions) (string, error) {
+	photo, err := c.GetChatPhoto(chatID)
+	if err != nil {
+		return "", err
+	}
+	return c.DownloadMedia(photo, opts...)
+}
+
+// SetChatPhoto changes the photo of a chat or channel. photo is the path of an image or a
+// video to upload, an uploaded InputFile, or a photo already on telegram as a Photo or an InputPhoto.
+// Returns ErrChatAdminRequired if the account can't change the chat info.
+func (c *Client) SetChatPhoto(chatID interface{}, photo interface{}) (bool, error) {
+	chatPhoto, err := c.inputChatPhoto(photo)
+	if err != nil {
+		return false, err
+	}
+	return c.editChatPhoto(chatID, chatPhoto)
+}
+
+// DeleteChatPhoto removes the photo of a chat or channel.
+// Returns ErrChatAdminRequired if the account can't change the chat info.
+func (c *Client) DeleteChatPhoto(chatID interface{}) (bool, error) {
+	return c.editChatPhoto(chatID, &InputChatPhotoEmpty{})
+}
+
+// editChatPhoto calls channels.editPhoto or messages.editChatPhoto depending on the chat
+func (c *Client) editChatPhoto(chatID interface{}, photo InputChatPhoto) (bool, error) {
+	peer, err := c.GetSendablePeer(chatID)
+	if err != nil {
+		return false, err
+	}
+	switch p := peer.(type) {
+	case *InputPeerChannel:
+		_, err = c.ChannelsEditPhoto(&InputChannelObj{ChannelID: p.ChannelID, AccessHash: p.AccessHash}, photo)
+	case *InputPeerChat:
+		_, err = c.MessagesEditChatPhoto(p.ChatID, photo)
 	default:
-		channel, err := c.GetSendablePeer(Channel)
+		return false, errors.New("peer is not a chat or channel")
+	}
+	if err != nil {
+		return false, adminRequired(err)
+	}
+	return true, nil
+}
+
+// inputChatPhoto converts the photo given to SetChatPhoto to an InputChatPhoto,
+// uploading it if it is a path
+func (c *Client) inputChatPhoto(photo interface{}) (InputChatPhoto, error) {
+	switch p := photo.(type) {
+	case string:
+		file, err := c.UploadFile(p)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if mime, _ := resolveMimeType(p); strings.HasPrefix(mime, "video/") {
+			return &InputChatUploadedPhoto{Video: file}, nil
 		}
-		if chat, ok := channel.(*InputPeerChannel); ok {
-			_, err = c.ChannelsJoinChannel(&InputChannelObj{ChannelID: chat.ChannelID, AccessHash: chat.AccessHash})
+		return &InputChatUploadedPhoto{File: file}, nil
+	case InputFile:
+		return &InputChatUploadedPhoto{File: p}, nil
+	case InputChatPhoto:
+		return p, nil
+	case InputPhoto:
+		return &InputChatPhotoObj{ID: p}, nil
+	case *PhotoObj:
+		return &InputChatPhotoObj{ID: &InputPhotoObj{ID: p.ID, AccessHash: p.AccessHash, FileReference: p.FileReference}}, nil
+	case nil:
+		return nil, errors.New("photo is nil")
+	}
+	return nil, errors.Errorf("unsupported chat photo: %T", photo)
+}
+
+// JoinChat joins a chat by a link: a public username (@username, t.me/username) or a
+// private invite link (t.me/+hash, t.me/joinchat/hash, tg://join?invite=hash).
+// The chat joined is cached and returned. If the chat approves new members, requested is
+// true and chat nil: a join request was sent and the account joins once an admin accepts it.
+func (c *Client) JoinChat(link string) (chat Chat, requested bool, err error) {
+	username, hash := parseJoinLink(link)
+	if hash != "" {
+		return c.joinByInvite(hash)
+	}
+	if username == "" {
+		return nil, false, errors.New("invalid chat link: " + link)
+	}
+	peer, err := c.ResolvePeer(username)
+	if err != nil {
+		return nil, false, err
+	}
+	channel, ok := peer.(*InputPeerChannel)
+	if !ok {
+		return nil, false, errors.New("peer is not a channel or supergroup")
+	}
+	updates, err := c.ChannelsJoinChannel(&InputChannelObj{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash})
+	if err != nil {
+		if matchRPCError(err, "INVITE_REQUEST_SENT") {
+			return nil, true, nil
+		}
+		return nil, false, err
+	}
+	if chat := c.updatesChat(updates); chat != nil {
+		return chat, false, nil
+	}
+	ch, err := c.GetChannel(channel.ChannelID)
+	if err != nil {
+		return nil, false, err
+	}
+	return ch, false, nil
+}
+
+// joinByInvite imports the invite with hash, returning the chat already joined if the
+// account is a member
+func (c *Client) joinByInvite(hash string) (Chat, bool, error) {
+	updates, err := c.MessagesImportChatInvite(hash)
+	if err != nil {
+		switch {
+		case matchRPCError(err, "INVITE_REQUEST_SENT"):
+			return nil, true, nil
+		case matchRPCError(err, "USER_ALREADY_PARTICIPANT"):
+			invite, err := c.MessagesCheckChatInvite(hash)
 			if err != nil {
-				return err
+				return nil, false, err
 			}
-		} else if chat, ok := channel.(*InputPeerChat); ok {
-			_, err = c.MessagesAddChatUser(chat.ChatID, &InputUserEmpty{}, 0)
-			if err != nil {
-				return err
+			if already, ok := invite.(*ChatInviteAlready); ok {
+				c.Cache.UpdatePeersToCache(nil, []Chat{already.Chat})
+				return already.Chat, false, nil
 			}
-		} else {
-			return errors.New("peer is not a channel or chat")
+		}
+		return nil, false, err
+	}
+	if chat := c.updatesChat(updates); chat != nil {
+		return chat, false, nil
+	}
+	return nil, false, errors.New("the invite didn't return the chat joined")
+}
+
+// updatesChat caches the users and chats of updates, returning the first chat
+func (c *Client) updatesChat(updates Updates) Chat {
+	var chats []Chat
+	switch u := updates.(type) {
+	case *UpdatesObj:
+		c.Cache.UpdatePeersToCache(u.Users, u.Chats)
+		chats = u.Chats
+	case *UpdatesCombined:
+		c.Cache.UpdatePeersToCache(u.Users, u.Chats)
+		chats = u.Chats
+	}
+	for _, chat := range chats {
+		switch chat.(type) {
+		case *ChatObj, *Channel:
+			return chat
 		}
 	}
 	return nil
 }
 
-// LeaveChannel leaves a channel or chat
+// parseJoinLink returns the username or the invite hash of a link to a chat
+func parseJoinLink(link string) (username, hash string) {
+	link = strings.TrimSpace(link)
+	if m := TG_JOIN_RE.FindStringSubmatch(link); m != nil {
+		return "", m[1]
+	}
+	if m := tgResolveRE.FindStringSubmatch(link); m != nil {
+		return m[1], ""
+	}
+	private := false
+	if m := USERNAME_RE.FindStringSubmatchIndex(link); m != nil && m[0] == 0 {
+		// the second group is set for t.me/+hash and t.me/joinchat/hash
+		private = m[2] >= 0 && link[m[2]:m[3]] != "@"
+		link = link[m[1]:]
+	}
+	link, _, _ = strings.Cut(link, "?")
+	link, _, _ = strings.Cut(link, "/")
+	if private {
+		return "", link
+	}
+	return link, ""
+}
+
+// JoinChannel joins a channel by its id or peer, or a chat by its link (see JoinChat)
 //
 //	Params:
-//	 - Channel: Channel or chat to leave
-//	 - Revoke: If true, the channel will be deleted
-func (c *Client) LeaveChannel(Channel interface{}, Revoke ...bool) error {
-	revokeChat := getVariadic(Revoke, false).(bool)
+//	- Channel: the link, id or peer of the channel or chat
+func (c *Client) JoinChannel(Channel interface{}) error {
+	if link, ok := Channel.(string); ok {
+		_, _, err := c.JoinChat(link)
+		return err
+	}
 	channel, err := c.GetSendablePeer(Channel)
 	if err != nil {
 		return err
 	}
-	if chat, ok := channel.(*InputPeerChannel); ok {
-		_, err = c.ChannelsLeaveChannel(&InputChannelObj{ChannelID: chat.ChannelID, AccessHash: chat.AccessHash})
-		if err != nil {
-			return err
-		}
-	} else if chat, ok := channel.(*InputPeerChat); ok {
-		_, err = c.MessagesDeleteChatUser(revokeChat, chat.ChatID, &InputUserEmpty{})
-		if err != nil {
-			return err
+	chat, ok := channel.(*InputPeerChannel)
+	if !ok {
+		return errors.New("peer is not a channel or supergroup, basic groups are joined by invite links")
+	}
+	updates, err := c.ChannelsJoinChannel(&InputChannelObj{ChannelID: chat.ChannelID, AccessHash: chat.AccessHash})
+	if err != nil {
+		if matchRPCError(err, "INVITE_REQUEST_SENT") {
+			return nil
 		}
-	} else {
-		return errors.New("peer is not a channel or chat")
+		return err
 	}
+	c.updatesChat(updates)
 	return nil
 }
 
+// LeaveChat leaves a channel or chat
+//
+//	Params:
+//	 - chatID: Channel or chat to leave
+//	 - revoke: If true, the history of a basic group is deleted as well
+func (c *Client) LeaveChat(chatID interface{}, revoke ...bool) error {
+	peer, err := c.GetSendablePeer(chatID)
+	if err != nil {
+		return err
+	}
+	switch p := peer.(type) {
+	case *InputPeerChannel:
+		_, err = c.ChannelsLeaveChannel(&InputChannelObj{ChannelID: p.ChannelID, AccessHash: p.AccessHash})
+	case *InputPeerChat:
+		_, err = c.MessagesDeleteChatUser(getVariadic(revoke, false).(bool), p.ChatID, &InputUserSelf{})
+	default:
+		return errors.New("peer is not a channel or chat")
+	}
+	return err
+}
+
+// LeaveChannel leaves a channel or chat
+//
+// Deprecated: use LeaveChat
+func (c *Client) LeaveChannel(Channel interface{}, Revoke ...bool) error {
+	return c.LeaveChat(Channel, Revoke...)
+}
+
 const (
 	Admin      = "admin"
 	Creator    = "creator"
@@ -120,14 +317,27 @@ const (
 )
 
 type Participant struct {
-	User        *UserObj           `json:"user,omitempty"`
+	User *UserObj `json:"user,omitempty"`
+	// Chat and Channel are set instead of User for a banned or left chat or channel,
+	// both are nil if it couldn't be resolved
+	Chat        *ChatObj           `json:"chat,omitempty"`
+	Channel     *Channel           `json:"channel,omitempty"`
 	Participant ChannelParticipant `json:"participant,omitempty"`
-	Status      string             `json:"status,omitempty"`
-	Rights      *ChatAdminRights   `json:"rights,omitempty"`
-	Rank        string             `json:"rank,omitempty"`
+	// Status is one of Creator, Admin, Member, Restricted, Left or Kicked (banned)
+	Status string           `json:"status,omitempty"`
+	Rights *ChatAdminRights `json:"rights,omitempty"`
+	// BannedRights are the restrictions of Restricted and Kicked participants
+	BannedRights *ChatBannedRights `json:"banned_rights,omitempty"`
+	Rank         string            `json:"rank,omitempty"`
+}
+
+// IsAdmin reports whether the participant is the creator or an admin of the chat
+func (p *Participant) IsAdmin() bool {
+	return p.Status == Creator || p.Status == Admin
 }
 
-// GetChatMember returns the members of a chat
+// GetChatMember returns a member of a chat, with their status and rights. Basic groups have
+// no per admin rights, their admins get the rights every admin of a basic group has.
 //
 //	Params:
 //	 - chatID: The ID of the chat
@@ -141,22 +351,99 @@ func (c *Client) GetChatMember(chatID interface{}, userID interface{}) (*Partici
 	if err != nil {
 		return nil, err
 	}
-	chat, ok := channel.(*InputPeerChannel)
-	if !ok {
-		return nil, errors.New("peer is not a channel")
+	switch chat := channel.(type) {
+	case *InputPeerChannel:
+		participant, err := c.ChannelsGetParticipant(&InputChannelObj{ChannelID: chat.ChannelID, AccessHash: chat.AccessHash}, user)
+		if err != nil {
+			return nil, err
+		}
+		c.Cache.UpdatePeersToCache(participant.Users, participant.Chats)
+		return c.packParticipant(participant.Participant)
+	case *InputPeerChat:
+		return c.getChatMember(chat.ChatID, user)
+	default:
+		return nil, errors.New("peer is not a chat or channel")
+	}
+}
+
+// getChatMember finds a member in the participants of a basic group
+func (c *Client) getChatMember(chatID int64, user InputPeer) (*Participant, error) {
+	var userID int64
+	switch u := user.(type) {
+	case *InputPeerUser:
+		userID = u.UserID
+	case *InputPeerUserFromMessage:
+		userID = u.UserID
+	case *InputPeerSelf:
+		me, err := c.Me()
+		if err != nil {
+			return nil, err
+		}
+		userID = me.ID
+	default:
+		return nil, errors.New("peer is not a user")
 	}
-	participant, err := c.ChannelsGetParticipant(&InputChannelObj{ChannelID: chat.ChannelID, AccessHash: chat.AccessHash}, user)
+	full, err := c.MessagesGetFullChat(chatID)
 	if err != nil {
 		return nil, err
 	}
-	c.Cache.UpdatePeersToCache(participant.Users, participant.Chats)
+	c.Cache.UpdatePeersToCache(full.Users, full.Chats)
+	chatFull, ok := full.FullChat.(*ChatFullObj)
+	if !ok {
+		return nil, errors.New("could not convert full chat")
+	}
+	participants, ok := chatFull.Participants.(*ChatParticipantsObj)
+	if !ok {
+		return nil, errors.New("participants of the chat are not visible")
+	}
+	for _, p := range participants.Participants {
+		if participant := chatParticipant(p); participantID(participant) == userID {
+			return c.packParticipant(participant)
+		}
+	}
+	return c.packParticipant(&ChannelParticipantLeft{Peer: &PeerUser{UserID: userID}})
+}
+
+// chatParticipant converts a participant of a basic group to the channel participant it matches
+func chatParticipant(p ChatParticipant) ChannelParticipant {
+	switch p := p.(type) {
+	case *ChatParticipantCreator:
+		rights := basicGroupAdminRights()
+		rights.AddAdmins = true
+		return &ChannelParticipantCreator{UserID: p.UserID, AdminRights: rights}
+	case *ChatParticipantAdmin:
+		return &ChannelParticipantAdmin{UserID: p.UserID, InviterID: p.InviterID, Date: p.Date, AdminRights: basicGroupAdminRights()}
+	case *ChatParticipantObj:
+		return &ChannelParticipantObj{UserID: p.UserID, Date: p.Date}
+	}
+	return nil
+}
+
+// basicGroupAdminRights are the rights of every admin of a basic group
+func basicGroupAdminRights() *ChatAdminRights {
+	return &ChatAdminRights{
+		ChangeInfo:     true,
+		DeleteMessages: true,
+		BanUsers:       true,
+		InviteUsers:    true,
+		PinMessages:    true,
+		ManageCall:     true,
+		Other:          true,
+	}
+}
+
+// packParticipant resolves the user (or the banned or left chat) and status of a channel
+// participant
+func (c *Client) packParticipant(p ChannelParticipant) (*Participant, error) {
 	var (
 		status string           = Member
 		rights *ChatAdminRights = &ChatAdminRights{}
-		rank   string           = ""
-		UserID int64            = 0
+		banned *ChatBannedRights
+		rank   string = ""
+		UserID int64  = 0
+		peer   Peer
 	)
-	switch p := participant.Participant.(type) {
+	switch p := p.(type) {
 	case *ChannelParticipantCreator:
 		status = Creator
 		rights = p.AdminRights
@@ -175,22 +462,39 @@ func (c *Client) GetChatMember(chatID interface{}, userID interface{}) (*Partici
 		UserID = p.UserID
 	case *ChannelParticipantBanned:
 		status = Restricted
-		UserID = c.GetPeerID(p.Peer)
+		if p.BannedRights != nil && p.BannedRights.ViewMessages {
+			status = Kicked
+		}
+		banned = p.BannedRights
+		peer = p.Peer
 	case *ChannelParticipantLeft:
 		status = Left
-		UserID = c.GetPeerID(p.Peer)
+		peer = p.Peer
+	}
+	participant := &Participant{
+		Participant:  p,
+		Status:       status,
+		Rights:       rights,
+		BannedRights: banned,
+		Rank:         rank,
+	}
+	// banned and left participants can be chats and channels, which don't fail the lookup
+	switch peer := peer.(type) {
+	case *PeerChat:
+		participant.Chat, _ = c.GetChat(peer.ChatID)
+		return participant, nil
+	case *PeerChannel:
+		participant.Channel, _ = c.GetChannel(peer.ChannelID)
+		return participant, nil
+	case *PeerUser:
+		UserID = peer.UserID
 	}
 	partUser, err := c.GetUser(UserID)
 	if err != nil {
 		return nil, err
 	}
-	return &Participant{
-		User:        partUser,
-		Participant: participant.Participant,
-		Status:      status,
-		Rights:      rights,
-		Rank:        rank,
-	}, nil
+	participant.User = partUser
+	return participant, nil
 }
 
 type ParticipantOptions struct {
@@ -229,48 +533,13 @@ func (c *Client) GetChatMembers(chatID interface{}, Opts ...*ParticipantOptions)
 		return nil, 0, errors.New("could not get participants")
 	}
 	c.Cache.UpdatePeersToCache(cParts.Users, cParts.Chats)
-	var (
-		status string           = Member
-		rights *ChatAdminRights = &ChatAdminRights{}
-		rank   string           = ""
-		UserID int64            = 0
-	)
-	participantsList := make([]*Participant, 0)
+	participantsList := make([]*Participant, 0, len(cParts.Participants))
 	for _, p := range cParts.Participants {
-		switch p := p.(type) {
-		case *ChannelParticipantCreator:
-			status = Creator
-			rights = p.AdminRights
-			rank = p.Rank
-			UserID = p.UserID
-		case *ChannelParticipantAdmin:
-			status = Admin
-			rights = p.AdminRights
-			rank = p.Rank
-			UserID = p.UserID
-		case *ChannelParticipantObj:
-			status = Member
-		case *ChannelParticipantSelf:
-			status = Member
-			UserID = p.UserID
-		case *ChannelParticipantBanned:
-			status = Restricted
-			UserID = c.GetPeerID(p.Peer)
-		case *ChannelParticipantLeft:
-			status = Left
-			UserID = c.GetPeerID(p.Peer)
-		}
-		partUser, err := c.GetUser(UserID)
+		participant, err := c.packParticipant(p)
 		if err != nil {
 			return nil, 0, err
 		}
-		participantsList = append(participantsList, &Participant{
-			User:        partUser,
-			Participant: p,
-			Status:      status,
-			Rights:      rights,
-			Rank:        rank,
-		})
+		participantsList = append(participantsList, participant)
 	}
 	return participantsList, cParts.Count, nil
 }
@@ -486,11 +755,14 @@ func (c *Client) GetStats(channelID interface{}, messageID ...interface{}) (*Sta
 }
 
 type InviteLinkOptions struct {
-	LegacyRevokePermanent bool   `json:"legacy_revoke_permanent,omitempty"`
-	Expire                int32  `json:"expire,omitempty"`
-	Limit                 int32  `json:"limit,omitempty"`
-	Title                 string `json:"title,omitempty"`
-	RequestNeeded         bool   `json:"request_needed,omitempty"`
+	LegacyRevokePermanent bool `json:"legacy_revoke_permanent,omitempty"`
+	// Expire is the unix time the link expires at
+	Expire int32 `json:"expire,omitempty"`
+	// Limit is the number of users that can join with the link
+	Limit int32  `json:"limit,omitempty"`
+	Title string `json:"title,omitempty"`
+	// RequestNeeded makes users joining with the link send a join request to the admins
+	RequestNeeded bool `json:"request_needed,omitempty"`
 }
 
 // GetChatInviteLink returns the invite link of a chat
@@ -498,7 +770,7 @@ type InviteLinkOptions struct {
 //	Params:
 //	 - peerID : The ID of the chat
 //	 - LegacyRevoke : If true, the link will be revoked
-//	 - Expire: The time in seconds after which the link will expire
+//	 - Expire: The unix time at which the link will expire
 //	 - Limit: The maximum number of users that can join the chat using the link
 //	 - Title: The title of the link
 //	 - RequestNeeded: If true, join requests will be needed to join the chat
@@ -519,36 +791,186 @@ func (c *Client) GetChatInviteLink(peerID interface{}, LinkOpts ...*InviteLinkOp
 	return link, err
 }
 
+// maxInviteLinksLimit is the most links messages.getExportedChatInvites returns per request
+const maxInviteLinksLimit = 100
+
+// CreateInviteLink creates an additional invite link to a chat, its Link is the
+// t.me/+hash URL. Returns ErrChatAdminRequired if the account can't invite users.
+// This method is a wrapper for messages.exportChatInvite.
+func (c *Client) CreateInviteLink(peerID interface{}, opts ...*InviteLinkOptions) (*ChatInviteExported, error) {
+	link, err := c.GetChatInviteLink(peerID, opts...)
+	if err != nil {
+		return nil, adminRequired(err)
+	}
+	invite, ok := link.(*ChatInviteExported)
+	if !ok {
+		return nil, errors.Errorf("unexpected invite: %T", link)
+	}
+	return invite, nil
+}
+
+// RevokeInviteLink revokes an invite link of a chat, returning the revoked link.
+// Revoking the primary link of the chat replaces it with a new one.
+// This method is a wrapper for messages.editExportedChatInvite.
+func (c *Client) RevokeInviteLink(peerID interface{}, link string) (*ChatInviteExported, error) {
+	peer, err := c.GetSendablePeer(peerID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.MessagesEditExportedChatInvite(&MessagesEditExportedChatInviteParams{
+		Revoked: true,
+		Peer:    peer,
+		Link:    link,
+	})
+	if err != nil {
+		return nil, adminRequired(err)
+	}
+	var invite ExportedChatInvite
+	switch resp := resp.(type) {
+	case *MessagesExportedChatInviteObj:
+		c.Cache.UpdatePeersToCache(resp.Users, nil)
+		invite = resp.Invite
+	case *MessagesExportedChatInviteReplaced:
+		c.Cache.UpdatePeersToCache(resp.Users, nil)
+		invite = resp.Invite
+	}
+	if invite, ok := invite.(*ChatInviteExported); ok {
+		return invite, nil
+	}
+	return nil, errors.Errorf("unexpected response: %T", resp)
+}
+
+// GetInviteLinks returns the invite links of a chat created by an admin, the account when
+// adminID is nil. With revoked, the revoked links are returned instead.
+// This method is a wrapper for messages.getExportedChatInvites.
+func (c *Client) GetInviteLinks(peerID interface{}, adminID interface{}, revoked ...bool) ([]*ChatInviteExported, error) {
+	peer, err := c.GetSendablePeer(peerID)
+	if err != nil {
+		return nil, err
+	}
+	var admin InputUser = &InputUserSelf{}
+	if adminID != nil {
+		adminPeer, err := c.GetSendablePeer(adminID)
+		if err != nil {
+			return nil, err
+		}
+		if admin, err = inputUser(adminPeer); err != nil {
+			return nil, err
+		}
+	}
+	params := &MessagesGetExportedChatInvitesParams{
+		Revoked: getVariadic(revoked, false).(bool),
+		Peer:    peer,
+		AdminID: admin,
+		Limit:   maxInviteLinksLimit,
+	}
+	return collectInviteLinks(func(offsetDate int32, offsetLink string) (*MessagesExportedChatInvites, error) {
+		params.OffsetDate, params.OffsetLink = offsetDate, offsetLink
+		resp, err := c.MessagesGetExportedChatInvites(params)
+		if err != nil {
+			return nil, adminRequired(err)
+		}
+		c.Cache.UpdatePeersToCache(resp.Users, nil)
+		return resp, nil
+	})
+}
+
+// collectInviteLinks fetches the pages of invite links until Count links were returned,
+// each page continuing from the date and link of the last one
+func collectInviteLinks(fetch func(offsetDate int32, offsetLink string) (*MessagesExportedChatInvites, error)) ([]*ChatInviteExported, error) {
+	var links []*ChatInviteExported
+	var offsetDate int32
+	var offsetLink string
+	for {
+		resp, err := fetch(offsetDate, offsetLink)
+		if err != nil {
+			return links, err
+		}
+		var last *ChatInviteExported
+		for _, invite := range resp.Invites {
+			if invite, ok := invite.(*ChatInviteExported); ok {
+				links = append(links, invite)
+				last = invite
+			}
+		}
+		if last == nil || len(links) >= int(resp.Count) || (last.Date == offsetDate && last.Link == offsetLink) {
+			return links, nil
+		}
+		offsetDate, offsetLink = last.Date, last.Link
+	}
+}
+
 type ChannelOptions struct {
-	About        string        `json:"about,omitempty"`
-	NotBroadcast bool          `json:"broadcast,omitempty"`
-	Megagroup    bool          `json:"megagroup,omitempty"`
-	Address      string        `json:"address,omitempty"`
-	ForImport    bool          `json:"for_import,omitempty"`
-	GeoPoint     InputGeoPoint `json:"geo_point,omitempty"`
+	About string `json:"about,omitempty"`
+	// Megagroup creates a supergroup instead of a broadcast channel
+	Megagroup bool `json:"megagroup,omitempty"`
+	// Forum creates a supergroup with topics enabled, implies Megagroup
+	Forum bool `json:"forum,omitempty"`
+	// Deprecated: use Megagroup
+	NotBroadcast bool `json:"broadcast,omitempty"`
+	// Address and GeoPoint create a location based group
+	Address  string        `json:"address,omitempty"`
+	GeoPoint InputGeoPoint `json:"geo_point,omitempty"`
+	// ForImport creates a supergroup to import the history of another app into
+	ForImport bool `json:"for_import,omitempty"`
+	// TtlPeriod is the auto delete timer of the messages, in seconds
+	TtlPeriod int32 `json:"ttl_period,omitempty"`
 }
 
-func (c *Client) CreateChannel(title string, opts ...ChannelOptions) (*Channel, error) {
+// CreateChannel creates a broadcast channel, or a supergroup with Megagroup or Forum.
+// The channel is cached and returned.
+// This method is a wrapper for channels.createChannel.
+func (c *Client) CreateChannel(title string, opts ...*ChannelOptions) (*Channel, error) {
 	opt := getVariadic(opts, &ChannelOptions{}).(*ChannelOptions)
-	u, err := c.ChannelsCreateChannel(&ChannelsCreateChannelParams{
-		Broadcast: !opt.NotBroadcast,
+	megagroup := opt.Megagroup || opt.Forum || opt.NotBroadcast
+	updates, err := c.ChannelsCreateChannel(&ChannelsCreateChannelParams{
+		Broadcast: !megagroup,
+		Megagroup: megagroup,
+		Forum:     opt.Forum,
+		ForImport: opt.ForImport,
+		Title:     title,
+		About:     opt.About,
 		GeoPoint:  opt.GeoPoint,
-		About:     opt.About, ForImport: opt.ForImport,
 		Address:   opt.Address,
-		Megagroup: opt.Megagroup,
-		Title:     title,
+		TtlPeriod: opt.TtlPeriod,
 	})
 	if err != nil {
 		return nil, err
 	}
-	switch u := u.(type) {
-	case *UpdatesObj:
-		chat := u.Chats[0]
-		if ch, ok := chat.(*Channel); ok {
-			return ch, nil
+	if ch, ok := c.updatesChat(updates).(*Channel); ok {
+		return ch, nil
+	}
+	return nil, errors.New("the reply didn't contain the channel created")
+}
+
+// CreateGroup creates a basic group with the users, at least one user other than the account
+// must be added. The group is cached and returned.
+// This method is a wrapper for messages.createChat.
+//
+//	Params:
+//	 - title: the title of the group
+//	 - users: the ids, usernames or peers of the users to add
+func (c *Client) CreateGroup(title string, users ...interface{}) (*ChatObj, error) {
+	inputUsers := make([]InputUser, 0, len(users))
+	for _, u := range users {
+		peer, err := c.GetSendablePeer(u)
+		if err != nil {
+			return nil, err
+		}
+		user, err := inputUser(peer)
+		if err != nil {
+			return nil, err
 		}
+		inputUsers = append(inputUsers, user)
+	}
+	updates, err := c.MessagesCreateChat(inputUsers, title, 0)
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("empty reply from server")
+	if chat, ok := c.updatesChat(updates).(*ChatObj); ok {
+		return chat, nil
+	}
+	return nil, errors.New("the reply didn't contain the group created")
 }
 
 func (c *Client) DeleteChannel(channelID interface{}) (*Updates, error) {
@@ -637,3 +1059,52 @@ func (c *Client) GetChatJoinRequests(channelID interface{}, lim int) ([]*UserObj
 
 	return allUsers, nil
 }
+
+// GetFullChannel returns the full info of a channel or supergroup, like its about and participants count,
+// cached for ClientConfig.FullInfoTTL or until an update about the channel arrives
+//
+//	Params:
+//	 - channelID: the channel or supergroup ID
+func (c *Client) GetFullChannel(channelID interface{}) (*ChannelFull, error) {
+	peer, err := c.GetSendablePeer(channelID)
+	if err != nil {
+		return nil, err
+	}
+	channelPeer, ok := peer.(*InputPeerChannel)
+	if !ok {
+		return nil, errors.New("could not convert peer to channel")
+	}
+	if full, ok := c.Cache.getChannelFull(channelPeer.ChannelID, time.Now()); ok {
+		return full, nil
+	}
+	fullChat, err := c.ChannelsGetFullChannel(&InputChannelObj{
+		ChannelID:  channelPeer.ChannelID,
+		AccessHash: channelPeer.AccessHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.Cache.UpdatePeersToCache(fullChat.Users, fullChat.Chats)
+	channelFull, ok := fullChat.FullChat.(*ChannelFull)
+	if !ok {
+		return nil, errors.New("could not convert full chat to channel")
+	}
+	c.Cache.setChannelFull(channelFull, time.Now())
+	return channelFull, nil
+}
+
+// GetLinkedChat returns the linked discussion group of a channel,
+// or the linked channel of a discussion group.
+//
+//	Params:
+//	 - channelID: the channel or supergroup ID
+func (c *Client) GetLinkedChat(channelID interface{}) (*Channel, error) {
+	channelFull, err := c.GetFullChannel(channelID)
+	if err != nil {
+		return nil, err
+	}
+	if channelFull.LinkedChatID == 0 {
+		return nil, errors.New("channel has no linked chat")
+	}
+	return c.GetChannel(channelFull.LinkedChatID)
+}
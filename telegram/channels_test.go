@@ -0,0 +1,137 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestInputChatPhoto(t *testing.T) {
+	c := &Client{Cache: NewCache()}
+	file := &InputFileObj{ID: 1, Parts: 1, Name: "photo.jpg"}
+	photo := &InputPhotoObj{ID: 2, AccessHash: 3, FileReference: []byte{4}}
+
+	tests := []struct {
+		photo interface{}
+		want  InputChatPhoto
+	}{
+		{file, &InputChatUploadedPhoto{File: file}},
+		{photo, &InputChatPhotoObj{ID: photo}},
+		{&PhotoObj{ID: 2, AccessHash: 3, FileReference: []byte{4}}, &InputChatPhotoObj{ID: photo}},
+		{&InputChatPhotoEmpty{}, &InputChatPhotoEmpty{}},
+	}
+	for _, tt := range tests {
+		got, err := c.inputChatPhoto(tt.photo)
+		if err != nil {
+			t.Fatalf("inputChatPhoto(%T): %v", tt.photo, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("inputChatPhoto(%T) = %#v, want %#v", tt.photo, got, tt.want)
+		}
+	}
+	if _, err := c.inputChatPhoto(42); err == nil {
+		t.Error("inputChatPhoto(42) should fail")
+	}
+}
+
+func TestParseJoinLink(t *testing.T) {
+	tests := []struct {
+		link, username, hash string
+	}{
+		{"@gogram", "gogram", ""},
+		{"gogram", "gogram", ""},
+		{"https://t.me/gogram/12", "gogram", ""},
+		{"t.me/gogram?start=1", "gogram", ""},
+		{"https://t.me/+AbCd_123-xyz", "", "AbCd_123-xyz"},
+		{"https://telegram.me/joinchat/AbCd123", "", "AbCd123"},
+		{"tg://join?invite=AbCd123", "", "AbCd123"},
+		{"tg://resolve?domain=gogram", "gogram", ""},
+	}
+	for _, tt := range tests {
+		username, hash := parseJoinLink(tt.link)
+		if username != tt.username || hash != tt.hash {
+			t.Errorf("parseJoinLink(%q) = %q, %q, want %q, %q", tt.link, username, hash, tt.username, tt.hash)
+		}
+	}
+}
+
+func TestUpdatesChat(t *testing.T) {
+	c := &Client{Cache: NewCache()}
+	channel := &Channel{ID: 100, AccessHash: 5, Title: "created"}
+	updates := &UpdatesObj{Chats: []Chat{&ChatForbidden{ID: 1}, channel}}
+
+	if got := c.updatesChat(updates); got != channel {
+		t.Fatalf("updatesChat() = %#v, want the channel", got)
+	}
+	if _, err := c.GetChannel(100); err != nil {
+		t.Errorf("the channel wasn't cached: %v", err)
+	}
+	if got := c.updatesChat(&UpdateShort{}); got != nil {
+		t.Errorf("updatesChat(UpdateShort) = %#v, want nil", got)
+	}
+}
+
+func TestAddMembers(t *testing.T) {
+	users := []InputUser{&InputUserObj{UserID: 1}, &InputUserObj{UserID: 2}, &InputUserObj{UserID: 3}}
+	var calls [][]int64
+	invite := func(batch []InputUser) error {
+		var ids []int64
+		for _, u := range batch {
+			ids = append(ids, u.(*InputUserObj).UserID)
+		}
+		calls = append(calls, ids)
+		for _, id := range ids {
+			if id == 2 {
+				return &RPCError{Code: 403, Message: "USER_PRIVACY_RESTRICTED"}
+			}
+		}
+		return nil
+	}
+
+	errs, err := addMembers(users, 2, invite)
+	if err != nil {
+		t.Fatalf("addMembers: %v", err)
+	}
+	if len(errs) != 3 || errs[0] != nil || !errors.Is(errs[1], ErrUserPrivacyRestricted) || errs[2] != nil {
+		t.Errorf("addMembers errors = %v, want only the second user to fail", errs)
+	}
+	// the failing batch is retried user by user to tell which one failed
+	if want := [][]int64{{1, 2}, {1}, {2}, {3}}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("invites = %v, want %v", calls, want)
+	}
+
+	errs, err = addMembers(users, 2, func([]InputUser) error {
+		return &RPCError{Code: 400, Message: "CHAT_ADMIN_REQUIRED"}
+	})
+	if err == nil || len(errs) != 0 {
+		t.Errorf("addMembers = %v, %v, want to stop at the chat error", errs, err)
+	}
+}
+
+func TestCollectInviteLinks(t *testing.T) {
+	var all []ExportedChatInvite
+	for i := 0; i < 5; i++ {
+		all = append(all, &ChatInviteExported{Link: "https://t.me/+" + string(rune('a'+i)), Date: int32(100 - i)})
+	}
+	var offsets []int32
+	links, err := collectInviteLinks(func(offsetDate int32, offsetLink string) (*MessagesExportedChatInvites, error) {
+		offsets = append(offsets, offsetDate)
+		start := 0
+		for i, invite := range all {
+			if invite.(*ChatInviteExported).Link == offsetLink {
+				start = i + 1
+			}
+		}
+		return &MessagesExportedChatInvites{Count: 5, Invites: all[start:min(start+2, len(all))]}, nil
+	})
+	if err != nil {
+		t.Fatalf("collectInviteLinks: %v", err)
+	}
+	if len(links) != 5 || links[4].Link != "https://t.me/+e" {
+		t.Errorf("collectInviteLinks returned %d links, want all 5", len(links))
+	}
+	if want := []int32{0, 99, 97}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("offsets = %v, want %v", offsets, want)
+	}
+}
@@ -0,0 +1,278 @@
+package telegram
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	mtproto "github.com/roj1512/gogram"
+	"github.com/roj1512/gogram/internal/keys"
+	"github.com/roj1512/gogram/internal/session"
+	"github.com/roj1512/gogram/internal/utils"
+)
+
+func TestIdleCtx(t *testing.T) {
+	client, err := NewClient(ClientConfig{AppID: 1, AppHash: "hash", MemorySession: true, LogLevel: LogError})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- client.IdleCtx(ctx)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("IdleCtx did not return after the context was canceled")
+	}
+	if !client.stopped() {
+		t.Error("client was not stopped")
+	}
+	if HandleIncomingUpdates(&UpdatesObj{}, client) {
+		t.Error("updates were handled after the client stopped")
+	}
+}
+
+func TestDisconnectPausesCacheFlush(t *testing.T) {
+	client, err := NewClient(ClientConfig{AppID: 1, AppHash: "hash", MemorySession: true, LogLevel: LogError, EnableCache: true, CachePath: t.TempDir() + "/cache.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	if err := client.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if client.Cache.flushTimer != nil || !client.flushPaused.Load() {
+		t.Error("the cache flush was not paused")
+	}
+	if client.stopped() {
+		t.Error("Disconnect stopped the client")
+	}
+}
+
+// silentServer accepts connections and reads the requests sent on them without ever
+// answering, a value is sent on the returned channel once a connection got a request
+func silentServer(t *testing.T) (string, <-chan struct{}) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	received := make(chan struct{}, 4)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 4096)
+				var read int
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+					// past the 4 bytes choosing the transport mode
+					if read <= 4 && read+n > 4 {
+						received <- struct{}{}
+					}
+					read += n
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+func TestDisconnectPendingRequests(t *testing.T) {
+	addr, received := silentServer(t)
+	sess := session.NewStringSession(make([]byte, 256), make([]byte, 8), 2, addr, 1).Encode()
+	client, err := NewClient(ClientConfig{
+		AppID:         1,
+		AppHash:       "hash",
+		MemorySession: true,
+		StringSession: sess,
+		LogLevel:      LogError,
+		EnableCache:   true,
+		CachePath:     t.TempDir() + "/cache.db",
+		CacheEntryTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	connect := func() <-chan error {
+		done := make(chan error, 1)
+		go func() { done <- client.Connect() }()
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the initial request wasn't sent")
+		}
+		return done
+	}
+	disconnect := func(done <-chan error) {
+		if err := client.Disconnect(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if !errors.Is(err, mtproto.ErrDisconnected) {
+				t.Errorf("expected the initial request to fail with ErrDisconnected, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the initial request was still waiting after Disconnect")
+		}
+	}
+	running := func() (flushing, sweeping bool) {
+		client.Cache.RLock()
+		defer client.Cache.RUnlock()
+		return client.Cache.flushTimer != nil, client.Cache.sweepStop != nil
+	}
+
+	disconnect(connect())
+	if flushing, sweeping := running(); flushing || sweeping {
+		t.Errorf("Disconnect left the cache flushing (%v) or sweeping (%v)", flushing, sweeping)
+	}
+
+	done := connect()
+	if flushing, sweeping := running(); !flushing || !sweeping || client.flushPaused.Load() {
+		t.Errorf("Connect didn't restart the cache flush (%v) and sweeper (%v)", flushing, sweeping)
+	}
+	disconnect(done)
+}
+
+func TestServerHost(t *testing.T) {
+	c := &Client{Log: utils.NewLogger("test")}
+	config := c.cleanClientConfig(ClientConfig{TestMode: true, MemorySession: true})
+	if host, err := serverHost(config); err != nil || host != TestDataCenters[DefaultTestDataCenter] {
+		t.Errorf("test mode: got %q, %v", host, err)
+	}
+	if keys, _ := keys.GetTestRSAKeys(); len(config.PublicKeys) != 1 || config.PublicKeys[0].N.Cmp(keys[0].N) != 0 {
+		t.Error("test mode doesn't use the public key of the test servers")
+	}
+	if host, _ := serverHost(ClientConfig{DataCenter: 1, DCList: map[int]string{1: "127.0.0.1:443"}}); host != "127.0.0.1:443" {
+		t.Errorf("DCList override: got %q", host)
+	}
+	// a partial DCList keeps the address of the other DCs
+	partial := map[int]string{1: "127.0.0.1:443"}
+	if host, _ := serverHost(ClientConfig{DataCenter: 2, DCList: partial}); host != DataCenters[2] {
+		t.Errorf("DC missing from DCList: got %q", host)
+	}
+	if host, _ := serverHost(ClientConfig{TestMode: true, DataCenter: 2, DCList: partial}); host != TestDataCenters[2] {
+		t.Errorf("test DC missing from DCList: got %q", host)
+	}
+	if _, err := serverHost(ClientConfig{TestMode: true, DataCenter: 5}); err == nil {
+		t.Error("the test servers have no DC 5")
+	}
+}
+
+func TestTakeoutRequest(t *testing.T) {
+	c := &Client{Cache: NewCache()}
+	req := &AccountFinishTakeoutSessionParams{Success: true}
+	if c.takeoutRequest(req) != Object(req) {
+		t.Error("a request outside a takeout session was wrapped")
+	}
+	takeout := newTakeoutSession(c, 42).client
+	wrapped, ok := takeout.takeoutRequest(req).(*InvokeWithTakeoutParams)
+	if !ok || wrapped.TakeoutID != 42 || wrapped.Query != Object(req) {
+		t.Fatalf("got %#v", takeout.takeoutRequest(req))
+	}
+	if takeout.takeoutRequest(wrapped) != Object(wrapped) {
+		t.Error("a request was wrapped twice")
+	}
+}
+
+// requestRecorder records the names of the requests made
+type requestRecorder struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (r *requestRecorder) ObserveRequest(method string, _ time.Duration, _ error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names = append(r.names, method)
+}
+
+func (r *requestRecorder) last() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.names) == 0 {
+		return ""
+	}
+	return r.names[len(r.names)-1]
+}
+
+func TestTakeoutSessionRequests(t *testing.T) {
+	newClient := func(metrics Metrics) *Client {
+		c, err := NewClient(ClientConfig{AppID: 1, AppHash: "hash", MemorySession: true, LogLevel: LogError, Metrics: metrics})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Stop() })
+		return c
+	}
+	main, senderMetrics := &requestRecorder{}, &requestRecorder{}
+	client := newClient(main)
+	sender := newClient(senderMetrics)
+	client.exportedSenders.senders = map[int][]*Client{5: {sender}}
+	takeout := newTakeoutSession(client, 42)
+
+	// the client isn't connected, the requests fail once recorded
+	takeout.client.getFileChunk(context.Background(), &InputDocumentFileLocation{}, 0, 4096)
+	if got := main.last(); got != "InvokeWithTakeout" {
+		t.Errorf("file chunk request sent as %q", got)
+	}
+	r, err := takeout.DownloadReader(&InputDocumentFileLocation{}, &DownloadOptions{DcID: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Read(make([]byte, 1))
+	if got := senderMetrics.last(); got != "InvokeWithTakeout" {
+		t.Errorf("file chunk request of an exported sender sent as %q", got)
+	}
+
+	takeout.Finish(true)
+	if _, err := takeout.MakeRequest(&HelpGetConfigParams{}); !errors.Is(err, ErrTakeoutFinished) {
+		t.Errorf("request after Finish: %v", err)
+	}
+	if _, err := takeout.parent.MakeRequest(&HelpGetConfigParams{}); errors.Is(err, ErrTakeoutFinished) {
+		t.Error("finishing the takeout session stopped the client")
+	}
+}
+
+func TestClientDataDefaults(t *testing.T) {
+	client, err := NewClient(ClientConfig{AppID: 1, AppHash: "hash", MemorySession: true, LogLevel: LogError, LangCode: "de", LangPack: "android"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	data := client.clientData
+	if data.sysLangCode != "de" || data.langPack != "android" || data.appVersion != DefaultAppVersion || data.deviceModel != DefaultDevice {
+		t.Errorf("got %+v", data)
+	}
+}
+
+// answeringClient returns an offline client whose requests are answered by answer instead
+// of telegram; answer may be called from several goroutines
+func answeringClient(t *testing.T, answer func(req Object) (any, error)) *Client {
+	t.Helper()
+	c, err := NewClient(ClientConfig{AppID: 1, AppHash: "hash", MemorySession: true, LogLevel: LogError})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.invoke = func(_ context.Context, req Object) (any, error) {
+		return answer(req)
+	}
+	t.Cleanup(func() { c.Stop() })
+	return c
+}
@@ -6,6 +6,7 @@ const (
 	ApiVersion = 170
 	Version    = "v2.3.5"
 
+	LogTrace   = "trace" // debug, with every request and response
 	LogDebug   = "debug"
 	LogInfo    = "info"
 	LogWarn    = "warn"
@@ -15,6 +16,8 @@ const (
 	MarkDown   string = "Markdown"
 	HTML       string = "HTML"
 	MarkDownV2 string = "MarkdownV2"
+	// NoParseMode sends the text as is, overriding the client's default parse mode
+	NoParseMode string = "None"
 
 	EntityUser    string = "user"
 	EntityChat    string = "chat"
@@ -41,7 +44,28 @@ const (
 
 var (
 	USERNAME_RE = regexp.MustCompile(`(?i)@|(?:https?://)?(?:www\.)?(?:telegram\.(?:me|dog)|t\.me)/(@|\+|joinchat/)?`)
-	TG_JOIN_RE  = regexp.MustCompile(`(?i)tg://join\?invite=([a-z0-9_\-]{22})`)
+	TG_JOIN_RE  = regexp.MustCompile(`(?i)tg://join\?invite=([a-z0-9_\-]+)`)
+	tgResolveRE = regexp.MustCompile(`(?i)tg://resolve\?domain=([a-z0-9_]+)`)
+)
+
+// ChatAction is a chat action shown to the other members of a chat, like "typing..."
+type ChatAction string
+
+const (
+	ActionTyping         ChatAction = "typing"
+	ActionUploadPhoto    ChatAction = "upload_photo"
+	ActionRecordVideo    ChatAction = "record_video"
+	ActionUploadVideo    ChatAction = "upload_video"
+	ActionRecordVoice    ChatAction = "record_audio"
+	ActionUploadVoice    ChatAction = "upload_audio"
+	ActionUploadDocument ChatAction = "upload_document"
+	ActionRecordRound    ChatAction = "record_round"
+	ActionUploadRound    ChatAction = "round_video"
+	ActionChooseSticker  ChatAction = "choose_sticker"
+	ActionChooseContact  ChatAction = "choose_contact"
+	ActionFindLocation   ChatAction = "geo"
+	ActionPlayGame       ChatAction = "game"
+	ActionCancel         ChatAction = "cancel"
 )
 
 var (
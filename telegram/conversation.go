@@ -73,8 +73,11 @@ func (c *Conversation) GetResponse() (*NewMessage, error) {
 	//peerID := c.Client.GetPeerID(c.Peer)
 	resp := make(chan *NewMessage, 1)
 	waitFunc := func(m *NewMessage) error {
-		resp <- m
-		c.lastMsg = m
+		select {
+		case resp <- m:
+			c.lastMsg = m
+		default:
+		}
 		return nil
 	}
 	//var filter = &Filters{}
@@ -87,6 +90,7 @@ func (c *Conversation) GetResponse() (*NewMessage, error) {
 	//}
 	h := c.Client.AddMessageHandler(OnNewMessage, waitFunc)
 	c.openH = append(c.openH, &h)
+	c.Client.releaseChat(c.Peer)
 	select {
 	case <-time.After(time.Duration(c.timeOut) * time.Second):
 		go c.removeHandle(&h)
@@ -99,7 +103,7 @@ func (c *Conversation) GetResponse() (*NewMessage, error) {
 
 func (c *Conversation) GetEdit() (*NewMessage, error) {
 	peerID := c.Client.GetPeerID(c.Peer)
-	resp := make(chan *NewMessage)
+	resp := make(chan *NewMessage, 1)
 	waitFunc := func(m *NewMessage) error {
 		IsTrigger := false
 		switch c.Peer.(type) {
@@ -116,13 +120,17 @@ func (c *Conversation) GetEdit() (*NewMessage, error) {
 			}
 		}
 		if IsTrigger {
-			resp <- m
-			c.lastMsg = m
+			select {
+			case resp <- m:
+				c.lastMsg = m
+			default:
+			}
 		}
 		return nil
 	}
 	h := c.Client.AddEditHandler(OnEditMessage, waitFunc)
 	c.openH = append(c.openH, &h)
+	c.Client.releaseChat(c.Peer)
 	select {
 	case <-time.After(time.Duration(c.timeOut) * time.Second):
 		go c.removeHandle(&h)
@@ -135,7 +143,7 @@ func (c *Conversation) GetEdit() (*NewMessage, error) {
 
 func (c *Conversation) GetReply() (*NewMessage, error) {
 	peerID := c.Client.GetPeerID(c.Peer)
-	resp := make(chan *NewMessage)
+	resp := make(chan *NewMessage, 1)
 	waitFunc := func(m *NewMessage) error {
 		if m.IsReply() {
 			IsTrigger := false
@@ -153,14 +161,18 @@ func (c *Conversation) GetReply() (*NewMessage, error) {
 				}
 			}
 			if IsTrigger {
-				resp <- m
-				c.lastMsg = m
+				select {
+				case resp <- m:
+					c.lastMsg = m
+				default:
+				}
 			}
 		}
 		return nil
 	}
 	h := c.Client.AddMessageHandler(OnNewMessage, waitFunc)
 	c.openH = append(c.openH, &h)
+	c.Client.releaseChat(c.Peer)
 	select {
 	case <-time.After(time.Duration(c.timeOut) * time.Second):
 		go c.removeHandle(&h)
@@ -180,13 +192,17 @@ func (c *Conversation) MarkRead() (*MessagesAffectedMessages, error) {
 }
 
 func (c *Conversation) WaitEvent(ev *Update) (Update, error) {
-	resp := make(chan Update)
+	resp := make(chan Update, 1)
 	waitFunc := func(u Update, c *Client) error {
-		resp <- u
+		select {
+		case resp <- u:
+		default:
+		}
 		return nil
 	}
 	h := c.Client.AddRawHandler(*ev, waitFunc)
 	c.openH = append(c.openH, &h)
+	c.Client.releaseChat(c.Peer)
 	select {
 	case <-time.After(time.Duration(c.timeOut) * time.Second):
 		go c.removeHandle(&h)
@@ -0,0 +1,114 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// defaultDedupCacheSize is the number of update keys remembered unless ClientConfig.DedupCacheSize is set
+const defaultDedupCacheSize = 1000
+
+// updateDedup remembers the keys of the most recent updates, dropping the
+// least recently seen one when full, to drop updates delivered twice
+type updateDedup struct {
+	sync.Mutex
+	size  int
+	order *list.List
+	keys  map[string]*list.Element
+}
+
+func newUpdateDedup(size int) *updateDedup {
+	if size <= 0 {
+		size = defaultDedupCacheSize
+	}
+	return &updateDedup{size: size, order: list.New(), keys: make(map[string]*list.Element, size)}
+}
+
+// seen reports whether key was already seen, remembering it otherwise
+func (d *updateDedup) seen(key string) bool {
+	d.Lock()
+	defer d.Unlock()
+	if el, ok := d.keys[key]; ok {
+		d.order.MoveToFront(el)
+		return true
+	}
+	d.keys[key] = d.order.PushFront(key)
+	if d.order.Len() > d.size {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.keys, oldest.Value.(string))
+	}
+	return false
+}
+
+// isDuplicate reports whether the update was already dispatched, always false with deduplication off
+func (c *Client) isDuplicate(update any) bool {
+	if c.dedup == nil {
+		return false
+	}
+	key, ok := updateKey(update)
+	return ok && c.dedup.seen(key)
+}
+
+// updateKey identifies an update by the message or query it's about, updates
+// without such an identifier are never taken for duplicates
+func updateKey(update any) (string, bool) {
+	switch u := update.(type) {
+	case *UpdateNewMessage:
+		return messageKey("new", u.Message)
+	case *UpdateNewChannelMessage:
+		return messageKey("new", u.Message)
+	case *UpdateNewScheduledMessage:
+		return messageKey("scheduled", u.Message)
+	case *UpdateEditMessage:
+		return messageKey("edit", u.Message)
+	case *UpdateEditChannelMessage:
+		return messageKey("edit", u.Message)
+	case *UpdateShortMessage:
+		return fmt.Sprintf("new:%d:%d", u.UserID, u.ID), true
+	case *UpdateShortChatMessage:
+		return fmt.Sprintf("new:%d:%d", -u.ChatID, u.ID), true
+	case *UpdateDeleteMessages:
+		return fmt.Sprintf("delete:%d", u.Pts), true
+	case *UpdateDeleteChannelMessages:
+		return fmt.Sprintf("delete:%d:%d", u.ChannelID, u.Pts), true
+	case *UpdateBotCallbackQuery:
+		return fmt.Sprintf("callback:%d", u.QueryID), true
+	case *UpdateInlineBotCallbackQuery:
+		return fmt.Sprintf("callback:%d", u.QueryID), true
+	case *UpdateBotInlineQuery:
+		return fmt.Sprintf("inline:%d", u.QueryID), true
+	}
+	return "", false
+}
+
+// messageKey is kind:peer:id, the same key as the short updates of a new message,
+// edits also carry the edit date as a message can be edited many times
+func messageKey(kind string, msg Message) (string, bool) {
+	switch msg := msg.(type) {
+	case *MessageObj:
+		if kind == "edit" {
+			return fmt.Sprintf("%s:%d:%d:%d", kind, peerKey(msg.PeerID), msg.ID, msg.EditDate), true
+		}
+		return fmt.Sprintf("%s:%d:%d", kind, peerKey(msg.PeerID), msg.ID), true
+	case *MessageService:
+		return fmt.Sprintf("%s:%d:%d", kind, peerKey(msg.PeerID), msg.ID), true
+	}
+	return "", false
+}
+
+// peerKey is the bot API style ID of a peer, telling users, chats and channels apart
+func peerKey(peer Peer) int64 {
+	switch peer := peer.(type) {
+	case *PeerUser:
+		return peer.UserID
+	case *PeerChat:
+		return -peer.ChatID
+	case *PeerChannel:
+		return ChannelIDToPeerID(peer.ChannelID)
+	}
+	return 0
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// maxDialogsLimit is the most dialogs messages.getDialogs returns per request
+const maxDialogsLimit = 100
+
+// CustomDialog is a dialog of the chat list with its top message
+type CustomDialog struct {
+	// Dialog is the raw *DialogObj, or *DialogFolder for a folder shown in the list
+	Dialog      Dialog
+	Peer        Peer
+	TopMessage  *NewMessage
+	UnreadCount int32
+	// UnreadMentions is the number of unread mentions of the account
+	UnreadMentions int32
+	Pinned         bool
+	FolderID       int32
+}
+
+// ChatID returns the bot API style ID of the chat of the dialog
+func (d *CustomDialog) ChatID() int64 {
+	return peerKey(d.Peer)
+}
+
+// IsFolder reports whether the dialog is a folder (like the archive) shown in the chat list
+func (d *CustomDialog) IsFolder() bool {
+	_, ok := d.Dialog.(*DialogFolder)
+	return ok
+}
+
+type DialogIterOptions struct {
+	// FolderID lists the dialogs of a folder, 1 being the archive
+	FolderID int32
+	// ExcludePinned leaves out pinned dialogs
+	ExcludePinned bool
+	// Limit is the number of dialogs fetched per request, at most 100 (default 100)
+	Limit int32
+	// MaxCount stops the iteration after this many dialogs (zero for every dialog)
+	MaxCount int
+}
+
+// dialogOffset is the position messages.getDialogs continues from, the date, ID and
+// chat of the top message of the last dialog of the previous page
+type dialogOffset struct {
+	date int32
+	id   int32
+	peer InputPeer
+}
+
+// dialogPage is a page of messages.getDialogs results
+type dialogPage struct {
+	dialogs  []Dialog
+	messages []Message
+	// count is the number of dialogs of the account, zero when the page holds them all
+	count int32
+}
+
+// DialogIterator iterates over the chat list, a page at a time.
+//
+//	iter := client.IterDialogs(&DialogIterOptions{MaxCount: 200})
+//	for iter.Next() {
+//		fmt.Println(iter.Dialog().ChatID(), iter.Dialog().UnreadCount)
+//	}
+//	if err := iter.Err(); err != nil { ... }
+type DialogIterator struct {
+	pager[*CustomDialog]
+	fetch   func(offset dialogOffset, limit int32) (dialogPage, error)
+	resolve func(peer Peer) (InputPeer, error)
+	pack    func(msg Message) *NewMessage
+	offset  dialogOffset
+	seen    map[int64]bool
+	current *CustomDialog
+}
+
+// IterDialogs returns an iterator over the dialogs of the account, most recent first
+// after the pinned ones. Pages are fetched with messages.getDialogs as the iterator
+// advances, waiting out FLOOD_WAIT errors between them, their users and chats are cached.
+func (c *Client) IterDialogs(Opts ...*DialogIterOptions) *DialogIterator {
+	opts := getVariadic(Opts, &DialogIterOptions{}).(*DialogIterOptions)
+	return newDialogIterator(*opts, func(offset dialogOffset, limit int32) (dialogPage, error) {
+		resp, err := c.MessagesGetDialogs(&MessagesGetDialogsParams{
+			ExcludePinned: opts.ExcludePinned,
+			FolderID:      opts.FolderID,
+			OffsetDate:    offset.date,
+			OffsetID:      offset.id,
+			OffsetPeer:    offset.peer,
+			Limit:         limit,
+		})
+		if err != nil {
+			return dialogPage{}, err
+		}
+		switch resp := resp.(type) {
+		case *MessagesDialogsObj:
+			c.Cache.UpdatePeersToCache(resp.Users, resp.Chats)
+			return dialogPage{dialogs: resp.Dialogs, messages: resp.Messages}, nil
+		case *MessagesDialogsSlice:
+			c.Cache.UpdatePeersToCache(resp.Users, resp.Chats)
+			return dialogPage{dialogs: resp.Dialogs, messages: resp.Messages, count: resp.Count}, nil
+		case *MessagesDialogsNotModified:
+			return dialogPage{}, nil
+		}
+		return dialogPage{}, fmt.Errorf("unexpected response: %s", reflect.TypeOf(resp))
+	}, func(peer Peer) (InputPeer, error) {
+		return c.GetSendablePeer(peer)
+	}, func(msg Message) *NewMessage {
+		return packMessage(c, msg)
+	})
+}
+
+func newDialogIterator(opts DialogIterOptions, fetch func(dialogOffset, int32) (dialogPage, error), resolve func(Peer) (InputPeer, error), pack func(Message) *NewMessage) *DialogIterator {
+	if opts.Limit <= 0 || opts.Limit > maxDialogsLimit {
+		opts.Limit = maxDialogsLimit
+	}
+	it := &DialogIterator{
+		fetch:   fetch,
+		resolve: resolve,
+		pack:    pack,
+		offset:  dialogOffset{peer: &InputPeerEmpty{}},
+		seen:    make(map[int64]bool),
+	}
+	it.pager = newPager(opts.Limit, opts.MaxCount, it.fetchPage)
+	return it
+}
+
+// Next advances to the next dialog, returning false at the end of the chat list or on error
+func (it *DialogIterator) Next() bool {
+	dialog, ok := it.next()
+	if ok {
+		it.current = dialog
+	}
+	return ok
+}
+
+// Dialog returns the current dialog
+func (it *DialogIterator) Dialog() *CustomDialog {
+	return it.current
+}
+
+func (it *DialogIterator) fetchPage(limit int32) ([]*CustomDialog, bool, error) {
+	page, err := it.fetch(it.offset, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	topMessages := make(map[[2]int64]Message, len(page.messages))
+	for _, msg := range page.messages {
+		topMessages[[2]int64{peerKey(messageChat(msg)), int64(messageID(msg))}] = msg
+	}
+	var dialogs []*CustomDialog
+	var last *CustomDialog
+	var lastTop Message
+	for _, d := range page.dialogs {
+		dialog := &CustomDialog{Dialog: d}
+		switch d := d.(type) {
+		case *DialogObj:
+			dialog.Peer, dialog.Pinned, dialog.FolderID = d.Peer, d.Pinned, d.FolderID
+			dialog.UnreadCount, dialog.UnreadMentions = d.UnreadCount, d.UnreadMentionsCount
+		case *DialogFolder:
+			dialog.Peer, dialog.Pinned = d.Peer, d.Pinned
+			dialog.UnreadCount = d.UnreadUnmutedMessagesCount + d.UnreadMutedMessagesCount
+			if d.Folder != nil {
+				dialog.FolderID = d.Folder.ID
+			}
+		default:
+			continue
+		}
+		top := topMessages[[2]int64{peerKey(dialog.Peer), int64(dialogTopMessage(d))}]
+		if top != nil {
+			dialog.TopMessage = it.pack(top)
+			// the next page starts after the last dialog with a message, those without
+			// one (like a chat whose history was cleared) can't be an offset
+			if _, folder := d.(*DialogFolder); !folder {
+				last, lastTop = dialog, top
+			}
+		}
+		if key := peerKey(dialog.Peer); !it.seen[key] {
+			it.seen[key] = true
+			dialogs = append(dialogs, dialog)
+		}
+	}
+	// a complete list comes as messages.dialogs, a slice ends once every dialog was listed
+	if page.count == 0 || len(it.seen) >= int(page.count) || len(dialogs) == 0 || last == nil {
+		return dialogs, true, nil
+	}
+	peer, err := it.resolve(last.Peer)
+	if err != nil {
+		return dialogs, true, err
+	}
+	next := dialogOffset{date: messageDate(lastTop), id: messageID(lastTop), peer: peer}
+	if next.date == it.offset.date && next.id == it.offset.id {
+		// the offset didn't move, asking again would return the same page
+		return dialogs, true, nil
+	}
+	it.offset = next
+	return dialogs, false, nil
+}
+
+func dialogTopMessage(d Dialog) int32 {
+	switch d := d.(type) {
+	case *DialogObj:
+		return d.TopMessage
+	case *DialogFolder:
+		return d.TopMessage
+	}
+	return 0
+}
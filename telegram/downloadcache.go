@@ -0,0 +1,232 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DEFAULT_DOWNLOAD_CACHE_SIZE is the default max size of the on-disk download cache (512 MB)
+	DEFAULT_DOWNLOAD_CACHE_SIZE int64 = 512 * 1024 * 1024
+)
+
+// downloadCache is an on-disk, size-bounded LRU cache of downloaded files,
+// keyed by the file's id (and thumb size for photos) and its size.
+// The key doesn't include the file reference, as the bytes of a file never change.
+type downloadCache struct {
+	sync.Mutex
+	dir     string
+	maxSize int64
+	size    int64
+	entries map[string]*downloadCacheEntry
+}
+
+type downloadCacheEntry struct {
+	size     int64
+	lastUsed time.Time
+}
+
+// SetDownloadCacheDir enables the on-disk download cache, DownloadMedia
+// serves files from this directory instead of downloading them again.
+// Least recently used files are evicted once the cache exceeds maxSize bytes.
+//
+//	Params:
+//	  - path: The directory to store cached files in, an empty path disables the cache.
+//	  - maxSize: Max size of the cache in bytes (default 512 MB).
+func (c *Client) SetDownloadCacheDir(path string, maxSize ...int64) error {
+	if path == "" {
+		c.downloadCache.Store(nil)
+		return nil
+	}
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return errors.Wrap(err, "creating download cache dir")
+	}
+	dc := &downloadCache{
+		dir:     path,
+		maxSize: getVariadic(maxSize, DEFAULT_DOWNLOAD_CACHE_SIZE).(int64),
+		entries: make(map[string]*downloadCacheEntry),
+	}
+	if err := dc.load(); err != nil {
+		return errors.Wrap(err, "loading download cache")
+	}
+	c.downloadCache.Store(dc)
+	return nil
+}
+
+// load indexes files already present in the cache directory
+func (dc *downloadCache) load() error {
+	files, err := os.ReadDir(dc.dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if filepath.Ext(f.Name()) == ".tmp" {
+			// leftover from an interrupted store
+			os.Remove(filepath.Join(dc.dir, f.Name()))
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		dc.entries[f.Name()] = &downloadCacheEntry{size: info.Size(), lastUsed: info.ModTime()}
+		dc.size += info.Size()
+	}
+	dc.evict()
+	return nil
+}
+
+// getDownloadCacheKey returns the cache key for a file location, or an empty string if it can't be cached
+func getDownloadCacheKey(location InputFileLocation, size int64) string {
+	if size <= 0 {
+		return ""
+	}
+	switch l := location.(type) {
+	case *InputDocumentFileLocation:
+		return fmt.Sprintf("doc_%d_%s_%d", l.ID, l.ThumbSize, size)
+	case *InputPhotoFileLocation:
+		return fmt.Sprintf("photo_%d_%s_%d", l.ID, l.ThumbSize, size)
+	default:
+		return ""
+	}
+}
+
+// open opens the cached file with the given key, reporting whether it was found.
+// The file is read without holding the lock, an eviction meanwhile only unlinks it.
+func (dc *downloadCache) open(key string) (*os.File, bool) {
+	dc.Lock()
+	defer dc.Unlock()
+	entry, ok := dc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	path := filepath.Join(dc.dir, key)
+	file, err := os.Open(path)
+	if err != nil {
+		// file was removed from under us, forget it
+		dc.size -= entry.size
+		delete(dc.entries, key)
+		return nil, false
+	}
+	if stat, err := file.Stat(); err != nil || stat.Size() != entry.size {
+		file.Close()
+		dc.size -= entry.size
+		delete(dc.entries, key)
+		return nil, false
+	}
+	entry.lastUsed = time.Now()
+	os.Chtimes(path, entry.lastUsed, entry.lastUsed)
+	return file, true
+}
+
+// store copies a downloaded file into the cache under the given key
+func (dc *downloadCache) store(key, src string, size int64) error {
+	if dc.has(key) {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if stat, err := in.Stat(); err != nil || stat.Size() != size {
+		// incomplete download, don't cache it
+		return nil
+	}
+	// concurrent stores of the same file write their own temp file
+	out, err := os.CreateTemp(dc.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+
+	dc.Lock()
+	defer dc.Unlock()
+	if _, ok := dc.entries[key]; ok {
+		os.Remove(out.Name())
+		return nil
+	}
+	if err := os.Rename(out.Name(), filepath.Join(dc.dir, key)); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	dc.entries[key] = &downloadCacheEntry{size: n, lastUsed: time.Now()}
+	dc.size += n
+	dc.evict()
+	return nil
+}
+
+// has reports whether a file is cached under the given key
+func (dc *downloadCache) has(key string) bool {
+	dc.Lock()
+	defer dc.Unlock()
+	_, ok := dc.entries[key]
+	return ok
+}
+
+// fromDownloadCache writes the cached file for key to the downloader's destination
+func (d *Downloader) fromDownloadCache(dc *downloadCache, key string) (string, bool) {
+	cached, ok := dc.open(key)
+	if !ok {
+		return "", false
+	}
+	defer cached.Close()
+	if d.FileName == "" {
+		d.FileName = GenerateRandomString(10)
+	}
+	file, err := d.createFile()
+	if err != nil {
+		return "", false
+	}
+	_, err = io.Copy(file, cached)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		d.Client.Log.Warn("reading from download cache: ", err)
+		os.Remove(d.FileName)
+		return "", false
+	}
+	return d.FileName, true
+}
+
+// evict removes least recently used files until the cache fits maxSize
+func (dc *downloadCache) evict() {
+	if dc.size <= dc.maxSize {
+		return
+	}
+	keys := make([]string, 0, len(dc.entries))
+	for key := range dc.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return dc.entries[keys[i]].lastUsed.Before(dc.entries[keys[j]].lastUsed)
+	})
+	for _, key := range keys {
+		if dc.size <= dc.maxSize {
+			break
+		}
+		os.Remove(filepath.Join(dc.dir, key))
+		dc.size -= dc.entries[key].size
+		delete(dc.entries, key)
+	}
+}
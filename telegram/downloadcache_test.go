@@ -0,0 +1,113 @@
+package telegram
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDownloadCache(t *testing.T, maxSize int64) (*Client, *downloadCache) {
+	t.Helper()
+	client, err := NewClient(ClientConfig{AppID: 1, AppHash: "hash", MemorySession: true, LogLevel: LogError})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetDownloadCacheDir(t.TempDir(), maxSize); err != nil {
+		t.Fatal(err)
+	}
+	return client, client.downloadCache.Load()
+}
+
+func writeTestFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "src")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDownloadCacheHit(t *testing.T) {
+	client, dc := newTestDownloadCache(t, DEFAULT_DOWNLOAD_CACHE_SIZE)
+	if err := dc.store("doc_1__5", writeTestFile(t, "hello"), 5); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "dst")
+	d := &Downloader{Client: client, FileName: dst}
+	path, ok := d.fromDownloadCache(dc, "doc_1__5")
+	if !ok || path != dst {
+		t.Fatalf("expected a hit written to %s, got %q, %v", dst, path, ok)
+	}
+	if b, _ := os.ReadFile(dst); string(b) != "hello" {
+		t.Errorf("expected the cached content, got %q", b)
+	}
+}
+
+func TestDownloadCacheMiss(t *testing.T) {
+	client, dc := newTestDownloadCache(t, DEFAULT_DOWNLOAD_CACHE_SIZE)
+	dst := writeTestFile(t, "keep")
+	d := &Downloader{Client: client, FileName: dst}
+	if _, ok := d.fromDownloadCache(dc, "doc_1__5"); ok {
+		t.Fatal("expected a miss")
+	}
+	// a miss must leave the destination alone
+	if b, _ := os.ReadFile(dst); string(b) != "keep" {
+		t.Errorf("expected the destination to be untouched, got %q", b)
+	}
+}
+
+func TestDownloadCacheEvict(t *testing.T) {
+	_, dc := newTestDownloadCache(t, 10)
+	for i := 0; i < 3; i++ {
+		if err := dc.store(fmt.Sprintf("doc_%d__4", i), writeTestFile(t, "abcd"), 4); err != nil {
+			t.Fatal(err)
+		}
+		dc.entries[fmt.Sprintf("doc_%d__4", i)].lastUsed = time.Now().Add(time.Duration(i-10) * time.Second)
+	}
+	if dc.has("doc_0__4") || !dc.has("doc_1__4") || !dc.has("doc_2__4") {
+		t.Errorf("expected the least recently used file to be evicted, have %v", dc.entries)
+	}
+	if dc.size != 8 {
+		t.Errorf("expected a size of 8, got %d", dc.size)
+	}
+	if _, err := os.Stat(filepath.Join(dc.dir, "doc_0__4")); !os.IsNotExist(err) {
+		t.Errorf("expected the evicted file to be removed, got %v", err)
+	}
+}
+
+func TestDownloadCacheConcurrent(t *testing.T) {
+	client, dc := newTestDownloadCache(t, DEFAULT_DOWNLOAD_CACHE_SIZE)
+	src := writeTestFile(t, "hello")
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := dc.store("doc_1__5", src, 5); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			dst := filepath.Join(dir, fmt.Sprint(i))
+			d := &Downloader{Client: client, FileName: dst}
+			if _, ok := d.fromDownloadCache(client.downloadCache.Load(), "doc_1__5"); ok {
+				if b, _ := os.ReadFile(dst); string(b) != "hello" {
+					t.Errorf("expected the cached content, got %q", b)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if dc.size != 5 || len(dc.entries) != 1 {
+		t.Errorf("expected a single cached file of 5 bytes, got %d in %v", dc.size, dc.entries)
+	}
+	files, _ := os.ReadDir(dc.dir)
+	if len(files) != 1 {
+		t.Errorf("expected no temp file left, got %d files", len(files))
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DownloadToPath downloads the file at location to path, fetching up to workers
+// chunks concurrently and writing each at its offset, so memory use is bounded
+// by workers * chunk size whatever the file size.
+//
+//	Params:
+//	  - location: The location of the file.
+//	  - path: The file to write to, it's truncated first.
+//	  - workers: Number of concurrent chunk requests (default 4).
+//	  - Opts: DcID and Size of the file, ChunkSize (default 512 KB) and ProgressCallback.
+//
+// If Size is given, the downloaded file is checked to be exactly that size.
+func (c *Client) DownloadToPath(location InputFileLocation, path string, workers int, Opts ...*DownloadOptions) error {
+	opts := getVariadic(Opts, &DownloadOptions{}).(*DownloadOptions)
+	if location == nil {
+		return errors.New("location can not be nil")
+	}
+	chunkSize := opts.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DEFAULT_PARTS
+	}
+	if err := checkChunkSize(chunkSize); err != nil {
+		return err
+	}
+	workers = getInt(workers, DEFAULT_WORKERS)
+	dc := getInt(int(opts.DcID), c.GetDC())
+
+	senders := []*Client{c}
+	if dc != c.GetDC() {
+		borrowed, err := c.BorrowExportedSenders(dc, min(workers, maxExportedSenders))
+		if err != nil {
+			return errors.Wrap(err, "borrowing senders")
+		}
+		senders = borrowed
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "creating file")
+	}
+	fetch := func(ctx context.Context, worker int, offset int64, limit int32) ([]byte, error) {
+		return senders[worker%len(senders)].getFileChunk(ctx, location, offset, limit)
+	}
+	err = downloadChunks(file, fetch, chunkSize, int64(opts.Size), workers, opts.ProgressCallback)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// downloadChunks fetches the chunks of a file with workers goroutines, writing them to w at
+// their offsets. With an unknown size (zero), the first short chunk marks the end of the file.
+func downloadChunks(w *os.File, fetch func(ctx context.Context, worker int, offset int64, limit int32) ([]byte, error), chunkSize int32, size int64, workers int, progress func(received, total int64)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		next     int64
+		end      int64 = -1 // number of parts, -1 until known
+		received int64
+		firstErr error
+		partErrs = make(map[int64]error)
+		wg       sync.WaitGroup
+	)
+	if size > 0 {
+		end = (size + int64(chunkSize) - 1) / int64(chunkSize)
+	}
+	// nextPart hands out part indices in order until the end of the file
+	nextPart := func() (int64, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr != nil || (end >= 0 && next >= end) {
+			return 0, false
+		}
+		next++
+		return next - 1, true
+	}
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+		mu.Unlock()
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for {
+				part, ok := nextPart()
+				if !ok {
+					return
+				}
+				offset := part * int64(chunkSize)
+				chunk, err := fetch(ctx, worker, offset, chunkSize)
+				if err != nil {
+					err = errors.Wrap(err, fmt.Sprintf("fetching part %d", part))
+					if size > 0 {
+						fail(err)
+						return
+					}
+					// with an unknown size, requests past the end may fail before the short
+					// chunk is seen, these are checked once the end is known
+					mu.Lock()
+					partErrs[part] = err
+					mu.Unlock()
+					return
+				}
+				if len(chunk) > 0 {
+					if _, err := w.WriteAt(chunk, offset); err != nil {
+						fail(errors.Wrap(err, "writing chunk"))
+						return
+					}
+				}
+				mu.Lock()
+				if len(chunk) < int(chunkSize) && (end < 0 || part+1 < end) {
+					// short chunk, the file ends here
+					end = part + 1
+				}
+				received += int64(len(chunk))
+				if progress != nil {
+					progress(received, max(size, received))
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	for part, err := range partErrs {
+		if end < 0 || part < end {
+			return err
+		}
+	}
+
+	stat, err := w.Stat()
+	if err != nil {
+		return err
+	}
+	if size > 0 && stat.Size() != size {
+		return errors.Errorf("downloaded %d bytes, expected %d", stat.Size(), size)
+	}
+	return nil
+}
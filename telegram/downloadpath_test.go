@@ -0,0 +1,55 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadChunks(t *testing.T) {
+	file := make([]byte, 10*4096+321)
+	for i := range file {
+		file[i] = byte(i * 7)
+	}
+	fetch := func(_ context.Context, _ int, offset int64, limit int32) ([]byte, error) {
+		if offset >= int64(len(file)) {
+			return nil, errors.New("OFFSET_INVALID")
+		}
+		return file[offset:min(offset+int64(limit), int64(len(file)))], nil
+	}
+
+	for _, size := range []int64{int64(len(file)), 0} {
+		path := filepath.Join(t.TempDir(), "file")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var last int64
+		err = downloadChunks(f, fetch, 4096, size, 4, func(received, total int64) {
+			if received < last {
+				t.Errorf("progress went back from %d to %d", last, received)
+			}
+			last = received
+		})
+		f.Close()
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		got, _ := os.ReadFile(path)
+		if !bytes.Equal(got, file) {
+			t.Fatalf("size %d: downloaded file doesn't match", size)
+		}
+		if last != int64(len(file)) {
+			t.Fatalf("size %d: progress ended at %d", size, last)
+		}
+	}
+
+	f, _ := os.Create(filepath.Join(t.TempDir(), "file"))
+	defer f.Close()
+	if err := downloadChunks(f, fetch, 4096, int64(len(file))+4096, 2, nil); err == nil {
+		t.Fatal("expected a size mismatch error")
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// downloadReader streams a file, fetching the next chunk only once the previous one is consumed
+type downloadReader struct {
+	ctx       context.Context
+	cancel    context.CancelFunc
+	fetch     func(ctx context.Context, offset int64, limit int32) ([]byte, error)
+	chunkSize int32
+	size      int64 // zero if unknown
+	offset    int64
+	buf       []byte
+	eof       bool
+}
+
+// DownloadReader returns a reader streaming the file at location, chunks are
+// fetched with upload.getFile as they are read so the file is never held in memory.
+// Closing the reader cancels the chunk being fetched.
+//
+//	Params:
+//	  - location: The location of the file.
+//	  - Opts: DcID of the file (default current DC), Size of the file and ChunkSize (default 512 KB).
+func (c *Client) DownloadReader(location InputFileLocation, Opts ...*DownloadOptions) (io.ReadCloser, error) {
+	opts := getVariadic(Opts, &DownloadOptions{}).(*DownloadOptions)
+	if location == nil {
+		return nil, errors.New("location can not be nil")
+	}
+	chunkSize := opts.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DEFAULT_PARTS
+	}
+	if err := checkChunkSize(chunkSize); err != nil {
+		return nil, err
+	}
+	sender := c
+	if dc := int(opts.DcID); dc != 0 && dc != c.GetDC() {
+		var err error
+		if sender, err = c.borrowSender(dc); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &downloadReader{
+		ctx:       ctx,
+		cancel:    cancel,
+		chunkSize: chunkSize,
+		size:      int64(opts.Size),
+		fetch: func(ctx context.Context, offset int64, limit int32) ([]byte, error) {
+			return sender.getFileChunk(ctx, location, offset, limit)
+		},
+	}, nil
+}
+
+// getFileChunk fetches limit bytes of the file at location from offset
+func (c *Client) getFileChunk(ctx context.Context, location InputFileLocation, offset int64, limit int32) ([]byte, error) {
+	resp, err := c.MakeRequestCtx(ctx, &UploadGetFileParams{
+		Location: location,
+		Offset:   offset,
+		Limit:    limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch v := resp.(type) {
+	case *UploadFileObj:
+		return v.Bytes, nil
+	case *UploadFileCdnRedirect:
+		return nil, errors.New("cdn redirects are not supported")
+	default:
+		return nil, errors.Errorf("unexpected response %T", resp)
+	}
+}
+
+// checkChunkSize validates a chunk size against the upload.getFile limits
+func checkChunkSize(chunkSize int32) error {
+	if chunkSize <= 0 || chunkSize%4096 != 0 || (1024*1024)%chunkSize != 0 {
+		return errors.New("chunk size must be a multiple of 4 KB dividing 1 MB")
+	}
+	return nil
+}
+
+func (r *downloadReader) Read(p []byte) (int, error) {
+	if r.ctx.Err() != nil {
+		return 0, io.ErrClosedPipe
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		chunk, err := r.fetch(r.ctx, r.offset, r.chunkSize)
+		if err != nil {
+			if r.ctx.Err() != nil {
+				return 0, io.ErrClosedPipe
+			}
+			return 0, errors.Wrap(err, "fetching chunk")
+		}
+		r.offset += int64(len(chunk))
+		// a short chunk is the last one
+		if len(chunk) < int(r.chunkSize) || (r.size > 0 && r.offset >= r.size) {
+			r.eof = true
+		}
+		r.buf = chunk
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *downloadReader) Close() error {
+	r.cancel()
+	return nil
+}
@@ -0,0 +1,71 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestDownloadReader(t *testing.T) {
+	file := make([]byte, 3*4096+123)
+	for i := range file {
+		file[i] = byte(i)
+	}
+	fetches := 0
+	r := &downloadReader{
+		chunkSize: 4096,
+		fetch: func(_ context.Context, offset int64, limit int32) ([]byte, error) {
+			fetches++
+			end := min(offset+int64(limit), int64(len(file)))
+			return file[offset:end], nil
+		},
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 1 {
+		t.Fatalf("expected a single lazy fetch, got %d", fetches)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(head, rest...), file) {
+		t.Fatal("streamed bytes don't match the file")
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Fatalf("read past EOF returned %d, %v", n, err)
+	}
+}
+
+func TestDownloadReaderClose(t *testing.T) {
+	r := &downloadReader{
+		chunkSize: 4096,
+		fetch: func(ctx context.Context, _ int64, _ int32) ([]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	r.Close()
+	select {
+	case err := <-done:
+		if err != io.ErrClosedPipe {
+			t.Fatalf("expected io.ErrClosedPipe, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't stop the in-flight fetch")
+	}
+}
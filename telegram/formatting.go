@@ -7,182 +7,654 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
-
+	"strconv"
 	"strings"
 	"unicode/utf16"
 
+	"github.com/pkg/errors"
 	"golang.org/x/net/html"
 )
 
-func (c *Client) FormatMessage(message string, mode string) ([]MessageEntity, string) {
+// FormatMessage parses message in the given parse mode (HTML, Markdown or MarkdownV2),
+// returning its entities and the plain text, or a *ParseError for malformed markup.
+func (c *Client) FormatMessage(message string, mode string) ([]MessageEntity, string, error) {
 	return parseEntities(message, mode)
 }
 
+// ParseError is returned for malformed markup, Offset is the byte offset of the offending text in the message
+type ParseError struct {
+	Mode   string
+	Offset int
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("can't parse %s: %s at byte offset %d", e.Mode, e.Reason, e.Offset)
+}
+
 // parseEntities parses the message and returns a list of MessageEntities and the cleaned text string
-func parseEntities(message string, mode string) ([]MessageEntity, string) {
-	if strings.EqualFold(mode, HTML) {
+func parseEntities(message string, mode string) ([]MessageEntity, string, error) {
+	switch {
+	case strings.EqualFold(mode, HTML):
 		return parseHTML(message)
-	} else if strings.EqualFold(mode, MarkDown) {
-		return parseMarkdown(message)
+	case strings.EqualFold(mode, MarkDownV2):
+		return parseMarkdown(message, markdownV2)
+	case strings.EqualFold(mode, MarkDown):
+		return parseMarkdown(message, markdownV1)
 	}
-	return []MessageEntity{}, message
+	return []MessageEntity{}, message, nil
 }
 
-// parseHTML parses HTML and returns a list of MessageEntities and the cleaned text string
-func parseHTML(text string) ([]MessageEntity, string) {
-	cleanedText, tags, err := parseHTMLToTags(text)
-	if err != nil {
-		return []MessageEntity{}, text
-	}
+// pendingEntity is an entity found by the parsers, converted to a MessageEntity once the text is done
+type pendingEntity struct {
+	kind   string
+	offset int32
+	length int32
+	arg    string // url, language or custom emoji id
+}
 
-	entities := parseTagsToEntity(tags)
-	return entities, cleanedText
+func (e pendingEntity) entity() MessageEntity {
+	switch e.kind {
+	case "bold":
+		return &MessageEntityBold{e.offset, e.length}
+	case "italic":
+		return &MessageEntityItalic{e.offset, e.length}
+	case "underline":
+		return &MessageEntityUnderline{e.offset, e.length}
+	case "strike":
+		return &MessageEntityStrike{e.offset, e.length}
+	case "spoiler":
+		return &MessageEntitySpoiler{e.offset, e.length}
+	case "code":
+		return &MessageEntityCode{e.offset, e.length}
+	case "pre":
+		return &MessageEntityPre{e.offset, e.length, e.arg}
+	case "blockquote":
+		return &MessageEntityBlockquote{e.offset, e.length}
+	case "url":
+		return &MessageEntityURL{e.offset, e.length}
+	case "email":
+		return &MessageEntityEmail{e.offset, e.length}
+	case "custom_emoji":
+		id, _ := strconv.ParseInt(e.arg, 10, 64)
+		return &MessageEntityCustomEmoji{e.offset, e.length, id}
+	}
+	return &MessageEntityTextURL{e.offset, e.length, e.arg}
 }
 
-// parseMarkdown parses Markdown and returns a list of MessageEntities and the cleaned text string
-func parseMarkdown(text string) ([]MessageEntity, string) {
-	htmlStr := MarkdownToHTML(text)
-	return parseHTML(htmlStr)
+// entityBuilder collects the plain text and entities of a formatted message, offsets are in UTF-16 code units
+type entityBuilder struct {
+	mode     string
+	text     strings.Builder
+	offset   int32
+	entities []pendingEntity
 }
 
-// Tag represents a tag in the HTML string, including its type, length, and offset and whether it has nested tags, and its attrs
-type Tag struct {
-	Type      string `json:"type"`
-	Length    int32  `json:"length"`
-	Offset    int32  `json:"offset"`
-	hasNested bool
-	Attrs     map[string]string
+func (b *entityBuilder) write(s string) {
+	b.text.WriteString(s)
+	b.offset += utf16RuneCountInString(s)
 }
 
-// supportedTag returns true if the tag is supported by the parser
-func supportedTag(tag string) bool {
-	switch tag {
-	case "b", "strong", "i", "em", "u", "s", "a", "code", "pre", "ins", "del", "spoiler":
-		return true
+// add records an entity from start to the current end of the text, empty entities are dropped
+func (b *entityBuilder) add(kind string, start int32, arg string) {
+	if kind == "" || b.offset == start {
+		return
 	}
-	return false
+	b.entities = append(b.entities, pendingEntity{kind, start, b.offset - start, arg})
 }
 
-func parseHTMLToTags(htmlStr string) (string, []Tag, error) {
-	// Parse the HTML string into a tree of nodes
-	doc, err := html.Parse(strings.NewReader(htmlStr))
-	if err != nil {
-		return "", nil, err
-	}
-
-	// Convert the tree of nodes into a string with no HTML tags
-	var textBuf bytes.Buffer
-	tagOffsets := []Tag{}
-	var parseNode func(*html.Node, int32)
-	var openTags []Tag
-	parseNode = func(n *html.Node, offset int32) {
-		if n.Type == html.ElementNode {
-			// Only record tag information for non-body, non-html, non-head, non-p tags
-			if supportedTag(n.Data) {
-				tagType := n.Data
-				tagLength := getTextLength(n)
-				TagAttrs := make(map[string]string)
-				for _, attr := range n.Attr {
-					TagAttrs[attr.Key] = attr.Val
-				}
+func (b *entityBuilder) errorf(offset int, format string, a ...interface{}) error {
+	return &ParseError{Mode: b.mode, Offset: offset, Reason: fmt.Sprintf(format, a...)}
+}
+
+func (b *entityBuilder) result() ([]MessageEntity, string, error) {
+	// outer entities first, as they are sent by telegram; entities are added as they are closed,
+	// so reversing them first puts the outer one first when two cover the same text
+	for i, j := 0, len(b.entities)-1; i < j; i, j = i+1, j-1 {
+		b.entities[i], b.entities[j] = b.entities[j], b.entities[i]
+	}
+	sort.SliceStable(b.entities, func(i, j int) bool {
+		if b.entities[i].offset != b.entities[j].offset {
+			return b.entities[i].offset < b.entities[j].offset
+		}
+		return b.entities[i].length > b.entities[j].length
+	})
+	entities := make([]MessageEntity, 0, len(b.entities))
+	for _, e := range b.entities {
+		entities = append(entities, e.entity())
+	}
+	return entities, b.text.String(), nil
+}
 
-				tagOffset := utf16RuneCountInString(textBuf.String())
-				tagOffsets = append(tagOffsets, Tag{Type: tagType, Length: tagLength, Offset: tagOffset, Attrs: TagAttrs})
+// htmlTag is an open tag while parsing HTML
+type htmlTag struct {
+	name  string
+	pos   int
+	start int32
+	kind  string
+	arg   string
+}
 
-				// if tag not closed, add to open tags
-				if n.FirstChild != nil && n.FirstChild.NextSibling == nil {
-					openTags = append(openTags, Tag{Type: tagType, Length: tagLength, Offset: tagOffset})
+// parseHTML parses the HTML subset supported by telegram and returns a list of MessageEntities and the cleaned text string
+func parseHTML(text string) ([]MessageEntity, string, error) {
+	b := &entityBuilder{mode: HTML}
+	var stack []*htmlTag
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case '<':
+			// a '<' not starting a tag is kept as text
+			if i+1 >= len(text) || !(text[i+1] == '/' || isASCIILetter(text[i+1])) {
+				break
+			}
+			end := strings.IndexByte(text[i:], '>')
+			if end < 0 || strings.IndexByte(text[i+1:i+end], '<') >= 0 {
+				break
+			}
+			raw := text[i+1 : i+end]
+			// unsupported tags, like <br> or a literal <username>, are kept as text
+			if !htmlTags[htmlTagName(raw)] {
+				b.write(text[i : i+end+1])
+				i += end + 1
+				continue
+			}
+			if raw[0] == '/' {
+				name := htmlTagName(raw)
+				if len(stack) == 0 {
+					return nil, "", b.errorf(i, "unexpected end tag </%s>", name)
+				}
+				top := stack[len(stack)-1]
+				if top.name != name {
+					return nil, "", b.errorf(i, "end tag </%s> doesn't match start tag <%s> at byte offset %d", name, top.name, top.pos)
+				}
+				stack = stack[:len(stack)-1]
+				b.add(top.kind, top.start, top.arg)
+			} else {
+				tag, err := b.htmlStartTag(raw, i, stack)
+				if err != nil {
+					return nil, "", err
+				}
+				stack = append(stack, tag)
+			}
+			i += end + 1
+			continue
+		case '&':
+			if end := strings.IndexByte(text[i:], ';'); end > 1 && end <= 32 {
+				ref := text[i : i+end+1]
+				if s := html.UnescapeString(ref); s != ref {
+					b.write(s)
+					i += end + 1
+					continue
 				}
-
 			}
-		} else if n.Type == html.TextNode {
-			// Write the text content of this node to the buffer
-			textBuf.WriteString(n.Data)
-			offset += utf16RuneCountInString(n.Data)
 		}
+		next := strings.IndexAny(text[i+1:], "<&")
+		if next < 0 {
+			next = len(text)
+		} else {
+			next += i + 1
+		}
+		b.write(text[i:next])
+		i = next
+	}
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return nil, "", b.errorf(top.pos, "can't find end tag for <%s>", top.name)
+	}
+	return b.result()
+}
 
-		// Recursively process child nodes
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			parseNode(c, offset)
+// htmlStartTag parses the start tag raw (without the angle brackets) found at pos
+func (b *entityBuilder) htmlStartTag(raw string, pos int, stack []*htmlTag) (*htmlTag, error) {
+	name, attrs, err := parseHTMLAttrs(raw)
+	if err != nil {
+		return nil, b.errorf(pos, "%s in tag <%s>", err, name)
+	}
+	tag := &htmlTag{name: name, pos: pos, start: b.offset}
+	switch name {
+	case "b", "strong":
+		tag.kind = "bold"
+	case "i", "em":
+		tag.kind = "italic"
+	case "u", "ins":
+		tag.kind = "underline"
+	case "s", "strike", "del":
+		tag.kind = "strike"
+	case "tg-spoiler", "spoiler":
+		tag.kind = "spoiler"
+	case "span":
+		if attrs["class"] != "tg-spoiler" {
+			return nil, b.errorf(pos, "tag <span> must have class \"tg-spoiler\"")
+		}
+		tag.kind = "spoiler"
+	case "blockquote":
+		tag.kind = "blockquote"
+	case "pre":
+		tag.kind, tag.arg = "pre", attrs["language"]
+	case "code":
+		tag.kind = "code"
+		// <pre><code class="language-go"> sets the language of the pre block
+		if n := len(stack); n > 0 && stack[n-1].name == "pre" && stack[n-1].start == b.offset {
+			if lang, ok := strings.CutPrefix(attrs["class"], "language-"); ok {
+				stack[n-1].arg = lang
+			}
+			tag.kind = ""
+		}
+	case "a":
+		href := attrs["href"]
+		switch {
+		case href == "":
+			tag.kind = "url"
+		case strings.HasPrefix(href, "mailto:"):
+			tag.kind = "email"
+		default:
+			tag.kind, tag.arg = "text_url", href
 		}
+	case "tg-emoji":
+		if _, err := strconv.ParseInt(attrs["emoji-id"], 10, 64); err != nil {
+			return nil, b.errorf(pos, "tag <tg-emoji> must have a numeric emoji-id")
+		}
+		tag.kind, tag.arg = "custom_emoji", attrs["emoji-id"]
+	}
+	return tag, nil
+}
+
+// htmlTags are the tags supported by telegram, others are kept as text
+var htmlTags = map[string]bool{
+	"b": true, "strong": true, "i": true, "em": true, "u": true, "ins": true,
+	"s": true, "strike": true, "del": true, "tg-spoiler": true, "spoiler": true, "span": true,
+	"blockquote": true, "pre": true, "code": true, "a": true, "tg-emoji": true,
+}
+
+// htmlTagName returns the lowercased name of the start or end tag raw (without the angle brackets)
+func htmlTagName(raw string) string {
+	raw = strings.TrimPrefix(raw, "/")
+	if end := strings.IndexAny(raw, " \t\r\n/"); end >= 0 {
+		raw = raw[:end]
+	}
+	return strings.ToLower(raw)
+}
 
-		// Check if any open tags are closed by this node
-		for i := len(openTags) - 1; i >= 0; i-- {
-			if openTags[i].Type == n.Data {
-				openTags[i].Length = utf16RuneCountInString(textBuf.String()) - openTags[i].Offset
-				openTags[i].hasNested = true
-				openTags = openTags[:i]
+// parseHTMLAttrs splits a start tag into its lowercased name and attributes
+func parseHTMLAttrs(raw string) (string, map[string]string, error) {
+	end := strings.IndexAny(raw, " \t\r\n/")
+	if end < 0 {
+		end = len(raw)
+	}
+	name := strings.ToLower(raw[:end])
+	attrs := make(map[string]string)
+	rest := raw[end:]
+	for {
+		rest = strings.TrimLeft(rest, " \t\r\n")
+		if rest == "" {
+			return name, attrs, nil
+		}
+		if rest[0] == '/' {
+			return name, attrs, errors.New("self-closing tags are not supported")
+		}
+		end := strings.IndexAny(rest, "= \t\r\n")
+		if end < 0 {
+			end = len(rest)
+		}
+		key := strings.ToLower(rest[:end])
+		rest = strings.TrimLeft(rest[end:], " \t\r\n")
+		if !strings.HasPrefix(rest, "=") {
+			attrs[key] = ""
+			continue
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\r\n")
+		var value string
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			end := strings.IndexByte(rest[1:], rest[0])
+			if end < 0 {
+				return name, attrs, errors.Errorf("unclosed value of attribute %q", key)
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			end := strings.IndexAny(rest, " \t\r\n")
+			if end < 0 {
+				end = len(rest)
 			}
+			value, rest = rest[:end], rest[end:]
 		}
+		attrs[key] = html.UnescapeString(value)
 	}
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// markdownSyntax describes a markdown flavour
+type markdownSyntax struct {
+	mode string
+	// delimiters of the inline entities, longer ones first
+	delimiters []markdownDelimiter
+	// escaped reports whether c can be escaped with a backslash
+	escaped func(c byte) bool
+	// reserved characters must be escaped when not part of an entity
+	reserved string
+	// blockquotes quotes the lines starting with '>'
+	blockquotes bool
+	// customEmoji parses ![👍](tg://emoji?id=5368324170671202286) as a custom emoji
+	customEmoji bool
+}
 
-	parseNode(doc, 0)
+type markdownDelimiter struct {
+	token string
+	kind  string
+}
 
-	// Adjust the length of any unclosed tags at the end of the string
-	lastOffset := utf16RuneCountInString(textBuf.String())
-	for i := range openTags {
-		openTags[i].Length = lastOffset - openTags[i].Offset
+var (
+	// markdownV1 is the markdown of the library: **bold**, __italic__, ~~strike~~, ||spoiler||, !!underline!!
+	markdownV1 = &markdownSyntax{
+		mode: MarkDown,
+		delimiters: []markdownDelimiter{
+			{"**", "bold"}, {"__", "italic"}, {"~~", "strike"}, {"||", "spoiler"}, {"!!", "underline"},
+		},
+		escaped: func(c byte) bool {
+			return strings.IndexByte("\\*_~|!`[]()", c) >= 0
+		},
 	}
+	// markdownV2 follows telegram's MarkdownV2: *bold*, _italic_, __underline__, ~strike~, ||spoiler||,
+	// >blockquote and ![emoji](tg://emoji?id=...)
+	markdownV2 = &markdownSyntax{
+		mode: MarkDownV2,
+		delimiters: []markdownDelimiter{
+			{"__", "underline"}, {"||", "spoiler"}, {"*", "bold"}, {"_", "italic"}, {"~", "strike"},
+		},
+		escaped: func(c byte) bool {
+			return c > 0 && c < 127
+		},
+		reserved:    "_*[]()~`>#+-=|{}.!",
+		blockquotes: true,
+		customEmoji: true,
+	}
+)
 
-	// Return the cleaned text string and tag offsets list
-	cleanedText := strings.TrimSpace(textBuf.String())
-	return cleanedText, tagOffsets, nil
+// markdownOpen is an open entity while parsing markdown
+type markdownOpen struct {
+	token   string
+	kind    string
+	pos     int
+	start   int32
+	url     string
+	textEnd int // for links, byte offset of the closing ']'
+	end     int // for links, byte offset after the closing ')'
 }
 
-// getTextLength returns the length of the text content of a node, including its children
-func getTextLength(n *html.Node) int32 {
-	var tagLength int32 = 0
-	currentNode := n.FirstChild
-	for currentNode != nil {
-		if currentNode.Type == html.TextNode {
-			tagLength += utf16RuneCountInString(currentNode.Data)
-		} else if currentNode.Type == html.ElementNode {
-			tagLength += getTextLength(currentNode)
+// markdownLinks finds the [text](url) links of a text, the closing ']' and ')' not escaped
+// with a backslash are listed once so matching a link from each '[' stays linear
+type markdownLinks struct {
+	text     string
+	brackets []int
+	parens   []int
+}
+
+func newMarkdownLinks(text string) *markdownLinks {
+	l := &markdownLinks{text: text}
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case ']':
+			l.brackets = append(l.brackets, i)
+		case ')':
+			l.parens = append(l.parens, i)
 		}
-		currentNode = currentNode.NextSibling
 	}
-	return tagLength
+	return l
 }
 
-// utf16RuneCountInString returns the number of UTF-16 code units in a string
-func utf16RuneCountInString(s string) int32 {
-	return int32(len(utf16.Encode([]rune(s))))
+// match matches the link starting with the '[' at i, returning the offsets of the closing ']',
+// of the url and after the closing ')'
+func (l *markdownLinks) match(i int) (textEnd, urlStart, urlEnd, end int, ok bool) {
+	textEnd, ok = nextOffset(l.brackets, i+1)
+	if !ok || textEnd+1 >= len(l.text) || l.text[textEnd+1] != '(' {
+		return 0, 0, 0, 0, false
+	}
+	urlStart = textEnd + 2
+	if urlEnd, ok = nextOffset(l.parens, urlStart); !ok {
+		return 0, 0, 0, 0, false
+	}
+	return textEnd, urlStart, urlEnd, urlEnd + 1, true
+}
+
+// nextOffset returns the first of the sorted offsets at or after i
+func nextOffset(offsets []int, i int) (int, bool) {
+	j := sort.SearchInts(offsets, i)
+	if j == len(offsets) {
+		return 0, false
+	}
+	return offsets[j], true
 }
 
-// parseTagsToEntity converts a list of tags to a list of MessageEntities
-func parseTagsToEntity(tags []Tag) []MessageEntity {
-	var entities []MessageEntity
-	for _, tag := range tags {
-		switch tag.Type {
-		case "a":
-			switch {
-			case tag.Attrs["href"] != "" && strings.HasPrefix(tag.Attrs["href"], "mailto:"):
-				entities = append(entities, &MessageEntityEmail{tag.Offset, tag.Length})
-
-			case tag.Attrs["href"] == "":
-				entities = append(entities, &MessageEntityURL{tag.Offset, tag.Length})
-			default:
-				entities = append(entities, &MessageEntityTextURL{tag.Offset, tag.Length, tag.Attrs["href"]})
+// parseMarkdown parses markdown of the given syntax and returns a list of MessageEntities and the cleaned text string
+func parseMarkdown(text string, syntax *markdownSyntax) ([]MessageEntity, string, error) {
+	b := &entityBuilder{mode: syntax.mode}
+	var stack []*markdownOpen
+	links := newMarkdownLinks(text)
+	specials := "\\`[]" + syntax.reserved
+	for _, d := range syntax.delimiters {
+		specials += d.token[:1]
+	}
+	if syntax.blockquotes {
+		specials += "\n"
+	}
+	quoting, quoteStart := false, int32(0)
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case syntax.blockquotes && c == '>' && (i == 0 || text[i-1] == '\n'):
+			if !quoting {
+				quoting, quoteStart = true, b.offset
 			}
-		case "b", "strong":
-			entities = append(entities, &MessageEntityBold{tag.Offset, tag.Length})
-		case "code":
-			entities = append(entities, &MessageEntityCode{tag.Offset, tag.Length})
-		case "em", "i":
-			entities = append(entities, &MessageEntityItalic{tag.Offset, tag.Length})
-		case "pre":
-			entities = append(entities, &MessageEntityPre{tag.Offset, tag.Length, tag.Attrs["language"]})
-		case "s", "strike", "del":
-			entities = append(entities, &MessageEntityStrike{tag.Offset, tag.Length})
-		case "u":
-			entities = append(entities, &MessageEntityUnderline{tag.Offset, tag.Length})
-		case "mention":
-			entities = append(entities, &MessageEntityMention{tag.Offset, tag.Length})
-		case "spoiler":
-			entities = append(entities, &MessageEntitySpoiler{tag.Offset, tag.Length})
+			i++
+			continue
+
+		case c == '\n' && quoting && !strings.HasPrefix(text[i+1:], ">"):
+			// the quote ends with the last line starting with '>'
+			b.add("blockquote", quoteStart, "")
+			quoting = false
+
+		case c == '\\':
+			if i+1 < len(text) && syntax.escaped(text[i+1]) {
+				b.write(text[i+1 : i+2])
+				i += 2
+				continue
+			}
+			if syntax.reserved != "" {
+				return nil, "", b.errorf(i, "character '\\' must be escaped")
+			}
+			b.write("\\")
+			i++
+			continue
+
+		case strings.HasPrefix(text[i:], "```"):
+			end, err := b.markdownCode(text, i, "```", syntax)
+			if err != nil {
+				return nil, "", err
+			}
+			i = end
+			continue
+
+		case c == '`':
+			end, err := b.markdownCode(text, i, "`", syntax)
+			if err != nil {
+				return nil, "", err
+			}
+			i = end
+			continue
+
+		case syntax.customEmoji && c == '!' && strings.HasPrefix(text[i+1:], "["):
+			textEnd, urlStart, urlEnd, end, ok := links.match(i + 1)
+			if !ok {
+				break
+			}
+			id, ok := strings.CutPrefix(unescapeMarkdown(text[urlStart:urlEnd], syntax), "tg://emoji?id=")
+			if _, err := strconv.ParseInt(id, 10, 64); !ok || err != nil {
+				return nil, "", b.errorf(i, "custom emoji must have a tg://emoji?id= url")
+			}
+			stack = append(stack, &markdownOpen{
+				token:   "[",
+				kind:    "custom_emoji",
+				pos:     i,
+				start:   b.offset,
+				url:     id,
+				textEnd: textEnd,
+				end:     end,
+			})
+			i += 2
+			continue
+
+		case c == '[':
+			textEnd, urlStart, urlEnd, end, ok := links.match(i)
+			if !ok {
+				break
+			}
+			stack = append(stack, &markdownOpen{
+				token:   "[",
+				kind:    "text_url",
+				pos:     i,
+				start:   b.offset,
+				url:     unescapeMarkdown(text[urlStart:urlEnd], syntax),
+				textEnd: textEnd,
+				end:     end,
+			})
+			i++
+			continue
+
+		case c == ']':
+			n := len(stack)
+			if n == 0 || stack[n-1].token != "[" || stack[n-1].textEnd != i {
+				for _, open := range stack {
+					if open.token == "[" && open.textEnd == i {
+						top := stack[n-1]
+						return nil, "", b.errorf(top.pos, "%s entity must be closed before the end of the link at byte offset %d", top.kind, i)
+					}
+				}
+				break
+			}
+			link := stack[n-1]
+			stack = stack[:n-1]
+			if link.url == "" {
+				return nil, "", b.errorf(link.pos, "link has an empty url")
+			}
+			b.add(link.kind, link.start, link.url)
+			i = link.end
+			continue
+
+		default:
+			d, ok := syntax.delimiter(text[i:])
+			if !ok {
+				break
+			}
+			if j := markdownOpenIndex(stack, d.token); j >= 0 {
+				if j != len(stack)-1 {
+					top := stack[len(stack)-1]
+					return nil, "", b.errorf(top.pos, "%s entity must be closed before the end of the %s entity at byte offset %d", top.kind, d.kind, i)
+				}
+				b.add(d.kind, stack[j].start, "")
+				stack = stack[:j]
+			} else {
+				stack = append(stack, &markdownOpen{token: d.token, kind: d.kind, pos: i, start: b.offset})
+			}
+			i += len(d.token)
+			continue
 		}
+
+		if strings.IndexByte(syntax.reserved, c) >= 0 {
+			return nil, "", b.errorf(i, "character '%c' is reserved and must be escaped with '\\'", c)
+		}
+		next := strings.IndexAny(text[i+1:], specials)
+		if next < 0 {
+			next = len(text)
+		} else {
+			next += i + 1
+		}
+		b.write(text[i:next])
+		i = next
+	}
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return nil, "", b.errorf(top.pos, "can't find end of %s entity", top.kind)
+	}
+	if quoting {
+		b.add("blockquote", quoteStart, "")
+	}
+	return b.result()
+}
+
+func markdownOpenIndex(stack []*markdownOpen, token string) int {
+	for j := len(stack) - 1; j >= 0; j-- {
+		if stack[j].token == token {
+			return j
+		}
+	}
+	return -1
+}
+
+// delimiter returns the entity delimiter text starts with, if any
+func (s *markdownSyntax) delimiter(text string) (markdownDelimiter, bool) {
+	for _, d := range s.delimiters {
+		if strings.HasPrefix(text, d.token) {
+			return d, true
+		}
+	}
+	return markdownDelimiter{}, false
+}
+
+// markdownCode parses the code or pre entity opened by fence at pos, returning the offset after its end
+func (b *entityBuilder) markdownCode(text string, pos int, fence string, syntax *markdownSyntax) (int, error) {
+	kind := "code"
+	if fence == "```" {
+		kind = "pre"
 	}
-	return entities
+	var content strings.Builder
+	i := pos + len(fence)
+	for ; i < len(text); i++ {
+		// only MarkdownV2 has escapes in code, for '`' and '\'
+		if syntax.reserved != "" && text[i] == '\\' && i+1 < len(text) && (text[i+1] == '`' || text[i+1] == '\\') {
+			content.WriteByte(text[i+1])
+			i++
+			continue
+		}
+		if strings.HasPrefix(text[i:], fence) {
+			break
+		}
+		content.WriteByte(text[i])
+	}
+	if i >= len(text) {
+		return 0, b.errorf(pos, "can't find end of %s entity", kind)
+	}
+	code, language := content.String(), ""
+	if kind == "pre" {
+		// ```go\n sets the language of the block
+		if nl := strings.IndexByte(code, '\n'); nl >= 0 && !strings.ContainsAny(code[:nl], " \t\r") {
+			language, code = code[:nl], code[nl+1:]
+		}
+	}
+	start := b.offset
+	b.write(code)
+	b.add(kind, start, language)
+	return i + len(fence), nil
+}
+
+// unescapeMarkdown removes the backslashes escaping characters of s
+func unescapeMarkdown(s string, syntax *markdownSyntax) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && syntax.escaped(s[i+1]) {
+			i++
+		}
+		out.WriteByte(s[i])
+	}
+	return out.String()
+}
+
+// utf16RuneCountInString returns the number of UTF-16 code units in a string
+func utf16RuneCountInString(s string) int32 {
+	return int32(len(utf16.Encode([]rune(s))))
 }
 
 // parseEntitiesToHTML converts a list of MessageEntities to HTML, given the original text
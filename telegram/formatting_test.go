@@ -0,0 +1,143 @@
+package telegram
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/roj1512/gogram/internal/utils"
+)
+
+func TestParseEntities(t *testing.T) {
+	tests := []struct {
+		mode     string
+		input    string
+		text     string
+		entities []MessageEntity
+	}{
+		{HTML, "<b>bold</b> <i>it</i> <code>x</code>", "bold it x", []MessageEntity{
+			&MessageEntityBold{0, 4}, &MessageEntityItalic{5, 2}, &MessageEntityCode{8, 1},
+		}},
+		{HTML, `<pre><code class="language-go">a &lt; b</code></pre>`, "a < b", []MessageEntity{
+			&MessageEntityPre{0, 5, "go"},
+		}},
+		{HTML, `<a href="https://t.me">😀<tg-spoiler>s</tg-spoiler></a> 1 < 2`, "😀s 1 < 2", []MessageEntity{
+			&MessageEntityTextURL{0, 3, "https://t.me"}, &MessageEntitySpoiler{2, 1},
+		}},
+		{MarkDown, "**bold** __it__ ||s|| `a*b` \\*\\*x", "bold it s a*b **x", []MessageEntity{
+			&MessageEntityBold{0, 4}, &MessageEntityItalic{5, 2}, &MessageEntitySpoiler{8, 1}, &MessageEntityCode{10, 3},
+		}},
+		{MarkDown, "[**link**](https://t.me/x_(y\\))", "link", []MessageEntity{
+			&MessageEntityTextURL{0, 4, "https://t.me/x_(y)"}, &MessageEntityBold{0, 4},
+		}},
+		{MarkDownV2, "*b _i_* __u__ ~s~ 1\\.5", "b i u s 1.5", []MessageEntity{
+			&MessageEntityBold{0, 3}, &MessageEntityItalic{2, 1}, &MessageEntityUnderline{4, 1}, &MessageEntityStrike{6, 1},
+		}},
+		{MarkDownV2, "```python\nprint(1)\n```", "print(1)\n", []MessageEntity{
+			&MessageEntityPre{0, 9, "python"},
+		}},
+		{MarkDown, "[\\[a\\]b](u) [c](", "[a]b [c](", []MessageEntity{
+			&MessageEntityTextURL{0, 4, "u"},
+		}},
+		{HTML, "hi <username>, a<br>b </foo> <b>x<y</b>", "hi <username>, a<br>b </foo> x<y", []MessageEntity{
+			&MessageEntityBold{29, 3},
+		}},
+		{MarkDownV2, ">quote *b*\n>line\nafter", "quote b\nline\nafter", []MessageEntity{
+			&MessageEntityBlockquote{0, 12}, &MessageEntityBold{6, 1},
+		}},
+		{MarkDownV2, "![👍](tg://emoji?id=5368324170671202286) ok", "👍 ok", []MessageEntity{
+			&MessageEntityCustomEmoji{0, 2, 5368324170671202286},
+		}},
+		{"", "<b>raw</b>", "<b>raw</b>", []MessageEntity{}},
+	}
+	for _, tt := range tests {
+		entities, text, err := parseEntities(tt.input, tt.mode)
+		if err != nil {
+			t.Errorf("%s %q: %v", tt.mode, tt.input, err)
+			continue
+		}
+		if text != tt.text || !reflect.DeepEqual(entities, tt.entities) {
+			t.Errorf("%s %q: got %q %v, want %q %v", tt.mode, tt.input, text, entities, tt.text, tt.entities)
+		}
+	}
+}
+
+func TestParseEntitiesErrors(t *testing.T) {
+	tests := []struct {
+		mode   string
+		input  string
+		offset int
+	}{
+		{HTML, "a <b>bold", 2},
+		{HTML, "<b><i>x</b></i>", 7},
+		{HTML, "<b>x</i>", 4},
+		{MarkDown, "a **bold", 2},
+		{MarkDown, "`code", 0},
+		{MarkDownV2, "1.5", 1},
+		{MarkDownV2, "*b _i*_", 3},
+		{MarkDownV2, "![x](https://t.me)", 0},
+	}
+	for _, tt := range tests {
+		_, _, err := parseEntities(tt.input, tt.mode)
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s %q: expected a ParseError, got %v", tt.mode, tt.input, err)
+			continue
+		}
+		if perr.Offset != tt.offset {
+			t.Errorf("%s %q: error at %d, want %d (%v)", tt.mode, tt.input, perr.Offset, tt.offset, err)
+		}
+	}
+}
+
+func TestDefaultParseMode(t *testing.T) {
+	c := &Client{Log: utils.NewLogger("test")}
+	c.setupClientData(ClientConfig{ParseMode: MarkDown, LogLevel: LogError})
+	if mode := c.parseModeFor(""); mode != MarkDown {
+		t.Errorf("default parse mode %q, want %q", mode, MarkDown)
+	}
+	if mode := c.parseModeFor(HTML); mode != HTML {
+		t.Errorf("per call parse mode %q, want %q", mode, HTML)
+	}
+	_, text, err := parseEntities("**x**", c.parseModeFor(NoParseMode))
+	if err != nil || text != "**x**" {
+		t.Errorf("NoParseMode parsed the text: %q, %v", text, err)
+	}
+}
+
+func TestFormatMessageError(t *testing.T) {
+	c := &Client{Log: utils.NewLogger("test")}
+	c.setupClientData(ClientConfig{LogLevel: LogError})
+	var perr *ParseError
+	if _, _, err := c.FormatMessage("a **b", MarkDown); !errors.As(err, &perr) {
+		t.Errorf("expected a ParseError, got %v", err)
+	}
+
+	b := &InlineBuilder{Client: c}
+	b.Article("title", "", "<b>ok</b>", &ArticleOptions{ParseMode: HTML})
+	b.Article("title", "", "a **b", &ArticleOptions{ParseMode: MarkDown})
+	if !errors.As(b.Err(), &perr) {
+		t.Errorf("expected the builder to keep the ParseError, got %v", b.Err())
+	}
+	if msg := b.Results()[1].(*InputBotInlineResultObj).SendMessage.(*InputBotInlineMessageText); msg.Message != "a **b" {
+		t.Errorf("expected the malformed text to be sent as is, got %q", msg.Message)
+	}
+}
+
+func TestParseMarkdownManyBrackets(t *testing.T) {
+	// a link is matched once from each '[', unclosed brackets don't rescan the text
+	input := strings.Repeat("[", 200000) + "](u"
+	start := time.Now()
+	_, text, err := parseEntities(input, MarkDown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != input {
+		t.Errorf("unclosed links changed the text")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("parsing took %v", d)
+	}
+}
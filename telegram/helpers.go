@@ -24,6 +24,12 @@ var (
 		4: "149.154.167.91:443",
 		5: "91.108.56.151:443",
 	}
+	// TestDataCenters are the addresses of the DCs of the test servers, see ClientConfig.TestMode
+	TestDataCenters = map[int]string{
+		1: "149.154.175.10:443",
+		2: "149.154.167.40:443",
+		3: "149.154.175.117:443",
+	}
 )
 
 func FileExists(path string) bool {
@@ -195,6 +201,141 @@ func processUpdates(updates Updates) []*MessageObj {
 	return messages
 }
 
+// sentMessage returns the message sent with randomID, picked from the updates answering
+// the request. An UpdateShortSentMessage leaves out the chat, text and reply, which are
+// filled from the request.
+func (c *Client) sentMessage(updates Updates, randomID int64, peer InputPeer, text string, replyID int32) *MessageObj {
+	var sent []Update
+	switch updates := updates.(type) {
+	case *UpdatesObj:
+		c.Cache.UpdatePeersToCache(updates.Users, updates.Chats)
+		sent = updates.Updates
+	case *UpdatesCombined:
+		c.Cache.UpdatePeersToCache(updates.Users, updates.Chats)
+		sent = updates.Updates
+	case *UpdateShortSentMessage:
+		msg := &MessageObj{
+			ID:        updates.ID,
+			Out:       updates.Out,
+			PeerID:    peerFromInput(peer),
+			Date:      updates.Date,
+			Message:   text,
+			Media:     updates.Media,
+			Entities:  updates.Entities,
+			TtlPeriod: updates.TtlPeriod,
+		}
+		if replyID != 0 {
+			msg.ReplyTo = &MessageReplyHeaderObj{ReplyToMsgID: replyID}
+		}
+		c.meMutex.Lock()
+		if c.me != nil {
+			msg.FromID = &PeerUser{UserID: c.me.ID}
+			if _, self := peer.(*InputPeerSelf); self {
+				msg.PeerID = msg.FromID
+			}
+		}
+		c.meMutex.Unlock()
+		return msg
+	default:
+		return processUpdate(updates)
+	}
+	var id int32
+	for _, update := range sent {
+		if u, ok := update.(*UpdateMessageID); ok && u.RandomID == randomID {
+			id = u.ID
+		}
+	}
+	for _, update := range sent {
+		var msg Message
+		switch u := update.(type) {
+		case *UpdateNewMessage:
+			msg = u.Message
+		case *UpdateNewChannelMessage:
+			msg = u.Message
+		case *UpdateNewScheduledMessage:
+			msg = u.Message
+		}
+		if m, ok := msg.(*MessageObj); ok && (id == 0 || m.ID == id) {
+			return m
+		}
+	}
+	return processUpdate(updates)
+}
+
+// sentMessages returns the messages sent with randomIDs in their order, picked from the
+// updates answering the request, messages not matched to a random ID come last
+func (c *Client) sentMessages(updates Updates, randomIDs []int64) []*MessageObj {
+	var sent []Update
+	switch updates := updates.(type) {
+	case *UpdatesObj:
+		c.Cache.UpdatePeersToCache(updates.Users, updates.Chats)
+		sent = updates.Updates
+	case *UpdatesCombined:
+		c.Cache.UpdatePeersToCache(updates.Users, updates.Chats)
+		sent = updates.Updates
+	default:
+		return processUpdates(updates)
+	}
+	order := make(map[int64]int, len(randomIDs))
+	for i, randomID := range randomIDs {
+		order[randomID] = i
+	}
+	position := make(map[int32]int)
+	for _, update := range sent {
+		if u, ok := update.(*UpdateMessageID); ok {
+			if i, ok := order[u.RandomID]; ok {
+				position[u.ID] = i
+			}
+		}
+	}
+	messages := make([]*MessageObj, len(randomIDs))
+	var unmatched []*MessageObj
+	for _, update := range sent {
+		var msg Message
+		switch u := update.(type) {
+		case *UpdateNewMessage:
+			msg = u.Message
+		case *UpdateNewChannelMessage:
+			msg = u.Message
+		case *UpdateNewScheduledMessage:
+			msg = u.Message
+		}
+		m, ok := msg.(*MessageObj)
+		if !ok {
+			continue
+		}
+		if i, ok := position[m.ID]; ok && messages[i] == nil {
+			messages[i] = m
+		} else {
+			unmatched = append(unmatched, m)
+		}
+	}
+	result := make([]*MessageObj, 0, len(randomIDs))
+	for _, m := range messages {
+		if m != nil {
+			result = append(result, m)
+		}
+	}
+	return append(result, unmatched...)
+}
+
+// peerFromInput returns the peer an input peer refers to
+func peerFromInput(peer InputPeer) Peer {
+	switch peer := peer.(type) {
+	case *InputPeerUser:
+		return &PeerUser{UserID: peer.UserID}
+	case *InputPeerChat:
+		return &PeerChat{ChatID: peer.ChatID}
+	case *InputPeerChannel:
+		return &PeerChannel{ChannelID: peer.ChannelID}
+	case *InputPeerUserFromMessage:
+		return &PeerUser{UserID: peer.UserID}
+	case *InputPeerChannelFromMessage:
+		return &PeerChannel{ChannelID: peer.ChannelID}
+	}
+	return &PeerUser{}
+}
+
 func processUpdate(upd Updates) *MessageObj {
 	if upd == nil {
 		return nil
@@ -245,39 +386,85 @@ updateTypeSwitch:
 	return nil
 }
 
+// isSelf reports whether peer is "me" or "self", referring to the logged in user (Saved Messages)
+func isSelf(peer string) bool {
+	return strings.EqualFold(peer, "me") || strings.EqualFold(peer, "self")
+}
+
+// inputUser converts the input peer of a user to an InputUser
+func inputUser(peer InputPeer) (InputUser, error) {
+	switch p := peer.(type) {
+	case *InputPeerUser:
+		return &InputUserObj{UserID: p.UserID, AccessHash: p.AccessHash}, nil
+	case *InputPeerUserFromMessage:
+		return &InputUserFromMessage{Peer: p.Peer, MsgID: p.MsgID, UserID: p.UserID}, nil
+	case *InputPeerSelf:
+		return &InputUserSelf{}, nil
+	}
+	return nil, errors.New("peer is not a user")
+}
+
+// inputChannel converts the input peer of a channel to an InputChannel
+func inputChannel(peer InputPeer) (InputChannel, error) {
+	switch p := peer.(type) {
+	case *InputPeerChannel:
+		return &InputChannelObj{ChannelID: p.ChannelID, AccessHash: p.AccessHash}, nil
+	case *InputPeerChannelFromMessage:
+		return &InputChannelFromMessage{Peer: p.Peer, MsgID: p.MsgID, ChannelID: p.ChannelID}, nil
+	}
+	return nil, errors.New("peer is not a channel")
+}
+
+// getInputPeerUser returns the input peer of a cached user, from a message they
+// were seen in when they are only known from min objects
+func (c *Client) getInputPeerUser(userID int64) (InputPeer, error) {
+	c.Cache.RLock()
+	peer, ok := c.Cache.userFromMessage(userID)
+	c.Cache.RUnlock()
+	if ok {
+		return peer, nil
+	}
+	peer, err := c.GetPeerUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return peer, nil
+}
+
+// getInputPeerChannel is getInputPeerUser for channels
+func (c *Client) getInputPeerChannel(channelID int64) (InputPeer, error) {
+	c.Cache.RLock()
+	peer, ok := c.Cache.channelFromMessage(channelID)
+	c.Cache.RUnlock()
+	if ok {
+		return peer, nil
+	}
+	peer, err := c.GetPeerChannel(channelID)
+	if err != nil {
+		return nil, err
+	}
+	return peer, nil
+}
+
 func (c *Client) GetSendablePeer(PeerID interface{}) (InputPeer, error) {
 PeerSwitch:
 	switch Peer := PeerID.(type) {
 	case nil:
 		return nil, errors.New("PeerID is nil")
 	case *PeerUser:
-		peerEntity, err := c.GetPeerUser(Peer.UserID)
-		if err != nil {
-			return nil, err
-		}
-		return &InputPeerUser{UserID: peerEntity.UserID, AccessHash: peerEntity.AccessHash}, nil
+		return c.getInputPeerUser(Peer.UserID)
 	case *PeerChat:
 		return &InputPeerChat{ChatID: Peer.ChatID}, nil
 	case *PeerChannel:
-		peerEntity, err := c.GetPeerChannel(Peer.ChannelID)
-		if err != nil {
-			return nil, err
-		}
-		return &InputPeerChannel{ChannelID: peerEntity.ChannelID, AccessHash: peerEntity.AccessHash}, nil
+		return c.getInputPeerChannel(Peer.ChannelID)
 	case *InputPeerChat:
 		return Peer, nil
 	case *InputPeerChannel:
-		peerEntity, err := c.GetPeerChannel(Peer.ChannelID)
-		if err != nil {
-			return nil, err
-		}
-		return &InputPeerChannel{ChannelID: peerEntity.ChannelID, AccessHash: peerEntity.AccessHash}, nil
+		return c.getInputPeerChannel(Peer.ChannelID)
 	case *InputPeerUser:
-		peerEntity, err := c.GetPeerUser(Peer.UserID)
-		if err != nil {
-			return nil, err
-		}
-		return &InputPeerUser{UserID: peerEntity.UserID, AccessHash: peerEntity.AccessHash}, nil
+		return c.getInputPeerUser(Peer.UserID)
+	case *InputPeerUserFromMessage, *InputPeerChannelFromMessage:
+		return Peer.(InputPeer), nil
 	case *InputPeer:
 		return *Peer, nil
 		// TODO: Add more types
@@ -294,17 +481,13 @@ PeerSwitch:
 	case *UserObj:
 		return &InputPeerUser{UserID: Peer.ID, AccessHash: Peer.AccessHash}, nil
 	case int64, int32, int:
-		PeerEntity, err := c.Cache.GetInputPeer(getAnyInt(PeerID))
-		if PeerEntity == nil {
-			return nil, err
-		}
-		return PeerEntity, nil
+		return c.GetInputPeer(getAnyInt(PeerID))
 	case string:
 		if i, err := strconv.ParseInt(Peer, 10, 64); err == nil {
 			PeerID = i
 			goto PeerSwitch
 		}
-		if Peer == "me" || Peer == "self" {
+		if isSelf(Peer) {
 			return &InputPeerSelf{}, nil
 		}
 		peerEntity, err := c.ResolveUsername(Peer)
@@ -372,7 +555,7 @@ mediaTypeSwitch:
 	case string:
 		if IsURL(media) {
 			if _, isImage := resolveMimeType(media); isImage {
-				return &InputMediaPhotoExternal{URL: media}, nil
+				return &InputMediaPhotoExternal{URL: media, TtlSeconds: attr.TTL}, nil
 			}
 			return &InputMediaDocumentExternal{URL: media, TtlSeconds: getValue(attr.TTL, 0).(int32)}, nil
 		} else {
@@ -395,7 +578,7 @@ mediaTypeSwitch:
 			Photo := media.Photo.(*PhotoObj)
 			return &InputMediaPhoto{ID: &InputPhotoObj{ID: Photo.ID, AccessHash: Photo.AccessHash, FileReference: Photo.FileReference}, TtlSeconds: getValue(attr.TTL, 0).(int32)}, nil
 		case *MessageMediaDocument:
-			return &InputMediaDocument{ID: &InputDocumentObj{ID: media.Document.(*DocumentObj).ID, AccessHash: media.Document.(*DocumentObj).AccessHash, FileReference: media.Document.(*DocumentObj).FileReference}}, nil
+			return &InputMediaDocument{ID: &InputDocumentObj{ID: media.Document.(*DocumentObj).ID, AccessHash: media.Document.(*DocumentObj).AccessHash, FileReference: media.Document.(*DocumentObj).FileReference}, TtlSeconds: attr.TTL}, nil
 		case *MessageMediaGeo:
 			return &InputMediaGeoPoint{GeoPoint: &InputGeoPointObj{Lat: media.Geo.(*GeoPointObj).Lat, Long: media.Geo.(*GeoPointObj).Long}}, nil
 		case *MessageMediaGame:
@@ -428,7 +611,7 @@ mediaTypeSwitch:
 			fileName = getValue(attr.FileName, media.Name).(string)
 		}
 		if IsPhoto {
-			return &InputMediaUploadedPhoto{File: media}, nil
+			return &InputMediaUploadedPhoto{File: media, TtlSeconds: attr.TTL}, nil
 		} else {
 			var Attributes = getValue(attr.Attributes, []DocumentAttribute{&DocumentAttributeFilename{FileName: fileName}}).([]DocumentAttribute)
 			hasFileName := false
@@ -579,26 +762,60 @@ func mergeAttrs(attrs2, attrs1 []DocumentAttribute) []DocumentAttribute {
 	return attrs
 }
 
+// ResolveUsername resolves a username to its *UserObj, *ChatObj or *Channel, caching the result
 func (c *Client) ResolveUsername(username string) (interface{}, error) {
 	resp, err := c.ContactsResolveUsername(strings.TrimPrefix(username, "@"))
 	if err != nil {
+		if matchRPCError(err, "USERNAME_NOT_OCCUPIED") {
+			return nil, errors.Wrap(ErrUsernameNotFound, username)
+		}
 		return nil, errors.Wrap(err, "resolving username")
 	}
 	c.Cache.UpdatePeersToCache(resp.Users, resp.Chats)
-	if len(resp.Users) != 0 {
-		return resp.Users[0].(*UserObj), nil
-	} else if len(resp.Chats) != 0 {
-		switch Peer := resp.Chats[0].(type) {
-		case *ChatObj:
-			return Peer, nil
-		case *Channel:
-			return Peer, nil
-		default:
-			return nil, fmt.Errorf("got wrong response: %s", reflect.TypeOf(resp).String())
+	return resolvedEntity(resp, username)
+}
+
+// ErrUsernameNotFound is returned when no user, bot or chat has a username
+var ErrUsernameNotFound = errors.New("USERNAME_NOT_OCCUPIED: username not found")
+
+// ResolvePeer resolves a username (with or without the @) to its InputPeer, the
+// peer is cached so it can be used by its ID afterwards.
+// "me" and "self" resolve to InputPeerSelf.
+// Returns ErrUsernameNotFound if the username is not taken.
+func (c *Client) ResolvePeer(username string) (InputPeer, error) {
+	if isSelf(username) {
+		return &InputPeerSelf{}, nil
+	}
+	entity, err := c.ResolveUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetSendablePeer(entity)
+}
+
+// resolvedEntity returns the user or chat a username resolved to, picked by the peer of the response
+func resolvedEntity(resp *ContactsResolvedPeer, username string) (interface{}, error) {
+	switch peer := resp.Peer.(type) {
+	case *PeerUser:
+		for _, u := range resp.Users {
+			if u, ok := u.(*UserObj); ok && u.ID == peer.UserID {
+				return u, nil
+			}
+		}
+	case *PeerChat:
+		for _, ch := range resp.Chats {
+			if ch, ok := ch.(*ChatObj); ok && ch.ID == peer.ChatID {
+				return ch, nil
+			}
+		}
+	case *PeerChannel:
+		for _, ch := range resp.Chats {
+			if ch, ok := ch.(*Channel); ok && ch.ID == peer.ChannelID {
+				return ch, nil
+			}
 		}
-	} else {
-		return nil, fmt.Errorf("no user or chat has username %s", username)
 	}
+	return nil, errors.Wrap(ErrUsernameNotFound, username)
 }
 
 func packMessage(c *Client, message Message) *NewMessage {
@@ -641,6 +858,7 @@ func packMessage(c *Client, message Message) *NewMessage {
 		m.SenderChat = &Channel{}
 	}
 	m.Peer = c.getPeer(m.Message.PeerID)
+	m.Command, m.CommandArgs = commandFor(m.Message.Message, c.selfUsername)
 	if m.IsMedia() {
 		FileID := PackBotFileID(m.Media())
 		m.File = &CustomFile{
@@ -659,12 +877,19 @@ func packDeleteMessage(c *Client, delete Update) *DeleteMessage {
 	case *UpdateDeleteMessages:
 		deleteMessage.Messages = d.Messages
 		deleteMessage.ChannelID = 0
+		deleteMessage.Pts = d.Pts
+		deleteMessage.PtsCount = d.PtsCount
 	case *UpdateDeleteChannelMessages:
 		deleteMessage.Messages = d.Messages
 		deleteMessage.ChannelID = d.ChannelID
+		deleteMessage.Pts = d.Pts
+		deleteMessage.PtsCount = d.PtsCount
+		deleteMessage.Channel = c.getChannel(&PeerChannel{ChannelID: d.ChannelID})
+		deleteMessage.Peer = c.getPeer(&PeerChannel{ChannelID: d.ChannelID})
 	}
 
 	deleteMessage.Client = c
+	deleteMessage.OriginalUpdate = delete
 	return deleteMessage
 }
 
@@ -729,6 +954,7 @@ func packChannelParticipant(c *Client, update *UpdateChannelParticipant) *Partic
 	pu.Client = c
 	pu.OriginalUpdate = update
 	pu.Channel = c.getChannel(&PeerChannel{ChannelID: update.ChannelID})
+	pu.Peer = c.getPeer(&PeerChannel{ChannelID: update.ChannelID})
 	pu.User, _ = c.GetUser(update.UserID)
 	pu.Actor, _ = c.GetUser(update.ActorID)
 	pu.Old = update.PrevParticipant
@@ -0,0 +1,165 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// maxHistoryLimit is the most messages messages.getHistory returns per request
+const maxHistoryLimit = 100
+
+type HistoryOptions struct {
+	// OffsetID starts after this message, older than it (newer with Reverse)
+	OffsetID int32
+	// MinID and MaxID bound the IDs of the messages returned
+	MinID int32
+	MaxID int32
+	// Limit is the number of messages fetched per request, at most 100 (default 100)
+	Limit int32
+	// MaxCount stops the iteration after this many messages (zero for the whole history)
+	MaxCount int
+	// Reverse iterates from the oldest message to the newest
+	Reverse bool
+}
+
+// HistoryIterator iterates over the history of a chat, or the results of SearchMessages, a page at a time.
+//
+//	iter, _ := client.IterHistory(chat, &HistoryOptions{MaxCount: 500})
+//	for iter.Next() {
+//		fmt.Println(iter.Message().Text())
+//	}
+//	if err := iter.Err(); err != nil { ... }
+type HistoryIterator struct {
+	pager[Message]
+	fetch   func(req *MessagesGetHistoryParams) ([]Message, error)
+	pack    func(msg Message) *NewMessage
+	req     MessagesGetHistoryParams
+	reverse bool
+	current *NewMessage
+}
+
+// IterHistory returns an iterator over the messages of a chat, newest first unless
+// Reverse is set. Pages are fetched with messages.getHistory as the iterator
+// advances, waiting out FLOOD_WAIT errors between them.
+//
+//	Params:
+//	 - peerID: The chat to iterate.
+//	 - Opts: Offset, ID bounds, page size, MaxCount and direction.
+func (c *Client) IterHistory(peerID interface{}, Opts ...*HistoryOptions) (*HistoryIterator, error) {
+	opts := getVariadic(Opts, &HistoryOptions{}).(*HistoryOptions)
+	peer, err := c.GetSendablePeer(peerID)
+	if err != nil {
+		return nil, err
+	}
+	return newHistoryIterator(peer, *opts, func(req *MessagesGetHistoryParams) ([]Message, error) {
+		resp, err := c.MessagesGetHistory(req)
+		if err != nil {
+			return nil, err
+		}
+		return c.messagesOf(resp)
+	}, func(msg Message) *NewMessage {
+		return packMessage(c, msg)
+	}), nil
+}
+
+func newHistoryIterator(peer InputPeer, opts HistoryOptions, fetch func(*MessagesGetHistoryParams) ([]Message, error), pack func(Message) *NewMessage) *HistoryIterator {
+	if opts.Limit <= 0 || opts.Limit > maxHistoryLimit {
+		opts.Limit = maxHistoryLimit
+	}
+	it := &HistoryIterator{
+		fetch:   fetch,
+		pack:    pack,
+		reverse: opts.Reverse,
+		req: MessagesGetHistoryParams{
+			Peer:     peer,
+			OffsetID: opts.OffsetID,
+			MinID:    opts.MinID,
+			MaxID:    opts.MaxID,
+		},
+	}
+	if opts.Reverse {
+		// with a negative add_offset the page starts at offset_id, so skip the offset message
+		it.req.OffsetID = max(opts.OffsetID, opts.MinID) + 1
+	}
+	it.pager = newPager(opts.Limit, opts.MaxCount, it.fetchPage)
+	return it
+}
+
+// Next advances to the next message, returning false at the end of the history or on error
+func (it *HistoryIterator) Next() bool {
+	msg, ok := it.next()
+	if ok {
+		it.current = it.pack(msg)
+	}
+	return ok
+}
+
+// Message returns the current message
+func (it *HistoryIterator) Message() *NewMessage {
+	return it.current
+}
+
+func (it *HistoryIterator) fetchPage(limit int32) ([]Message, bool, error) {
+	req := it.req
+	req.Limit = limit
+	if it.reverse {
+		req.AddOffset = -req.Limit
+	}
+	msgs, err := it.fetch(&req)
+	if err != nil {
+		return nil, false, err
+	}
+	done := len(msgs) < int(req.Limit)
+	if len(msgs) == 0 {
+		return nil, done, nil
+	}
+	// pages are newest first
+	if it.reverse {
+		it.req.OffsetID = messageID(msgs[0]) + 1
+		for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+			msgs[i], msgs[j] = msgs[j], msgs[i]
+		}
+	} else {
+		it.req.OffsetID = messageID(msgs[len(msgs)-1])
+	}
+	var page []Message
+	for _, msg := range msgs {
+		if _, empty := msg.(*MessageEmpty); !empty {
+			page = append(page, msg)
+		}
+	}
+	return page, done, nil
+}
+
+// messagesOf returns the messages of a response of messages.getHistory and the like,
+// caching their users and chats
+func (c *Client) messagesOf(resp MessagesMessages) ([]Message, error) {
+	switch resp := resp.(type) {
+	case *MessagesMessagesObj:
+		c.Cache.UpdatePeersToCache(resp.Users, resp.Chats)
+		return resp.Messages, nil
+	case *MessagesMessagesSlice:
+		c.Cache.UpdatePeersToCache(resp.Users, resp.Chats)
+		return resp.Messages, nil
+	case *MessagesChannelMessages:
+		c.Cache.UpdatePeersToCache(resp.Users, resp.Chats)
+		return resp.Messages, nil
+	case *MessagesMessagesNotModified:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unexpected response: %s", reflect.TypeOf(resp))
+}
+
+func messageID(msg Message) int32 {
+	switch msg := msg.(type) {
+	case *MessageObj:
+		return msg.ID
+	case *MessageService:
+		return msg.ID
+	case *MessageEmpty:
+		return msg.ID
+	}
+	return 0
+}
@@ -0,0 +1,292 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fakeHistory serves messages.getHistory over messages 1..n like telegram does
+func fakeHistory(n int32) func(req *MessagesGetHistoryParams) ([]Message, error) {
+	return func(req *MessagesGetHistoryParams) ([]Message, error) {
+		var ids []int32 // newest first
+		for id := n; id >= 1; id-- {
+			ids = append(ids, id)
+		}
+		start := len(ids)
+		for i, id := range ids {
+			if req.OffsetID == 0 || id < req.OffsetID {
+				start = i
+				break
+			}
+		}
+		start += int(req.AddOffset)
+		end := min(start+int(req.Limit), len(ids))
+		start = max(start, 0)
+		var msgs []Message
+		for _, id := range ids[start:max(start, end)] {
+			msgs = append(msgs, &MessageObj{ID: id})
+		}
+		return msgs, nil
+	}
+}
+
+func collectHistory(t *testing.T, it *HistoryIterator) []int32 {
+	var ids []int32
+	for it.Next() {
+		ids = append(ids, it.Message().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func packTestMessage(msg Message) *NewMessage {
+	return &NewMessage{ID: messageID(msg)}
+}
+
+func TestHistoryIterator(t *testing.T) {
+	ids := collectHistory(t, newHistoryIterator(&InputPeerSelf{}, HistoryOptions{}, fakeHistory(250), packTestMessage))
+	if len(ids) != 250 || ids[0] != 250 || ids[249] != 1 {
+		t.Fatalf("newest first: got %d messages, %v...", len(ids), ids[:3])
+	}
+
+	ids = collectHistory(t, newHistoryIterator(&InputPeerSelf{}, HistoryOptions{Reverse: true, Limit: 30}, fakeHistory(250), packTestMessage))
+	for i, id := range ids {
+		if id != int32(i+1) {
+			t.Fatalf("reverse: message %d has id %d", i, id)
+		}
+	}
+	if len(ids) != 250 {
+		t.Fatalf("reverse: got %d messages", len(ids))
+	}
+
+	ids = collectHistory(t, newHistoryIterator(&InputPeerSelf{}, HistoryOptions{MaxCount: 120, OffsetID: 200}, fakeHistory(250), packTestMessage))
+	if len(ids) != 120 || ids[0] != 199 || ids[119] != 80 {
+		t.Fatalf("max count: got %d messages from %d to %d", len(ids), ids[0], ids[len(ids)-1])
+	}
+}
+
+func TestHistoryIteratorFloodWait(t *testing.T) {
+	fetch := fakeHistory(10)
+	flooded := false
+	it := newHistoryIterator(&InputPeerSelf{}, HistoryOptions{}, func(req *MessagesGetHistoryParams) ([]Message, error) {
+		if !flooded {
+			flooded = true
+			return nil, &RPCError{Code: 420, Message: "FLOOD_WAIT_X", AdditionalInfo: 3}
+		}
+		return fetch(req)
+	}, packTestMessage)
+	var slept time.Duration
+	it.sleep = func(d time.Duration) { slept += d }
+	if ids := collectHistory(t, it); len(ids) != 10 {
+		t.Fatalf("got %d messages after the flood wait", len(ids))
+	}
+	if slept != 3*time.Second {
+		t.Errorf("slept %s, want 3s", slept)
+	}
+}
+
+func TestGlobalSearchIterator(t *testing.T) {
+	msg := func(chat int64, id, date int32) Message {
+		return &MessageObj{ID: id, Date: date, PeerID: &PeerUser{UserID: chat}}
+	}
+	// recorded pages of a search, the third repeats the end of the second and the fourth
+	// is served again for any later offset, as telegram does when the results run out
+	pages := []globalPage{
+		{messages: []Message{msg(1, 10, 900), msg(2, 7, 800)}, nextRate: 800},
+		{messages: []Message{msg(3, 4, 700), msg(1, 9, 600)}},
+		{messages: []Message{msg(1, 9, 600), msg(2, 3, 500)}, nextRate: 500},
+		{messages: []Message{msg(2, 3, 500)}, nextRate: 500},
+	}
+	var offsets []globalOffset
+	fetch := func(offset globalOffset, limit int32) (globalPage, error) {
+		offsets = append(offsets, offset)
+		if len(offsets) > 10 {
+			t.Fatal("search does not terminate")
+		}
+		return pages[min(len(offsets)-1, len(pages)-1)], nil
+	}
+	resolve := func(peer Peer) (InputPeer, error) {
+		return &InputPeerUser{UserID: peer.(*PeerUser).UserID}, nil
+	}
+
+	it := newGlobalSearchIterator(GlobalSearchOptions{Limit: 2}, fetch, resolve, packTestMessage)
+	var ids []int32
+	for it.Next() {
+		ids = append(ids, it.Message().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int32{10, 7, 4, 9, 3}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+	// each page continues from the rate, chat and id of the last message of the previous one
+	want := []globalOffset{
+		{peer: &InputPeerEmpty{}},
+		{rate: 800, peer: &InputPeerUser{UserID: 2}, id: 7},
+		{rate: 600, peer: &InputPeerUser{UserID: 1}, id: 9},
+		{rate: 500, peer: &InputPeerUser{UserID: 2}, id: 3},
+	}
+	if !reflect.DeepEqual(offsets, want) {
+		t.Errorf("offsets %+v, want %+v", offsets, want)
+	}
+}
+
+func TestDialogIterator(t *testing.T) {
+	dialog := func(user int64, top int32) Dialog {
+		return &DialogObj{Peer: &PeerUser{UserID: user}, TopMessage: top, UnreadCount: int32(user)}
+	}
+	top := func(user int64, id, date int32) Message {
+		return &MessageObj{ID: id, Date: date, PeerID: &PeerUser{UserID: user}}
+	}
+	// 5 dialogs served 2 at a time, the last page repeats a dialog already listed
+	pages := []dialogPage{
+		{dialogs: []Dialog{dialog(1, 50), dialog(2, 40)}, messages: []Message{top(1, 50, 900), top(2, 40, 800)}, count: 5},
+		{dialogs: []Dialog{dialog(3, 30), dialog(4, 20)}, messages: []Message{top(3, 30, 700), top(4, 20, 600)}, count: 5},
+		{dialogs: []Dialog{dialog(4, 20), dialog(5, 10)}, messages: []Message{top(4, 20, 600), top(5, 10, 500)}, count: 5},
+	}
+	var offsets []dialogOffset
+	fetch := func(offset dialogOffset, limit int32) (dialogPage, error) {
+		offsets = append(offsets, offset)
+		if len(offsets) > len(pages) {
+			t.Fatal("iteration does not stop at the end of the list")
+		}
+		return pages[len(offsets)-1], nil
+	}
+	resolve := func(peer Peer) (InputPeer, error) {
+		return &InputPeerUser{UserID: peer.(*PeerUser).UserID}, nil
+	}
+
+	it := newDialogIterator(DialogIterOptions{Limit: 2}, fetch, resolve, packTestMessage)
+	var chats []int64
+	for it.Next() {
+		if it.Dialog().TopMessage == nil || it.Dialog().UnreadCount != int32(it.Dialog().ChatID()) {
+			t.Errorf("dialog %+v", it.Dialog())
+		}
+		chats = append(chats, it.Dialog().ChatID())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 2, 3, 4, 5}; !reflect.DeepEqual(chats, want) {
+		t.Errorf("got %v, want %v", chats, want)
+	}
+	if want := (dialogOffset{date: 600, id: 20, peer: &InputPeerUser{UserID: 4}}); !reflect.DeepEqual(offsets[2], want) {
+		t.Errorf("third page offset %+v, want %+v", offsets[2], want)
+	}
+}
+
+func TestDialogIteratorWithoutTopMessage(t *testing.T) {
+	// the last dialog of the first page has no message, the next page starts after the one before it
+	pages := []dialogPage{
+		{
+			dialogs:  []Dialog{&DialogObj{Peer: &PeerUser{UserID: 1}, TopMessage: 50}, &DialogObj{Peer: &PeerUser{UserID: 2}}},
+			messages: []Message{&MessageObj{ID: 50, Date: 900, PeerID: &PeerUser{UserID: 1}}},
+			count:    3,
+		},
+		{
+			dialogs:  []Dialog{&DialogObj{Peer: &PeerUser{UserID: 3}, TopMessage: 30}},
+			messages: []Message{&MessageObj{ID: 30, Date: 700, PeerID: &PeerUser{UserID: 3}}},
+			count:    3,
+		},
+	}
+	var offsets []dialogOffset
+	fetch := func(offset dialogOffset, limit int32) (dialogPage, error) {
+		offsets = append(offsets, offset)
+		if len(offsets) > len(pages) {
+			t.Fatal("iteration does not stop at the end of the list")
+		}
+		return pages[len(offsets)-1], nil
+	}
+	resolve := func(peer Peer) (InputPeer, error) {
+		return &InputPeerUser{UserID: peer.(*PeerUser).UserID}, nil
+	}
+
+	it := newDialogIterator(DialogIterOptions{Limit: 2}, fetch, resolve, packTestMessage)
+	var chats []int64
+	for it.Next() {
+		chats = append(chats, it.Dialog().ChatID())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{1, 2, 3}; !reflect.DeepEqual(chats, want) {
+		t.Errorf("got %v, want %v", chats, want)
+	}
+	if want := (dialogOffset{date: 900, id: 50, peer: &InputPeerUser{UserID: 1}}); len(offsets) != 2 || !reflect.DeepEqual(offsets[1], want) {
+		t.Errorf("offsets %+v, want the second from %+v", offsets, want)
+	}
+}
+
+func TestSearchMessages(t *testing.T) {
+	history := fakeHistory(150)
+	var searches []*MessagesSearchParams
+	c := answeringClient(t, func(req Object) (any, error) {
+		search, ok := req.(*MessagesSearchParams)
+		if !ok {
+			return nil, errors.New("unexpected request")
+		}
+		searches = append(searches, search)
+		msgs, _ := history(&MessagesGetHistoryParams{OffsetID: search.OffsetID, AddOffset: search.AddOffset, Limit: search.Limit})
+		return &MessagesMessagesSlice{Messages: msgs, Count: 150, Users: []User{&UserObj{ID: 9, AccessHash: 1}}}, nil
+	})
+	from := time.Unix(1700000000, 0)
+	it, err := c.SearchMessages(&InputPeerChat{ChatID: 1}, "invoice", nil, &SearchOptions{TopMsgID: 3, MinDate: from})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := collectHistory(t, it)
+	if len(ids) != 150 || ids[0] != 150 || ids[149] != 1 {
+		t.Fatalf("got %d messages, from %d", len(ids), ids[0])
+	}
+	// the pages share the query, the offset moves past the last message of the previous one
+	if len(searches) != 2 || searches[1].OffsetID != 51 {
+		t.Fatalf("searched %d pages", len(searches))
+	}
+	first := searches[0]
+	if first.Q != "invoice" || first.TopMsgID != 3 || first.MinDate != int32(from.Unix()) || first.MaxDate != 0 {
+		t.Errorf("search %+v", first)
+	}
+	if _, ok := first.Filter.(*InputMessagesFilterEmpty); !ok {
+		t.Errorf("a nil filter was sent as %T", first.Filter)
+	}
+	c.Cache.RLock()
+	_, cached := c.Cache.users[9]
+	c.Cache.RUnlock()
+	if !cached {
+		t.Error("the users of the results were not cached")
+	}
+
+	searches = nil
+	it, err = c.SearchMessages(&InputPeerChat{ChatID: 1}, "", &InputMessagesFilterPhotos{}, &SearchOptions{HistoryOptions: HistoryOptions{Reverse: true, MaxCount: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := collectHistory(t, it); len(ids) != 10 || ids[0] != 1 || ids[9] != 10 {
+		t.Errorf("reverse: got %v", ids)
+	}
+	if _, ok := searches[0].Filter.(*InputMessagesFilterPhotos); !ok || searches[0].AddOffset != -10 {
+		t.Errorf("reverse search %+v", searches[0])
+	}
+}
+
+func TestMessagesOf(t *testing.T) {
+	c := &Client{Cache: NewCache()}
+	for _, resp := range []MessagesMessages{
+		&MessagesMessagesObj{Messages: []Message{&MessageObj{ID: 1}}},
+		&MessagesMessagesSlice{Messages: []Message{&MessageObj{ID: 1}}},
+		&MessagesChannelMessages{Messages: []Message{&MessageObj{ID: 1}}},
+	} {
+		if msgs, err := c.messagesOf(resp); err != nil || len(msgs) != 1 {
+			t.Errorf("%T: got %v, %v", resp, msgs, err)
+		}
+	}
+	if msgs, err := c.messagesOf(&MessagesMessagesNotModified{}); err != nil || msgs != nil {
+		t.Errorf("not modified: got %v, %v", msgs, err)
+	}
+}
@@ -25,6 +25,7 @@ type (
 		Client        *Client
 		QueryID       int64
 		InlineResults []InputBotInlineResult
+		err           error
 	}
 )
 
@@ -48,6 +49,24 @@ func (b *InlineBuilder) Results() []InputBotInlineResult {
 	return b.InlineResults
 }
 
+// Err returns the first error building the results, a *ParseError for malformed markup
+// in a text or caption, which is then sent as plain text
+func (b *InlineBuilder) Err() error {
+	return b.err
+}
+
+// formatMessage parses the text of a result, keeping the first error for Err
+func (b *InlineBuilder) formatMessage(text, parseMode string) ([]MessageEntity, string) {
+	entities, plain, err := b.Client.FormatMessage(text, b.Client.parseModeFor(parseMode))
+	if err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return []MessageEntity{}, text
+	}
+	return entities, plain
+}
+
 type ArticleOptions struct {
 	ID           string                             `json:"id,omitempty"`
 	Title        string                             `json:"title,omitempty"`
@@ -73,7 +92,7 @@ func (b *InlineBuilder) Article(title, description, text string, options ...*Art
 	} else {
 		opts = ArticleOptions{}
 	}
-	e, text := b.Client.FormatMessage(text, getValue(opts.ParseMode, b.Client.ParseMode()).(string))
+	e, text := b.formatMessage(text, opts.ParseMode)
 	result := &InputBotInlineResultObj{
 		ID:          getValue(opts.ID, fmt.Sprint(GenerateRandomLong())).(string),
 		Type:        "article",
@@ -130,7 +149,7 @@ PhotoTypeSwitch:
 		b.Client.Logger.Warn("InlineBuilder.Photo: Photo is not a InputMediaPhoto, its a", reflect.TypeOf(Photo).String())
 		Image = &InputPhotoEmpty{}
 	}
-	e, text := b.Client.FormatMessage(opts.Caption, getValue(opts.ParseMode, b.Client.ParseMode()).(string))
+	e, text := b.formatMessage(opts.Caption, opts.ParseMode)
 	result := &InputBotInlineResultPhoto{
 		ID:    getValue(opts.ID, fmt.Sprint(GenerateRandomLong())).(string),
 		Type:  "photo",
@@ -186,7 +205,7 @@ DocTypeSwitch:
 		b.Client.Logger.Warn("InlineBuilder.Document: Document is not a InputMediaDocument")
 		Doc = &InputDocumentEmpty{}
 	}
-	e, text := b.Client.FormatMessage(opts.Caption, getValue(opts.ParseMode, b.Client.ParseMode()).(string))
+	e, text := b.formatMessage(opts.Caption, opts.ParseMode)
 	result := &InputBotInlineResultDocument{
 		ID:          getValue(opts.ID, fmt.Sprint(GenerateRandomLong())).(string),
 		Type:        "document",
@@ -227,7 +246,7 @@ func (b *InlineBuilder) Game(ID, ShortName string, options ...*ArticleOptions) I
 	} else {
 		opts = ArticleOptions{}
 	}
-	e, text := b.Client.FormatMessage(opts.Caption, getValue(opts.ParseMode, b.Client.ParseMode()).(string))
+	e, text := b.formatMessage(opts.Caption, opts.ParseMode)
 	result := &InputBotInlineResultGame{
 		ID:        getValue(opts.ID, fmt.Sprint(GenerateRandomLong())).(string),
 		ShortName: ShortName,
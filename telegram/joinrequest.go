@@ -0,0 +1,131 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import "github.com/pkg/errors"
+
+// ErrJoinRequestMissing is returned when approving or declining a join request that was
+// already handled by another admin or withdrawn
+var ErrJoinRequestMissing = errors.New("HIDE_REQUESTER_MISSING: the join request was already handled or withdrawn")
+
+// JoinRequest is a change of the join requests of a chat whose invite links need approval.
+// Bots receive each request as it is sent (UpdateBotChatInviteRequester), admin accounts the
+// number of pending requests and the latest requesters (UpdatePendingJoinRequests).
+type JoinRequest struct {
+	Client         *Client
+	OriginalUpdate Update
+	Peer           Peer
+	// UserID is the user asking to join, zero for a change of the pending requests
+	UserID int64
+	// About is the bio of the user
+	About string
+	// Invite is the link the request was sent through
+	Invite ExportedChatInvite
+	Date   int32
+	// Pending is the number of pending requests, RecentRequesters the IDs of the latest
+	// users asking to join, both only set for a change of the pending requests
+	Pending          int32
+	RecentRequesters []int64
+}
+
+func packJoinRequest(c *Client, update Update) *JoinRequest {
+	r := &JoinRequest{Client: c, OriginalUpdate: update}
+	switch u := update.(type) {
+	case *UpdateBotChatInviteRequester:
+		r.Peer, r.UserID, r.About, r.Invite, r.Date = u.Peer, u.UserID, u.About, u.Invite, u.Date
+	case *UpdatePendingJoinRequests:
+		r.Peer, r.Pending, r.RecentRequesters = u.Peer, u.RequestsPending, u.RecentRequesters
+	}
+	return r
+}
+
+// ChatID returns the bot API style ID of the chat the request is for
+func (r *JoinRequest) ChatID() int64 {
+	return peerKey(r.Peer)
+}
+
+// User returns the user asking to join, nil for a change of the pending requests
+func (r *JoinRequest) User() *UserObj {
+	if r.UserID == 0 {
+		return nil
+	}
+	user, _ := r.Client.GetUser(r.UserID)
+	return user
+}
+
+// Approve adds the user to the chat
+func (r *JoinRequest) Approve() (bool, error) {
+	if r.UserID == 0 {
+		return false, errors.New("the update isn't the request of a user, see ApproveAllJoinRequests")
+	}
+	return r.Client.ApproveJoinRequest(r.Peer, r.UserID)
+}
+
+// Decline declines the request of the user
+func (r *JoinRequest) Decline() (bool, error) {
+	if r.UserID == 0 {
+		return false, errors.New("the update isn't the request of a user, see DeclineAllJoinRequests")
+	}
+	return r.Client.DeclineJoinRequest(r.Peer, r.UserID)
+}
+
+// ApproveJoinRequest adds a user who asked to join a chat.
+// Returns ErrJoinRequestMissing if the request was already handled.
+// This method is a wrapper for messages.hideChatJoinRequest.
+func (c *Client) ApproveJoinRequest(chatID interface{}, userID interface{}) (bool, error) {
+	return c.hideJoinRequest(chatID, userID, true)
+}
+
+// DeclineJoinRequest declines the request of a user to join a chat.
+// Returns ErrJoinRequestMissing if the request was already handled.
+// This method is a wrapper for messages.hideChatJoinRequest.
+func (c *Client) DeclineJoinRequest(chatID interface{}, userID interface{}) (bool, error) {
+	return c.hideJoinRequest(chatID, userID, false)
+}
+
+// ApproveAllJoinRequests adds every user who asked to join a chat, or only those who
+// asked through link.
+// This method is a wrapper for messages.hideAllChatJoinRequests.
+func (c *Client) ApproveAllJoinRequests(chatID interface{}, link ...string) (bool, error) {
+	return c.hideAllJoinRequests(chatID, getVariadic(link, "").(string), true)
+}
+
+// DeclineAllJoinRequests declines every request to join a chat, or only those sent
+// through link.
+// This method is a wrapper for messages.hideAllChatJoinRequests.
+func (c *Client) DeclineAllJoinRequests(chatID interface{}, link ...string) (bool, error) {
+	return c.hideAllJoinRequests(chatID, getVariadic(link, "").(string), false)
+}
+
+func (c *Client) hideJoinRequest(chatID interface{}, userID interface{}, approved bool) (bool, error) {
+	peer, err := c.GetSendablePeer(chatID)
+	if err != nil {
+		return false, err
+	}
+	u, err := c.GetSendablePeer(userID)
+	if err != nil {
+		return false, err
+	}
+	user, err := inputUser(u)
+	if err != nil {
+		return false, err
+	}
+	if _, err := c.MessagesHideChatJoinRequest(approved, peer, user); err != nil {
+		if matchRPCError(err, "HIDE_REQUESTER_MISSING") {
+			return false, errors.Wrap(ErrJoinRequestMissing, err.Error())
+		}
+		return false, adminRequired(err)
+	}
+	return true, nil
+}
+
+func (c *Client) hideAllJoinRequests(chatID interface{}, link string, approved bool) (bool, error) {
+	peer, err := c.GetSendablePeer(chatID)
+	if err != nil {
+		return false, err
+	}
+	if _, err := c.MessagesHideAllChatJoinRequests(approved, peer, link); err != nil {
+		return false, adminRequired(err)
+	}
+	return true, nil
+}
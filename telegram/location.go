@@ -0,0 +1,130 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// LiveForever is the live period of a live location shared until it is stopped
+const LiveForever int32 = math.MaxInt32
+
+type LocationOptions struct {
+	MediaOptions
+	// LivePeriod makes the location live for that many seconds (60 to 86400, or LiveForever)
+	LivePeriod int32 `json:"live_period,omitempty"`
+	// Heading is the direction the user is moving in degrees (1 to 360), live locations only
+	Heading int32 `json:"heading,omitempty"`
+	// ProximityRadius notifies about users getting closer than that many meters, live locations only
+	ProximityRadius int32 `json:"proximity_radius,omitempty"`
+	// Accuracy is the radius of uncertainty of the location in meters (0 to 1500)
+	Accuracy int32 `json:"accuracy,omitempty"`
+}
+
+type VenueOptions struct {
+	MediaOptions
+	// Provider is the venue provider, "foursquare" or "gplaces"
+	Provider  string `json:"provider,omitempty"`
+	VenueID   string `json:"venue_id,omitempty"`
+	VenueType string `json:"venue_type,omitempty"`
+}
+
+// inputGeoPoint validates the coordinates of a location
+func inputGeoPoint(lat, long float64, accuracy int32) (*InputGeoPointObj, error) {
+	if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("latitude %v is out of range, it must be between -90 and 90", lat)
+	}
+	if math.IsNaN(long) || long < -180 || long > 180 {
+		return nil, fmt.Errorf("longitude %v is out of range, it must be between -180 and 180", long)
+	}
+	if accuracy < 0 || accuracy > 1500 {
+		return nil, fmt.Errorf("accuracy %d is out of range, it must be between 0 and 1500", accuracy)
+	}
+	return &InputGeoPointObj{Lat: lat, Long: long, AccuracyRadius: accuracy}, nil
+}
+
+// locationMedia is the media of a location, a live one when LivePeriod is set
+func locationMedia(lat, long float64, opt *LocationOptions) (InputMedia, error) {
+	point, err := inputGeoPoint(lat, long, opt.Accuracy)
+	if err != nil {
+		return nil, err
+	}
+	if opt.LivePeriod == 0 {
+		return &InputMediaGeoPoint{GeoPoint: point}, nil
+	}
+	if opt.LivePeriod != LiveForever && (opt.LivePeriod < 60 || opt.LivePeriod > 86400) {
+		return nil, fmt.Errorf("live period %d is out of range, it must be between 60 and 86400 seconds", opt.LivePeriod)
+	}
+	if opt.Heading < 0 || opt.Heading > 360 {
+		return nil, fmt.Errorf("heading %d is out of range, it must be between 1 and 360", opt.Heading)
+	}
+	return &InputMediaGeoLive{
+		GeoPoint:                    point,
+		Period:                      opt.LivePeriod,
+		Heading:                     opt.Heading,
+		ProximityNotificationRadius: opt.ProximityRadius,
+	}, nil
+}
+
+// SendLocation sends a location, a live location when LivePeriod is set in the options
+func (c *Client) SendLocation(peerID interface{}, lat, long float64, opts ...*LocationOptions) (*NewMessage, error) {
+	opt := getVariadic(opts, &LocationOptions{}).(*LocationOptions)
+	media, err := locationMedia(lat, long, opt)
+	if err != nil {
+		return nil, err
+	}
+	return c.SendMedia(peerID, media, &opt.MediaOptions)
+}
+
+// SendVenue sends a venue, a location with a title and an address
+func (c *Client) SendVenue(peerID interface{}, lat, long float64, title, address string, opts ...*VenueOptions) (*NewMessage, error) {
+	opt := getVariadic(opts, &VenueOptions{}).(*VenueOptions)
+	point, err := inputGeoPoint(lat, long, 0)
+	if err != nil {
+		return nil, err
+	}
+	return c.SendMedia(peerID, &InputMediaVenue{
+		GeoPoint:  point,
+		Title:     title,
+		Address:   address,
+		Provider:  opt.Provider,
+		VenueID:   opt.VenueID,
+		VenueType: opt.VenueType,
+	}, &opt.MediaOptions)
+}
+
+// EditLiveLocation moves the live location of the message, the period of the options is ignored
+func (m *NewMessage) EditLiveLocation(lat, long float64, opts ...*LocationOptions) (*NewMessage, error) {
+	opt := getVariadic(opts, &LocationOptions{}).(*LocationOptions)
+	live := *opt
+	live.LivePeriod = LiveForever
+	media, err := locationMedia(lat, long, &live)
+	if err != nil {
+		return nil, err
+	}
+	media.(*InputMediaGeoLive).Period = 0
+	return m.editLiveLocation(media)
+}
+
+// StopLiveLocation stops sharing the live location of the message
+func (m *NewMessage) StopLiveLocation() (*NewMessage, error) {
+	geo, ok := m.Media().(*MessageMediaGeoLive)
+	if !ok {
+		return nil, errors.New("message is not a live location")
+	}
+	point := &InputGeoPointObj{}
+	if p, ok := geo.Geo.(*GeoPointObj); ok {
+		point.Lat, point.Long = p.Lat, p.Long
+	}
+	return m.editLiveLocation(&InputMediaGeoLive{Stopped: true, GeoPoint: point})
+}
+
+func (m *NewMessage) editLiveLocation(media InputMedia) (*NewMessage, error) {
+	if _, ok := m.Media().(*MessageMediaGeoLive); !ok {
+		return nil, errors.New("message is not a live location")
+	}
+	return m.Client.editMessage(m.Peer, m.ID, "", nil, media, &SendOptions{LinkPreview: true, ReplyMarkup: m.Message.ReplyMarkup})
+}
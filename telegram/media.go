@@ -38,7 +38,9 @@ func (p *Progress) String() string {
 }
 
 type UploadOptions struct {
-	// Worker count for upload file.
+	// Workers is the number of parts uploaded concurrently (default 4).
+	Workers int `json:"workers,omitempty"`
+	// Deprecated: use Workers
 	Threads int `json:"threads,omitempty"`
 	//  Chunk size for upload file.
 	ChunkSize int32 `json:"chunk_size,omitempty"`
@@ -46,6 +48,11 @@ type UploadOptions struct {
 	FileName string `json:"file_name,omitempty"`
 	// output Progress channel for upload file.
 	ProgressChan chan Progress `json:"progress_chan,omitempty"`
+	// ProgressCallback is called with the bytes sent after each uploaded part, and once more on completion.
+	ProgressCallback func(sent, total int64) `json:"-"`
+	// ResumeFile is where the upload state is saved after each part, an upload
+	// interrupted midway continues from it when started again with the same ResumeFile.
+	ResumeFile string `json:"resume_file,omitempty"`
 }
 
 type FileMeta struct {
@@ -67,6 +74,17 @@ type Uploader struct {
 	progress  chan Progress
 	totalDone int64
 	Meta      FileMeta `json:"meta,omitempty"`
+
+	progressCallback func(sent, total int64)
+	progressMutex    sync.Mutex
+	sent             int64
+
+	resumeFile   string
+	requireState bool
+	uploaded     map[int32]bool
+	savePart     func(w *Client, part int32, buf []byte) error
+	errMutex     sync.Mutex
+	err          error
 }
 
 // UploadFile upload file to telegram.
@@ -80,7 +98,7 @@ func (c *Client) UploadFile(file interface{}, Opts ...*UploadOptions) (InputFile
 		Source:    file,
 		Client:    c,
 		ChunkSize: opts.ChunkSize,
-		Worker:    opts.Threads,
+		Worker:    getInt(opts.Workers, opts.Threads),
 		Meta: FileMeta{
 			FileName: opts.FileName,
 		},
@@ -88,19 +106,45 @@ func (c *Client) UploadFile(file interface{}, Opts ...*UploadOptions) (InputFile
 	if opts.ProgressChan != nil {
 		u.progress = opts.ProgressChan
 	}
+	u.progressCallback = opts.ProgressCallback
+	u.resumeFile = opts.ResumeFile
 	return u.Upload()
 }
 
 func (u *Uploader) Upload() (InputFile, error) {
+	state, err := u.loadState()
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		// the part size must match the one the parts were uploaded with
+		u.ChunkSize = state.ChunkSize
+	}
 	if err := u.Init(); err != nil {
 		return nil, err
 	}
+	if state != nil {
+		if err := u.restoreState(state); err != nil {
+			return nil, err
+		}
+	}
 	if err := u.Start(); err != nil {
 		return nil, err
 	}
+	if !u.Meta.IsBig {
+		if err := u.hashFile(); err != nil {
+			return nil, errors.Wrap(err, "hashing file")
+		}
+	}
+	if u.resumeFile != "" {
+		os.Remove(u.resumeFile)
+	}
 	if u.progress != nil {
 		u.progress <- Progress{Total: u.Meta.FileSize, Now: u.Meta.FileSize, Done: true}
 	}
+	if u.progressCallback != nil {
+		u.progressCallback(u.Meta.FileSize, u.Meta.FileSize)
+	}
 	return u.saveFile(), nil
 }
 
@@ -159,12 +203,13 @@ func (u *Uploader) Init() error {
 }
 
 func (u *Uploader) allocateWorkers() error {
-	fmt.Println("allocateWorkers")
-	borrowedSenders, err := u.Client.BorrowExportedSenders(u.Client.GetDC(), u.Worker)
+	if len(u.Workers) > 0 {
+		return nil
+	}
+	borrowedSenders, err := u.Client.BorrowExportedSenders(u.Client.GetDC(), min(u.Worker, maxExportedSenders))
 	if err != nil {
 		return err
 	}
-	fmt.Println("borrowedSenders", borrowedSenders)
 	u.Workers = borrowedSenders
 	u.Client.Log.Info(fmt.Sprintf("Uploading file %s with %d workers", u.Meta.FileName, len(u.Workers)))
 
@@ -179,59 +224,44 @@ func (u *Uploader) saveFile() InputFile {
 	return &InputFileObj{u.FileID, u.Parts, u.Meta.FileName, string(u.Meta.Md5Hash.Sum(nil))}
 }
 
-func (u *Uploader) dividePartsToWorkers() [][]int32 {
-	var (
-		parts  = u.Parts
-		worker = u.Worker
-	)
-	if parts < int32(worker) {
-		worker = int(parts)
+// maxExportedSenders is the most senders BorrowExportedSenders hands out at once
+const maxExportedSenders = 10
+
+// Start uploads the parts not uploaded yet, up to u.Worker at a time. Parts are
+// taken in order from a shared queue, each carrying its own index, so the order
+// they complete in doesn't matter; the senders are shared round-robin.
+func (u *Uploader) Start() error {
+	if u.Worker > int(u.Parts) {
+		u.Worker = int(u.Parts)
 	}
-	if int32(worker) == 0 {
-		worker = 1
+	if u.Worker < 1 {
+		u.Worker = 1
 	}
-	var (
-		perWorker = parts / int32(worker)
-		remainder = parts % int32(worker)
-	)
-	var (
-		start = int32(0)
-		end   = int32(0)
-	)
-	var (
-		partsToWorkers = make([][]int32, worker)
-	)
-	for i := 0; i < worker; i++ {
-		end = start + perWorker
-		if remainder > 0 {
-			end++
-			remainder--
-		}
-		partsToWorkers[i] = []int32{start, end}
-		start = end
+	if err := u.allocateWorkers(); err != nil {
+		return errors.Wrap(err, "allocating workers")
 	}
-	u.Worker = worker
-	u.Parts = parts
-	u.allocateWorkers()
-	return partsToWorkers
-}
-
-func (u *Uploader) Start() error {
-	var (
-		parts = u.dividePartsToWorkers()
-	)
-	for i, w := range u.Workers {
+	if len(u.Workers) == 0 {
+		return errors.New("no workers available for upload")
+	}
+	parts := make(chan int32)
+	for i := 0; i < u.Worker; i++ {
 		u.wg.Add(1)
-		go u.uploadParts(w, parts[i])
+		go u.uploadParts(u.Workers[i%len(u.Workers)], parts)
+	}
+	for i := int32(0); i < u.Parts; i++ {
+		if u.failed() {
+			break
+		}
+		if !u.isUploaded(i) {
+			parts <- i
+		}
 	}
+	close(parts)
 	u.wg.Wait()
-	return nil
+	return u.err
 }
 
 func (u *Uploader) readPart(part int32) ([]byte, error) {
-	var (
-		err error
-	)
 	switch s := u.Source.(type) {
 	case string:
 		f, err := os.Open(s)
@@ -244,13 +274,13 @@ func (u *Uploader) readPart(part int32) ([]byte, error) {
 			return nil, err
 		}
 		buf := make([]byte, u.ChunkSize)
-		_, err = f.Read(buf)
-		if err != nil {
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
 			return nil, err
 		}
-		return buf, nil
+		return buf[:n], nil
 	case []byte:
-		return s[part*u.ChunkSize : (part+1)*u.ChunkSize], nil
+		return s[int64(part)*int64(u.ChunkSize) : min(int64(part+1)*int64(u.ChunkSize), int64(len(s)))], nil
 	case fs.File:
 		fs, err := s.Stat()
 		if err != nil {
@@ -266,47 +296,103 @@ func (u *Uploader) readPart(part int32) ([]byte, error) {
 			return nil, err
 		}
 		buf := make([]byte, u.ChunkSize)
-		_, err = f.Read(buf)
-		if err != nil {
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
 			return nil, err
 		}
-		return buf, nil
+		return buf[:n], nil
 	case *bytes.Reader:
 		// coverted io.Reader to bytes.Reader
 		buf := make([]byte, u.ChunkSize)
-		_, err = s.ReadAt(buf, int64(part*u.ChunkSize))
-		if err != nil {
+		n, err := s.ReadAt(buf, int64(part*u.ChunkSize))
+		if err != nil && err != io.EOF {
 			return nil, err
 		}
-		return buf, nil
+		return buf[:n], nil
 	default:
 		return nil, errors.New("unknown source type, only support string, []byte, fs.File, io.Reader")
 	}
 }
 
-func (u *Uploader) uploadParts(w *Client, parts []int32) {
+func (u *Uploader) uploadParts(w *Client, parts <-chan int32) {
 	defer u.wg.Done()
-	for i := parts[0]; i < parts[1]; i++ {
+	savePart := u.savePart
+	if savePart == nil {
+		savePart = u.sendPart
+	}
+	for i := range parts {
+		if u.failed() {
+			continue // drain the queue
+		}
 		buf, err := u.readPart(i)
+		if err == nil {
+			err = savePart(w, i, buf)
+		}
 		if err != nil {
-			u.Client.Log.Error(err)
+			// the parts uploaded so far stay in the resume file
+			u.setErr(errors.Wrap(err, fmt.Sprintf("uploading part %d", i)))
 			continue
 		}
-		if u.Meta.IsBig {
-			_, err = w.UploadSaveBigFilePart(u.FileID, i, u.Parts, buf)
-		} else {
-			u.Meta.Md5Hash.Write(buf)
-			_, err = w.UploadSaveFilePart(u.FileID, i, buf)
-		}
+		u.Client.Log.Debug(fmt.Sprintf("uploaded part %d of %d", i, u.Parts))
+		u.partDone(i, len(buf))
+	}
+}
 
-		w.Logger.Debug(fmt.Sprintf("uploaded part %d of %d", i, u.Parts))
-		u.totalDone++
-		if u.progress != nil {
-			u.progress <- Progress{Total: int64(u.Parts), Now: u.totalDone}
-		}
+func (u *Uploader) sendPart(w *Client, part int32, buf []byte) error {
+	var err error
+	if u.Meta.IsBig {
+		_, err = w.UploadSaveBigFilePart(u.FileID, part, u.Parts, buf)
+	} else {
+		_, err = w.UploadSaveFilePart(u.FileID, part, buf)
+	}
+	return err
+}
+
+func (u *Uploader) failed() bool {
+	u.errMutex.Lock()
+	defer u.errMutex.Unlock()
+	return u.err != nil
+}
+
+func (u *Uploader) setErr(err error) {
+	u.errMutex.Lock()
+	if u.err == nil {
+		u.err = err
+	}
+	u.errMutex.Unlock()
+}
+
+// hashFile computes the md5 checksum of a small file, in order, once all parts are uploaded
+func (u *Uploader) hashFile() error {
+	u.Meta.Md5Hash = md5.New()
+	for i := int32(0); i < u.Parts; i++ {
+		buf, err := u.readPart(i)
 		if err != nil {
-			panic(err)
+			return err
 		}
+		u.Meta.Md5Hash.Write(buf)
+	}
+	return nil
+}
+
+// partDone records an uploaded part of n bytes and reports the progress,
+// under a lock so sent only ever grows across workers
+func (u *Uploader) partDone(part int32, n int) {
+	u.progressMutex.Lock()
+	defer u.progressMutex.Unlock()
+	u.totalDone++
+	u.sent += int64(n)
+	if u.resumeFile != "" {
+		u.uploaded[part] = true
+		if err := u.saveState(); err != nil {
+			u.Client.Log.Warn("saving upload state: ", err)
+		}
+	}
+	if u.progress != nil {
+		u.progress <- Progress{Total: int64(u.Parts), Now: u.totalDone}
+	}
+	if u.progressCallback != nil {
+		u.progressCallback(u.sent, u.Meta.FileSize)
 	}
 }
 
@@ -321,11 +407,20 @@ type DownloadOptions struct {
 	Threads int `json:"threads,omitempty"`
 	// Chunk size to download file
 	ChunkSize int32 `json:"chunk_size,omitempty"`
+	// ProgressCallback is called with the bytes received after each chunk, used by DownloadToPath.
+	ProgressCallback func(received, total int64) `json:"-"`
+	// Thumb downloads the largest thumbnail of a document, or the smallest size of a photo
+	Thumb bool `json:"thumb,omitempty"`
+	// ThumbSize picks the thumbnail downloaded with Thumb by type ("m", "x", "y", or "v" for a video thumbnail)
+	ThumbSize string `json:"thumb_size,omitempty"`
 }
 
+// DownloadMedia downloads the file of a message, media, photo or document to disk, returning
+// its path. Photos are downloaded in their largest size. ErrNoDownloadableMedia is returned
+// for a message without a file.
 func (c *Client) DownloadMedia(file interface{}, Opts ...*DownloadOptions) (string, error) {
 	opts := getVariadic(Opts, &DownloadOptions{}).(*DownloadOptions)
-	location, dc, size, fileName, err := GetFileLocation(file)
+	location, dc, size, fileName, err := fileLocation(file, opts.Thumb, opts.ThumbSize)
 	if err != nil {
 		return "", err
 	}
@@ -342,9 +437,42 @@ func (c *Client) DownloadMedia(file interface{}, Opts ...*DownloadOptions) (stri
 		Worker:    opts.Threads,
 		ChunkSize: getValue(opts.ChunkSize, DEFAULT_PARTS).(int32),
 	}
+	cache := c.downloadCache.Load()
+	if key := getDownloadCacheKey(location, size); key != "" && cache != nil {
+		if path, ok := d.fromDownloadCache(cache, key); ok {
+			return path, nil
+		}
+		path, err := d.Download()
+		if err == nil {
+			if err := cache.store(key, path, size); err != nil {
+				c.Log.Warn("storing in download cache: ", err)
+			}
+		}
+		return path, err
+	}
 	return d.Download()
 }
 
+// DownloadMediaBytes downloads the file of a message like DownloadMedia, returning its
+// content instead of writing it to disk.
+func (c *Client) DownloadMediaBytes(file interface{}, Opts ...*DownloadOptions) ([]byte, error) {
+	opts := getVariadic(Opts, &DownloadOptions{}).(*DownloadOptions)
+	location, dc, size, _, err := fileLocation(file, opts.Thumb, opts.ThumbSize)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.DownloadReader(location, &DownloadOptions{
+		DcID:      getValue(dc, opts.DcID).(int32),
+		Size:      int32(getValue(size, int64(opts.Size)).(int64)),
+		ChunkSize: opts.ChunkSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
 type (
 	Downloader struct {
 		*Client
@@ -2,10 +2,15 @@ package telegram
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/roj1512/gogram/internal/encoding/tl"
 )
 
 type SendOptions struct {
@@ -21,7 +26,7 @@ type SendOptions struct {
 	ParseMode     string              `json:"parse_mode,omitempty"`
 	ReplyID       int32               `json:"reply_id,omitempty"`
 	ReplyMarkup   ReplyMarkup         `json:"reply_markup,omitempty"`
-	ScheduleDate  int32               `json:"schedule_date,omitempty"`
+	ScheduleDate  time.Time           `json:"schedule_date,omitempty"`
 	SendAs        interface{}         `json:"send_as,omitempty"`
 	Silent        bool                `json:"silent,omitempty"`
 	Thumb         interface{}         `json:"thumb,omitempty"`
@@ -43,39 +48,48 @@ type SendOptions struct {
 // If the message parameter is a media object, the function will send the media as a separate message and return a pointer to a NewMessage object containing information about the sent media.
 // If the message parameter is a string, the function will parse it for entities and send it as a text message.
 func (c *Client) SendMessage(peerID interface{}, message interface{}, opts ...*SendOptions) (*NewMessage, error) {
-	opt := getVariadic(opts, &SendOptions{}).(*SendOptions)
-	opt.ParseMode = getStr(opt.ParseMode, c.ParseMode())
+	// the options are filled in below, a copy keeps those of the caller reusable
+	o := *getVariadic(opts, &SendOptions{}).(*SendOptions)
+	opt := &o
+	opt.ParseMode = c.parseModeFor(opt.ParseMode)
 	var (
 		entities    []MessageEntity
 		textMessage string
-		rawText     string
+		caption     interface{}
 		media       interface{}
 	)
 	switch message := message.(type) {
 	case string:
-		entities, textMessage = parseEntities(message, opt.ParseMode)
-		rawText = message
+		var err error
+		if entities, textMessage, err = parseEntities(message, opt.ParseMode); err != nil {
+			return nil, err
+		}
+		caption = message
 	case MessageMedia, InputMedia, InputFile:
 		media = message
 	case NewMessage:
 		entities = message.Message.Entities
 		textMessage = message.MessageText()
-		rawText = message.MessageText()
+		caption = &message
 		media = message.Media()
 	case *NewMessage:
 		entities = message.Message.Entities
 		textMessage = message.MessageText()
-		rawText = message.MessageText()
+		caption = message
 		media = message.Media()
 	default:
 		return nil, fmt.Errorf("invalid message type: %s", reflect.TypeOf(message))
 	}
+	if _, ok := media.(*MessageMediaWebPage); ok {
+		// the preview of a link is generated again from the text
+		media, opt.LinkPreview = nil, true
+	}
 	if opt.Entites != nil {
 		entities = opt.Entites
 	}
 	media = getValue(media, opt.Media)
 	if media != nil {
-		opt.Caption = getValue(opt.Caption, rawText)
+		opt.Caption = getValue(opt.Caption, caption)
 		return c.SendMedia(peerID, media, convertOption(opt))
 	}
 	senderPeer, err := c.GetSendablePeer(peerID)
@@ -93,6 +107,11 @@ func (c *Client) SendMessage(peerID interface{}, message interface{}, opts ...*S
 }
 
 func (c *Client) sendMessage(Peer InputPeer, Message string, entities []MessageEntity, sendAs InputPeer, opt *SendOptions) (*NewMessage, error) {
+	schedule, err := scheduleDate(opt.ScheduleDate)
+	if err != nil {
+		return nil, err
+	}
+	randomID := GenRandInt()
 	updateResp, err := c.MessagesSendMessage(&MessagesSendMessageParams{
 		NoWebpage:              !opt.LinkPreview,
 		Silent:                 opt.Silent,
@@ -105,17 +124,17 @@ func (c *Client) sendMessage(Peer InputPeer, Message string, entities []MessageE
 			ReplyToMsgID: opt.ReplyID,
 		},
 		Message:      Message,
-		RandomID:     GenRandInt(),
+		RandomID:     randomID,
 		ReplyMarkup:  opt.ReplyMarkup,
 		Entities:     entities,
-		ScheduleDate: opt.ScheduleDate,
+		ScheduleDate: schedule,
 		SendAs:       sendAs,
 	})
 	if err != nil {
 		return nil, err
 	}
 	if updateResp != nil {
-		return packMessage(c, processUpdate(updateResp)), nil
+		return packMessage(c, c.sentMessage(updateResp, randomID, Peer, Message, opt.ReplyID)), nil
 	}
 	return nil, errors.New("no response")
 }
@@ -133,7 +152,7 @@ func (c *Client) sendMessage(Peer InputPeer, Message string, entities []MessageE
 //   - error: Returns an error on failure.
 func (c *Client) EditMessage(peerID interface{}, id int32, message interface{}, opts ...*SendOptions) (*NewMessage, error) {
 	opt := getVariadic(opts, &SendOptions{}).(*SendOptions)
-	opt.ParseMode = getStr(opt.ParseMode, c.ParseMode())
+	opt.ParseMode = c.parseModeFor(opt.ParseMode)
 	var (
 		entities    []MessageEntity
 		textMessage string
@@ -141,7 +160,10 @@ func (c *Client) EditMessage(peerID interface{}, id int32, message interface{},
 	)
 	switch message := message.(type) {
 	case string:
-		entities, textMessage = parseEntities(message, opt.ParseMode)
+		var err error
+		if entities, textMessage, err = parseEntities(message, opt.ParseMode); err != nil {
+			return nil, err
+		}
 	case MessageMedia, InputMedia, InputFile:
 		media = message
 	case *NewMessage:
@@ -156,6 +178,8 @@ func (c *Client) EditMessage(peerID interface{}, id int32, message interface{},
 	}
 	media = getValue(media, opt.Media)
 	switch p := peerID.(type) {
+	case InputBotInlineMessageID:
+		return c.editBotInlineMessage(p, textMessage, entities, media, opt)
 	case *InputBotInlineMessageID:
 		return c.editBotInlineMessage(*p, textMessage, entities, media, opt)
 	}
@@ -171,6 +195,10 @@ func (c *Client) editMessage(Peer InputPeer, id int32, Message string, entities
 		media InputMedia
 		err   error
 	)
+	schedule, err := scheduleDate(options.ScheduleDate)
+	if err != nil {
+		return nil, err
+	}
 	if Media != nil {
 		media, err = c.getSendableMedia(Media, &MediaMetadata{
 			Attributes:    options.Attributes,
@@ -191,10 +219,10 @@ func (c *Client) editMessage(Peer InputPeer, id int32, Message string, entities
 		ReplyMarkup:  options.ReplyMarkup,
 		Entities:     entities,
 		Media:        media,
-		ScheduleDate: options.ScheduleDate,
+		ScheduleDate: schedule,
 	})
 	if err != nil {
-		return nil, err
+		return nil, messageAuthorRequired(err)
 	}
 	if updateResp != nil {
 		return packMessage(c, processUpdate(updateResp)), nil
@@ -255,6 +283,27 @@ func (c *Client) editBotInlineMessage(ID InputBotInlineMessageID, Message string
 	return nil, errors.New("request failed")
 }
 
+// EditReplyMarkup replaces the inline keyboard of a message leaving its text and media
+// as they are, a nil markup removes the keyboard. peerID is the InputBotInlineMessageID
+// of messages sent via inline mode.
+func (c *Client) EditReplyMarkup(peerID interface{}, id int32, markup ReplyMarkup) (*NewMessage, error) {
+	if markup == nil {
+		markup = &ReplyInlineMarkup{}
+	}
+	opt := &SendOptions{LinkPreview: true, ReplyMarkup: markup}
+	switch p := peerID.(type) {
+	case InputBotInlineMessageID:
+		return c.editBotInlineMessage(p, "", nil, nil, opt)
+	case *InputBotInlineMessageID:
+		return c.editBotInlineMessage(*p, "", nil, nil, opt)
+	}
+	peer, err := c.GetSendablePeer(peerID)
+	if err != nil {
+		return nil, err
+	}
+	return c.editMessage(peer, id, "", nil, nil, opt)
+}
+
 type MediaOptions struct {
 	Attributes    []DocumentAttribute `json:"attributes,omitempty"`
 	Caption       interface{}         `json:"caption,omitempty"`
@@ -268,11 +317,13 @@ type MediaOptions struct {
 	ParseMode     string              `json:"parse_mode,omitempty"`
 	ReplyID       int32               `json:"reply_id,omitempty"`
 	ReplyMarkup   ReplyMarkup         `json:"reply_markup,omitempty"`
-	ScheduleDate  int32               `json:"schedule_date,omitempty"`
+	ScheduleDate  time.Time           `json:"schedule_date,omitempty"`
 	SendAs        interface{}         `json:"send_as,omitempty"`
 	Silent        bool                `json:"silent,omitempty"`
 	Thumb         interface{}         `json:"thumb,omitempty"`
-	TTL           int32               `json:"ttl,omitempty"`
+	// TTL makes the photo or video self-destruct that many seconds (1 to 60) after
+	// it is opened, or once it is closed with ViewOnce. Private chats only.
+	TTL int32 `json:"ttl,omitempty"`
 }
 
 type MediaMetadata struct {
@@ -302,18 +353,27 @@ type MediaMetadata struct {
 //   - If send_as in opts is not nil, the message will be sent from the specified peer, otherwise it will be sent from the sender peer.
 func (c *Client) SendMedia(peerID interface{}, Media interface{}, opts ...*MediaOptions) (*NewMessage, error) {
 	opt := getVariadic(opts, &MediaOptions{}).(*MediaOptions)
-	opt.ParseMode = getStr(opt.ParseMode, c.ParseMode())
+	opt.ParseMode = c.parseModeFor(opt.ParseMode)
 	var (
 		entities    []MessageEntity
 		textMessage string
 	)
+	senderPeer, err := c.GetSendablePeer(peerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMediaTTL(senderPeer, opt.TTL); err != nil {
+		return nil, err
+	}
 	sendMedia, err := c.getSendableMedia(Media, &MediaMetadata{FileName: opt.FileName, Thumb: opt.Thumb, ForceDocument: opt.ForceDocument, Attributes: opt.Attributes, TTL: opt.TTL})
 	if err != nil {
 		return nil, err
 	}
 	switch cap := opt.Caption.(type) {
 	case string:
-		entities, textMessage = parseEntities(cap, opt.ParseMode)
+		if entities, textMessage, err = parseEntities(cap, opt.ParseMode); err != nil {
+			return nil, err
+		}
 	case *NewMessage:
 		entities = cap.Message.Entities
 		textMessage = cap.MessageText()
@@ -321,10 +381,6 @@ func (c *Client) SendMedia(peerID interface{}, Media interface{}, opts ...*Media
 	if opt.Entites != nil {
 		entities = opt.Entites
 	}
-	senderPeer, err := c.GetSendablePeer(peerID)
-	if err != nil {
-		return nil, err
-	}
 	var sendAs InputPeer
 	if opt.SendAs != nil {
 		sendAs, err = c.GetSendablePeer(opt.SendAs)
@@ -336,6 +392,11 @@ func (c *Client) SendMedia(peerID interface{}, Media interface{}, opts ...*Media
 }
 
 func (c *Client) sendMedia(Peer InputPeer, Media InputMedia, Caption string, entities []MessageEntity, sendAs InputPeer, opt *MediaOptions) (*NewMessage, error) {
+	schedule, err := scheduleDate(opt.ScheduleDate)
+	if err != nil {
+		return nil, err
+	}
+	randomID := GenRandInt()
 	updateResp, err := c.MessagesSendMedia(&MessagesSendMediaParams{
 		Silent:                 opt.Silent,
 		Background:             false,
@@ -347,22 +408,44 @@ func (c *Client) sendMedia(Peer InputPeer, Media InputMedia, Caption string, ent
 			ReplyToMsgID: opt.ReplyID,
 		},
 		Media:        Media,
-		RandomID:     GenRandInt(),
+		RandomID:     randomID,
 		ReplyMarkup:  opt.ReplyMarkup,
 		Message:      Caption,
 		Entities:     entities,
-		ScheduleDate: opt.ScheduleDate,
+		ScheduleDate: schedule,
 		SendAs:       sendAs,
 	})
 	if err != nil {
 		return nil, err
 	}
 	if updateResp != nil {
-		return packMessage(c, processUpdate(updateResp)), nil
+		return packMessage(c, c.sentMessage(updateResp, randomID, Peer, Caption, opt.ReplyID)), nil
 	}
 	return nil, errors.New("no response")
 }
 
+// ViewOnce is the TTL of media that can be opened only once
+const ViewOnce int32 = math.MaxInt32
+
+// checkMediaTTL checks self-destructing media is sent to a private chat, with a timer
+// of 1 to 60 seconds or ViewOnce
+func checkMediaTTL(peer InputPeer, ttl int32) error {
+	if ttl == 0 {
+		return nil
+	}
+	if ttl != ViewOnce && (ttl < 1 || ttl > 60) {
+		return fmt.Errorf("ttl of %d seconds is out of range, it must be between 1 and 60 or ViewOnce", ttl)
+	}
+	switch peer.(type) {
+	case *InputPeerUser, *InputPeerUserFromMessage, *InputPeerSelf:
+		return nil
+	}
+	return errors.New("self-destructing media can only be sent to private chats")
+}
+
+// MaxAlbumSize is the most media a single album can hold
+const MaxAlbumSize = 10
+
 // SendAlbum sends a media album.
 // This method is a wrapper for messages.sendMultiMedia.
 //
@@ -380,9 +463,10 @@ func (c *Client) sendMedia(Peer InputPeer, Media InputMedia, Caption string, ent
 //   - If the caption in opts is a pointer to a NewMessage, its entities will be used instead.
 //   - If the entites field in opts is not nil, it will override any entities parsed from the caption.
 //   - If send_as in opts is not nil, the messages will be sent from the specified peer, otherwise they will be sent from the sender peer.
+//   - The caption is set on the first item, an album holds at most MaxAlbumSize items.
 func (c *Client) SendAlbum(peerID interface{}, Album interface{}, opts ...*MediaOptions) ([]*NewMessage, error) {
 	opt := getVariadic(opts, &MediaOptions{}).(*MediaOptions)
-	opt.ParseMode = getStr(opt.ParseMode, c.ParseMode())
+	opt.ParseMode = c.parseModeFor(opt.ParseMode)
 	var (
 		entities    []MessageEntity
 		textMessage string
@@ -391,10 +475,19 @@ func (c *Client) SendAlbum(peerID interface{}, Album interface{}, opts ...*Media
 	if multiErr != nil {
 		return nil, multiErr
 	}
+	if len(InputAlbum) == 0 {
+		return nil, errors.New("album is empty")
+	}
+	if len(InputAlbum) > MaxAlbumSize {
+		return nil, fmt.Errorf("album has %d items, at most %d can be sent together", len(InputAlbum), MaxAlbumSize)
+	}
 
 	switch cap := opt.Caption.(type) {
 	case string:
-		entities, textMessage = parseEntities(cap, opt.ParseMode)
+		var err error
+		if entities, textMessage, err = parseEntities(cap, opt.ParseMode); err != nil {
+			return nil, err
+		}
 	case *NewMessage:
 		entities = cap.Message.Entities
 		textMessage = cap.MessageText()
@@ -402,8 +495,9 @@ func (c *Client) SendAlbum(peerID interface{}, Album interface{}, opts ...*Media
 	if opt.Entites != nil {
 		entities = opt.Entites
 	}
-	InputAlbum[len(InputAlbum)-1].Message = textMessage
-	InputAlbum[len(InputAlbum)-1].Entities = entities
+	// the caption of the first item is shown as the album caption
+	InputAlbum[0].Message = textMessage
+	InputAlbum[0].Entities = entities
 	senderPeer, err := c.GetSendablePeer(peerID)
 	if err != nil {
 		return nil, err
@@ -419,6 +513,10 @@ func (c *Client) SendAlbum(peerID interface{}, Album interface{}, opts ...*Media
 }
 
 func (c *Client) sendAlbum(Peer InputPeer, Album []*InputSingleMedia, sendAs InputPeer, opt *MediaOptions) ([]*NewMessage, error) {
+	schedule, err := scheduleDate(opt.ScheduleDate)
+	if err != nil {
+		return nil, err
+	}
 	updateResp, err := c.MessagesSendMultiMedia(&MessagesSendMultiMediaParams{
 		Silent:                 opt.Silent,
 		Background:             false,
@@ -429,7 +527,7 @@ func (c *Client) sendAlbum(Peer InputPeer, Album []*InputSingleMedia, sendAs Inp
 		ReplyTo: &InputReplyToMessage{
 			ReplyToMsgID: opt.ReplyID,
 		},
-		ScheduleDate: opt.ScheduleDate,
+		ScheduleDate: schedule,
 		SendAs:       sendAs,
 		MultiMedia:   Album,
 	})
@@ -458,45 +556,132 @@ func (c *Client) sendAlbum(Peer InputPeer, Album []*InputSingleMedia, sendAs Inp
 //	 - big: Whether to use big emoji.
 func (c *Client) SendReaction(peerID interface{}, msgID int32, reaction interface{}, big ...bool) error {
 	b := getVariadic(big, false).(bool)
+	r, err := buildReactions(reaction)
+	if err != nil {
+		return err
+	}
+	return c.sendReaction(peerID, msgID, r, b, false)
+}
+
+func (c *Client) sendReaction(peerID interface{}, msgID int32, reactions []Reaction, big, addToRecent bool) error {
 	peer, err := c.GetSendablePeer(peerID)
 	if err != nil {
 		return err
 	}
+	_, err = c.MessagesSendReaction(&MessagesSendReactionParams{
+		Peer:        peer,
+		Big:         big,
+		AddToRecent: addToRecent,
+		MsgID:       msgID,
+		Reaction:    reactions,
+	})
+	return err
+}
+
+// buildReactions converts emoticons or custom emojis to a list of reactions, an empty emoticon removes the reactions
+func buildReactions(reaction interface{}) ([]Reaction, error) {
 	var r []Reaction
 	switch reaction := reaction.(type) {
 	case string:
-		if reaction == "" {
-			r = append(r, &ReactionEmpty{})
-		}
-		r = append(r, &ReactionEmoji{reaction})
+		return buildReactions([]string{reaction})
 	case []string:
 		for _, v := range reaction {
 			if v == "" {
-				r = append(r, &ReactionEmpty{})
+				return []Reaction{&ReactionEmpty{}}, nil
 			}
 			r = append(r, &ReactionEmoji{v})
 		}
 	case ReactionCustomEmoji:
 		r = append(r, &reaction)
+	case *ReactionCustomEmoji:
+		r = append(r, reaction)
 	case []ReactionCustomEmoji:
-		for _, v := range reaction {
-			r = append(r, &v)
+		for i := range reaction {
+			r = append(r, &reaction[i])
 		}
+	case Reaction:
+		r = append(r, reaction)
+	case []Reaction:
+		r = reaction
+	default:
+		return nil, fmt.Errorf("invalid reaction type: %s", reflect.TypeOf(reaction))
 	}
-	_, err = c.MessagesSendReaction(&MessagesSendReactionParams{
-		Peer:        peer,
-		Big:         b,
-		AddToRecent: false,
-		MsgID:       msgID,
-		Reaction:    r,
-	})
-	return err
+	return r, nil
 }
 
-// SendDice sends a special dice message.
+// maxReactionsLimit is the most reactions messages.getMessageReactionsList returns per request
+const maxReactionsLimit = 100
+
+type ReactionsOptions struct {
+	// Reaction only lists the users that reacted with this emoticon or custom emoji
+	Reaction interface{}
+	// Limit is the number of reactions returned (zero for every reaction)
+	Limit int
+}
+
+// GetMessageReactions returns who reacted to a message and with what, the most recent first.
+// Reactions to messages in channels and large groups are only listed when the chat allows it.
+// This method is a wrapper for messages.getMessageReactionsList.
+func (c *Client) GetMessageReactions(peerID interface{}, msgID int32, opts ...*ReactionsOptions) ([]*MessagePeerReaction, error) {
+	opt := getVariadic(opts, &ReactionsOptions{}).(*ReactionsOptions)
+	peer, err := c.GetSendablePeer(peerID)
+	if err != nil {
+		return nil, err
+	}
+	params := &MessagesGetMessageReactionsListParams{Peer: peer, ID: msgID}
+	if opt.Reaction != nil {
+		r, err := buildReactions(opt.Reaction)
+		if err != nil {
+			return nil, err
+		}
+		if len(r) != 1 {
+			return nil, errors.New("reactions can be filtered by a single reaction")
+		}
+		params.Reaction = r[0]
+	}
+	var reactions []*MessagePeerReaction
+	for {
+		params.Limit = maxReactionsLimit
+		if opt.Limit > 0 {
+			params.Limit = min(params.Limit, int32(opt.Limit-len(reactions)))
+		}
+		resp, err := c.MessagesGetMessageReactionsList(params)
+		if err != nil {
+			return nil, err
+		}
+		c.Cache.UpdatePeersToCache(resp.Users, resp.Chats)
+		reactions = append(reactions, resp.Reactions...)
+		if resp.NextOffset == "" || len(resp.Reactions) == 0 || (opt.Limit > 0 && len(reactions) >= opt.Limit) {
+			return reactions, nil
+		}
+		params.Offset = resp.NextOffset
+	}
+}
+
+// The emoticons of the animated dice telegram rolls
+const (
+	DiceDie        = "🎲"
+	DiceDarts      = "🎯"
+	DiceBasketball = "🏀"
+	DiceFootball   = "⚽"
+	DiceSlots      = "🎰"
+	DiceBowling    = "🎳"
+)
+
+// SendDice sends an animated dice rolled by telegram, emoji is one of the Dice
+// emoticons and defaults to DiceDie. The rolled value is read with NewMessage.Dice.
 // This method calls messages.sendMedia with a dice media.
-func (c *Client) SendDice(peerID interface{}, emoji string) (*NewMessage, error) {
-	return c.SendMedia(peerID, &InputMediaDice{Emoticon: emoji})
+func (c *Client) SendDice(peerID interface{}, emoji string, opts ...*MediaOptions) (*NewMessage, error) {
+	// emoji keyboards may append the variation selector, as in "⚽️"
+	emoji = strings.TrimSuffix(emoji, "\uFE0F")
+	switch emoji {
+	case "":
+		emoji = DiceDie
+	case DiceDie, DiceDarts, DiceBasketball, DiceFootball, DiceSlots, DiceBowling:
+	default:
+		return nil, fmt.Errorf("%q is not a dice emoticon", emoji)
+	}
+	return c.SendMedia(peerID, &InputMediaDice{Emoticon: emoji}, opts...)
 }
 
 type ActionResult struct {
@@ -532,6 +717,10 @@ func (c *Client) SendAction(PeerID interface{}, Action interface{}, topMsgID ...
 		} else {
 			return nil, errors.New("unknown action")
 		}
+	case ChatAction:
+		return c.SendAction(PeerID, string(a), topMsgID...)
+	case SendMessageAction:
+		_, err = c.MessagesSetTyping(peerChat, TopMsgID, a)
 	case *SendMessageAction:
 		_, err = c.MessagesSetTyping(peerChat, TopMsgID, *a)
 	default:
@@ -540,6 +729,55 @@ func (c *Client) SendAction(PeerID interface{}, Action interface{}, topMsgID ...
 	return &ActionResult{Peer: peerChat, Client: c}, err
 }
 
+// SendChatAction shows action in the chat, telegram clears it after about
+// five seconds or once a message is sent.
+//
+//	Params:
+//	 - peerID: The chat to show the action in.
+//	 - action: The action, like ActionTyping or ActionUploadPhoto.
+//	 - topMsgID: The forum topic, if any.
+func (c *Client) SendChatAction(peerID interface{}, action ChatAction, topMsgID ...int32) error {
+	_, err := c.SendAction(peerID, action, topMsgID...)
+	return err
+}
+
+// chatActionInterval is how often a kept chat action is sent again, before telegram clears it
+var chatActionInterval = 4 * time.Second
+
+// KeepChatAction shows action in the chat until the returned cancel function is
+// called, sending it again every few seconds for long operations.
+func (c *Client) KeepChatAction(peerID interface{}, action ChatAction, topMsgID ...int32) (cancel func(), err error) {
+	result, err := c.SendAction(peerID, action, topMsgID...)
+	if err != nil {
+		return nil, err
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(chatActionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := c.MessagesSetTyping(result.Peer, getVariadic(topMsgID, int32(0)).(int32), Actions[string(action)]); err != nil {
+					c.Log.Debug("sending chat action: ", err)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			// an action still being sent would show again after the cancel
+			<-stopped
+			result.Cancel()
+		})
+	}, nil
+}
+
 // SendReadAck sends a read acknowledgement.
 // This method is a wrapper for messages.readHistory.
 func (c *Client) SendReadAck(PeerID interface{}, MaxID ...int32) (*MessagesAffectedMessages, error) {
@@ -551,8 +789,6 @@ func (c *Client) SendReadAck(PeerID interface{}, MaxID ...int32) (*MessagesAffec
 	return c.MessagesReadHistory(peerChat, maxID)
 }
 
-// SendPoll sends a poll. TODO
-
 type ForwardOptions struct {
 	HideCaption  bool        `json:"hide_caption,omitempty"`
 	HideAuthor   bool        `json:"hide_author,omitempty"`
@@ -561,12 +797,75 @@ type ForwardOptions struct {
 	Background   bool        `json:"background,omitempty"`
 	WithMyScore  bool        `json:"with_my_score,omitempty"`
 	SendAs       interface{} `json:"send_as,omitempty"`
-	ScheduleDate int32       `json:"schedule_date,omitempty"`
+	ScheduleDate time.Time   `json:"schedule_date,omitempty"`
 }
 
-// Forward forwards a message.
-// This method is a wrapper for messages.forwardMessages.
+// maxForwardIDs is the most messages forwarded by a single messages.forwardMessages
+const maxForwardIDs = 100
+
+// CopyMessage sends a copy of a message of fromPeerID to peerID, without the forward header:
+// the copy is sent by the client, with the text and entities of the message or its photo,
+// document, location or contact and caption. Caption and Entites of opts replace the
+// caption of the message. Other media, like polls or games, return an error.
+func (c *Client) CopyMessage(peerID interface{}, fromPeerID interface{}, msgID int32, opts ...*SendOptions) (*NewMessage, error) {
+	opt := getVariadic(opts, &SendOptions{}).(*SendOptions)
+	msgs, err := c.GetMessagesByID(fromPeerID, []int32{msgID})
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 || msgs[0] == nil {
+		return nil, fmt.Errorf("message %d not found", msgID)
+	}
+	return c.copyMessage(peerID, msgs[0], opt)
+}
+
+func (c *Client) copyMessage(peerID interface{}, msg *NewMessage, opt *SendOptions) (*NewMessage, error) {
+	if err := copyableMessage(msg); err != nil {
+		return nil, err
+	}
+	return c.SendMessage(peerID, msg, opt)
+}
+
+// copyableMessage checks the content of a message can be sent again by the client
+func copyableMessage(msg *NewMessage) error {
+	if msg.Action != nil {
+		return fmt.Errorf("message %d is a service message, it can't be copied", msg.ID)
+	}
+	switch media := msg.Media().(type) {
+	case nil, *MessageMediaWebPage, *MessageMediaContact:
+		return nil
+	case *MessageMediaPhoto:
+		if _, ok := media.Photo.(*PhotoObj); ok {
+			return nil
+		}
+	case *MessageMediaDocument:
+		if _, ok := media.Document.(*DocumentObj); ok {
+			return nil
+		}
+	case *MessageMediaGeo:
+		if _, ok := media.Geo.(*GeoPointObj); ok {
+			return nil
+		}
+	default:
+		return fmt.Errorf("copying %s media is not supported", strings.TrimPrefix(reflect.TypeOf(media).Elem().Name(), "MessageMedia"))
+	}
+	return fmt.Errorf("the media of message %d is no longer available", msg.ID)
+}
+
+// Forward forwards messages, see ForwardMessages.
 func (c *Client) Forward(peerID interface{}, fromPeerID interface{}, msgIDs []int32, opts ...*ForwardOptions) ([]NewMessage, error) {
+	forwarded, err := c.ForwardMessages(peerID, fromPeerID, msgIDs, opts...)
+	m := make([]NewMessage, 0, len(forwarded))
+	for _, msg := range forwarded {
+		m = append(m, *msg)
+	}
+	return m, err
+}
+
+// ForwardMessages forwards messages of fromPeerID to peerID, in batches of 100 messages,
+// returning the forwarded messages in the order of msgIDs.
+// This method is a wrapper for messages.forwardMessages.
+func (c *Client) ForwardMessages(peerID interface{}, fromPeerID interface{}, msgIDs []int32, opts ...*ForwardOptions) ([]*NewMessage, error) {
 	opt := getVariadic(opts, &ForwardOptions{}).(*ForwardOptions)
 	toPeer, err := c.GetSendablePeer(peerID)
 	if err != nil {
@@ -576,10 +875,6 @@ func (c *Client) Forward(peerID interface{}, fromPeerID interface{}, msgIDs []in
 	if err != nil {
 		return nil, err
 	}
-	randomIDs := make([]int64, len(msgIDs))
-	for i := range randomIDs {
-		randomIDs[i] = rand.Int63()
-	}
 	var sendAs InputPeer
 	if opt.SendAs != nil {
 		sendAs, err = c.GetSendablePeer(opt.SendAs)
@@ -587,27 +882,36 @@ func (c *Client) Forward(peerID interface{}, fromPeerID interface{}, msgIDs []in
 			return nil, err
 		}
 	}
-	updateResp, err := c.MessagesForwardMessages(&MessagesForwardMessagesParams{
-		ToPeer:            toPeer,
-		FromPeer:          fromPeer,
-		ID:                msgIDs,
-		RandomID:          randomIDs,
-		Silent:            opt.Silent,
-		Background:        false,
-		Noforwards:        opt.Protected,
-		ScheduleDate:      opt.ScheduleDate,
-		DropAuthor:        opt.HideAuthor,
-		DropMediaCaptions: opt.HideCaption,
-		SendAs:            sendAs,
-	})
+	schedule, err := scheduleDate(opt.ScheduleDate)
 	if err != nil {
 		return nil, err
 	}
-	var m []NewMessage
-	if updateResp != nil {
-		updates := processUpdates(updateResp)
-		for _, update := range updates {
-			m = append(m, *packMessage(c, update))
+	var m []*NewMessage
+	for start := 0; start < len(msgIDs); start += maxForwardIDs {
+		ids := msgIDs[start:min(start+maxForwardIDs, len(msgIDs))]
+		randomIDs := make([]int64, len(ids))
+		for i := range randomIDs {
+			randomIDs[i] = rand.Int63()
+		}
+		updateResp, err := c.MessagesForwardMessages(&MessagesForwardMessagesParams{
+			ToPeer:            toPeer,
+			FromPeer:          fromPeer,
+			ID:                ids,
+			RandomID:          randomIDs,
+			Silent:            opt.Silent,
+			Background:        opt.Background,
+			WithMyScore:       opt.WithMyScore,
+			Noforwards:        opt.Protected,
+			ScheduleDate:      schedule,
+			DropAuthor:        opt.HideAuthor,
+			DropMediaCaptions: opt.HideCaption,
+			SendAs:            sendAs,
+		})
+		if err != nil {
+			return m, err
+		}
+		for _, msg := range c.sentMessages(updateResp, randomIDs) {
+			m = append(m, packMessage(c, msg))
 		}
 	}
 	return m, nil
@@ -697,8 +1001,12 @@ func (c *Client) GetMessages(PeerID interface{}, Opts ...*SearchOption) ([]NewMe
 		for _, id := range ids {
 			inputIDs = append(inputIDs, &InputMessageID{ID: id})
 		}
-	case int, int64, int32:
-		inputIDs = append(inputIDs, &InputMessageID{ID: int32(i.(int))})
+	case int:
+		inputIDs = append(inputIDs, &InputMessageID{ID: int32(i)})
+	case int32:
+		inputIDs = append(inputIDs, &InputMessageID{ID: i})
+	case int64:
+		inputIDs = append(inputIDs, &InputMessageID{ID: int32(i)})
 	case *InputMessage:
 		inputIDs = append(inputIDs, *i)
 	case *InputMessagePinned:
@@ -773,15 +1081,87 @@ func (c *Client) GetMessages(PeerID interface{}, Opts ...*SearchOption) ([]NewMe
 	return messages, nil
 }
 
+// GetMessagesByID fetches messages by their IDs, with channels.getMessages for channels
+// and supergroups and messages.getMessages for private chats and basic groups.
+// The result is in the order of ids, with nil for messages that don't exist or were deleted.
+func (c *Client) GetMessagesByID(peerID interface{}, ids []int32) ([]*NewMessage, error) {
+	peer, err := c.GetSendablePeer(peerID)
+	if err != nil {
+		return nil, err
+	}
+	inputIDs := make([]InputMessage, len(ids))
+	for i, id := range ids {
+		inputIDs[i] = &InputMessageID{ID: id}
+	}
+	req, err := getMessagesRequest(peer, inputIDs)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.MakeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	found, ok := resp.(MessagesMessages)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response: %s", reflect.TypeOf(resp))
+	}
+	m, err := c.messagesOf(found)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*NewMessage, len(ids))
+	for i, msg := range orderMessages(ids, m) {
+		if msg != nil {
+			messages[i] = packMessage(c, msg)
+		}
+	}
+	return messages, nil
+}
+
+// getMessagesRequest picks channels.getMessages for channels and supergroups, messages.getMessages otherwise
+func getMessagesRequest(peer InputPeer, ids []InputMessage) (tl.Object, error) {
+	switch peer := peer.(type) {
+	case *InputPeerChannel:
+		return &ChannelsGetMessagesParams{
+			Channel: &InputChannelObj{ChannelID: peer.ChannelID, AccessHash: peer.AccessHash},
+			ID:      ids,
+		}, nil
+	case *InputPeerChat, *InputPeerUser, *InputPeerSelf:
+		return &MessagesGetMessagesParams{ID: ids}, nil
+	}
+	return nil, fmt.Errorf("invalid peer type: %s", reflect.TypeOf(peer))
+}
+
+// orderMessages puts msgs in the order of ids, with nil for missing or empty messages
+func orderMessages(ids []int32, msgs []Message) []Message {
+	byID := make(map[int32]Message, len(msgs))
+	for _, msg := range msgs {
+		switch msg := msg.(type) {
+		case *MessageObj:
+			byID[msg.ID] = msg
+		case *MessageService:
+			byID[msg.ID] = msg
+		}
+	}
+	ordered := make([]Message, len(ids))
+	for i, id := range ids {
+		ordered[i] = byID[id]
+	}
+	return ordered
+}
+
 type PinOptions struct {
-	Unpin     bool `json:"unpin,omitempty"`
+	Unpin bool `json:"unpin,omitempty"`
+	// PmOneside pins the message only for yourself in private chats, it is pinned for both sides by default
 	PmOneside bool `json:"pm_oneside,omitempty"`
-	Silent    bool `json:"silent,omitempty"`
+	// Silent pins without notifying the members of the chat
+	Silent bool `json:"silent,omitempty"`
 }
 
-// Pin pins a message.
-// This method is a wrapper for messages.pinMessage.
-func (c *Client) PinMessage(PeerID interface{}, MsgID int32, Opts ...*PinOptions) (Updates, error) {
+// PinMessage pins a message, returning the service message telegram posts about the pin,
+// nil when none is posted (as when pinning only for yourself).
+// This method is a wrapper for messages.updatePinnedMessage.
+func (c *Client) PinMessage(PeerID interface{}, MsgID int32, Opts ...*PinOptions) (*NewMessage, error) {
 	opts := getVariadic(Opts, &PinOptions{}).(*PinOptions)
 	peer, err := c.GetSendablePeer(PeerID)
 	if err != nil {
@@ -797,14 +1177,63 @@ func (c *Client) PinMessage(PeerID interface{}, MsgID int32, Opts ...*PinOptions
 	if err != nil {
 		return nil, err
 	}
-	return resp, nil
+	if msg := c.serviceMessage(resp); msg != nil {
+		return packMessage(c, msg), nil
+	}
+	return nil, nil
+}
+
+// serviceMessage returns the service message among the updates, caching their users and chats
+func (c *Client) serviceMessage(updates Updates) *MessageService {
+	var sent []Update
+	switch updates := updates.(type) {
+	case *UpdatesObj:
+		c.Cache.UpdatePeersToCache(updates.Users, updates.Chats)
+		sent = updates.Updates
+	case *UpdatesCombined:
+		c.Cache.UpdatePeersToCache(updates.Users, updates.Chats)
+		sent = updates.Updates
+	}
+	for _, update := range sent {
+		var msg Message
+		switch u := update.(type) {
+		case *UpdateNewMessage:
+			msg = u.Message
+		case *UpdateNewChannelMessage:
+			msg = u.Message
+		}
+		if m, ok := msg.(*MessageService); ok {
+			return m
+		}
+	}
+	return nil
 }
 
 // UnpinMessage unpins a message.
-func (c *Client) UnpinMessage(PeerID interface{}, MsgID int32, Opts ...*PinOptions) (Updates, error) {
+func (c *Client) UnpinMessage(PeerID interface{}, MsgID int32, Opts ...*PinOptions) error {
 	opts := getVariadic(Opts, &PinOptions{}).(*PinOptions)
 	opts.Unpin = true
-	return c.PinMessage(PeerID, MsgID, opts)
+	_, err := c.PinMessage(PeerID, MsgID, opts)
+	return err
+}
+
+// UnpinAll unpins every pinned message of a chat.
+// This method is a wrapper for messages.unpinAllMessages.
+func (c *Client) UnpinAll(PeerID interface{}) error {
+	peer, err := c.GetSendablePeer(PeerID)
+	if err != nil {
+		return err
+	}
+	for {
+		resp, err := c.MessagesUnpinAllMessages(peer, 0)
+		if err != nil {
+			return err
+		}
+		// a non zero offset means more messages are left to unpin
+		if resp.Offset == 0 {
+			return nil
+		}
+	}
 }
 
 // Gets the current pinned message in a chat
@@ -921,6 +1350,31 @@ func (c *Client) GetMediaGroup(PeerID interface{}, MsgID int32) ([]NewMessage, e
 	return sameGroup(resp, groupID), nil
 }
 
+// GetReadParticipants returns the members who have read a message in a small group,
+// along with the date they read it.
+// An empty slice is returned if the group is too big or the message is too old for read receipts.
+//
+//	Params:
+//	  - PeerID: The ID of the group.
+//	  - MsgID: The ID of the message.
+func (c *Client) GetReadParticipants(PeerID interface{}, MsgID int32) ([]*ReadParticipantDate, error) {
+	peer, err := c.GetSendablePeer(PeerID)
+	if err != nil {
+		return nil, err
+	}
+	if MsgID <= 0 {
+		return nil, errors.New("invalid message ID")
+	}
+	participants, err := c.MessagesGetMessageReadParticipants(peer, MsgID)
+	if err != nil {
+		if matchError(err, "CHAT_TOO_BIG") || matchError(err, "MSG_TOO_OLD") {
+			return []*ReadParticipantDate{}, nil
+		}
+		return nil, err
+	}
+	return participants, nil
+}
+
 // Internal functions
 
 func convertOption(s *SendOptions) *MediaOptions {
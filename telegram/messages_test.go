@@ -0,0 +1,543 @@
+package telegram
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestGetMessagesRequest(t *testing.T) {
+	ids := []InputMessage{&InputMessageID{ID: 1}}
+
+	// supergroups and channels go through channels.getMessages
+	req, err := getMessagesRequest(&InputPeerChannel{ChannelID: 10, AccessHash: 20}, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, ok := req.(*ChannelsGetMessagesParams)
+	if !ok {
+		t.Fatalf("supergroup: got %T, want *ChannelsGetMessagesParams", req)
+	}
+	if c := ch.Channel.(*InputChannelObj); c.ChannelID != 10 || c.AccessHash != 20 {
+		t.Errorf("supergroup: got channel %+v", c)
+	}
+
+	// private chats use messages.getMessages
+	req, err = getMessagesRequest(&InputPeerUser{UserID: 5, AccessHash: 6}, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := req.(*MessagesGetMessagesParams); !ok {
+		t.Fatalf("private chat: got %T, want *MessagesGetMessagesParams", req)
+	}
+
+	if _, err := getMessagesRequest(&InputPeerEmpty{}, ids); err == nil {
+		t.Error("expected an error for an empty peer")
+	}
+}
+
+func TestOrderMessages(t *testing.T) {
+	msgs := []Message{&MessageObj{ID: 3}, &MessageEmpty{ID: 2}, &MessageService{ID: 4}}
+	got := orderMessages([]int32{1, 2, 3, 4}, msgs)
+	if got[0] != nil || got[1] != nil || got[3] == nil || got[2].(*MessageObj).ID != 3 {
+		t.Errorf("unexpected order: %v", got)
+	}
+}
+
+func TestSentMessage(t *testing.T) {
+	c := &Client{Cache: NewCache()}
+	channel := &InputPeerChannel{ChannelID: 7, AccessHash: 8}
+
+	// an album-like response, with the message sent with random id 2 second
+	updates := &UpdatesObj{Updates: []Update{
+		&UpdateMessageID{ID: 10, RandomID: 1},
+		&UpdateMessageID{ID: 11, RandomID: 2},
+		&UpdateNewChannelMessage{Message: &MessageObj{ID: 10, PeerID: &PeerChannel{ChannelID: 7}}},
+		&UpdateNewChannelMessage{Message: &MessageObj{ID: 11, PeerID: &PeerChannel{ChannelID: 7}, Date: 100}},
+	}}
+	if msg := c.sentMessage(updates, 2, channel, "", 0); msg == nil || msg.ID != 11 || msg.Date != 100 {
+		t.Errorf("picked %+v, want message 11", msg)
+	}
+
+	// short responses leave out the chat and text
+	short := &UpdateShortSentMessage{Out: true, ID: 5, Date: 200}
+	msg := c.sentMessage(short, 3, &InputPeerUser{UserID: 9}, "hello", 4)
+	if msg.ID != 5 || msg.Date != 200 || msg.Message != "hello" {
+		t.Errorf("short sent message: %+v", msg)
+	}
+	if peer, ok := msg.PeerID.(*PeerUser); !ok || peer.UserID != 9 {
+		t.Errorf("short sent message chat: %+v", msg.PeerID)
+	}
+	if reply, ok := msg.ReplyTo.(*MessageReplyHeaderObj); !ok || reply.ReplyToMsgID != 4 {
+		t.Errorf("short sent message reply: %+v", msg.ReplyTo)
+	}
+}
+
+func TestSentMessages(t *testing.T) {
+	c := &Client{Cache: NewCache()}
+	// forwarded messages arrive out of the order of their random ids
+	updates := &UpdatesObj{Updates: []Update{
+		&UpdateMessageID{ID: 21, RandomID: 5},
+		&UpdateMessageID{ID: 20, RandomID: 6},
+		&UpdateNewMessage{Message: &MessageObj{ID: 20}},
+		&UpdateNewMessage{Message: &MessageObj{ID: 21}},
+	}}
+	msgs := c.sentMessages(updates, []int64{5, 6})
+	if len(msgs) != 2 || msgs[0].ID != 21 || msgs[1].ID != 20 {
+		t.Errorf("got %+v, want messages 21 and 20", msgs)
+	}
+}
+
+func TestKeyboardBuilders(t *testing.T) {
+	inline := NewInlineKeyboard().
+		Row(Button{}.URL("docs", "https://example.org"), Button{}.Data("refresh", "cb")).
+		Row().
+		Row(Button{}.WebApp("app", "https://example.org/app")).
+		Build()
+	if len(inline.Rows) != 2 || len(inline.Rows[0].Buttons) != 2 {
+		t.Fatalf("unexpected rows %+v", inline.Rows)
+	}
+	if data := inline.Rows[0].Buttons[1].(*KeyboardButtonCallback).Data; string(data) != "cb" {
+		t.Errorf("callback data %q", data)
+	}
+
+	reply := NewReplyKeyboard().Row(Button{}.Text("yes"), Button{}.Text("no")).Resize().Placeholder("pick").Build()
+	if !reply.Resize || reply.SingleUse || reply.Placeholder != "pick" || len(reply.Rows) != 1 {
+		t.Errorf("unexpected markup %+v", reply)
+	}
+}
+
+func TestLocationMedia(t *testing.T) {
+	if _, err := locationMedia(91, 0, &LocationOptions{}); err == nil {
+		t.Error("latitude 91 accepted")
+	}
+	if _, err := locationMedia(0, -180.5, &LocationOptions{}); err == nil {
+		t.Error("longitude -180.5 accepted")
+	}
+	if _, err := locationMedia(1, 2, &LocationOptions{LivePeriod: 30}); err == nil {
+		t.Error("live period of 30 seconds accepted")
+	}
+	media, err := locationMedia(51.5, -0.12, &LocationOptions{LivePeriod: 900, Heading: 90})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if live, ok := media.(*InputMediaGeoLive); !ok || live.Period != 900 || live.Heading != 90 {
+		t.Errorf("unexpected live location %+v", media)
+	}
+}
+
+func TestPollMedia(t *testing.T) {
+	c := &Client{Cache: NewCache()}
+	media, err := c.pollMedia("best?", []string{"go", "rust", "zig"}, &PollOptions{Quiz: true, CorrectAnswer: 2, Explanation: "it is"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(media.CorrectAnswers) != 1 || string(media.CorrectAnswers[0]) != string(media.Poll.Answers[2].Option) {
+		t.Errorf("correct answers %v", media.CorrectAnswers)
+	}
+	if media.Solution != "it is" || media.Poll.PublicVoters {
+		t.Errorf("unexpected poll %+v", media)
+	}
+	if _, err := c.pollMedia("q", []string{"only"}, &PollOptions{}); err == nil {
+		t.Error("poll of one option accepted")
+	}
+
+	c.rememberPoll(media.Poll)
+	vote := packPollVote(c, &UpdateMessagePollVote{PollID: media.Poll.ID, Options: [][]byte{media.Poll.Answers[1].Option}})
+	if answers := vote.Answers(); len(answers) != 1 || answers[0] != "rust" {
+		t.Errorf("vote answers %v", answers)
+	}
+}
+
+func TestPollCache(t *testing.T) {
+	c := &Client{Cache: NewCache()}
+	for _, period := range []int32{4, 601} {
+		if _, err := c.pollMedia("q", []string{"a", "b"}, &PollOptions{ClosePeriod: period}); err == nil {
+			t.Errorf("close period of %d accepted", period)
+		}
+	}
+
+	now := time.Now()
+	c.polls.store(&Poll{ID: 1}, now)
+	c.polls.store(&Poll{ID: 2}, now)
+	if c.polls.load(1, now) == nil {
+		t.Fatal("poll 1 not remembered")
+	}
+	update := packPollUpdate(c, &UpdateMessagePoll{PollID: 1, Poll: &Poll{ID: 1, Closed: true, Answers: []*PollAnswer{{Text: "a", Option: pollOption(0)}}},
+		Results: &PollResults{Results: []*PollAnswerVoters{{Option: pollOption(0), Voters: 3}}}})
+	if !update.Closed() || update.Results()[0].Text != "a" {
+		t.Errorf("closing update %+v", update.Results())
+	}
+	if c.polls.load(1, now) != nil {
+		t.Error("a closed poll is still remembered")
+	}
+	later := now.Add(pollTTL)
+	if c.polls.load(2, later) != nil {
+		t.Error("an expired poll was returned")
+	}
+	c.polls.store(&Poll{ID: 3}, later)
+	if len(c.polls.polls) != 1 {
+		t.Errorf("expired polls were not evicted, have %v", c.polls.polls)
+	}
+}
+
+func TestScheduleDate(t *testing.T) {
+	if date, err := scheduleDate(time.Time{}); err != nil || date != 0 {
+		t.Errorf("zero time scheduled to %d, %v", date, err)
+	}
+	if _, err := scheduleDate(time.Now().Add(-time.Minute)); err == nil {
+		t.Error("past date accepted")
+	}
+	if date, err := scheduleDate(ScheduleWhenOnline); err != nil || date != 0x7FFFFFFE {
+		t.Errorf("when online scheduled to %d, %v", date, err)
+	}
+	future := time.Now().Add(time.Hour)
+	if date, err := scheduleDate(future); err != nil || int64(date) != future.Unix() {
+		t.Errorf("future date scheduled to %d, %v", date, err)
+	}
+}
+
+func TestCheckMediaTTL(t *testing.T) {
+	if err := checkMediaTTL(&InputPeerUser{UserID: 1}, ViewOnce); err != nil {
+		t.Error(err)
+	}
+	if err := checkMediaTTL(&InputPeerChannel{ChannelID: 1}, 10); err == nil {
+		t.Error("ttl accepted in a channel")
+	}
+	if err := checkMediaTTL(&InputPeerUser{UserID: 1}, 61); err == nil {
+		t.Error("ttl of 61 seconds accepted")
+	}
+	if err := checkMediaTTL(&InputPeerChat{ChatID: 1}, 0); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCopyableMessage(t *testing.T) {
+	for _, media := range []MessageMedia{nil, &MessageMediaPhoto{Photo: &PhotoObj{}}, &MessageMediaDocument{Document: &DocumentObj{}}, &MessageMediaWebPage{}} {
+		if err := copyableMessage(&NewMessage{Message: &MessageObj{Media: media}}); err != nil {
+			t.Errorf("%T: %v", media, err)
+		}
+	}
+	if err := copyableMessage(&NewMessage{Message: &MessageObj{Media: &MessageMediaPoll{}}}); err == nil || !strings.Contains(err.Error(), "Poll") {
+		t.Errorf("poll: got %v", err)
+	}
+	if err := copyableMessage(&NewMessage{Message: &MessageObj{Media: &MessageMediaPhoto{Photo: &PhotoEmpty{}}}}); err == nil {
+		t.Error("an expired photo can't be copied")
+	}
+	if err := copyableMessage(&NewMessage{Message: &MessageObj{}, Action: &MessageActionPinMessage{}}); err == nil {
+		t.Error("a service message can't be copied")
+	}
+}
+
+func TestSendMessageKeepsOptions(t *testing.T) {
+	client, err := NewClient(ClientConfig{AppID: 1, AppHash: "hash", MemorySession: true, LogLevel: LogError, ParseMode: MarkDown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	opt := &SendOptions{}
+	msg := &NewMessage{Message: &MessageObj{Message: "https://t.me", Media: &MessageMediaWebPage{}}}
+	// the client isn't connected, the message is never sent
+	client.SendMessage(int64(1), msg, opt)
+	if opt.LinkPreview || opt.ParseMode != "" {
+		t.Errorf("the options of the caller were changed: %+v", opt)
+	}
+}
+
+func TestSendChatAction(t *testing.T) {
+	var sent SendMessageAction
+	c := answeringClient(t, func(req Object) (any, error) {
+		sent = req.(*MessagesSetTypingParams).Action
+		return true, nil
+	})
+	actions := map[ChatAction]SendMessageAction{
+		ActionTyping:         &SendMessageTypingAction{},
+		ActionUploadPhoto:    &SendMessageUploadPhotoAction{},
+		ActionRecordVideo:    &SendMessageRecordVideoAction{},
+		ActionUploadVideo:    &SendMessageUploadVideoAction{},
+		ActionRecordVoice:    &SendMessageRecordAudioAction{},
+		ActionUploadVoice:    &SendMessageUploadAudioAction{},
+		ActionUploadDocument: &SendMessageUploadDocumentAction{},
+		ActionRecordRound:    &SendMessageRecordRoundAction{},
+		ActionUploadRound:    &SendMessageUploadRoundAction{},
+		ActionChooseSticker:  &SendMessageChooseStickerAction{},
+		ActionChooseContact:  &SendMessageChooseContactAction{},
+		ActionFindLocation:   &SendMessageGeoLocationAction{},
+		ActionPlayGame:       &SendMessageGamePlayAction{},
+		ActionCancel:         &SendMessageCancelAction{},
+	}
+	for action, want := range actions {
+		sent = nil
+		if err := c.SendChatAction(&InputPeerChat{ChatID: 1}, action); err != nil {
+			t.Errorf("%s: %v", action, err)
+		} else if !reflect.DeepEqual(sent, want) {
+			t.Errorf("%s sent as %T, want %T", action, sent, want)
+		}
+	}
+	if err := c.SendChatAction(&InputPeerChat{ChatID: 1}, ChatAction("dance")); err == nil {
+		t.Error("an unknown action was sent")
+	}
+}
+
+func TestKeepChatAction(t *testing.T) {
+	interval := chatActionInterval
+	chatActionInterval = 10 * time.Millisecond
+	defer func() { chatActionInterval = interval }()
+
+	var mu sync.Mutex
+	var sent []SendMessageAction
+	c := answeringClient(t, func(req Object) (any, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, req.(*MessagesSetTypingParams).Action)
+		return true, nil
+	})
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sent)
+	}
+	cancel, err := c.KeepChatAction(&InputPeerChat{ChatID: 1}, ActionUploadPhoto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); count() < 3; {
+		if time.Now().After(deadline) {
+			t.Fatalf("the action was sent %d times", count())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	cancel() // a second call does nothing
+	after := count()
+	time.Sleep(5 * chatActionInterval)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != after {
+		t.Errorf("the action was sent %d more times after cancel", len(sent)-after)
+	}
+	for _, action := range sent[:after-1] {
+		if _, ok := action.(*SendMessageUploadPhotoAction); !ok {
+			t.Errorf("kept sending %T", action)
+		}
+	}
+	if _, ok := sent[after-1].(*SendMessageCancelAction); !ok {
+		t.Errorf("cancel sent %T, want the cancel action", sent[after-1])
+	}
+}
+
+func TestEditReplyMarkup(t *testing.T) {
+	var requests []Object
+	answer := func(req Object) (any, error) {
+		switch req := req.(type) {
+		case *MessagesEditMessageParams:
+			requests = append(requests, req)
+			msg := &MessageObj{ID: req.ID, PeerID: &PeerChat{ChatID: 1}, Message: "text", ReplyMarkup: req.ReplyMarkup}
+			return &UpdatesObj{Updates: []Update{&UpdateEditMessage{Message: msg}}}, nil
+		case *MessagesEditInlineBotMessageParams:
+			requests = append(requests, req)
+			return true, nil
+		}
+		return nil, errors.New("unexpected request") // e.g. the lookup of the chat, which may fail
+	}
+	c := answeringClient(t, answer)
+	markup := &ReplyInlineMarkup{Rows: []*KeyboardButtonRow{{Buttons: []KeyboardButton{&KeyboardButtonCallback{Text: "b", Data: []byte("d")}}}}}
+
+	msg, err := c.EditReplyMarkup(&InputPeerChat{ChatID: 1}, 5, markup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != 5 || msg.Text() != "text" {
+		t.Errorf("got message %d %q", msg.ID, msg.Text())
+	}
+	// the text and media are left out of the request, only the keyboard changes
+	req := requests[0].(*MessagesEditMessageParams)
+	if req.ID != 5 || req.Message != "" || req.Media != nil || req.Entities != nil || req.NoWebpage || req.ReplyMarkup != markup {
+		t.Errorf("edit request %+v", req)
+	}
+
+	if _, err := c.EditReplyMarkup(&InputPeerChat{ChatID: 1}, 5, nil); err != nil {
+		t.Fatal(err)
+	}
+	if markup, ok := requests[1].(*MessagesEditMessageParams).ReplyMarkup.(*ReplyInlineMarkup); !ok || len(markup.Rows) != 0 {
+		t.Errorf("a nil markup was sent as %#v", requests[1].(*MessagesEditMessageParams).ReplyMarkup)
+	}
+
+	inline := &InputBotInlineMessageIDObj{DcID: int32(c.GetDC()), ID: 7}
+	query := &InlineCallbackQuery{Client: c, MsgID: inline}
+	if err := query.EditReplyMarkup(markup); err != nil {
+		t.Fatal(err)
+	}
+	if req, ok := requests[2].(*MessagesEditInlineBotMessageParams); !ok || req.ID != inline || req.Message != "" || req.ReplyMarkup != markup {
+		t.Errorf("inline edit request %#v", requests[2])
+	}
+
+	c.invoke = func(context.Context, Object) (any, error) {
+		return nil, &RPCError{Code: 403, Message: "MESSAGE_AUTHOR_REQUIRED"}
+	}
+	if _, err := c.EditReplyMarkup(&InputPeerChat{ChatID: 1}, 5, markup); !errors.Is(err, ErrMessageAuthorRequired) {
+		t.Errorf("expected ErrMessageAuthorRequired, got %v", err)
+	}
+}
+
+func TestPinMessage(t *testing.T) {
+	var pin *MessagesUpdatePinnedMessageParams
+	updates := []Update{&UpdatePinnedMessages{Pinned: true, Peer: &PeerChat{ChatID: 1}, Messages: []int32{5}}}
+	c := answeringClient(t, func(req Object) (any, error) {
+		if p, ok := req.(*MessagesUpdatePinnedMessageParams); ok {
+			pin = p
+			return &UpdatesObj{Updates: updates}, nil
+		}
+		return nil, errors.New("unexpected request")
+	})
+
+	// pinned only for yourself, no service message is posted
+	msg, err := c.PinMessage(&InputPeerChat{ChatID: 1}, 5, &PinOptions{PmOneside: true, Silent: true})
+	if err != nil || msg != nil {
+		t.Errorf("got %v, %v, want no message", msg, err)
+	}
+	if pin.ID != 5 || !pin.PmOneside || !pin.Silent || pin.Unpin {
+		t.Errorf("pin request %+v", pin)
+	}
+
+	service := &MessageService{ID: 6, PeerID: &PeerChat{ChatID: 1}, Action: &MessageActionPinMessage{}, ReplyTo: &MessageReplyHeaderObj{ReplyToMsgID: 5}}
+	updates = append(updates, &UpdateNewMessage{Message: service})
+	msg, err = c.PinMessage(&InputPeerChat{ChatID: 1}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg == nil || msg.ID != 6 || msg.Action == nil {
+		t.Errorf("expected the pin service message, got %+v", msg)
+	}
+
+	// NewMessage.Pin returns it too
+	c.Cache.UpdateUser(&UserObj{ID: 7, AccessHash: 8})
+	pinned := &NewMessage{Client: c, ID: 5, Message: &MessageObj{ID: 5, PeerID: &PeerUser{UserID: 7}}}
+	if msg, err := pinned.Pin(); err != nil || msg == nil || msg.ID != 6 {
+		t.Errorf("got %+v, %v, want the pin service message", msg, err)
+	}
+}
+
+func TestUnpinAll(t *testing.T) {
+	offsets := []int32{20, 10, 0, 0}
+	calls := 0
+	c := answeringClient(t, func(req Object) (any, error) {
+		if _, ok := req.(*MessagesUnpinAllMessagesParams); !ok {
+			return nil, errors.New("unexpected request")
+		}
+		calls++
+		return &MessagesAffectedHistory{Offset: offsets[calls-1]}, nil
+	})
+	if err := c.UnpinAll(&InputPeerChat{ChatID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// repeated while telegram reports messages left to unpin
+	if calls != 3 {
+		t.Errorf("unpinned in %d requests, want 3", calls)
+	}
+}
+
+func TestGetMessageReactions(t *testing.T) {
+	var params []MessagesGetMessageReactionsListParams
+	pages := map[string]string{"": "a", "a": "b", "b": ""}
+	c := answeringClient(t, func(req Object) (any, error) {
+		p, ok := req.(*MessagesGetMessageReactionsListParams)
+		if !ok {
+			return nil, errors.New("unexpected request")
+		}
+		params = append(params, *p)
+		reactions := make([]*MessagePeerReaction, p.Limit)
+		for i := range reactions {
+			reactions[i] = &MessagePeerReaction{PeerID: &PeerUser{UserID: 7}, Reaction: &ReactionEmoji{"👍"}}
+		}
+		return &MessagesMessageReactionsList{Reactions: reactions, Users: []User{&UserObj{ID: 7, AccessHash: 8}}, NextOffset: pages[p.Offset]}, nil
+	})
+
+	// every page is fetched until telegram returns no next offset
+	reactions, err := c.GetMessageReactions(&InputPeerChat{ChatID: 1}, 5, &ReactionsOptions{Reaction: "👍"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reactions) != 300 || len(params) != 3 {
+		t.Fatalf("got %d reactions in %d requests, want 300 in 3", len(reactions), len(params))
+	}
+	for i, offset := range []string{"", "a", "b"} {
+		if p := params[i]; p.Offset != offset || p.Limit != maxReactionsLimit || p.ID != 5 {
+			t.Errorf("request %d: %+v", i, p)
+		}
+	}
+	if r, ok := params[0].Reaction.(*ReactionEmoji); !ok || r.Emoticon != "👍" {
+		t.Errorf("filtered by %#v", params[0].Reaction)
+	}
+	if _, err := c.Cache.GetInputPeer(7); err != nil {
+		t.Errorf("the users weren't cached: %v", err)
+	}
+
+	// the last page only asks for the reactions left
+	params = nil
+	reactions, err = c.GetMessageReactions(&InputPeerChat{ChatID: 1}, 5, &ReactionsOptions{Limit: 150})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reactions) != 150 || len(params) != 2 || params[0].Limit != 100 || params[1].Limit != 50 {
+		t.Errorf("got %d reactions, requests %+v", len(reactions), params)
+	}
+	if params[0].Reaction != nil {
+		t.Errorf("filtered by %#v without a reaction", params[0].Reaction)
+	}
+
+	if _, err := c.GetMessageReactions(&InputPeerChat{ChatID: 1}, 5, &ReactionsOptions{Reaction: []string{"👍", "👎"}}); err == nil {
+		t.Error("filtering by two reactions was accepted")
+	}
+}
+
+func TestUnreact(t *testing.T) {
+	var sent *MessagesSendReactionParams
+	c := answeringClient(t, func(req Object) (any, error) {
+		if p, ok := req.(*MessagesSendReactionParams); ok {
+			sent = p
+			return &UpdatesObj{}, nil
+		}
+		return nil, errors.New("unexpected request")
+	})
+	c.Cache.UpdateUser(&UserObj{ID: 7, AccessHash: 8})
+	msg := &NewMessage{Client: c, ID: 5, Message: &MessageObj{ID: 5, PeerID: &PeerUser{UserID: 7}}}
+	if err := msg.Unreact(); err != nil {
+		t.Fatal(err)
+	}
+	if sent == nil || sent.MsgID != 5 || len(sent.Reaction) != 0 {
+		t.Fatalf("sent %+v, want no reactions", sent)
+	}
+	if p, ok := sent.Peer.(*InputPeerUser); !ok || p.UserID != 7 || p.AccessHash != 8 {
+		t.Errorf("sent to %#v", sent.Peer)
+	}
+}
+
+func TestSendDice(t *testing.T) {
+	var sent []string
+	c := answeringClient(t, func(req Object) (any, error) {
+		if p, ok := req.(*MessagesSendMediaParams); ok {
+			sent = append(sent, p.Media.(*InputMediaDice).Emoticon)
+			return &UpdateShortSentMessage{ID: 9}, nil
+		}
+		return nil, errors.New("unexpected request")
+	})
+	for _, emoji := range []string{"", DiceDarts, "⚽️"} {
+		if _, err := c.SendDice(&InputPeerChat{ChatID: 1}, emoji); err != nil {
+			t.Fatalf("%q: %v", emoji, err)
+		}
+	}
+	// the die is the default and the variation selector is dropped
+	if want := []string{DiceDie, DiceDarts, DiceFootball}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q, want %q", sent, want)
+	}
+	if _, err := c.SendDice(&InputPeerChat{ChatID: 1}, "🃏"); err == nil {
+		t.Error("a card was sent as a dice")
+	}
+}
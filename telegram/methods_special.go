@@ -74,16 +74,16 @@ type InvokeWithTakeoutParams struct {
 }
 
 func (*InvokeWithTakeoutParams) CRC() uint32 {
-	return 0xda9b0d0d //nolint:gomnd not magic
+	return 0xaca9fd2e //nolint:gomnd not magic
 }
 
-func (m *Client) InvokeWithTakeout(takeoutID int, query tl.Object) (tl.Object, error) {
+func (m *Client) InvokeWithTakeout(takeoutID int64, query tl.Object) (tl.Object, error) {
 	data, err := m.MakeRequest(&InvokeWithTakeoutParams{
-		TakeoutID: int64(takeoutID),
+		TakeoutID: takeoutID,
 		Query:     query,
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "sending InvokeWithLayer")
+		return nil, errors.Wrap(err, "sending InvokeWithTakeout")
 	}
 
 	return data.(tl.Object), nil
@@ -0,0 +1,355 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrChatAdminRequired is returned when the account lacks the admin rights an action needs
+var ErrChatAdminRequired = errors.New("CHAT_ADMIN_REQUIRED: you don't have the admin rights needed")
+
+// ErrUserPrivacyRestricted is the AddChatMembers error of users whose privacy settings don't let them be added
+var ErrUserPrivacyRestricted = errors.New("USER_PRIVACY_RESTRICTED: the privacy settings of the user don't allow adding them")
+
+// ErrUserNotMutualContact is the AddChatMembers error of users who left the chat or only let mutual contacts add them
+var ErrUserNotMutualContact = errors.New("USER_NOT_MUTUAL_CONTACT: the user left the chat or only allows mutual contacts to add them")
+
+// maxInviteUsers is the most users channels.inviteToChannel adds per request
+const maxInviteUsers = 200
+
+// AdminRights are the rights given to an admin by PromoteChatMember,
+// promoting with no rights demotes the admin
+type AdminRights struct {
+	ChangeInfo     bool `json:"change_info,omitempty"`
+	PostMessages   bool `json:"post_messages,omitempty"`
+	EditMessages   bool `json:"edit_messages,omitempty"`
+	DeleteMessages bool `json:"delete_messages,omitempty"`
+	BanUsers       bool `json:"ban_users,omitempty"`
+	InviteUsers    bool `json:"invite_users,omitempty"`
+	PinMessages    bool `json:"pin_messages,omitempty"`
+	AddAdmins      bool `json:"add_admins,omitempty"`
+	Anonymous      bool `json:"anonymous,omitempty"`
+	ManageCall     bool `json:"manage_call,omitempty"`
+	ManageTopics   bool `json:"manage_topics,omitempty"`
+	PostStories    bool `json:"post_stories,omitempty"`
+	EditStories    bool `json:"edit_stories,omitempty"`
+	DeleteStories  bool `json:"delete_stories,omitempty"`
+	// Title is the custom title shown next to the admin
+	Title string `json:"title,omitempty"`
+}
+
+func (r AdminRights) chatAdminRights() *ChatAdminRights {
+	rights := &ChatAdminRights{
+		ChangeInfo:     r.ChangeInfo,
+		PostMessages:   r.PostMessages,
+		EditMessages:   r.EditMessages,
+		DeleteMessages: r.DeleteMessages,
+		BanUsers:       r.BanUsers,
+		InviteUsers:    r.InviteUsers,
+		PinMessages:    r.PinMessages,
+		AddAdmins:      r.AddAdmins,
+		Anonymous:      r.Anonymous,
+		ManageCall:     r.ManageCall,
+		ManageTopics:   r.ManageTopics,
+		PostStories:    r.PostStories,
+		EditStories:    r.EditStories,
+		DeleteStories:  r.DeleteStories,
+	}
+	// other is the right to see the admin log and the other members, every admin has it
+	rights.Other = *rights != ChatAdminRights{}
+	return rights
+}
+
+// ChatPermissions are what a restricted member is allowed to do,
+// the zero value mutes the member
+type ChatPermissions struct {
+	SendMessages bool `json:"send_messages,omitempty"`
+	SendPhotos   bool `json:"send_photos,omitempty"`
+	SendVideos   bool `json:"send_videos,omitempty"`
+	// SendVideoNotes allows round videos
+	SendVideoNotes bool `json:"send_video_notes,omitempty"`
+	SendAudios     bool `json:"send_audios,omitempty"`
+	SendVoices     bool `json:"send_voices,omitempty"`
+	SendDocuments  bool `json:"send_documents,omitempty"`
+	SendPolls      bool `json:"send_polls,omitempty"`
+	// SendOther allows stickers, gifs, games and inline bots
+	SendOther    bool `json:"send_other,omitempty"`
+	EmbedLinks   bool `json:"embed_links,omitempty"`
+	ChangeInfo   bool `json:"change_info,omitempty"`
+	InviteUsers  bool `json:"invite_users,omitempty"`
+	PinMessages  bool `json:"pin_messages,omitempty"`
+	ManageTopics bool `json:"manage_topics,omitempty"`
+}
+
+func (p ChatPermissions) chatBannedRights(until time.Time) *ChatBannedRights {
+	rights := &ChatBannedRights{
+		SendMessages:    !p.SendMessages,
+		SendPlain:       !p.SendMessages,
+		SendPhotos:      !p.SendPhotos,
+		SendVideos:      !p.SendVideos,
+		SendRoundvideos: !p.SendVideoNotes,
+		SendAudios:      !p.SendAudios,
+		SendVoices:      !p.SendVoices,
+		SendDocs:        !p.SendDocuments,
+		SendPolls:       !p.SendPolls,
+		SendStickers:    !p.SendOther,
+		SendGifs:        !p.SendOther,
+		SendGames:       !p.SendOther,
+		SendInline:      !p.SendOther,
+		EmbedLinks:      !p.EmbedLinks,
+		ChangeInfo:      !p.ChangeInfo,
+		InviteUsers:     !p.InviteUsers,
+		PinMessages:     !p.PinMessages,
+		ManageTopics:    !p.ManageTopics,
+		UntilDate:       untilDate(until),
+	}
+	// send_media bans every kind of media at once, it is set only when none is allowed
+	rights.SendMedia = !(p.SendPhotos || p.SendVideos || p.SendVideoNotes || p.SendAudios ||
+		p.SendVoices || p.SendDocuments || p.SendPolls || p.SendOther)
+	return rights
+}
+
+// untilDate is the unix time of a restriction end, zero (forever) for the zero time
+func untilDate(until time.Time) int32 {
+	if until.IsZero() {
+		return 0
+	}
+	return int32(until.Unix())
+}
+
+type RestrictOptions struct {
+	// Until is when the restriction is lifted, it is forever when zero
+	// or more than 366 days or less than 30 seconds from now
+	Until time.Time `json:"until,omitempty"`
+}
+
+type BanOptions struct {
+	// Until is when the ban is lifted, it is forever when zero
+	// or more than 366 days or less than 30 seconds from now
+	Until time.Time `json:"until,omitempty"`
+	// Revoke deletes the messages of the member (basic groups only)
+	Revoke bool `json:"revoke,omitempty"`
+}
+
+// PromoteChatMember gives a member of a chat the admin rights, in basic groups admins
+// can't have separate rights, the member is made an admin when any right is set.
+// Returns ErrChatAdminRequired if the account can't add admins.
+func (c *Client) PromoteChatMember(chatID interface{}, userID interface{}, rights AdminRights) (bool, error) {
+	chat, user, err := c.moderationPeers(chatID, userID, func(r *ChatAdminRights) bool { return r.AddAdmins })
+	if err != nil {
+		return false, err
+	}
+	adminRights := rights.chatAdminRights()
+	switch p := chat.(type) {
+	case *InputPeerChannel:
+		_, err = c.ChannelsEditAdmin(&InputChannelObj{ChannelID: p.ChannelID, AccessHash: p.AccessHash}, user, adminRights, rights.Title)
+	case *InputPeerChat:
+		_, err = c.MessagesEditChatAdmin(p.ChatID, user, adminRights.Other)
+	}
+	return err == nil, adminRequired(err)
+}
+
+// RestrictChatMember restricts a member of a supergroup to the permissions,
+// RestrictChatMember with every permission lifts the restrictions.
+// Returns ErrChatAdminRequired if the account can't ban users.
+func (c *Client) RestrictChatMember(chatID interface{}, userID interface{}, permissions ChatPermissions, opts ...*RestrictOptions) (bool, error) {
+	o := getVariadic(opts, &RestrictOptions{}).(*RestrictOptions)
+	chat, user, err := c.moderationPeers(chatID, userID, func(r *ChatAdminRights) bool { return r.BanUsers })
+	if err != nil {
+		return false, err
+	}
+	channel, ok := chat.(*InputPeerChannel)
+	if !ok {
+		return false, errors.New("members of basic groups can't be restricted")
+	}
+	_, err = c.ChannelsEditBanned(&InputChannelObj{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash}, inputUserPeer(user), permissions.chatBannedRights(o.Until))
+	return err == nil, adminRequired(err)
+}
+
+// BanChatMember bans a member from a chat, they can't join again until unbanned
+// or Until passes, in basic groups the member is only removed.
+// Returns ErrChatAdminRequired if the account can't ban users.
+func (c *Client) BanChatMember(chatID interface{}, userID interface{}, opts ...*BanOptions) (bool, error) {
+	o := getVariadic(opts, &BanOptions{}).(*BanOptions)
+	chat, user, err := c.moderationPeers(chatID, userID, func(r *ChatAdminRights) bool { return r.BanUsers })
+	if err != nil {
+		return false, err
+	}
+	switch p := chat.(type) {
+	case *InputPeerChannel:
+		rights := (ChatPermissions{}).chatBannedRights(o.Until)
+		rights.ViewMessages = true
+		_, err = c.ChannelsEditBanned(&InputChannelObj{ChannelID: p.ChannelID, AccessHash: p.AccessHash}, inputUserPeer(user), rights)
+	case *InputPeerChat:
+		_, err = c.MessagesDeleteChatUser(o.Revoke, p.ChatID, user)
+	}
+	return err == nil, adminRequired(err)
+}
+
+// moderationPeers resolves the chat and user of a moderation action, checking the
+// account is the creator of the chat or an admin the allowed function accepts the rights of
+func (c *Client) moderationPeers(chatID, userID interface{}, allowed func(*ChatAdminRights) bool) (InputPeer, InputUser, error) {
+	chat, err := c.GetSendablePeer(chatID)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch chat.(type) {
+	case *InputPeerChannel, *InputPeerChat:
+	default:
+		return nil, nil, errors.New("peer is not a chat or channel")
+	}
+	u, err := c.GetSendablePeer(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := inputUser(u)
+	if err != nil {
+		return nil, nil, err
+	}
+	self, err := c.GetChatMember(chat, &InputPeerSelf{})
+	if err != nil {
+		return nil, nil, err
+	}
+	if self.Status != Creator && (self.Status != Admin || self.Rights == nil || !allowed(self.Rights)) {
+		return nil, nil, ErrChatAdminRequired
+	}
+	return chat, user, nil
+}
+
+// inputUserPeer converts an InputUser back to the InputPeer of the user
+func inputUserPeer(user InputUser) InputPeer {
+	switch u := user.(type) {
+	case *InputUserObj:
+		return &InputPeerUser{UserID: u.UserID, AccessHash: u.AccessHash}
+	case *InputUserFromMessage:
+		return &InputPeerUserFromMessage{Peer: u.Peer, MsgID: u.MsgID, UserID: u.UserID}
+	}
+	return &InputPeerSelf{}
+}
+
+// adminRequired maps CHAT_ADMIN_REQUIRED to ErrChatAdminRequired
+func adminRequired(err error) error {
+	if matchRPCError(err, "CHAT_ADMIN_REQUIRED") {
+		return errors.Wrap(ErrChatAdminRequired, err.Error())
+	}
+	return err
+}
+
+// AddMemberResult is the outcome of adding one of the users of AddChatMembers
+type AddMemberResult struct {
+	// User is the user as given to AddChatMembers
+	User interface{}
+	// Err is why the user wasn't added, like ErrUserPrivacyRestricted, nil if they were
+	Err error
+}
+
+// AddChatMembers adds users to a chat, with channels.inviteToChannel in batches for
+// channels and supergroups or messages.addChatUser for basic groups. A user who can't be
+// added doesn't stop the others, their error is in the result at their index; the error
+// returned is for the chat itself, like ErrChatAdminRequired, ending the additions; it is
+// also the error of the users not attempted.
+func (c *Client) AddChatMembers(chatID interface{}, users ...interface{}) ([]AddMemberResult, error) {
+	peer, err := c.GetSendablePeer(chatID)
+	if err != nil {
+		return nil, err
+	}
+	var invite func(users []InputUser) error
+	batch := maxInviteUsers
+	switch p := peer.(type) {
+	case *InputPeerChannel:
+		channel := &InputChannelObj{ChannelID: p.ChannelID, AccessHash: p.AccessHash}
+		invite = func(users []InputUser) error {
+			_, err := c.ChannelsInviteToChannel(channel, users)
+			return err
+		}
+	case *InputPeerChat:
+		batch = 1
+		invite = func(users []InputUser) error {
+			_, err := c.MessagesAddChatUser(p.ChatID, users[0], 0)
+			return err
+		}
+	default:
+		return nil, errors.New("peer is not a chat or channel")
+	}
+
+	results := make([]AddMemberResult, len(users))
+	var inputUsers []InputUser
+	var indexes []int
+	for i, u := range users {
+		results[i].User = u
+		peer, err := c.GetSendablePeer(u)
+		if err == nil {
+			var user InputUser
+			if user, err = inputUser(peer); err == nil {
+				inputUsers = append(inputUsers, user)
+				indexes = append(indexes, i)
+				continue
+			}
+		}
+		results[i].Err = err
+	}
+	errs, err := addMembers(inputUsers, batch, invite)
+	err = adminRequired(err)
+	for j, i := range indexes {
+		if j < len(errs) {
+			results[i].Err = errs[j]
+		} else {
+			results[i].Err = err // not attempted
+		}
+	}
+	return results, err
+}
+
+// addMembers invites the users in batches, inviting the users of a batch failing because of
+// one of them separately. It returns the error of each user invited, and the error that
+// stopped the invites if it isn't about a user.
+func addMembers(users []InputUser, batch int, invite func([]InputUser) error) ([]error, error) {
+	errs := make([]error, 0, len(users))
+	for start := 0; start < len(users); start += batch {
+		end := min(start+batch, len(users))
+		err := invite(users[start:end])
+		switch {
+		case err == nil:
+			errs = append(errs, make([]error, end-start)...)
+			continue
+		case !isUserInviteError(err):
+			return errs, err
+		case end-start == 1:
+			errs = append(errs, inviteError(err))
+			continue
+		}
+		for _, user := range users[start:end] {
+			err := invite([]InputUser{user})
+			if err != nil && !isUserInviteError(err) {
+				return errs, err
+			}
+			errs = append(errs, inviteError(err))
+		}
+	}
+	return errs, nil
+}
+
+// isUserInviteError reports whether an invite failed because of a user rather than the chat
+func isUserInviteError(err error) bool {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	return strings.HasPrefix(rpcErr.Message, "USER_") || strings.HasPrefix(rpcErr.Message, "INPUT_USER_") ||
+		rpcErr.Message == "BOT_GROUPS_BLOCKED" || rpcErr.Message == "YOU_BLOCKED_USER"
+}
+
+// inviteError maps the privacy errors of an invite to their typed errors
+func inviteError(err error) error {
+	switch {
+	case matchRPCError(err, "USER_PRIVACY_RESTRICTED"):
+		return errors.Wrap(ErrUserPrivacyRestricted, err.Error())
+	case matchRPCError(err, "USER_NOT_MUTUAL_CONTACT"):
+		return errors.Wrap(ErrUserNotMutualContact, err.Error())
+	}
+	return err
+}
@@ -19,12 +19,38 @@ type NewMessage struct {
 	Peer           InputPeer
 	Sender         *UserObj
 	SenderChat     *Channel
+	// Command is the bot command the message starts with, without the slash and
+	// bot mention, empty if there's none or the command is addressed to another bot
+	Command string
+	// CommandArgs are the whitespace separated words following Command
+	CommandArgs []string
 }
 
 type DeleteMessage struct {
-	Client    *Client
-	ChannelID int64
-	Messages  []int32
+	Client         *Client
+	ChannelID      int64
+	Channel        *Channel
+	Peer           InputPeer
+	Messages       []int32
+	Pts            int32
+	PtsCount       int32
+	OriginalUpdate Update
+}
+
+// IsChannel returns true if the messages were deleted from a channel or supergroup
+func (d *DeleteMessage) IsChannel() bool {
+	return d.ChannelID != 0
+}
+
+// ChatID returns the id of the channel the messages were deleted from,
+// zero for deletions in private chats and basic groups (the server does not send the peer for those)
+func (d *DeleteMessage) ChatID() int64 {
+	return d.ChannelID
+}
+
+func (d *DeleteMessage) Marshal() string {
+	b, _ := json.MarshalIndent(d.OriginalUpdate, "", "  ")
+	return string(b)
 }
 
 type CustomFile struct {
@@ -57,14 +83,13 @@ func (m *NewMessage) MarkRead() (err error) {
 	return
 }
 
-func (a *NewMessage) Pin(opts ...*PinOptions) (err error) {
-	_, err = a.Client.PinMessage(a.ChatID(), a.ID, opts...)
-	return
+// Pin pins the message, returning the service message telegram posts about the pin (see Client.PinMessage)
+func (a *NewMessage) Pin(opts ...*PinOptions) (*NewMessage, error) {
+	return a.Client.PinMessage(a.ChatID(), a.ID, opts...)
 }
 
 func (a *NewMessage) Unpin() (err error) {
-	_, err = a.Client.UnpinMessage(a.ChatID(), a.ID)
-	return err
+	return a.Client.UnpinMessage(a.ChatID(), a.ID)
 }
 
 func (m *NewMessage) GetReplyMessage() (*NewMessage, error) {
@@ -315,6 +340,16 @@ func (m *NewMessage) Animation() *DocumentObj {
 	return nil
 }
 
+// Dice returns the dice of the message with its rolled value, nil if it is not a dice
+func (m *NewMessage) Dice() *MessageMediaDice {
+	if m.IsMedia() {
+		if dice, ok := m.Media().(*MessageMediaDice); ok {
+			return dice
+		}
+	}
+	return nil
+}
+
 func (m *NewMessage) Geo() *GeoPointObj {
 	if m.IsMedia() {
 		if m, ok := m.Media().(*MessageMediaGeo); ok {
@@ -432,6 +467,33 @@ func (m *NewMessage) Args() string {
 	return strings.TrimSpace(strings.Join(Messages[1:], " "))
 }
 
+// parseCommand splits a "/cmd@botname arg1 arg2" text into the command, the
+// mentioned bot (empty if none) and the arguments
+func parseCommand(text string) (command, mention string, args []string) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", nil
+	}
+	fields := strings.Fields(text)
+	command = strings.TrimPrefix(fields[0], "/")
+	if i := strings.Index(command, "@"); i >= 0 {
+		command, mention = command[:i], command[i+1:]
+	}
+	if command == "" {
+		return "", "", nil
+	}
+	return command, mention, fields[1:]
+}
+
+// commandFor returns the command and arguments of text, if it's not addressed to
+// another bot; selfUsername is only called for commands with a mention
+func commandFor(text string, selfUsername func() string) (string, []string) {
+	command, mention, args := parseCommand(text)
+	if command == "" || mention != "" && !strings.EqualFold(mention, selfUsername()) {
+		return "", nil
+	}
+	return command, args
+}
+
 // IsCommand returns true if the message is a command
 func (m *NewMessage) IsCommand() bool {
 	for _, p := range m.Message.Entities {
@@ -463,12 +525,7 @@ func (m *NewMessage) Reply(Text interface{}, Opts ...SendOptions) (*NewMessage,
 		Opts[0].ReplyID = m.ID
 	}
 	resp, err := m.Client.SendMessage(m.ChatID(), Text, &Opts[0])
-	if resp == nil {
-		return nil, err
-	}
-	response := *resp
-	response.Message.PeerID = m.Message.PeerID
-	return &response, err
+	return resp, err
 }
 
 // ReplyWithoutError calls message.Reply and wraps the error to error channel of the client
@@ -485,22 +542,43 @@ func (m *NewMessage) Respond(Text interface{}, Opts ...SendOptions) (*NewMessage
 		Opts = append(Opts, SendOptions{})
 	}
 	resp, err := m.Client.SendMessage(m.ChatID(), Text, &Opts[0])
-	if resp == nil {
-		return nil, err
-	}
-	response := *resp
-	response.Message.PeerID = m.Message.PeerID
-	return &response, err
+	return resp, err
 }
 
-func (m *NewMessage) SendDice(Emoticon string) (*NewMessage, error) {
-	return m.Client.SendDice(m.ChatID(), Emoticon)
+func (m *NewMessage) SendDice(Emoticon string, Opts ...*MediaOptions) (*NewMessage, error) {
+	return m.Client.SendDice(m.ChatID(), Emoticon, Opts...)
 }
 
 func (m *NewMessage) SendAction(Action interface{}) (*ActionResult, error) {
 	return m.Client.SendAction(m.ChatID(), Action)
 }
 
+// Typing shows "typing..." in the chat until the returned cancel function is called
+func (m *NewMessage) Typing() (cancel func(), err error) {
+	return m.Client.KeepChatAction(m.ChatID(), ActionTyping)
+}
+
+// EditReplyMarkup replaces the inline keyboard of the message, nil removes it
+func (m *NewMessage) EditReplyMarkup(markup ReplyMarkup) error {
+	_, err := m.Client.EditReplyMarkup(m.ChatID(), m.ID, markup)
+	return err
+}
+
+// ErrMessageAuthorRequired is returned when editing a message sent by someone else,
+// only channel posts can be edited by other admins
+var ErrMessageAuthorRequired = errors.New("MESSAGE_AUTHOR_REQUIRED: the message wasn't sent by you")
+
+// messageAuthorRequired maps MESSAGE_AUTHOR_REQUIRED to ErrMessageAuthorRequired
+func messageAuthorRequired(err error) error {
+	if matchRPCError(err, "MESSAGE_AUTHOR_REQUIRED") {
+		return errors.Wrap(ErrMessageAuthorRequired, err.Error())
+	}
+	return err
+}
+
+// Edit edits the text (or media) of the message, SendOptions sets the parse mode,
+// entities and reply markup. Returns ErrMessageAuthorRequired if the message can't
+// be edited by the client.
 func (m *NewMessage) Edit(Text interface{}, Opts ...SendOptions) (*NewMessage, error) {
 	if len(Opts) == 0 {
 		Opts = append(Opts, SendOptions{})
@@ -521,12 +599,7 @@ func (m *NewMessage) ReplyMedia(Media interface{}, Opts ...MediaOptions) (*NewMe
 		Opts[0].ReplyID = m.ID
 	}
 	resp, err := m.Client.SendMedia(m.ChatID(), Media, &Opts[0])
-	if err != nil {
-		return nil, err
-	}
-	response := *resp
-	response.Message.PeerID = m.Message.PeerID
-	return &response, err
+	return resp, err
 }
 
 func (m *NewMessage) RespondMedia(Media interface{}, Opts ...MediaOptions) (*NewMessage, error) {
@@ -534,12 +607,7 @@ func (m *NewMessage) RespondMedia(Media interface{}, Opts ...MediaOptions) (*New
 		Opts = append(Opts, MediaOptions{})
 	}
 	resp, err := m.Client.SendMedia(m.ChatID(), Media, &Opts[0])
-	if err != nil {
-		return nil, err
-	}
-	response := *resp
-	response.Message.PeerID = m.Message.PeerID
-	return &response, err
+	return resp, err
 }
 
 // Delete deletes the message
@@ -547,19 +615,52 @@ func (m *NewMessage) Delete() (*MessagesAffectedMessages, error) {
 	return m.Client.DeleteMessages(m.ChatID(), []int32{m.ID})
 }
 
-// React to a message
-func (m *NewMessage) React(Reactions ...any) error {
-	return m.Client.SendReaction(m.ChatID(), m.ID, Reactions, true)
+// React sets the reactions of the user on the message, several emoticons can be
+// given where multiple reactions are allowed; no emoticons removes the reactions.
+func (m *NewMessage) React(emoticons ...string) error {
+	reactions := make([]Reaction, 0, len(emoticons))
+	for _, e := range emoticons {
+		if e != "" {
+			reactions = append(reactions, &ReactionEmoji{Emoticon: e})
+		}
+	}
+	return m.Client.sendReaction(m.ChatID(), m.ID, reactions, false, true)
+}
+
+// ReactCustomEmoji reacts to the message with custom emojis, given by their document IDs
+func (m *NewMessage) ReactCustomEmoji(documentIDs ...int64) error {
+	reactions := make([]Reaction, 0, len(documentIDs))
+	for _, id := range documentIDs {
+		reactions = append(reactions, &ReactionCustomEmoji{DocumentID: id})
+	}
+	return m.Client.sendReaction(m.ChatID(), m.ID, reactions, false, true)
 }
 
-// Forward forwards the message to a chat
+// Unreact removes the reactions of the user from the message
+func (m *NewMessage) Unreact() error {
+	return m.Client.sendReaction(m.ChatID(), m.ID, nil, false, false)
+}
+
+// GetReactions returns who reacted to the message and with what
+func (m *NewMessage) GetReactions(opts ...*ReactionsOptions) ([]*MessagePeerReaction, error) {
+	return m.Client.GetMessageReactions(m.ChatID(), m.ID, opts...)
+}
+
+// ForwardTo forwards the message to a chat, returning the forwarded message
 func (m *NewMessage) ForwardTo(PeerID interface{}, Opts ...*ForwardOptions) (*NewMessage, error) {
-	resps, err := m.Client.Forward(m.ChatID(), PeerID, []int32{m.ID}, Opts...)
-	if resps == nil {
+	resps, err := m.Client.ForwardMessages(PeerID, m.ChatID(), []int32{m.ID}, Opts...)
+	if err != nil {
 		return nil, err
 	}
-	resps[0].Message.PeerID = m.Message.PeerID
-	return &resps[0], err
+	if len(resps) == 0 {
+		return nil, errors.New("message not forwarded")
+	}
+	return resps[0], nil
+}
+
+// CopyTo sends a copy of the message to a chat without the forward header, see Client.CopyMessage
+func (m *NewMessage) CopyTo(peerID interface{}, opts ...*SendOptions) (*NewMessage, error) {
+	return m.Client.copyMessage(peerID, m, getVariadic(opts, &SendOptions{}).(*SendOptions))
 }
 
 // GetMediaGroup returns the media group of the message
@@ -571,7 +672,18 @@ func (m *NewMessage) GetMediaGroup() ([]NewMessage, error) {
 // if path is empty, it will be downloaded to the current directory,
 // returns the path to the downloaded file
 func (m *NewMessage) Download(opts ...*DownloadOptions) (string, error) {
-	return m.Client.DownloadMedia(m.Media(), opts...)
+	return m.Client.DownloadMedia(m, opts...)
+}
+
+// DownloadBytes downloads the media of the message, returning its content
+func (m *NewMessage) DownloadBytes(opts ...*DownloadOptions) ([]byte, error) {
+	return m.Client.DownloadMediaBytes(m, opts...)
+}
+
+// DownloadThumb downloads the thumbnail of the media of the message of type size ("m", "x",
+// "y"...), the largest one when it has none of that type or size is empty.
+func (m *NewMessage) DownloadThumb(size string) ([]byte, error) {
+	return m.Client.DownloadMediaBytes(m, &DownloadOptions{Thumb: true, ThumbSize: size})
 }
 
 // Album Type for MediaGroup
@@ -611,7 +723,7 @@ func (a *Album) ForwardTo(PeerID interface{}, Opts ...*ForwardOptions) ([]NewMes
 	for _, m := range a.Messages {
 		ids = append(ids, m.ID)
 	}
-	return a.Client.Forward(a.Messages[0].ChatID(), PeerID, ids, Opts...)
+	return a.Client.Forward(PeerID, a.Messages[0].ChatID(), ids, Opts...)
 }
 
 func (a *Album) IsReply() bool {
@@ -650,7 +762,7 @@ func (a *Album) MarkRead() error {
 	return a.Messages[0].MarkRead()
 }
 
-func (a *Album) Pin(Opts ...*PinOptions) error {
+func (a *Album) Pin(Opts ...*PinOptions) (*NewMessage, error) {
 	return a.Messages[0].Pin(Opts...)
 }
 
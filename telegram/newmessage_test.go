@@ -0,0 +1,73 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCommandFor(t *testing.T) {
+	self := func() string { return "MyBot" }
+	tests := []struct {
+		text    string
+		command string
+		args    []string
+	}{
+		{"/start", "start", []string{}},
+		{"/start@MyBot", "start", []string{}},
+		{"/start@mybot  a   b", "start", []string{"a", "b"}},
+		{"/start@OtherBot a", "", nil},
+		{"/ban@MyBot\n123 spam", "ban", []string{"123", "spam"}},
+		{"/@MyBot", "", nil},
+		{"/", "", nil},
+		{"start", "", nil},
+		{"", "", nil},
+	}
+	for _, tt := range tests {
+		command, args := commandFor(tt.text, self)
+		if command != tt.command || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%q: got %q %q, want %q %q", tt.text, command, args, tt.command, tt.args)
+		}
+	}
+
+	if command, _ := commandFor("/start", func() string { t.Fatal("username fetched for a command without mention"); return "" }); command != "start" {
+		t.Errorf("got %q", command)
+	}
+}
+
+func TestSelfUsername(t *testing.T) {
+	requests := &requestRecorder{}
+	client, err := NewClient(ClientConfig{AppID: 1, AppHash: "hash", MemorySession: true, LogLevel: LogError, Metrics: requests})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Stop()
+	// the client isn't connected, the lookup fails and isn't retried right away
+	if username := client.selfUsername(); username != "" {
+		t.Errorf("got %q", username)
+	}
+	client.selfUsername()
+	if len(requests.names) != 1 {
+		t.Errorf("a failed lookup was retried: %v", requests.names)
+	}
+
+	if _, err := client.completeLogin(&AuthAuthorizationObj{User: &UserObj{ID: 1, Username: "MyBot", Bot: true}}); err != nil {
+		t.Fatal(err)
+	}
+	// the login only fetches the update state
+	if username := client.selfUsername(); username != "MyBot" || !reflect.DeepEqual(requests.names, []string{"UsersGetFullUser", "UpdatesGetState"}) {
+		t.Errorf("got %q after login, requests %v", username, requests.names)
+	}
+}
+
+func TestMessageAuthorRequired(t *testing.T) {
+	err := messageAuthorRequired(&RPCError{Code: 403, Message: "MESSAGE_AUTHOR_REQUIRED"})
+	if !errors.Is(err, ErrMessageAuthorRequired) {
+		t.Errorf("messageAuthorRequired(MESSAGE_AUTHOR_REQUIRED) = %v, want ErrMessageAuthorRequired", err)
+	}
+	other := &RPCError{Code: 400, Message: "MESSAGE_NOT_MODIFIED"}
+	if err := messageAuthorRequired(other); err != other {
+		t.Errorf("messageAuthorRequired(MESSAGE_NOT_MODIFIED) = %v, want it unchanged", err)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import "time"
+
+// pager is the part shared by the iterators: it buffers the items of the pages fetched,
+// stops after maxCount items and waits out FLOOD_WAIT errors before asking for a page again
+type pager[T any] struct {
+	// fetchPage returns the items of the next page of at most limit items, done is set
+	// when no page follows
+	fetchPage func(limit int32) (items []T, done bool, err error)
+	sleep     func(d time.Duration)
+	limit     int32 // items per page
+	maxCount  int   // zero for no limit
+	buf       []T
+	count     int
+	done      bool
+	err       error
+}
+
+func newPager[T any](limit int32, maxCount int, fetchPage func(limit int32) ([]T, bool, error)) pager[T] {
+	return pager[T]{fetchPage: fetchPage, sleep: time.Sleep, limit: limit, maxCount: maxCount}
+}
+
+// next returns the next item, fetching pages until one has new items, false at the end
+// or on error
+func (p *pager[T]) next() (T, bool) {
+	var zero T
+	if p.maxCount > 0 && p.count >= p.maxCount {
+		return zero, false
+	}
+	for len(p.buf) == 0 {
+		if p.done || p.err != nil {
+			return zero, false
+		}
+		limit := p.limit
+		if p.maxCount > 0 {
+			limit = min(limit, int32(p.maxCount-p.count))
+		}
+		// the items fetched before an error are still yielded
+		items, done, err := p.fetchPage(limit)
+		p.buf, p.done = append(p.buf, items...), done
+		if wait, ok := IsFloodWait(err); ok {
+			p.sleep(wait)
+		} else if err != nil {
+			p.err = err
+		}
+	}
+	item := p.buf[0]
+	p.buf = p.buf[1:]
+	p.count++
+	return item, true
+}
+
+// Err returns the error that stopped the iteration, if any
+func (p *pager[T]) Err() error {
+	return p.err
+}
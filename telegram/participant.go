@@ -8,6 +8,7 @@ type ParticipantUpdate struct {
 	Client         *Client
 	OriginalUpdate *UpdateChannelParticipant
 	Channel        *Channel
+	Peer           InputPeer
 	User           *UserObj
 	Actor          *UserObj
 	Old            ChannelParticipant
@@ -23,6 +24,11 @@ func (pu *ParticipantUpdate) ChannelID() int64 {
 	return 0
 }
 
+// ChatID returns the bot-api style id (-100 prefixed) of the channel
+func (pu *ParticipantUpdate) ChatID() int64 {
+	return ChannelIDToPeerID(pu.ChannelID())
+}
+
 func (pu *ParticipantUpdate) UserID() int64 {
 	if pu.User != nil {
 		return pu.User.ID
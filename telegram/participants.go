@@ -0,0 +1,167 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// maxParticipantsLimit is the most participants channels.getParticipants returns per request
+const maxParticipantsLimit = 200
+
+// ErrParticipantsLimit is returned by ParticipantIterator.Err when telegram stops returning
+// new members before Count is reached, as only about 10k members of a group can be listed
+var ErrParticipantsLimit = errors.New("telegram stopped returning new members before the end of the list")
+
+type ParticipantIterOptions struct {
+	// Filter of the members, like ChannelParticipantsRecent (default), ChannelParticipantsAdmins,
+	// ChannelParticipantsBots or ChannelParticipantsKicked
+	Filter ChannelParticipantsFilter
+	// Query searches the members by name, overriding Filter
+	Query string
+	// MaxCount stops the iteration after this many members (zero for all)
+	MaxCount int
+}
+
+// ParticipantIterator iterates over the members of a channel or supergroup, a page at a time
+type ParticipantIterator struct {
+	pager[ChannelParticipant]
+	fetch   func(offset, limit int32) (*ChannelsChannelParticipantsObj, error)
+	pack    func(p ChannelParticipant) (*Participant, error)
+	offset  int32
+	total   int32
+	seen    map[int64]bool
+	current *Participant
+}
+
+// IterParticipants returns an iterator over the members of a channel or supergroup.
+// Pages are fetched with channels.getParticipants as the iterator advances, members
+// already seen are skipped and FLOOD_WAIT errors are waited out.
+//
+//	Params:
+//	 - chatID: The channel or supergroup.
+//	 - Opts: Filter, search query and MaxCount.
+func (c *Client) IterParticipants(chatID interface{}, Opts ...*ParticipantIterOptions) (*ParticipantIterator, error) {
+	opts := getVariadic(Opts, &ParticipantIterOptions{}).(*ParticipantIterOptions)
+	peer, err := c.GetSendablePeer(chatID)
+	if err != nil {
+		return nil, err
+	}
+	channel, ok := peer.(*InputPeerChannel)
+	if !ok {
+		return nil, errors.New("peer is not a channel")
+	}
+	filter := opts.Filter
+	if opts.Query != "" {
+		filter = &ChannelParticipantsSearch{Q: opts.Query}
+	} else if filter == nil {
+		filter = &ChannelParticipantsRecent{}
+	}
+	input := &InputChannelObj{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash}
+	return newParticipantIterator(*opts, func(offset, limit int32) (*ChannelsChannelParticipantsObj, error) {
+		resp, err := c.ChannelsGetParticipants(input, filter, offset, limit, 0)
+		if err != nil {
+			return nil, err
+		}
+		switch resp := resp.(type) {
+		case *ChannelsChannelParticipantsObj:
+			c.Cache.UpdatePeersToCache(resp.Users, resp.Chats)
+			return resp, nil
+		case *ChannelsChannelParticipantsNotModified:
+			return &ChannelsChannelParticipantsObj{}, nil
+		}
+		return nil, fmt.Errorf("unexpected response: %s", reflect.TypeOf(resp))
+	}, c.packParticipant), nil
+}
+
+func newParticipantIterator(opts ParticipantIterOptions, fetch func(offset, limit int32) (*ChannelsChannelParticipantsObj, error), pack func(ChannelParticipant) (*Participant, error)) *ParticipantIterator {
+	it := &ParticipantIterator{
+		fetch: fetch,
+		pack:  pack,
+		seen:  make(map[int64]bool),
+	}
+	it.pager = newPager(maxParticipantsLimit, opts.MaxCount, it.fetchPage)
+	return it
+}
+
+// Next advances to the next member, returning false at the end of the list or on error
+func (it *ParticipantIterator) Next() bool {
+	p, ok := it.next()
+	if !ok {
+		return false
+	}
+	it.current, it.err = it.pack(p)
+	return it.err == nil
+}
+
+// Participant returns the current member
+func (it *ParticipantIterator) Participant() *Participant {
+	return it.current
+}
+
+// User returns the user of the current member
+func (it *ParticipantIterator) User() *UserObj {
+	if it.current == nil {
+		return nil
+	}
+	return it.current.User
+}
+
+func (it *ParticipantIterator) fetchPage(limit int32) ([]ChannelParticipant, bool, error) {
+	resp, err := it.fetch(it.offset, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	it.total = max(it.total, resp.Count)
+	it.offset += int32(len(resp.Participants))
+	var page []ChannelParticipant
+	for _, p := range resp.Participants {
+		id := participantID(p)
+		if it.seen[id] {
+			continue
+		}
+		it.seen[id] = true
+		page = append(page, p)
+	}
+	if len(page) == 0 {
+		// an empty page, or one with only members already seen, ends the list
+		if int32(len(it.seen)) < it.total {
+			return nil, true, ErrParticipantsLimit
+		}
+		return nil, true, nil
+	}
+	return page, false, nil
+}
+
+func participantID(p ChannelParticipant) int64 {
+	switch p := p.(type) {
+	case *ChannelParticipantCreator:
+		return p.UserID
+	case *ChannelParticipantAdmin:
+		return p.UserID
+	case *ChannelParticipantObj:
+		return p.UserID
+	case *ChannelParticipantSelf:
+		return p.UserID
+	case *ChannelParticipantBanned:
+		return peerID(p.Peer)
+	case *ChannelParticipantLeft:
+		return peerID(p.Peer)
+	}
+	return 0
+}
+
+func peerID(p Peer) int64 {
+	switch p := p.(type) {
+	case *PeerUser:
+		return p.UserID
+	case *PeerChat:
+		return p.ChatID
+	case *PeerChannel:
+		return p.ChannelID
+	}
+	return 0
+}
@@ -0,0 +1,112 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParticipantIterator(t *testing.T) {
+	// 450 members, telegram only lists 420 of them and repeats one across pages
+	var listed []int64
+	for id := int64(1); id <= 420; id++ {
+		listed = append(listed, id)
+		if id == 200 {
+			listed = append(listed, 1)
+		}
+	}
+	fetch := func(offset, limit int32) (*ChannelsChannelParticipantsObj, error) {
+		resp := &ChannelsChannelParticipantsObj{Count: 450}
+		for i := offset; i < offset+limit && int(i) < len(listed); i++ {
+			resp.Participants = append(resp.Participants, &ChannelParticipantObj{UserID: listed[i]})
+		}
+		return resp, nil
+	}
+	pack := func(p ChannelParticipant) (*Participant, error) {
+		return &Participant{User: &UserObj{ID: participantID(p)}, Participant: p}, nil
+	}
+
+	it := newParticipantIterator(ParticipantIterOptions{}, fetch, pack)
+	seen := make(map[int64]bool)
+	for it.Next() {
+		if seen[it.User().ID] {
+			t.Fatalf("user %d yielded twice", it.User().ID)
+		}
+		seen[it.User().ID] = true
+	}
+	if len(seen) != 420 {
+		t.Errorf("got %d members, want 420", len(seen))
+	}
+	if it.Err() != ErrParticipantsLimit {
+		t.Errorf("got error %v, want ErrParticipantsLimit", it.Err())
+	}
+
+	it = newParticipantIterator(ParticipantIterOptions{MaxCount: 250}, fetch, pack)
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if count != 250 || it.Err() != nil {
+		t.Errorf("max count: got %d members, error %v", count, it.Err())
+	}
+}
+
+func TestPackParticipantStatus(t *testing.T) {
+	c := &Client{Cache: NewCache()}
+	for id := int64(1); id <= 4; id++ {
+		c.Cache.UpdateUser(&UserObj{ID: id})
+	}
+	cases := []struct {
+		participant ChannelParticipant
+		status      string
+		admin       bool
+	}{
+		{chatParticipant(&ChatParticipantCreator{UserID: 1}), Creator, true},
+		{chatParticipant(&ChatParticipantAdmin{UserID: 2}), Admin, true},
+		{&ChannelParticipantBanned{Peer: &PeerUser{UserID: 3}, BannedRights: &ChatBannedRights{SendMedia: true}}, Restricted, false},
+		{&ChannelParticipantBanned{Peer: &PeerUser{UserID: 4}, BannedRights: &ChatBannedRights{ViewMessages: true}}, Kicked, false},
+	}
+	for _, tc := range cases {
+		p, err := c.packParticipant(tc.participant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Status != tc.status || p.IsAdmin() != tc.admin {
+			t.Errorf("user %d: got %s (admin %v), want %s", p.User.ID, p.Status, p.IsAdmin(), tc.status)
+		}
+	}
+	c.Cache.UpdateChannel(&Channel{ID: 5})
+	p, err := c.packParticipant(&ChannelParticipantBanned{Peer: &PeerChannel{ChannelID: 5}, BannedRights: &ChatBannedRights{ViewMessages: true}})
+	if err != nil || p.Channel == nil || p.Channel.ID != 5 || p.User != nil || p.Status != Kicked {
+		t.Errorf("banned channel: got %+v, %v", p, err)
+	}
+	c.Cache.UpdateChat(&ChatObj{ID: 6})
+	if p, err := c.packParticipant(&ChannelParticipantLeft{Peer: &PeerChat{ChatID: 6}}); err != nil || p.Status != Left || p.Chat == nil || p.User != nil {
+		t.Errorf("left chat: got %+v, %v", p, err)
+	}
+	if p, _ := c.packParticipant(chatParticipant(&ChatParticipantAdmin{UserID: 2})); !p.Rights.BanUsers || p.Rights.AddAdmins {
+		t.Errorf("unexpected basic group admin rights %+v", p.Rights)
+	}
+}
+
+func TestChatPermissions(t *testing.T) {
+	until := time.Unix(1700000000, 0)
+	rights := ChatPermissions{SendMessages: true, SendPhotos: true}.chatBannedRights(until)
+	if rights.SendMessages || rights.SendPhotos || rights.SendMedia {
+		t.Error("allowed permissions banned")
+	}
+	if !rights.SendVideos || !rights.SendStickers || !rights.PinMessages {
+		t.Error("permissions not allowed are not banned")
+	}
+	if rights.UntilDate != 1700000000 {
+		t.Errorf("until date %d", rights.UntilDate)
+	}
+	if muted := (ChatPermissions{}).chatBannedRights(time.Time{}); !muted.SendMedia || muted.UntilDate != 0 {
+		t.Error("zero permissions don't ban media forever")
+	}
+	if admin := (AdminRights{PinMessages: true}).chatAdminRights(); !admin.Other || !admin.PinMessages {
+		t.Error("admin rights not converted")
+	}
+	if demoted := (AdminRights{}).chatAdminRights(); demoted.Other {
+		t.Error("empty admin rights keep other")
+	}
+}
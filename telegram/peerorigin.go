@@ -0,0 +1,95 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+// messageOrigin is a message a user or channel was seen in, it stands in for their
+// access hash (as inputPeerUserFromMessage or inputPeerChannelFromMessage) as long as
+// they are only known from min objects, whose access hash can't be used
+type messageOrigin struct {
+	// chatID is the bot API style ID of the chat the message is in
+	chatID int64
+	msgID  int32
+}
+
+// messagePeer is the chat and ID of the message a peer is resolved from
+type messagePeer struct {
+	Peer  InputPeer
+	MsgID int32
+}
+
+// peerFromMessage returns the message a user or channel can be resolved from, called with the cache locked
+func (c *CACHE) peerFromMessage(key cacheEntryKey) (messagePeer, bool) {
+	origin, ok := c.origins[key]
+	if !ok {
+		return messagePeer{}, false
+	}
+	var chat InputPeer
+	switch {
+	case IsChannelID(origin.chatID):
+		channelID := PeerIDToChannelID(origin.chatID)
+		accessHash, ok := c.InputPeers.InputChannels[channelID]
+		if !ok {
+			return messagePeer{}, false
+		}
+		chat = &InputPeerChannel{ChannelID: channelID, AccessHash: accessHash}
+	case IsChatID(origin.chatID):
+		chat = &InputPeerChat{ChatID: -origin.chatID}
+	default:
+		return messagePeer{}, false
+	}
+	return messagePeer{Peer: chat, MsgID: origin.msgID}, true
+}
+
+func (c *CACHE) userFromMessage(userID int64) (InputPeer, bool) {
+	peer, ok := c.peerFromMessage(cacheEntryKey{cacheEntryUser, userID})
+	if !ok {
+		return nil, false
+	}
+	return &InputPeerUserFromMessage{Peer: peer.Peer, MsgID: peer.MsgID, UserID: userID}, true
+}
+
+func (c *CACHE) channelFromMessage(channelID int64) (InputPeer, bool) {
+	peer, ok := c.peerFromMessage(cacheEntryKey{cacheEntryChannel, channelID})
+	if !ok {
+		return nil, false
+	}
+	return &InputPeerChannelFromMessage{Peer: peer.Peer, MsgID: peer.MsgID, ChannelID: channelID}, true
+}
+
+// rememberOrigins remembers the message as the origin of its sender and of the peer it was
+// forwarded from, unless their access hash is known. Called before caching the users and chats
+// of the message, caching a full (not min) object then forgets the origin.
+func (c *CACHE) rememberOrigins(msg Message) {
+	m, ok := msg.(*MessageObj)
+	if !ok {
+		return
+	}
+	origin := messageOrigin{chatID: peerKey(m.PeerID), msgID: m.ID}
+	if origin.chatID >= 0 {
+		return // users of private chats are always sent in full
+	}
+	peers := []Peer{m.FromID}
+	if m.FwdFrom != nil {
+		peers = append(peers, m.FwdFrom.FromID)
+	}
+	c.Lock()
+	defer c.Unlock()
+	for _, peer := range peers {
+		var key cacheEntryKey
+		var known bool
+		switch p := peer.(type) {
+		case *PeerUser:
+			key = cacheEntryKey{cacheEntryUser, p.UserID}
+			_, known = c.InputPeers.InputUsers[p.UserID]
+		case *PeerChannel:
+			key = cacheEntryKey{cacheEntryChannel, p.ChannelID}
+			_, known = c.InputPeers.InputChannels[p.ChannelID]
+		default:
+			continue
+		}
+		// a known hash without an origin was learned from a full object
+		if _, fromMessage := c.origins[key]; !known || fromMessage {
+			c.origins[key] = origin
+		}
+	}
+}
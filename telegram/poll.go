@@ -0,0 +1,259 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pollTTL is how long a poll not seen updated is remembered
+const pollTTL = 24 * time.Hour
+
+type PollOptions struct {
+	MediaOptions
+	// Quiz makes the poll a quiz, CorrectAnswer is then the index of the right option
+	Quiz          bool `json:"quiz,omitempty"`
+	CorrectAnswer int  `json:"correct_answer,omitempty"`
+	// Explanation is shown when a wrong quiz answer is picked, parsed in the ParseMode
+	Explanation    string `json:"explanation,omitempty"`
+	MultipleChoice bool   `json:"multiple_choice,omitempty"`
+	// Public shows who voted for what, polls are anonymous by default
+	Public bool `json:"public,omitempty"`
+	// ClosePeriod closes the poll that many seconds (5 to 600) after it is sent
+	ClosePeriod int32 `json:"close_period,omitempty"`
+	// CloseDate is the unix time the poll closes at
+	CloseDate int32 `json:"close_date,omitempty"`
+}
+
+// pollOption is the identifier of the option at index i, a single byte as the
+// official clients use
+func pollOption(i int) []byte {
+	return []byte{byte(i)}
+}
+
+// SendPoll sends a poll of 2 to 10 options, or a quiz with PollOptions.Quiz.
+// Votes are received with AddPollHandler and AddPollVoteHandler.
+func (c *Client) SendPoll(peerID interface{}, question string, options []string, opts ...*PollOptions) (*NewMessage, error) {
+	opt := getVariadic(opts, &PollOptions{}).(*PollOptions)
+	media, err := c.pollMedia(question, options, opt)
+	if err != nil {
+		return nil, err
+	}
+	m, err := c.SendMedia(peerID, media, &opt.MediaOptions)
+	if err != nil {
+		return nil, err
+	}
+	if poll := m.Poll(); poll != nil {
+		c.rememberPoll(poll.Poll)
+	}
+	return m, nil
+}
+
+func (c *Client) pollMedia(question string, options []string, opt *PollOptions) (*InputMediaPoll, error) {
+	if len(options) < 2 || len(options) > 10 {
+		return nil, fmt.Errorf("a poll has 2 to 10 options, got %d", len(options))
+	}
+	if opt.Quiz && opt.MultipleChoice {
+		return nil, errors.New("a quiz can't be multiple choice")
+	}
+	if opt.ClosePeriod != 0 && (opt.ClosePeriod < 5 || opt.ClosePeriod > 600) {
+		return nil, fmt.Errorf("a poll closes 5 to 600 seconds after it is sent, got %d", opt.ClosePeriod)
+	}
+	poll := &Poll{
+		ID:             rand.Int63(),
+		Question:       question,
+		Quiz:           opt.Quiz,
+		MultipleChoice: opt.MultipleChoice,
+		PublicVoters:   opt.Public,
+		ClosePeriod:    opt.ClosePeriod,
+		CloseDate:      opt.CloseDate,
+	}
+	for i, option := range options {
+		poll.Answers = append(poll.Answers, &PollAnswer{Text: option, Option: pollOption(i)})
+	}
+	media := &InputMediaPoll{Poll: poll}
+	if opt.Quiz {
+		if opt.CorrectAnswer < 0 || opt.CorrectAnswer >= len(options) {
+			return nil, fmt.Errorf("correct answer %d is not an option", opt.CorrectAnswer)
+		}
+		media.CorrectAnswers = [][]byte{pollOption(opt.CorrectAnswer)}
+		if opt.Explanation != "" {
+			entities, text, err := parseEntities(opt.Explanation, c.parseModeFor(opt.ParseMode))
+			if err != nil {
+				return nil, err
+			}
+			media.Solution, media.SolutionEntities = text, entities
+		}
+	}
+	return media, nil
+}
+
+// pollCache holds the polls sent or seen updated by the client, to map the options of
+// votes back to their text. Closed polls are forgotten, and polls not seen for pollTTL.
+type pollCache struct {
+	sync.Mutex
+	polls     map[int64]*Poll
+	seen      map[int64]time.Time
+	lastSweep time.Time
+}
+
+func (pc *pollCache) store(poll *Poll, now time.Time) {
+	pc.Lock()
+	defer pc.Unlock()
+	if pc.polls == nil {
+		pc.polls, pc.seen = make(map[int64]*Poll), make(map[int64]time.Time)
+	}
+	if now.Sub(pc.lastSweep) >= pollTTL/24 {
+		for id, seen := range pc.seen {
+			if now.Sub(seen) >= pollTTL {
+				delete(pc.polls, id)
+				delete(pc.seen, id)
+			}
+		}
+		pc.lastSweep = now
+	}
+	if poll.Closed {
+		// no vote follows
+		delete(pc.polls, poll.ID)
+		delete(pc.seen, poll.ID)
+		return
+	}
+	pc.polls[poll.ID], pc.seen[poll.ID] = poll, now
+}
+
+func (pc *pollCache) load(pollID int64, now time.Time) *Poll {
+	pc.Lock()
+	defer pc.Unlock()
+	if seen, ok := pc.seen[pollID]; !ok || now.Sub(seen) >= pollTTL {
+		return nil
+	}
+	return pc.polls[pollID]
+}
+
+// rememberPoll keeps the options of a poll, to map the options of votes back to their text
+func (c *Client) rememberPoll(poll *Poll) {
+	if poll != nil {
+		c.polls.store(poll, time.Now())
+	}
+}
+
+// GetPoll returns a poll sent or seen updated by the client in the last 24 hours, nil when
+// unknown or closed
+func (c *Client) GetPoll(pollID int64) *Poll {
+	return c.polls.load(pollID, time.Now())
+}
+
+// pollAnswerText returns the text of an option of a poll, empty when the poll is nil
+func pollAnswerText(poll *Poll, option []byte) string {
+	if poll != nil {
+		for _, answer := range poll.Answers {
+			if string(answer.Option) == string(option) {
+				return answer.Text
+			}
+		}
+	}
+	return ""
+}
+
+// PollAnswerResult is the result of a poll option
+type PollAnswerResult struct {
+	// Text is empty when the poll is not known to the client
+	Text    string
+	Option  []byte
+	Voters  int32
+	Chosen  bool
+	Correct bool
+}
+
+// PollUpdate is an update of the results of a poll
+type PollUpdate struct {
+	Client         *Client
+	OriginalUpdate *UpdateMessagePoll
+	PollID         int64
+	// Poll is the poll updated, nil when it is neither sent with the update nor known
+	Poll *Poll
+	// TotalVoters is the number of users that voted
+	TotalVoters int32
+}
+
+func packPollUpdate(c *Client, update *UpdateMessagePoll) *PollUpdate {
+	p := &PollUpdate{Client: c, OriginalUpdate: update, PollID: update.PollID, Poll: update.Poll}
+	if p.Poll == nil {
+		p.Poll = c.GetPoll(update.PollID)
+	}
+	c.rememberPoll(update.Poll)
+	if update.Results != nil {
+		p.TotalVoters = update.Results.TotalVoters
+	}
+	return p
+}
+
+// Question returns the question of the poll, empty when the poll is not known
+func (p *PollUpdate) Question() string {
+	if p.Poll != nil {
+		return p.Poll.Question
+	}
+	return ""
+}
+
+// Closed reports whether the poll no longer takes votes
+func (p *PollUpdate) Closed() bool {
+	return p.Poll != nil && p.Poll.Closed
+}
+
+// Results returns the votes of each option, with the text of the option
+func (p *PollUpdate) Results() []PollAnswerResult {
+	if p.OriginalUpdate.Results == nil {
+		return nil
+	}
+	results := make([]PollAnswerResult, 0, len(p.OriginalUpdate.Results.Results))
+	for _, r := range p.OriginalUpdate.Results.Results {
+		results = append(results, PollAnswerResult{
+			Text:    pollAnswerText(p.Poll, r.Option),
+			Option:  r.Option,
+			Voters:  r.Voters,
+			Chosen:  r.Chosen,
+			Correct: r.Correct,
+		})
+	}
+	return results
+}
+
+// PollVote is the vote of a user in a public poll sent by the bot
+type PollVote struct {
+	Client         *Client
+	OriginalUpdate *UpdateMessagePollVote
+	PollID         int64
+	// Voter is the user or channel that voted
+	Voter   Peer
+	Options [][]byte
+}
+
+func packPollVote(c *Client, update *UpdateMessagePollVote) *PollVote {
+	return &PollVote{Client: c, OriginalUpdate: update, PollID: update.PollID, Voter: update.Peer, Options: update.Options}
+}
+
+// VoterID returns the ID of the voter
+func (v *PollVote) VoterID() int64 {
+	return v.Client.GetPeerID(v.Voter)
+}
+
+// Retracted reports whether the vote was retracted
+func (v *PollVote) Retracted() bool {
+	return len(v.Options) == 0
+}
+
+// Answers returns the text of the chosen options, empty strings for options of unknown polls
+func (v *PollVote) Answers() []string {
+	poll := v.Client.GetPoll(v.PollID)
+	answers := make([]string, 0, len(v.Options))
+	for _, option := range v.Options {
+		answers = append(answers, pollAnswerText(poll, option))
+	}
+	return answers
+}
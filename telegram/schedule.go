@@ -0,0 +1,86 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ScheduleWhenOnline is the schedule date sending a message once the other user of a
+// private chat comes online, it needs their last seen time to be visible
+var ScheduleWhenOnline = time.Unix(0x7FFFFFFE, 0)
+
+// maxScheduleAhead is how far in the future telegram lets messages be scheduled
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// scheduleDate validates the schedule date of a message, the zero time sends it right away
+func scheduleDate(date time.Time) (int32, error) {
+	switch {
+	case date.IsZero():
+		return 0, nil
+	case date.Equal(ScheduleWhenOnline):
+		return int32(date.Unix()), nil
+	case !date.After(time.Now()):
+		return 0, fmt.Errorf("schedule date %s is not in the future", date.Format(time.RFC3339))
+	case date.After(time.Now().Add(maxScheduleAhead)):
+		return 0, fmt.Errorf("schedule date %s is more than a year ahead", date.Format(time.RFC3339))
+	}
+	return int32(date.Unix()), nil
+}
+
+// GetScheduledMessages returns the messages scheduled in a chat.
+// This method is a wrapper for messages.getScheduledHistory.
+func (c *Client) GetScheduledMessages(peerID interface{}) ([]*NewMessage, error) {
+	peer, err := c.GetSendablePeer(peerID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.MessagesGetScheduledHistory(peer, 0)
+	if err != nil {
+		return nil, err
+	}
+	m, err := c.messagesOf(resp)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*NewMessage, 0, len(m))
+	for _, msg := range m {
+		messages = append(messages, packMessage(c, msg))
+	}
+	return messages, nil
+}
+
+// SendScheduledMessages sends scheduled messages right away, returning the sent messages.
+// This method is a wrapper for messages.sendScheduledMessages.
+func (c *Client) SendScheduledMessages(peerID interface{}, ids []int32) ([]*NewMessage, error) {
+	peer, err := c.GetSendablePeer(peerID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.MessagesSendScheduledMessages(peer, ids)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, errors.New("no response")
+	}
+	var m []*NewMessage
+	for _, msg := range c.sentMessages(resp, nil) {
+		m = append(m, packMessage(c, msg))
+	}
+	return m, nil
+}
+
+// DeleteScheduledMessages deletes scheduled messages before they are sent.
+// This method is a wrapper for messages.deleteScheduledMessages.
+func (c *Client) DeleteScheduledMessages(peerID interface{}, ids []int32) error {
+	peer, err := c.GetSendablePeer(peerID)
+	if err != nil {
+		return err
+	}
+	_, err = c.MessagesDeleteScheduledMessages(peer, ids)
+	return err
+}
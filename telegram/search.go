@@ -0,0 +1,73 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import "time"
+
+type SearchOptions struct {
+	HistoryOptions
+	// FromUser only matches messages sent by this user
+	FromUser interface{}
+	// TopMsgID searches in the replies to this message, or in the topic it starts
+	TopMsgID int32
+	// MinDate and MaxDate bound the dates of the messages matched
+	MinDate time.Time
+	MaxDate time.Time
+}
+
+// SearchMessages returns an iterator over the messages of a chat matching the query and
+// the filter (like &InputMessagesFilterPhotos{} or &InputMessagesFilterURL{}), newest
+// first unless Reverse is set. Either may be empty, a nil filter matches every message.
+// Pages are fetched with messages.search as the iterator advances.
+//
+//	iter, _ := client.SearchMessages(chat, "invoice", &InputMessagesFilterDocument{})
+//	for iter.Next() {
+//		fmt.Println(iter.Message().ID)
+//	}
+func (c *Client) SearchMessages(peerID interface{}, query string, filter MessagesFilter, Opts ...*SearchOptions) (*HistoryIterator, error) {
+	opts := getVariadic(Opts, &SearchOptions{}).(*SearchOptions)
+	peer, err := c.GetSendablePeer(peerID)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = &InputMessagesFilterEmpty{}
+	}
+	var fromID InputPeer
+	if opts.FromUser != nil {
+		if fromID, err = c.GetSendablePeer(opts.FromUser); err != nil {
+			return nil, err
+		}
+	}
+	params := searchParams(query, filter, fromID, opts)
+	return newHistoryIterator(peer, opts.HistoryOptions, func(req *MessagesGetHistoryParams) ([]Message, error) {
+		search := params
+		search.Peer = req.Peer
+		search.OffsetID, search.AddOffset, search.Limit = req.OffsetID, req.AddOffset, req.Limit
+		search.MinID, search.MaxID = req.MinID, req.MaxID
+		resp, err := c.MessagesSearch(&search)
+		if err != nil {
+			return nil, err
+		}
+		return c.messagesOf(resp)
+	}, func(msg Message) *NewMessage {
+		return packMessage(c, msg)
+	}), nil
+}
+
+// searchParams are the parameters of messages.search the pages of a search share
+func searchParams(query string, filter MessagesFilter, fromID InputPeer, opts *SearchOptions) MessagesSearchParams {
+	params := MessagesSearchParams{
+		Q:        query,
+		Filter:   filter,
+		FromID:   fromID,
+		TopMsgID: opts.TopMsgID,
+	}
+	if !opts.MinDate.IsZero() {
+		params.MinDate = int32(opts.MinDate.Unix())
+	}
+	if !opts.MaxDate.IsZero() {
+		params.MaxDate = int32(opts.MaxDate.Unix())
+	}
+	return params
+}
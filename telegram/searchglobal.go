@@ -0,0 +1,189 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+type GlobalSearchOptions struct {
+	// Filter only matches messages of a kind, like &InputMessagesFilterPhotos{}
+	Filter MessagesFilter
+	// FolderID searches only the chats of a folder, 1 being the archive
+	FolderID int32
+	// MinDate and MaxDate bound the dates of the messages matched
+	MinDate time.Time
+	MaxDate time.Time
+	// Limit is the number of messages fetched per request, at most 100 (default 100)
+	Limit int32
+	// MaxCount stops the iteration after this many messages (zero for every match)
+	MaxCount int
+}
+
+// globalOffset is the position messages.searchGlobal continues from, the rate, chat
+// and ID of the last message of the previous page
+type globalOffset struct {
+	rate int32
+	peer InputPeer
+	id   int32
+}
+
+// globalPage is a page of messages.searchGlobal results
+type globalPage struct {
+	messages []Message
+	nextRate int32
+	// last is set when the results are complete, no page follows
+	last bool
+}
+
+// GlobalSearchIterator iterates over the results of SearchGlobal, a page at a time.
+type GlobalSearchIterator struct {
+	pager[Message]
+	fetch   func(offset globalOffset, limit int32) (globalPage, error)
+	resolve func(peer Peer) (InputPeer, error)
+	pack    func(msg Message) *NewMessage
+	offset  globalOffset
+	seen    map[[2]int64]bool
+	current *NewMessage
+}
+
+// SearchGlobal returns an iterator over the messages of every chat matching the query,
+// newest first. Pages are fetched with messages.searchGlobal as the iterator advances,
+// waiting out FLOOD_WAIT errors between them.
+func (c *Client) SearchGlobal(query string, Opts ...*GlobalSearchOptions) *GlobalSearchIterator {
+	opts := getVariadic(Opts, &GlobalSearchOptions{}).(*GlobalSearchOptions)
+	params := MessagesSearchGlobalParams{Q: query, Filter: opts.Filter, FolderID: opts.FolderID}
+	if params.Filter == nil {
+		params.Filter = &InputMessagesFilterEmpty{}
+	}
+	if !opts.MinDate.IsZero() {
+		params.MinDate = int32(opts.MinDate.Unix())
+	}
+	if !opts.MaxDate.IsZero() {
+		params.MaxDate = int32(opts.MaxDate.Unix())
+	}
+	return newGlobalSearchIterator(*opts, func(offset globalOffset, limit int32) (globalPage, error) {
+		req := params
+		req.OffsetRate, req.OffsetPeer, req.OffsetID, req.Limit = offset.rate, offset.peer, offset.id, limit
+		resp, err := c.MessagesSearchGlobal(&req)
+		if err != nil {
+			return globalPage{}, err
+		}
+		switch resp := resp.(type) {
+		case *MessagesMessagesSlice:
+			c.Cache.UpdatePeersToCache(resp.Users, resp.Chats)
+			return globalPage{messages: resp.Messages, nextRate: resp.NextRate}, nil
+		case *MessagesMessagesObj:
+			c.Cache.UpdatePeersToCache(resp.Users, resp.Chats)
+			return globalPage{messages: resp.Messages, last: true}, nil
+		case *MessagesChannelMessages:
+			c.Cache.UpdatePeersToCache(resp.Users, resp.Chats)
+			return globalPage{messages: resp.Messages, last: true}, nil
+		case *MessagesMessagesNotModified:
+			return globalPage{last: true}, nil
+		}
+		return globalPage{}, fmt.Errorf("unexpected response: %s", reflect.TypeOf(resp))
+	}, func(peer Peer) (InputPeer, error) {
+		return c.GetSendablePeer(peer)
+	}, func(msg Message) *NewMessage {
+		return packMessage(c, msg)
+	})
+}
+
+func newGlobalSearchIterator(opts GlobalSearchOptions, fetch func(globalOffset, int32) (globalPage, error), resolve func(Peer) (InputPeer, error), pack func(Message) *NewMessage) *GlobalSearchIterator {
+	if opts.Limit <= 0 || opts.Limit > maxHistoryLimit {
+		opts.Limit = maxHistoryLimit
+	}
+	it := &GlobalSearchIterator{
+		fetch:   fetch,
+		resolve: resolve,
+		pack:    pack,
+		offset:  globalOffset{peer: &InputPeerEmpty{}},
+		seen:    make(map[[2]int64]bool),
+	}
+	it.pager = newPager(opts.Limit, opts.MaxCount, it.fetchPage)
+	return it
+}
+
+// Next advances to the next message, returning false at the end of the results or on error
+func (it *GlobalSearchIterator) Next() bool {
+	msg, ok := it.next()
+	if ok {
+		it.current = it.pack(msg)
+	}
+	return ok
+}
+
+// Message returns the current message
+func (it *GlobalSearchIterator) Message() *NewMessage {
+	return it.current
+}
+
+func (it *GlobalSearchIterator) fetchPage(limit int32) ([]Message, bool, error) {
+	page, err := it.fetch(it.offset, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	var msgs []Message
+	var last Message
+	for _, msg := range page.messages {
+		if _, empty := msg.(*MessageEmpty); empty {
+			continue
+		}
+		last = msg
+		// pages may overlap at their edges, a message is yielded once
+		key := [2]int64{peerKey(messageChat(msg)), int64(messageID(msg))}
+		if !it.seen[key] {
+			it.seen[key] = true
+			msgs = append(msgs, msg)
+		}
+	}
+	if page.last || last == nil || len(msgs) == 0 {
+		return msgs, true, nil
+	}
+	peer, err := it.resolve(messageChat(last))
+	if err != nil {
+		return msgs, true, err
+	}
+	// the rate orders the results, it is the date of the last message unless telegram sends the next one
+	next := globalOffset{rate: page.nextRate, peer: peer, id: messageID(last)}
+	if next.rate == 0 {
+		next.rate = messageDate(last)
+	}
+	if next.rate == it.offset.rate && next.id == it.offset.id && peerKey(messageChat(last)) == it.lastChat() {
+		// the offset didn't move, asking again would return the same page
+		return msgs, true, nil
+	}
+	it.offset = next
+	return msgs, false, nil
+}
+
+// lastChat is the chat of the offset of the next page, zero before the first page
+func (it *GlobalSearchIterator) lastChat() int64 {
+	return peerKey(peerFromInput(it.offset.peer))
+}
+
+// messageChat returns the chat a message is in
+func messageChat(msg Message) Peer {
+	switch msg := msg.(type) {
+	case *MessageObj:
+		return msg.PeerID
+	case *MessageService:
+		return msg.PeerID
+	case *MessageEmpty:
+		return msg.PeerID
+	}
+	return nil
+}
+
+func messageDate(msg Message) int32 {
+	switch msg := msg.(type) {
+	case *MessageObj:
+		return msg.Date
+	case *MessageService:
+		return msg.Date
+	}
+	return 0
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/roj1512/gogram/internal/encoding/tl"
+)
+
+// ErrTakeoutInitDelay is returned by Takeout until the export is confirmed from another session
+var ErrTakeoutInitDelay = errors.New("TAKEOUT_INIT_DELAY: the data export must be confirmed from another logged in session, try again later")
+
+type TakeoutOptions struct {
+	// Contacts, MessageUsers, MessageChats, MessageMegagroups and MessageChannels tell
+	// telegram what is going to be exported
+	Contacts          bool
+	MessageUsers      bool
+	MessageChats      bool
+	MessageMegagroups bool
+	MessageChannels   bool
+	// Files exports files up to FileMaxSize bytes
+	Files       bool
+	FileMaxSize int64
+}
+
+// ErrTakeoutFinished is returned by the requests of a takeout session after Finish or Stop
+var ErrTakeoutFinished = errors.New("the takeout session is finished")
+
+// TakeoutSession sends requests in a takeout session, which has looser flood limits for
+// exporting the data of the account. Every request it makes, file downloads included, is
+// wrapped in invokeWithTakeout; Finish or Stop ends the session, not the client.
+//
+//	takeout, err := client.Takeout(&TakeoutOptions{MessageUsers: true})
+//	if err != nil { ... }
+//	defer takeout.Finish(true)
+//	iter, _ := takeout.IterHistory(chat)
+type TakeoutSession struct {
+	ID     int64
+	parent *Client
+	// client shares the connection and cache of parent, sending its requests in the session
+	client     *Client
+	finishOnce sync.Once
+	finished   atomic.Bool
+	finishErr  error
+}
+
+// Takeout starts a takeout session to export the data of the account, user accounts only.
+// Telegram may ask for the export to be confirmed from another session first, Takeout
+// then returns ErrTakeoutInitDelay.
+// This method is a wrapper for account.initTakeoutSession.
+func (c *Client) Takeout(opts ...*TakeoutOptions) (*TakeoutSession, error) {
+	opt := getVariadic(opts, &TakeoutOptions{}).(*TakeoutOptions)
+	takeout, err := c.AccountInitTakeoutSession(&AccountInitTakeoutSessionParams{
+		Contacts:          opt.Contacts,
+		MessageUsers:      opt.MessageUsers,
+		MessageChats:      opt.MessageChats,
+		MessageMegagroups: opt.MessageMegagroups,
+		MessageChannels:   opt.MessageChannels,
+		Files:             opt.Files,
+		FileMaxSize:       opt.FileMaxSize,
+	})
+	if err != nil {
+		if matchRPCError(err, "TAKEOUT_INIT_DELAY_X") {
+			return nil, errors.Wrap(ErrTakeoutInitDelay, err.Error())
+		}
+		return nil, err
+	}
+	return newTakeoutSession(c, takeout.ID), nil
+}
+
+func newTakeoutSession(c *Client, id int64) *TakeoutSession {
+	t := &TakeoutSession{ID: id, parent: c}
+	t.client = c.takeoutClient(t)
+	return t
+}
+
+// takeoutClient returns a client sharing the connection and cache of c whose requests
+// are sent in the takeout session t
+func (c *Client) takeoutClient(t *TakeoutSession) *Client {
+	tc := &Client{
+		MTProto:    c.MTProto,
+		Cache:      c.Cache,
+		clientData: c.clientData,
+		updates:    c.updates,
+		stopCh:     make(chan struct{}),
+		Log:        c.Log,
+		takeout:    t,
+	}
+	tc.downloadCache.Store(c.downloadCache.Load())
+	return tc
+}
+
+// takeoutRequest wraps a request in invokeWithTakeout when the client is a takeout session
+func (c *Client) takeoutRequest(msg tl.Object) tl.Object {
+	if _, wrapped := msg.(*InvokeWithTakeoutParams); c.takeout == nil || wrapped {
+		return msg
+	}
+	return &InvokeWithTakeoutParams{TakeoutID: c.takeout.ID, Query: msg}
+}
+
+// MakeRequest sends a request in the takeout session
+func (t *TakeoutSession) MakeRequest(msg tl.Object) (any, error) {
+	return t.client.MakeRequest(msg)
+}
+
+// MakeRequestCtx sends a request in the takeout session, bound to ctx
+func (t *TakeoutSession) MakeRequestCtx(ctx context.Context, msg tl.Object) (any, error) {
+	return t.client.MakeRequestCtx(ctx, msg)
+}
+
+// Batch sends requests together in the takeout session, see Client.Batch
+func (t *TakeoutSession) Batch(reqs []Object) ([]any, error) {
+	return t.client.Batch(reqs)
+}
+
+// IterHistory iterates over the messages of a chat in the takeout session, see Client.IterHistory
+func (t *TakeoutSession) IterHistory(peerID interface{}, opts ...*HistoryOptions) (*HistoryIterator, error) {
+	return t.client.IterHistory(peerID, opts...)
+}
+
+// IterDialogs iterates over the chat list in the takeout session, see Client.IterDialogs
+func (t *TakeoutSession) IterDialogs(opts ...*DialogIterOptions) *DialogIterator {
+	return t.client.IterDialogs(opts...)
+}
+
+// DownloadMedia downloads a file in the takeout session, see Client.DownloadMedia
+func (t *TakeoutSession) DownloadMedia(file interface{}, opts ...*DownloadOptions) (string, error) {
+	return t.client.DownloadMedia(file, opts...)
+}
+
+// DownloadMediaBytes downloads a file in the takeout session, see Client.DownloadMediaBytes
+func (t *TakeoutSession) DownloadMediaBytes(file interface{}, opts ...*DownloadOptions) ([]byte, error) {
+	return t.client.DownloadMediaBytes(file, opts...)
+}
+
+// DownloadReader streams a file in the takeout session, see Client.DownloadReader
+func (t *TakeoutSession) DownloadReader(location InputFileLocation, opts ...*DownloadOptions) (io.ReadCloser, error) {
+	return t.client.DownloadReader(location, opts...)
+}
+
+// Finish ends the takeout session, success reports whether the data was exported
+// completely. Requests made afterwards fail with ErrTakeoutFinished, the client keeps
+// running. Calling Finish again returns the result of the first call.
+// This method is a wrapper for account.finishTakeoutSession.
+func (t *TakeoutSession) Finish(success bool) error {
+	t.finishOnce.Do(func() {
+		_, t.finishErr = t.client.AccountFinishTakeoutSession(success)
+		t.finished.Store(true)
+	})
+	return t.finishErr
+}
+
+// Stop ends the takeout session as completed, it is Finish(true)
+func (t *TakeoutSession) Stop() error {
+	return t.Finish(true)
+}
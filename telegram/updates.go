@@ -3,11 +3,15 @@
 package telegram
 
 import (
+	"bytes"
 	"reflect"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/pkg/errors"
+	"github.com/roj1512/gogram/internal/utils"
 )
 
 const DEF_ALBUM_WAIT_TIME = 600 * time.Millisecond
@@ -72,6 +76,24 @@ func (c *Client) removeHandle(h interface{}) {
 				c.dispatcher.participantHandles = append(c.dispatcher.participantHandles[:i], c.dispatcher.participantHandles[i+1:]...)
 			}
 		}
+	case *pollHandle:
+		for i, h := range c.dispatcher.pollHandles {
+			if reflect.DeepEqual(h, handle) {
+				c.dispatcher.pollHandles = append(c.dispatcher.pollHandles[:i], c.dispatcher.pollHandles[i+1:]...)
+			}
+		}
+	case *pollVoteHandle:
+		for i, h := range c.dispatcher.pollVoteHandles {
+			if reflect.DeepEqual(h, handle) {
+				c.dispatcher.pollVoteHandles = append(c.dispatcher.pollVoteHandles[:i], c.dispatcher.pollVoteHandles[i+1:]...)
+			}
+		}
+	case *joinRequestHandle:
+		for i, h := range c.dispatcher.joinRequestHandles {
+			if reflect.DeepEqual(h, handle) {
+				c.dispatcher.joinRequestHandles = append(c.dispatcher.joinRequestHandles[:i], c.dispatcher.joinRequestHandles[i+1:]...)
+			}
+		}
 	case *rawHandle:
 		for i, h := range c.dispatcher.rawHandles {
 			if reflect.DeepEqual(h, handle) {
@@ -135,6 +157,18 @@ type participantHandle struct {
 	Handler func(p *ParticipantUpdate) error
 }
 
+type pollHandle struct {
+	Handler func(p *PollUpdate) error
+}
+
+type pollVoteHandle struct {
+	Handler func(v *PollVote) error
+}
+
+type joinRequestHandle struct {
+	Handler func(r *JoinRequest) error
+}
+
 type rawHandle struct {
 	updateType Update
 	Handler    func(m Update, c *Client) error
@@ -150,7 +184,36 @@ type UpdateDispatcher struct {
 	actionHandles         []chatActionHandle
 	messageDeleteHandles  []messageDeleteHandle
 	albumHandles          []albumHandle
+	pollHandles           []pollHandle
+	pollVoteHandles       []pollVoteHandle
+	joinRequestHandles    []joinRequestHandle
 	rawHandles            []rawHandle
+	middlewares           []Middleware
+}
+
+// HandlerFunc is a new message handler
+type HandlerFunc func(m *NewMessage) error
+
+// Middleware wraps a message handler, it runs its own logic and calls next to
+// continue the chain, or returns without calling it to skip the handler
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// UseMiddleware adds middlewares wrapping every message handler.
+//
+// For each new message, a matching handler runs: pattern match, filters, then the
+// middlewares in the order they were added (the first added runs first), then the handler.
+// An error returned by a middleware without calling next stops the chain and is logged
+// like a handler error.
+func (c *Client) UseMiddleware(middlewares ...Middleware) {
+	c.dispatcher.middlewares = append(c.dispatcher.middlewares, middlewares...)
+}
+
+// wrapMessageHandler applies the middlewares to handler, the first middleware being the outermost
+func (d *UpdateDispatcher) wrapMessageHandler(handler HandlerFunc) HandlerFunc {
+	for i := len(d.middlewares) - 1; i >= 0; i-- {
+		handler = d.middlewares[i](handler)
+	}
+	return handler
 }
 
 func (c *Client) handleMessageUpdate(update Message) {
@@ -161,25 +224,27 @@ func (c *Client) handleMessageUpdate(update Message) {
 		}
 		for _, handler := range c.dispatcher.messageHandles {
 			if handler.IsMatch(msg.Message) {
-				go func(h messageHandle) {
+				h := handler
+				c.runHandler(func() {
 					m := packMessage(c, msg)
 					if h.runFilterChain(m) {
 						defer c.NewRecovery()()
-						if err := h.Handler(m); err != nil {
+						if err := c.dispatcher.wrapMessageHandler(h.Handler)(m); err != nil {
 							c.Log.Error(err)
 						}
 					}
-				}(handler)
+				})
 			}
 		}
 	case *MessageService:
 		for _, handler := range c.dispatcher.actionHandles {
-			go func(h chatActionHandle) {
+			h := handler
+			c.runHandler(func() {
 				defer c.NewRecovery()()
 				if err := h.Handler(packMessage(c, msg)); err != nil {
 					c.Log.Error(err)
 				}
-			}(handler)
+			})
 		}
 	}
 }
@@ -228,12 +293,13 @@ func (c *Client) handleEditUpdate(update Message) {
 	case *MessageObj:
 		for _, handle := range c.dispatcher.messageEditHandles {
 			if handle.IsMatch(msg.Message) {
-				go func(h messageEditHandle) {
+				h := handle
+				c.runHandler(func() {
 					defer c.NewRecovery()()
 					if err := h.Handler(packMessage(c, msg)); err != nil {
 						c.Log.Error("updates.dispatcher.EditMessage -", err)
 					}
-				}(handle)
+				})
 			}
 		}
 	}
@@ -242,12 +308,13 @@ func (c *Client) handleEditUpdate(update Message) {
 func (c *Client) handleCallbackUpdate(update *UpdateBotCallbackQuery) {
 	for _, handle := range c.dispatcher.callbackHandles {
 		if handle.IsMatch(update.Data) {
-			go func(h callbackHandle) {
+			h := handle
+			c.runHandler(func() {
 				defer c.NewRecovery()()
 				if err := h.Handler(packCallbackQuery(c, update)); err != nil {
 					c.Log.Error("updates.dispatcher.CallbackQuery -", err)
 				}
-			}(handle)
+			})
 		}
 	}
 }
@@ -255,60 +322,119 @@ func (c *Client) handleCallbackUpdate(update *UpdateBotCallbackQuery) {
 func (c *Client) handleInlineCallbackUpdate(update *UpdateInlineBotCallbackQuery) {
 	for _, handle := range c.dispatcher.inlineCallbackHandles {
 		if handle.IsMatch(update.Data) {
-			go func(h inlineCallbackHandle) {
+			h := handle
+			c.runHandler(func() {
 				defer c.NewRecovery()()
 				if err := h.Handler(packInlineCallbackQuery(c, update)); err != nil {
 					c.Log.Error("updates.dispatcher.InlineCallbackQuery -", err)
 				}
-			}(handle)
+			})
 		}
 	}
 }
 
 func (c *Client) handleParticipantUpdate(update *UpdateChannelParticipant) {
+	if len(c.dispatcher.participantHandles) == 0 {
+		return
+	}
+	// resolve the channel and involved users once, before dispatching
+	packed := packChannelParticipant(c, update)
 	for _, handle := range c.dispatcher.participantHandles {
-		go func(h participantHandle) {
+		h := handle
+		c.runHandler(func() {
 			defer c.NewRecovery()()
-			if err := h.Handler(packChannelParticipant(c, update)); err != nil {
+			if err := h.Handler(packed); err != nil {
 				c.Log.Error("updates.dispatcher.ParticipantUpdate -", err)
 			}
-		}(handle)
+		})
 	}
 }
 
 func (c *Client) handleInlineUpdate(update *UpdateBotInlineQuery) {
 	for _, handle := range c.dispatcher.inlineHandles {
 		if handle.IsMatch(update.Query) {
-			go func(h inlineHandle) {
+			h := handle
+			c.runHandler(func() {
 				defer c.NewRecovery()()
 				if err := h.Handler(packInlineQuery(c, update)); err != nil {
 					c.Log.Error("updates.dispatcher.InlineQuery -", err)
 				}
-			}(handle)
+			})
 		}
 	}
 }
 
 func (c *Client) handleDeleteUpdate(update Update) {
 	for _, handle := range c.dispatcher.messageDeleteHandles {
-		go func(h messageDeleteHandle) {
+		h := handle
+		c.runHandler(func() {
 			defer c.NewRecovery()()
 			if err := h.Handler(packDeleteMessage(c, update)); err != nil {
 				c.Log.Error("updates.dispatcher.DeleteUpdate -", err)
 			}
-		}(handle)
+		})
+	}
+}
+
+func (c *Client) handlePollUpdate(update *UpdateMessagePoll) {
+	// the poll is remembered even without handlers, for the votes that follow
+	packed := packPollUpdate(c, update)
+	for _, handle := range c.dispatcher.pollHandles {
+		h := handle
+		c.runHandler(func() {
+			defer c.NewRecovery()()
+			if err := h.Handler(packed); err != nil {
+				c.Log.Error("updates.dispatcher.PollUpdate -", err)
+			}
+		})
+	}
+}
+
+func (c *Client) handlePollVoteUpdate(update *UpdateMessagePollVote) {
+	for _, handle := range c.dispatcher.pollVoteHandles {
+		h := handle
+		c.runHandler(func() {
+			defer c.NewRecovery()()
+			if err := h.Handler(packPollVote(c, update)); err != nil {
+				c.Log.Error("updates.dispatcher.PollVote -", err)
+			}
+		})
+	}
+}
+
+func (c *Client) handleJoinRequestUpdate(update Update) {
+	for _, handle := range c.dispatcher.joinRequestHandles {
+		h := handle
+		c.runHandler(func() {
+			defer c.NewRecovery()()
+			if err := h.Handler(packJoinRequest(c, update)); err != nil {
+				c.Log.Error("updates.dispatcher.JoinRequest -", err)
+			}
+		})
 	}
 }
 
 func (c *Client) handleRawUpdate(update Update) {
+	// catch-all handlers finish before the typed ones start
 	for _, handle := range c.dispatcher.rawHandles {
-		if reflect.TypeOf(update) == reflect.TypeOf(handle.updateType) {
-			go func(h rawHandle) {
+		if handle.updateType == nil {
+			func() {
+				defer c.NewRecovery()()
+				if err := handle.Handler(update, c); err != nil {
+					c.Log.Error("updates.dispatcher.RawUpdate -", err)
+				}
+			}()
+		}
+	}
+	for _, handle := range c.dispatcher.rawHandles {
+		if handle.updateType != nil && reflect.TypeOf(update) == reflect.TypeOf(handle.updateType) {
+			h := handle
+			c.runHandler(func() {
 				defer c.NewRecovery()()
 				if err := h.Handler(update, c); err != nil {
 					c.Log.Error("updates.dispatcher.RawUpdate -", err)
 				}
-			}(handle)
+			})
 		}
 	}
 }
@@ -346,30 +472,35 @@ func (e *messageEditHandle) IsMatch(text string) bool {
 }
 
 func (h *callbackHandle) IsMatch(data []byte) bool {
-	switch pattern := h.Pattern.(type) {
-	case string:
-		if pattern == OnCallbackQuery {
-			return true
-		}
-		p := regexp.MustCompile(pattern)
-		return p.Match(data) || strings.HasPrefix(string(data), pattern)
-	case *regexp.Regexp:
-		return pattern.Match(data)
-	default:
-		return false
+	if pattern, ok := h.Pattern.(string); ok && pattern == OnCallbackQuery {
+		return true
 	}
+	return matchCallbackData(h.Pattern, data)
 }
 
 func (h *inlineCallbackHandle) IsMatch(data []byte) bool {
-	switch pattern := h.Pattern.(type) {
+	if pattern, ok := h.Pattern.(string); ok && pattern == OnInlineCallbackQuery {
+		return true
+	}
+	return matchCallbackData(h.Pattern, data)
+}
+
+// CallbackPrefix is a callback handler pattern matching the data starting with it,
+// e.g. CallbackPrefix("page:") handles "page:1" and "page:2"
+type CallbackPrefix string
+
+// matchCallbackData matches callback data against a string (exact), a CallbackPrefix
+// or a *regexp.Regexp
+func matchCallbackData(pattern interface{}, data []byte) bool {
+	switch pattern := pattern.(type) {
 	case string:
-		if pattern == OnInlineCallbackQuery {
-			return true
-		}
-		p := regexp.MustCompile(pattern)
-		return p.Match(data) || strings.HasPrefix(string(data), pattern)
+		return string(data) == pattern
+	case CallbackPrefix:
+		return strings.HasPrefix(string(data), string(pattern))
 	case *regexp.Regexp:
 		return pattern.Match(data)
+	case []byte:
+		return bytes.Equal(data, pattern)
 	default:
 		return false
 	}
@@ -416,6 +547,12 @@ func (h *messageHandle) runFilterChain(m *NewMessage) bool {
 					return false
 				}
 			}
+			if filter.Text != nil && !filter.Text.MatchString(m.Text()) {
+				return false
+			}
+			if filter.Func != nil && !filter.Func(m) {
+				return false
+			}
 			if filter.Users != nil && len(filter.Users) > 0 {
 				actUsers = filter.Users
 			}
@@ -428,31 +565,24 @@ func (h *messageHandle) runFilterChain(m *NewMessage) bool {
 		}
 	}
 
-	var peerCheckPassed bool
-
-	if inSlice(m.SenderID(), actUsers) {
-		if actAsBlacklist {
-			return false
-		}
-		peerCheckPassed = true
-	}
-	if inSlice(m.ChatID(), actGroups) {
-		if actAsBlacklist {
-			return false
-		}
-		peerCheckPassed = true
+	inUsers, inChats := inSlice(m.SenderID(), actUsers), inSlice(m.ChatID(), actGroups)
+	if actAsBlacklist {
+		return !inUsers && !inChats
 	}
-
-	if !actAsBlacklist && (len(actUsers) > 0 || len(actGroups) > 0) && !peerCheckPassed {
+	// users and chats are separate filters, both have to pass
+	if len(actUsers) > 0 && !inUsers || len(actGroups) > 0 && !inChats {
 		return false
 	}
-
 	return true
 }
 
+// Filter restricts the messages a handler runs for, a handler with several filters
+// only runs for messages passing all of them
 type Filter struct {
 	Private, Group, Channel, Media, Command, Reply, Forward, FromBot, Blacklist bool
 	Users, Chats                                                                []int64
+	Text                                                                        *regexp.Regexp
+	Func                                                                        func(m *NewMessage) bool
 }
 
 var (
@@ -471,8 +601,43 @@ var (
 	FilterChats = func(chats ...int64) Filter {
 		return Filter{Chats: chats}
 	}
+	FilterText = func(pattern string) Filter {
+		p, err := regexp.Compile(pattern)
+		if err != nil {
+			// an invalid pattern never matches instead of panicking
+			utils.NewLogger("gogram").SetLevel(LIB_LOG_LEVEL).Error("invalid text filter ", pattern, ": ", err)
+			return Filter{Func: func(*NewMessage) bool { return false }}
+		}
+		return Filter{Text: p}
+	}
+	FilterFunc = func(f func(m *NewMessage) bool) Filter {
+		return Filter{Func: f}
+	}
 )
 
+// Filters groups the built-in filters, e.g
+//
+//	client.AddMessageHandler(OnNewMessage, handler, Filters.Private, Filters.FromUser(id))
+var Filters = struct {
+	Private, Group, Channel, Media, Command, Reply, Forward, FromBot, Blacklist Filter
+	// FromUser passes messages sent by any of the users
+	FromUser func(users ...int64) Filter
+	// InChat passes messages sent in any of the chats
+	InChat func(chats ...int64) Filter
+	// Text passes messages whose text matches the regular expression, an invalid one is logged and never matches
+	Text func(pattern string) Filter
+	// Func passes messages f returns true for
+	Func func(f func(m *NewMessage) bool) Filter
+}{
+	Private: FilterPrivate, Group: FilterGroup, Channel: FilterChannel, Media: FilterMedia,
+	Command: FilterCommand, Reply: FilterReply, Forward: FilterForward, FromBot: FilterFromBot,
+	Blacklist: FilterBlacklist,
+	FromUser:  FilterUsers,
+	InChat:    FilterChats,
+	Text:      FilterText,
+	Func:      FilterFunc,
+}
+
 func (c *Client) AddMessageHandler(pattern interface{}, handler func(m *NewMessage) error, filters ...Filter) messageHandle {
 	var messageFilters []Filter
 	if len(filters) > 0 {
@@ -483,6 +648,22 @@ func (c *Client) AddMessageHandler(pattern interface{}, handler func(m *NewMessa
 	return handle
 }
 
+// AddCommandHandler handles messages starting with the bot command, e.g "start" for
+// "/start" or "/start@botusername". Commands mentioning another bot are ignored.
+// The parsed command and its arguments are in m.Command and m.CommandArgs.
+func (c *Client) AddCommandHandler(command string, handler func(m *NewMessage) error, filters ...Filter) messageHandle {
+	command = strings.TrimPrefix(command, "/")
+	isCommand := FilterFunc(func(m *NewMessage) bool {
+		return strings.EqualFold(m.Command, command)
+	})
+	return c.AddMessageHandler(OnNewMessage, handler, append(filters, isCommand)...)
+}
+
+// Handle updates categorized as "UpdateDeleteMessages"
+//
+// Included Updates:
+//   - Messages Deleted (private chats and basic groups)
+//   - Channel Messages Deleted
 func (c *Client) AddDeleteHandler(pattern interface{}, handler func(d *DeleteMessage) error) messageDeleteHandle {
 	handle := messageDeleteHandle{
 		Pattern: pattern,
@@ -525,6 +706,9 @@ func (c *Client) AddInlineHandler(pattern interface{}, handler func(m *InlineQue
 
 // Handle updates categorized as "UpdateBotCallbackQuery"
 //
+// The pattern is OnCallbackQuery to match any data, a string matching data exactly,
+// a CallbackPrefix matching the start of the data, or a *regexp.Regexp.
+//
 // Included Updates:
 //   - Callback Query
 func (c *Client) AddCallbackHandler(pattern interface{}, handler func(m *CallbackQuery) error) callbackHandle {
@@ -558,71 +742,155 @@ func (c *Client) AddParticipantHandler(handler func(m *ParticipantUpdate) error)
 	return handle
 }
 
+// OnChatMember is an alias for AddParticipantHandler,
+// handlers receive the old and new participant states along with the actor of the change.
+func (c *Client) OnChatMember(handler func(m *ParticipantUpdate) error) participantHandle {
+	return c.AddParticipantHandler(handler)
+}
+
+// AddPollHandler handles updates of the results of polls, the options of the
+// results carry their text when the poll was sent or seen by the client
+func (c *Client) AddPollHandler(handler func(p *PollUpdate) error) pollHandle {
+	handle := pollHandle{Handler: handler}
+	c.dispatcher.pollHandles = append(c.dispatcher.pollHandles, handle)
+	return handle
+}
+
+// AddPollVoteHandler handles the votes of users in public polls sent by the bot
+func (c *Client) AddPollVoteHandler(handler func(v *PollVote) error) pollVoteHandle {
+	handle := pollVoteHandle{Handler: handler}
+	c.dispatcher.pollVoteHandles = append(c.dispatcher.pollVoteHandles, handle)
+	return handle
+}
+
+// AddJoinRequestHandler handles the requests to join chats whose invite links need
+// approval: bots get each request, admin accounts the changes of the pending requests.
+func (c *Client) AddJoinRequestHandler(handler func(r *JoinRequest) error) joinRequestHandle {
+	handle := joinRequestHandle{Handler: handler}
+	c.dispatcher.joinRequestHandles = append(c.dispatcher.joinRequestHandles, handle)
+	return handle
+}
+
+// Handle updates of the type of updateType, like &UpdateBotMessageReaction{},
+// or every update when updateType is nil.
+//
+// Handlers for every update (see OnAnyUpdate) run one after another and all
+// return before the handlers of the update's type start, each in its own goroutine.
 func (c *Client) AddRawHandler(updateType Update, handler func(m Update, c *Client) error) rawHandle {
 	handle := rawHandle{updateType: updateType, Handler: handler}
 	c.dispatcher.rawHandles = append(c.dispatcher.rawHandles, handle)
 	return handle
 }
 
+// OnAnyUpdate handles every update received, useful to log them or find out which
+// updates a chat produces, it's AddRawHandler with a nil update type
+func (c *Client) OnAnyUpdate(handler func(m Update, c *Client) error) rawHandle {
+	return c.AddRawHandler(nil, handler)
+}
+
 // Sort and Handle all the Incoming Updates
 // Many more types to be added
 func HandleIncomingUpdates(u interface{}, c *Client) bool {
-UpdateTypeSwitching:
+	if c.stopped() {
+		return false
+	}
 	switch upd := u.(type) {
 	case *UpdatesObj:
-		go cache.UpdatePeersToCache(upd.Users, upd.Chats)
-		for _, update := range upd.Updates {
-			switch update := update.(type) {
-			case *UpdateNewMessage:
-				go c.handleMessageUpdate(update.Message)
-			case *UpdateNewChannelMessage:
-				go c.handleMessageUpdate(update.Message)
-			case *UpdateNewScheduledMessage:
-				go c.handleMessageUpdate(update.Message)
-			case *UpdateEditMessage:
-				go c.handleEditUpdate(update.Message)
-			case *UpdateEditChannelMessage:
-				go c.handleEditUpdate(update.Message)
-			case *UpdateBotInlineQuery:
-				go c.handleInlineUpdate(update)
-			case *UpdateBotCallbackQuery:
-				go c.handleCallbackUpdate(update)
-			case *UpdateInlineBotCallbackQuery:
-				go c.handleInlineCallbackUpdate(update)
-			case *UpdateChannelParticipant:
-				go c.handleParticipantUpdate(update)
-			case *UpdateDeleteChannelMessages:
-				go c.handleDeleteUpdate(update)
-			case *UpdateDeleteMessages:
-				go c.handleDeleteUpdate(update)
-			}
-			go c.handleRawUpdate(update)
-		}
+		c.dispatchUpdates(c.updates.filter(upd.Updates, upd.Seq, upd.Seq, upd.Date), upd.Users, upd.Chats)
+	case *UpdatesCombined:
+		c.dispatchUpdates(c.updates.filter(upd.Updates, upd.SeqStart, upd.Seq, upd.Date), upd.Users, upd.Chats)
 	case *UpdateShort:
-		switch upd := upd.Update.(type) {
-		case *UpdateNewMessage:
-			go c.handleMessageUpdateW(upd.Message, upd.Pts)
-		case *UpdateNewChannelMessage:
-			go c.handleMessageUpdateW(upd.Message, upd.Pts)
+		if c.updates.applyUpdate(upd.Update) {
+			c.dispatchUpdates([]Update{upd.Update}, nil, nil)
 		}
-		go c.handleRawUpdate(upd.Update)
 	case *UpdateShortMessage:
-		go c.handleMessageUpdateW(&MessageObj{Out: upd.Out, Mentioned: upd.Mentioned, Message: upd.Message, MediaUnread: upd.MediaUnread, FromID: getPeerUser(upd.UserID), PeerID: getPeerUser(upd.UserID), Date: upd.Date, Entities: upd.Entities}, upd.Pts)
+		if c.updates.applyPts(upd.Pts, upd.PtsCount) && !c.isDuplicate(upd) {
+			c.dispatchUpdate(updateChatID(upd), func() {
+				c.handleMessageUpdateW(&MessageObj{Out: upd.Out, Mentioned: upd.Mentioned, Message: upd.Message, MediaUnread: upd.MediaUnread, FromID: getPeerUser(upd.UserID), PeerID: getPeerUser(upd.UserID), Date: upd.Date, Entities: upd.Entities}, upd.Pts)
+			})
+		}
 	case *UpdateShortChatMessage:
-		go c.handleMessageUpdateW(&MessageObj{Out: upd.Out, Mentioned: upd.Mentioned, Message: upd.Message, MediaUnread: upd.MediaUnread, FromID: getPeerUser(upd.FromID), PeerID: getPeerUser(upd.ChatID), Date: upd.Date, Entities: upd.Entities}, upd.Pts)
+		if c.updates.applyPts(upd.Pts, upd.PtsCount) && !c.isDuplicate(upd) {
+			c.dispatchUpdate(updateChatID(upd), func() {
+				c.handleMessageUpdateW(&MessageObj{Out: upd.Out, Mentioned: upd.Mentioned, Message: upd.Message, MediaUnread: upd.MediaUnread, FromID: getPeerUser(upd.FromID), PeerID: getPeerUser(upd.ChatID), Date: upd.Date, Entities: upd.Entities}, upd.Pts)
+			})
+		}
 	case *UpdateShortSentMessage:
-		go c.handleMessageUpdateW(&MessageObj{Out: upd.Out, Date: upd.Date, Media: upd.Media, Entities: upd.Entities}, upd.Pts)
-	case *UpdatesCombined:
-		u = upd.Updates
-		go cache.UpdatePeersToCache(upd.Users, upd.Chats)
-		goto UpdateTypeSwitching
+		if c.updates.applyPts(upd.Pts, upd.PtsCount) {
+			c.dispatchUpdate(0, func() {
+				c.handleMessageUpdateW(&MessageObj{Out: upd.Out, Date: upd.Date, Media: upd.Media, Entities: upd.Entities}, upd.Pts)
+			})
+		}
 	case *UpdatesTooLong:
+		go func() {
+			if err := c.updates.sync(); err != nil {
+				c.Log.Error(errors.Wrap(err, "fetching missed updates"))
+			}
+		}()
 	default:
 		c.Log.Warn("Ignoring Unknown Update Type: ", u)
 	}
 	return true
 }
 
+// dispatchUpdates caches the users and chats of the updates and passes them to the handlers
+func (c *Client) dispatchUpdates(updates []Update, users []User, chats []Chat) {
+	for _, update := range updates {
+		switch u := update.(type) {
+		case *UpdateNewMessage:
+			c.Cache.rememberOrigins(u.Message)
+		case *UpdateNewChannelMessage:
+			c.Cache.rememberOrigins(u.Message)
+		}
+	}
+	c.Cache.UpdatePeersToCache(users, chats)
+	for _, update := range updates {
+		if c.isDuplicate(update) {
+			continue
+		}
+		c.Cache.invalidateFull(update)
+		update := update
+		c.dispatchUpdate(updateChatID(update), func() {
+			c.handleUpdate(update)
+		})
+	}
+}
+
+// handleUpdate runs the handlers of an update, then its raw handlers
+func (c *Client) handleUpdate(update Update) {
+	switch update := update.(type) {
+	case *UpdateNewMessage:
+		c.handleMessageUpdate(update.Message)
+	case *UpdateNewChannelMessage:
+		c.handleMessageUpdate(update.Message)
+	case *UpdateNewScheduledMessage:
+		c.handleMessageUpdate(update.Message)
+	case *UpdateEditMessage:
+		c.handleEditUpdate(update.Message)
+	case *UpdateEditChannelMessage:
+		c.handleEditUpdate(update.Message)
+	case *UpdateBotInlineQuery:
+		c.handleInlineUpdate(update)
+	case *UpdateBotCallbackQuery:
+		c.handleCallbackUpdate(update)
+	case *UpdateInlineBotCallbackQuery:
+		c.handleInlineCallbackUpdate(update)
+	case *UpdateChannelParticipant:
+		c.handleParticipantUpdate(update)
+	case *UpdateMessagePoll:
+		c.handlePollUpdate(update)
+	case *UpdateMessagePollVote:
+		c.handlePollVoteUpdate(update)
+	case *UpdateBotChatInviteRequester, *UpdatePendingJoinRequests:
+		c.handleJoinRequestUpdate(update)
+	case *UpdateDeleteChannelMessages:
+		c.handleDeleteUpdate(update)
+	case *UpdateDeleteMessages:
+		c.handleDeleteUpdate(update)
+	}
+	c.handleRawUpdate(update)
+}
+
 func (c *Client) GetDifference(Pts int32, Limit int32) (Message, error) {
 	c.Logger.Debug("updates.getDifference: [pts: ", Pts, " limit: ", Limit, "]")
 
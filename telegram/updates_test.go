@@ -0,0 +1,495 @@
+package telegram
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/roj1512/gogram/internal/utils"
+)
+
+func TestCallbackHandleIsMatch(t *testing.T) {
+	tests := []struct {
+		pattern interface{}
+		data    string
+		match   bool
+	}{
+		{OnCallbackQuery, "anything", true},
+		{"yes", "yes", true},
+		{"1", "1", true},
+		{"1", "10", false},
+		{"1", "21", false},
+		{"1", "x1y", false},
+		{"page_", "page_2", false},
+		{CallbackPrefix("page_"), "page_2", true},
+		{CallbackPrefix("page_"), "next", false},
+		{`^vote:\d+$`, "vote:12", false},
+		{"open(", "open(", true},
+		{"open(", "close", false},
+		{regexp.MustCompile(`^del:(\d+)$`), "del:5", true},
+		{regexp.MustCompile(`^del:(\d+)$`), "del:x", false},
+	}
+	for _, tt := range tests {
+		h := &callbackHandle{Pattern: tt.pattern}
+		if got := h.IsMatch([]byte(tt.data)); got != tt.match {
+			t.Errorf("pattern %v, data %q: got %v", tt.pattern, tt.data, got)
+		}
+	}
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	c := &Client{dispatcher: &UpdateDispatcher{}}
+	var calls []string
+	c.UseMiddleware(func(next HandlerFunc) HandlerFunc {
+		return func(m *NewMessage) error {
+			calls = append(calls, "first")
+			return next(m)
+		}
+	}, func(next HandlerFunc) HandlerFunc {
+		return func(m *NewMessage) error {
+			calls = append(calls, "second")
+			if m.ID == 0 {
+				return errors.New("unauthorized")
+			}
+			return next(m)
+		}
+	})
+	handler := c.dispatcher.wrapMessageHandler(func(m *NewMessage) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+
+	if err := handler(&NewMessage{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, ",") != "first,second,handler" {
+		t.Fatalf("unexpected order %v", calls)
+	}
+
+	calls = nil
+	if err := handler(&NewMessage{}); err == nil {
+		t.Fatal("expected the middleware error")
+	}
+	if strings.Join(calls, ",") != "first,second" {
+		t.Fatalf("handler ran after the middleware aborted: %v", calls)
+	}
+}
+
+func TestMessageFilters(t *testing.T) {
+	private := &NewMessage{Message: &MessageObj{Message: "/start now", PeerID: &PeerUser{UserID: 10}}}
+	group := &NewMessage{Message: &MessageObj{Message: "hello", PeerID: &PeerChat{ChatID: 20}, FromID: &PeerUser{UserID: 10}}}
+
+	tests := []struct {
+		filters []Filter
+		msg     *NewMessage
+		pass    bool
+	}{
+		{[]Filter{Filters.Private}, private, true},
+		{[]Filter{Filters.Private}, group, false},
+		{[]Filter{Filters.Private, Filters.FromUser(10)}, private, true},
+		{[]Filter{Filters.Private, Filters.FromUser(11)}, private, false},
+		{[]Filter{Filters.Text(`^/start`)}, private, true},
+		{[]Filter{Filters.Text(`^/start`)}, group, false},
+		{[]Filter{Filters.Text(`(`)}, private, false},
+		{[]Filter{Filters.FromUser(10), Filters.InChat(20)}, group, true},
+		{[]Filter{Filters.FromUser(10), Filters.InChat(21)}, group, false},
+		{[]Filter{Filters.Blacklist, Filters.FromUser(10)}, group, false},
+		{[]Filter{Filters.Func(func(m *NewMessage) bool { return m.ChatID() == 20 })}, group, true},
+	}
+	for i, tt := range tests {
+		h := &messageHandle{Filters: tt.filters}
+		if got := h.runFilterChain(tt.msg); got != tt.pass {
+			t.Errorf("case %d: got %v, want %v", i, got, tt.pass)
+		}
+	}
+}
+
+func TestUpdateGapRecovery(t *testing.T) {
+	requested := make(chan *UpdatesGetDifferenceParams, 1)
+	dispatched := make(chan []Update, 1)
+	s := &updateState{
+		channels:   make(map[int64]int32),
+		recovering: make(map[int64]bool),
+		missed:     make(map[int64]bool),
+		getDifference: func(params *UpdatesGetDifferenceParams) (UpdatesDifference, error) {
+			requested <- params
+			return &UpdatesDifferenceObj{
+				NewMessages: []Message{&MessageObj{ID: 3}, &MessageObj{ID: 4}, &MessageObj{ID: 5}},
+				State:       &UpdatesState{Pts: 15, Date: 100},
+			}, nil
+		},
+		dispatch: func(updates []Update, _ []User, _ []Chat) {
+			dispatched <- updates
+		},
+		log: utils.NewLogger("test").SetLevel("error"),
+	}
+	s.setState(&UpdatesState{Pts: 10, Date: 90})
+
+	newMessage := func(id, pts int32) Update {
+		return &UpdateNewMessage{Message: &MessageObj{ID: id}, Pts: pts, PtsCount: 1}
+	}
+	if kept := s.filter([]Update{newMessage(1, 11)}, 0, 0, 0); len(kept) != 1 {
+		t.Fatalf("update following the local pts was dropped")
+	}
+	if kept := s.filter([]Update{newMessage(1, 11)}, 0, 0, 0); len(kept) != 0 {
+		t.Fatalf("update already applied was dispatched again")
+	}
+	// pts 12 and 13 are missing
+	if kept := s.filter([]Update{newMessage(5, 14)}, 0, 0, 0); len(kept) != 0 {
+		t.Fatalf("update after a gap was dispatched")
+	}
+
+	select {
+	case params := <-requested:
+		if params.Pts != 11 || params.Date != 90 {
+			t.Errorf("getDifference from pts %d date %d, want 11 and 90", params.Pts, params.Date)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("getDifference was not called after a pts gap")
+	}
+	select {
+	case updates := <-dispatched:
+		if len(updates) != 3 {
+			t.Errorf("dispatched %d recovered updates, want 3", len(updates))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("recovered updates were not dispatched")
+	}
+	if kept := s.filter([]Update{newMessage(6, 16)}, 0, 0, 0); len(kept) != 1 {
+		t.Errorf("update following the recovered state was dropped")
+	}
+}
+
+func TestUpdateDifferenceTooLong(t *testing.T) {
+	var requested []int32
+	diffs := []UpdatesDifference{
+		&UpdatesDifferenceTooLong{Pts: 50},
+		&UpdatesDifferenceSlice{NewMessages: []Message{&MessageObj{ID: 1}}, IntermediateState: &UpdatesState{Pts: 60, Date: 95}},
+		&UpdatesDifferenceObj{NewMessages: []Message{&MessageObj{ID: 2}}, State: &UpdatesState{Pts: 70, Date: 100}},
+	}
+	var dispatched int
+	s := &updateState{
+		channels: make(map[int64]int32),
+		getDifference: func(params *UpdatesGetDifferenceParams) (UpdatesDifference, error) {
+			requested = append(requested, params.Pts)
+			diff := diffs[0]
+			diffs = diffs[1:]
+			return diff, nil
+		},
+		dispatch: func(updates []Update, _ []User, _ []Chat) {
+			dispatched += len(updates)
+		},
+		log: utils.NewLogger("test").SetLevel("error"),
+	}
+	s.setState(&UpdatesState{Pts: 10, Date: 90})
+	if err := s.fetchDifference(); err != nil {
+		t.Fatal(err)
+	}
+	// getDifference is called again after a too long or partial difference
+	if !reflect.DeepEqual(requested, []int32{10, 50, 60}) || dispatched != 2 || s.pts != 70 {
+		t.Errorf("requested from pts %v, dispatched %d, pts %d", requested, dispatched, s.pts)
+	}
+}
+
+func TestUpdateGapBeforeState(t *testing.T) {
+	requested := make(chan *UpdatesGetDifferenceParams, 1)
+	s := &updateState{
+		channels:   make(map[int64]int32),
+		recovering: make(map[int64]bool),
+		missed:     make(map[int64]bool),
+		getState: func() (*UpdatesState, error) {
+			return &UpdatesState{Pts: 20, Qts: 3, Date: 100}, nil
+		},
+		getDifference: func(params *UpdatesGetDifferenceParams) (UpdatesDifference, error) {
+			requested <- params
+			return &UpdatesDifferenceEmpty{Date: 100}, nil
+		},
+		dispatch: func([]Update, []User, []Chat) {},
+		log:      utils.NewLogger("test").SetLevel("error"),
+	}
+	newMessage := func(pts int32) Update {
+		return &UpdateNewMessage{Message: &MessageObj{}, Pts: pts, PtsCount: 1}
+	}
+	// the first update gives the pts, the date isn't known until getState
+	s.filter([]Update{newMessage(11)}, 0, 0, 0)
+	s.filter([]Update{newMessage(14)}, 0, 0, 0)
+	select {
+	case params := <-requested:
+		if params.Pts != 11 || params.Qts != 3 || params.Date != 100 {
+			t.Errorf("getDifference from %+v, want pts 11, qts 3 and date 100", params)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the gap was not fetched")
+	}
+
+	// the state fetched at startup seeds the sequence
+	s = &updateState{channels: make(map[int64]int32)}
+	s.observe(&UpdatesState{Pts: 20, Date: 100})
+	s.observe(&UpdatesState{Pts: 30, Date: 200})
+	if s.pts != 20 || s.date != 100 || !s.known {
+		t.Errorf("state %d %d %v after getState, want 20 100 true", s.pts, s.date, s.known)
+	}
+}
+
+func TestAnyUpdateHandler(t *testing.T) {
+	c := &Client{dispatcher: &UpdateDispatcher{}, Log: utils.NewLogger("test").SetLevel("error")}
+	var mu sync.Mutex
+	var seen []string
+	typed := make(chan []string, 1)
+	c.OnAnyUpdate(func(u Update, _ *Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, reflect.TypeOf(u).Elem().Name())
+		return nil
+	})
+	c.AddRawHandler(&UpdateBotMessageReaction{}, func(Update, *Client) error {
+		mu.Lock()
+		defer mu.Unlock()
+		typed <- append([]string(nil), seen...)
+		return nil
+	})
+
+	c.handleRawUpdate(&UpdateUserTyping{})
+	c.handleRawUpdate(&UpdateBotMessageReaction{})
+	select {
+	case got := <-typed:
+		if strings.Join(got, ",") != "UpdateUserTyping,UpdateBotMessageReaction" {
+			t.Errorf("catch-all handler saw %v before the typed handler ran", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("typed raw handler was not called")
+	}
+}
+
+func TestUpdateDedup(t *testing.T) {
+	c := &Client{dedup: newUpdateDedup(2)}
+	update := func(id int32) Update {
+		return &UpdateNewChannelMessage{Message: &MessageObj{ID: id, PeerID: &PeerChannel{ChannelID: 1}}}
+	}
+	if c.isDuplicate(update(1)) || !c.isDuplicate(update(1)) {
+		t.Fatal("the second delivery of an update was not dropped")
+	}
+	if c.isDuplicate(&UpdateNewMessage{Message: &MessageObj{ID: 1, PeerID: &PeerUser{UserID: 1}}}) {
+		t.Fatal("a message with the same ID in another chat was dropped")
+	}
+	c.isDuplicate(update(2))
+	if c.isDuplicate(update(1)) {
+		t.Fatal("update evicted from the cache was still dropped")
+	}
+	if c.isDuplicate(&UpdateUserTyping{}) || c.isDuplicate(&UpdateUserTyping{}) {
+		t.Fatal("update without an ID was dropped")
+	}
+
+	// a message delivered live as a short update and again by getDifference
+	if c.isDuplicate(&UpdateShortMessage{ID: 7, UserID: 5}) || !c.isDuplicate(&UpdateNewMessage{Message: &MessageObj{ID: 7, PeerID: &PeerUser{UserID: 5}}}) {
+		t.Error("a private message was dispatched twice")
+	}
+	if c.isDuplicate(&UpdateShortChatMessage{ID: 7, ChatID: 5}) || !c.isDuplicate(&UpdateNewMessage{Message: &MessageObj{ID: 7, PeerID: &PeerChat{ChatID: 5}}}) {
+		t.Error("a group message was dispatched twice")
+	}
+	edit := func(date int32) Update {
+		return &UpdateEditMessage{Message: &MessageObj{ID: 7, PeerID: &PeerUser{UserID: 5}, EditDate: date}}
+	}
+	if c.isDuplicate(edit(10)) || c.isDuplicate(edit(20)) || !c.isDuplicate(edit(20)) {
+		t.Error("edits aren't told apart by their date")
+	}
+
+	var wg sync.WaitGroup
+	var dropped atomic.Int32
+	c.dedup = newUpdateDedup(100)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := int32(0); id < 50; id++ {
+				if c.isDuplicate(update(id)) {
+					dropped.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := dropped.Load(); n != 7*50 {
+		t.Errorf("dropped %d concurrent deliveries, want %d", n, 7*50)
+	}
+}
+
+func TestUpdateShort(t *testing.T) {
+	c := answeringClient(t, func(req Object) (any, error) {
+		return nil, errors.New("unexpected request")
+	})
+	polls := make(chan *PollUpdate, 1)
+	c.AddPollHandler(func(p *PollUpdate) error {
+		polls <- p
+		return nil
+	})
+	callbacks := make(chan *CallbackQuery, 1)
+	c.AddCallbackHandler(OnCallbackQuery, func(q *CallbackQuery) error {
+		callbacks <- q
+		return nil
+	})
+
+	// updates wrapped in updateShort reach their typed handlers
+	HandleIncomingUpdates(&UpdateShort{Update: &UpdateMessagePoll{PollID: 3, Poll: &Poll{ID: 3}}}, c)
+	HandleIncomingUpdates(&UpdateShort{Update: &UpdateBotCallbackQuery{QueryID: 4, Peer: &PeerUser{UserID: 1}, Data: []byte("a")}}, c)
+	select {
+	case p := <-polls:
+		if p.PollID != 3 {
+			t.Errorf("got poll %d, want 3", p.PollID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the poll handler was not called")
+	}
+	select {
+	case q := <-callbacks:
+		if q.QueryID != 4 {
+			t.Errorf("got query %d, want 4", q.QueryID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the callback handler was not called")
+	}
+}
+
+func TestUpdateWorkers(t *testing.T) {
+	w := newUpdateWorkers(2)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var chatA []int
+	doneA := make(chan struct{})
+	w.run(1, func() {
+		<-release // a slow handler in chat 1
+		mu.Lock()
+		chatA = append(chatA, 1)
+		mu.Unlock()
+	})
+	w.run(1, func() {
+		mu.Lock()
+		chatA = append(chatA, 2)
+		mu.Unlock()
+		close(doneA)
+	})
+
+	doneB := make(chan struct{})
+	w.run(2, func() { close(doneB) })
+	select {
+	case <-doneB:
+	case <-time.After(2 * time.Second):
+		t.Fatal("update of chat 2 waited for the slow handler of chat 1")
+	}
+
+	close(release)
+	select {
+	case <-doneA:
+	case <-time.After(2 * time.Second):
+		t.Fatal("updates of chat 1 were not handled")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(chatA) != 2 || chatA[0] != 1 || chatA[1] != 2 {
+		t.Errorf("updates of chat 1 handled in order %v", chatA)
+	}
+}
+
+func TestUpdateWorkersDetach(t *testing.T) {
+	w := newUpdateWorkers(1)
+	next := make(chan struct{})
+	done := make(chan struct{})
+	w.run(1, func() {
+		// waits for the next update of its chat, like a conversation
+		w.detach(1)
+		<-next
+		close(done)
+	})
+	w.run(1, func() { close(next) })
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the update waited for was queued behind the handler waiting for it")
+	}
+
+	// the slot of the detached worker is free again
+	other := make(chan struct{})
+	w.run(2, func() { close(other) })
+	select {
+	case <-other:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the detached worker kept its slot")
+	}
+	w.detach(3) // no worker for the chat
+}
+
+func TestConversationWithWorkers(t *testing.T) {
+	c := answeringClient(t, func(req Object) (any, error) {
+		return nil, errors.New("unexpected request")
+	})
+	c.workers = newUpdateWorkers(1)
+	answers := make(chan string, 1)
+	var once sync.Once
+	c.AddMessageHandler("/ask", func(m *NewMessage) error {
+		once.Do(func() {
+			conv := NewConversation(c, &InputPeerUser{UserID: 7}, 2)
+			resp, err := conv.GetResponse()
+			if err != nil {
+				answers <- err.Error()
+				return
+			}
+			answers <- resp.Text()
+		})
+		return nil
+	})
+	message := func(id int32, text string) Update {
+		return &UpdateNewMessage{Message: &MessageObj{ID: id, Message: text, PeerID: &PeerUser{UserID: 7}}}
+	}
+	c.dispatchUpdates([]Update{message(1, "/ask")}, nil, nil)
+	// the answer is sent until the conversation waiting for it gets it
+	tick := time.NewTicker(20 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case answer := <-answers:
+			if answer != "fine" {
+				t.Errorf("got %q, want the next message", answer)
+			}
+			return
+		case <-tick.C:
+			c.dispatchUpdates([]Update{message(2, "fine")}, nil, nil)
+		}
+	}
+}
+
+func TestJoinRequestHandler(t *testing.T) {
+	c := &Client{dispatcher: &UpdateDispatcher{}, Cache: NewCache(), Log: utils.NewLogger("test").SetLevel("error")}
+	got := make(chan *JoinRequest, 2)
+	c.AddJoinRequestHandler(func(r *JoinRequest) error {
+		got <- r
+		return nil
+	})
+
+	c.handleUpdate(&UpdateBotChatInviteRequester{Peer: &PeerChannel{ChannelID: 10}, UserID: 5, About: "hi"})
+	c.handleUpdate(&UpdatePendingJoinRequests{Peer: &PeerChat{ChatID: 20}, RequestsPending: 3, RecentRequesters: []int64{5, 6}})
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-got:
+			switch r.OriginalUpdate.(type) {
+			case *UpdateBotChatInviteRequester:
+				if r.ChatID() != -1000000000010 || r.UserID != 5 || r.About != "hi" {
+					t.Errorf("bot join request = %+v", r)
+				}
+			case *UpdatePendingJoinRequests:
+				if r.ChatID() != -20 || r.UserID != 0 || r.Pending != 3 || len(r.RecentRequesters) != 2 {
+					t.Errorf("pending join requests = %+v", r)
+				}
+				if _, err := r.Approve(); err == nil {
+					t.Error("approving the pending requests update should fail")
+				}
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("join request handler was not called")
+		}
+	}
+}
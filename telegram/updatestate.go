@@ -0,0 +1,401 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/roj1512/gogram/internal/utils"
+)
+
+// channelDifferenceLimit is the most messages fetched per updates.getChannelDifference request
+const channelDifferenceLimit = 100
+
+// updateState tracks the pts, qts, seq and date of the common update sequence and the pts
+// of every channel. An update that doesn't follow the last one applied means some were
+// missed, they are fetched with updates.getDifference (or getChannelDifference) and
+// dispatched to the handlers like any other update.
+type updateState struct {
+	sync.Mutex
+	pts, qts, seq, date int32
+	known               bool
+	channels            map[int64]int32
+	// recovering holds the sequences being fetched, 0 for the common one, and
+	// missed the ones that had another gap meanwhile, fetched again once done
+	recovering map[int64]bool
+	missed     map[int64]bool
+
+	getState             func() (*UpdatesState, error)
+	getDifference        func(*UpdatesGetDifferenceParams) (UpdatesDifference, error)
+	getChannelDifference func(channelID int64, pts int32) (UpdatesChannelDifference, error)
+	dispatch             func(updates []Update, users []User, chats []Chat)
+	log                  *utils.Logger
+}
+
+func newUpdateState(c *Client) *updateState {
+	return &updateState{
+		channels:      make(map[int64]int32),
+		recovering:    make(map[int64]bool),
+		missed:        make(map[int64]bool),
+		getState:      c.UpdatesGetState,
+		getDifference: c.UpdatesGetDifference,
+		getChannelDifference: func(channelID int64, pts int32) (UpdatesChannelDifference, error) {
+			channel, err := c.Cache.getChannelPeer(channelID)
+			if err != nil {
+				return nil, err
+			}
+			return c.UpdatesGetChannelDifference(&UpdatesGetChannelDifferenceParams{
+				Channel: channel,
+				Filter:  &ChannelMessagesFilterEmpty{},
+				Pts:     pts,
+				Limit:   channelDifferenceLimit,
+			})
+		},
+		dispatch: c.dispatchUpdates,
+		log:      c.Log,
+	}
+}
+
+// sync fetches what was missed while disconnected, or the current state if none is known yet
+func (s *updateState) sync() error {
+	s.Lock()
+	if s.known {
+		s.startRecovery(0)
+		s.Unlock()
+		return nil
+	}
+	s.Unlock()
+	state, err := s.getState()
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	s.setState(state)
+	s.Unlock()
+	return nil
+}
+
+// filter returns the updates to dispatch, applying their pts and dropping
+// the ones already applied or following a gap, which start a recovery
+func (s *updateState) filter(updates []Update, seqStart, seq, date int32) []Update {
+	s.Lock()
+	defer s.Unlock()
+	if seq != 0 && s.known {
+		if s.seq != 0 && seqStart > s.seq+1 {
+			s.startRecovery(0)
+		}
+		s.seq = max(s.seq, seq)
+	}
+	if date != 0 {
+		s.date = max(s.date, date)
+	}
+	kept := make([]Update, 0, len(updates))
+	for _, update := range updates {
+		if s.apply(update) {
+			kept = append(kept, update)
+		}
+	}
+	return kept
+}
+
+// applyUpdate applies the pts of a single update, reporting whether to dispatch it
+func (s *updateState) applyUpdate(update Update) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.apply(update)
+}
+
+// applyPts applies the pts of an update of the common sequence, reporting whether to dispatch it
+func (s *updateState) applyPts(pts, count int32) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.applyChannelPts(0, pts, count)
+}
+
+func (s *updateState) apply(update Update) bool {
+	if u, ok := update.(*UpdateChannelTooLong); ok {
+		s.channelTooLong(u.ChannelID)
+		return true
+	}
+	channelID, pts, count, ok := updatePts(update)
+	if !ok {
+		return true
+	}
+	return s.applyChannelPts(channelID, pts, count)
+}
+
+func (s *updateState) applyChannelPts(channelID int64, pts, count int32) bool {
+	local, known := s.pts, s.known
+	if channelID != 0 {
+		local, known = s.channels[channelID]
+	}
+	switch {
+	case !known || local+count == pts:
+		s.setPts(channelID, pts)
+		return true
+	case local+count > pts:
+		return false // already applied
+	}
+	s.log.Debug(fmt.Sprintf("update gap in sequence %d: local pts %d, update pts %d (count %d)", channelID, local, pts, count))
+	s.startRecovery(channelID)
+	return false
+}
+
+func (s *updateState) setPts(channelID int64, pts int32) {
+	if channelID != 0 {
+		s.channels[channelID] = pts
+		return
+	}
+	s.pts, s.known = pts, true
+}
+
+func (s *updateState) setState(state *UpdatesState) {
+	if state == nil {
+		return
+	}
+	s.pts, s.qts, s.seq, s.date, s.known = state.Pts, state.Qts, state.Seq, state.Date, true
+}
+
+// initState takes the state of updates.getState when none was fetched yet, keeping
+// the pts of the updates already applied so that a gap after them is still fetched
+func (s *updateState) initState(state *UpdatesState) {
+	switch {
+	case state == nil || s.date != 0:
+	case !s.known:
+		s.setState(state)
+	default:
+		s.qts, s.seq, s.date = state.Qts, state.Seq, state.Date
+	}
+}
+
+// observe applies the pts of the updates returned by a request, like a sent message
+func (s *updateState) observe(resp any) {
+	switch resp := resp.(type) {
+	case *UpdatesObj:
+		s.filter(resp.Updates, resp.Seq, resp.Seq, resp.Date)
+	case *UpdatesCombined:
+		s.filter(resp.Updates, resp.SeqStart, resp.Seq, resp.Date)
+	case *UpdateShort:
+		s.applyUpdate(resp.Update)
+	case *UpdateShortSentMessage:
+		s.applyPts(resp.Pts, resp.PtsCount)
+	case *UpdatesState:
+		s.Lock()
+		s.initState(resp)
+		s.Unlock()
+	}
+}
+
+// channelTooLong fetches the updates missed in a channel, if its pts is known
+func (s *updateState) channelTooLong(channelID int64) {
+	if _, known := s.channels[channelID]; known {
+		s.startRecovery(channelID)
+	}
+}
+
+// startRecovery fetches the updates missed in a sequence, unless it's already being fetched
+func (s *updateState) startRecovery(channelID int64) {
+	if s.recovering[channelID] {
+		s.missed[channelID] = true
+		return
+	}
+	s.recovering[channelID] = true
+	go s.recover(channelID)
+}
+
+func (s *updateState) recover(channelID int64) {
+	for {
+		var err error
+		if channelID == 0 {
+			err = s.fetchDifference()
+		} else {
+			err = s.fetchChannelDifference(channelID)
+		}
+		s.Lock()
+		if err != nil || !s.missed[channelID] {
+			delete(s.recovering, channelID)
+			delete(s.missed, channelID)
+			s.Unlock()
+			if err != nil {
+				s.log.Error(errors.Wrap(err, "fetching missed updates"))
+			}
+			return
+		}
+		delete(s.missed, channelID)
+		s.Unlock()
+	}
+}
+
+func (s *updateState) fetchDifference() error {
+	s.Lock()
+	date := s.date
+	s.Unlock()
+	if date == 0 {
+		// getDifference needs the date of the state, only known after getState
+		state, err := s.getState()
+		if err != nil {
+			return err
+		}
+		s.Lock()
+		s.initState(state)
+		s.Unlock()
+	}
+	for {
+		s.Lock()
+		params := &UpdatesGetDifferenceParams{Pts: s.pts, Qts: s.qts, Date: s.date}
+		s.Unlock()
+		diff, err := s.getDifference(params)
+		if err != nil {
+			return err
+		}
+		switch diff := diff.(type) {
+		case *UpdatesDifferenceEmpty:
+			s.Lock()
+			s.date, s.seq = diff.Date, diff.Seq
+			s.Unlock()
+			return nil
+		case *UpdatesDifferenceObj:
+			s.Lock()
+			s.setState(diff.State)
+			s.Unlock()
+			s.dispatchDifference(diff.NewMessages, diff.OtherUpdates, diff.Users, diff.Chats)
+			return nil
+		case *UpdatesDifferenceSlice:
+			s.Lock()
+			s.setState(diff.IntermediateState)
+			s.Unlock()
+			s.dispatchDifference(diff.NewMessages, diff.OtherUpdates, diff.Users, diff.Chats)
+		case *UpdatesDifferenceTooLong:
+			// too many were missed, continue from the pts telegram gives
+			s.Lock()
+			s.pts = diff.Pts
+			s.Unlock()
+		default:
+			return fmt.Errorf("unexpected difference: %s", reflect.TypeOf(diff))
+		}
+	}
+}
+
+func (s *updateState) fetchChannelDifference(channelID int64) error {
+	for {
+		s.Lock()
+		pts := s.channels[channelID]
+		s.Unlock()
+		diff, err := s.getChannelDifference(channelID, pts)
+		if err != nil {
+			return err
+		}
+		switch diff := diff.(type) {
+		case *UpdatesChannelDifferenceEmpty:
+			s.Lock()
+			s.channels[channelID] = diff.Pts
+			s.Unlock()
+			return nil
+		case *UpdatesChannelDifferenceObj:
+			s.Lock()
+			s.channels[channelID] = diff.Pts
+			s.Unlock()
+			s.dispatchDifference(diff.NewMessages, diff.OtherUpdates, diff.Users, diff.Chats)
+			if diff.Final {
+				return nil
+			}
+		case *UpdatesChannelDifferenceTooLong:
+			// too many were missed, continue from the latest messages
+			if dialog, ok := diff.Dialog.(*DialogObj); ok {
+				s.Lock()
+				s.channels[channelID] = dialog.Pts
+				s.Unlock()
+			}
+			s.dispatchDifference(diff.Messages, nil, diff.Users, diff.Chats)
+			return nil
+		default:
+			return fmt.Errorf("unexpected channel difference: %s", reflect.TypeOf(diff))
+		}
+	}
+}
+
+// dispatchDifference dispatches the messages and updates of a difference, the
+// pts they carry is already accounted for by the state that came with them
+func (s *updateState) dispatchDifference(messages []Message, other []Update, users []User, chats []Chat) {
+	updates := make([]Update, 0, len(messages)+len(other))
+	for _, msg := range messages {
+		if isChannelMessage(msg) {
+			updates = append(updates, &UpdateNewChannelMessage{Message: msg})
+		} else {
+			updates = append(updates, &UpdateNewMessage{Message: msg})
+		}
+	}
+	for _, update := range other {
+		if u, ok := update.(*UpdateChannelTooLong); ok {
+			s.Lock()
+			s.channelTooLong(u.ChannelID)
+			s.Unlock()
+			continue
+		}
+		updates = append(updates, update)
+	}
+	if len(updates) > 0 {
+		s.dispatch(updates, users, chats)
+	}
+}
+
+// updatePts returns the pts and pts_count of an update, and the channel
+// it belongs to (zero for the common sequence)
+func updatePts(update Update) (channelID int64, pts, count int32, ok bool) {
+	switch u := update.(type) {
+	case *UpdateNewMessage:
+		return 0, u.Pts, u.PtsCount, true
+	case *UpdateDeleteMessages:
+		return 0, u.Pts, u.PtsCount, true
+	case *UpdateEditMessage:
+		return 0, u.Pts, u.PtsCount, true
+	case *UpdateReadHistoryInbox:
+		return 0, u.Pts, u.PtsCount, true
+	case *UpdateReadHistoryOutbox:
+		return 0, u.Pts, u.PtsCount, true
+	case *UpdateReadMessagesContents:
+		return 0, u.Pts, u.PtsCount, true
+	case *UpdateWebPage:
+		return 0, u.Pts, u.PtsCount, true
+	case *UpdatePinnedMessages:
+		return 0, u.Pts, u.PtsCount, true
+	case *UpdateFolderPeers:
+		return 0, u.Pts, u.PtsCount, true
+	case *UpdateNewChannelMessage:
+		channelID := messageChannelID(u.Message)
+		return channelID, u.Pts, u.PtsCount, channelID != 0
+	case *UpdateEditChannelMessage:
+		channelID := messageChannelID(u.Message)
+		return channelID, u.Pts, u.PtsCount, channelID != 0
+	case *UpdateDeleteChannelMessages:
+		return u.ChannelID, u.Pts, u.PtsCount, true
+	case *UpdateChannelWebPage:
+		return u.ChannelID, u.Pts, u.PtsCount, true
+	case *UpdatePinnedChannelMessages:
+		return u.ChannelID, u.Pts, u.PtsCount, true
+	}
+	return 0, 0, 0, false
+}
+
+func messageChannelID(msg Message) int64 {
+	var peer Peer
+	switch msg := msg.(type) {
+	case *MessageObj:
+		peer = msg.PeerID
+	case *MessageService:
+		peer = msg.PeerID
+	case *MessageEmpty:
+		peer = msg.PeerID
+	}
+	if channel, ok := peer.(*PeerChannel); ok {
+		return channel.ChannelID
+	}
+	return 0
+}
+
+func isChannelMessage(msg Message) bool {
+	return messageChannelID(msg) != 0
+}
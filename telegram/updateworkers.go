@@ -0,0 +1,171 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import "sync"
+
+// updateWorkers handles updates on at most n goroutines, one chat at a time per
+// goroutine: updates of a chat are handled in the order they arrived, while
+// updates of other chats are handled by the other workers meanwhile
+type updateWorkers struct {
+	sync.Mutex
+	sem    chan struct{}
+	queues map[int64][]func()
+	// draining holds the worker handling each chat, until it's done or detached
+	draining map[int64]*chatWorker
+}
+
+type chatWorker struct {
+	detached bool
+}
+
+func newUpdateWorkers(n int) *updateWorkers {
+	return &updateWorkers{sem: make(chan struct{}, n), queues: make(map[int64][]func()), draining: make(map[int64]*chatWorker)}
+}
+
+// run queues job after the ones of the same chat, starting a worker for the chat if it has none
+func (w *updateWorkers) run(chatID int64, job func()) {
+	w.Lock()
+	queue, busy := w.queues[chatID]
+	w.queues[chatID] = append(queue, job)
+	w.Unlock()
+	if !busy {
+		go w.drain(chatID)
+	}
+}
+
+func (w *updateWorkers) drain(chatID int64) {
+	w.sem <- struct{}{}
+	worker := &chatWorker{}
+	w.Lock()
+	w.draining[chatID] = worker
+	for {
+		if worker.detached {
+			// another worker handles the chat now, the slot was freed by detach
+			w.Unlock()
+			return
+		}
+		queue := w.queues[chatID]
+		if len(queue) == 0 {
+			delete(w.queues, chatID)
+			delete(w.draining, chatID)
+			w.Unlock()
+			<-w.sem
+			return
+		}
+		w.queues[chatID] = queue[1:]
+		w.Unlock()
+		queue[0]()
+		w.Lock()
+	}
+}
+
+// detach lets the job running for a chat go on outside of the pool, the next
+// updates of the chat are handled by another worker instead of waiting for it
+func (w *updateWorkers) detach(chatID int64) {
+	w.Lock()
+	defer w.Unlock()
+	worker, ok := w.draining[chatID]
+	if !ok {
+		return
+	}
+	worker.detached = true
+	delete(w.draining, chatID)
+	<-w.sem
+	if len(w.queues[chatID]) > 0 {
+		go w.drain(chatID)
+	} else {
+		delete(w.queues, chatID)
+	}
+}
+
+// dispatchUpdate handles an update on its own goroutine, or queues it
+// to the worker pool when ClientConfig.UpdateWorkers is set
+func (c *Client) dispatchUpdate(chatID int64, handle func()) {
+	if c.workers == nil {
+		go handle()
+		return
+	}
+	c.workers.run(chatID, handle)
+}
+
+// runHandler runs a handler of an update, on its own goroutine unless the
+// update is handled by a worker, which runs its handlers one after another
+func (c *Client) runHandler(handler func()) {
+	if c.workers == nil {
+		go handler()
+		return
+	}
+	handler()
+}
+
+// releaseChat lets the updates of a chat be handled while a handler of the chat
+// waits for them, as a Conversation does, instead of queueing them behind it
+func (c *Client) releaseChat(peer InputPeer) {
+	if c.workers != nil {
+		c.workers.detach(inputPeerKey(peer))
+	}
+}
+
+// updateChatID returns the chat an update belongs to, updates of the same chat
+// are handled in order by the worker pool (zero when unknown)
+func updateChatID(update any) int64 {
+	switch u := update.(type) {
+	case *UpdateNewMessage:
+		return messagePeerKey(u.Message)
+	case *UpdateNewChannelMessage:
+		return messagePeerKey(u.Message)
+	case *UpdateNewScheduledMessage:
+		return messagePeerKey(u.Message)
+	case *UpdateEditMessage:
+		return messagePeerKey(u.Message)
+	case *UpdateEditChannelMessage:
+		return messagePeerKey(u.Message)
+	case *UpdateShortMessage:
+		return u.UserID
+	case *UpdateShortChatMessage:
+		return -u.ChatID
+	case *UpdateBotCallbackQuery:
+		return peerKey(u.Peer)
+	case *UpdateBotInlineQuery:
+		return u.UserID
+	case *UpdateInlineBotCallbackQuery:
+		return u.UserID
+	case *UpdateChannelParticipant:
+		return ChannelIDToPeerID(u.ChannelID)
+	case *UpdateBotChatInviteRequester:
+		return peerKey(u.Peer)
+	case *UpdatePendingJoinRequests:
+		return peerKey(u.Peer)
+	case *UpdateDeleteChannelMessages:
+		return ChannelIDToPeerID(u.ChannelID)
+	}
+	return 0
+}
+
+// inputPeerKey is the peerKey of the peer an input peer refers to
+func inputPeerKey(peer InputPeer) int64 {
+	switch peer := peer.(type) {
+	case *InputPeerUser:
+		return peer.UserID
+	case *InputPeerChat:
+		return -peer.ChatID
+	case *InputPeerChannel:
+		return ChannelIDToPeerID(peer.ChannelID)
+	case *InputPeerUserFromMessage:
+		return peer.UserID
+	case *InputPeerChannelFromMessage:
+		return ChannelIDToPeerID(peer.ChannelID)
+	}
+	return 0
+}
+
+func messagePeerKey(msg Message) int64 {
+	switch msg := msg.(type) {
+	case *MessageObj:
+		return peerKey(msg.PeerID)
+	case *MessageService:
+		return peerKey(msg.PeerID)
+	}
+	return 0
+}
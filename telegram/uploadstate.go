@@ -0,0 +1,119 @@
+// Copyright (c) 2024 RoseLoverX
+
+package telegram
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// UploadState is the progress of an upload, saved to UploadOptions.ResumeFile.
+// Parts are keyed by index, so the file id and part size must stay the same on resume.
+type UploadState struct {
+	FileID    int64   `json:"file_id"`
+	FileName  string  `json:"file_name"`
+	FileSize  int64   `json:"file_size"`
+	ChunkSize int32   `json:"chunk_size"`
+	Parts     int32   `json:"parts"`
+	Uploaded  []int32 `json:"uploaded"`
+}
+
+// ResumeUpload continues an interrupted upload from its resume file,
+// only the parts not uploaded yet are sent.
+//
+//	Params:
+//	  - file: The same file the upload was started with.
+//	  - resumeFile: The UploadOptions.ResumeFile of the interrupted upload.
+func (c *Client) ResumeUpload(file interface{}, resumeFile string, Opts ...*UploadOptions) (InputFile, error) {
+	opts := getVariadic(Opts, &UploadOptions{}).(*UploadOptions)
+	if file == nil {
+		return nil, errors.New("file can not be nil")
+	}
+	u := &Uploader{
+		Source:           file,
+		Client:           c,
+		Worker:           getInt(opts.Workers, opts.Threads),
+		progress:         opts.ProgressChan,
+		progressCallback: opts.ProgressCallback,
+		resumeFile:       resumeFile,
+		requireState:     true,
+		Meta: FileMeta{
+			FileName: opts.FileName,
+		},
+	}
+	return u.Upload()
+}
+
+// loadState reads the resume file, if any
+func (u *Uploader) loadState() (*UploadState, error) {
+	u.uploaded = make(map[int32]bool)
+	if u.resumeFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(u.resumeFile)
+	if err != nil {
+		if os.IsNotExist(err) && !u.requireState {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "reading upload state")
+	}
+	var state UploadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errors.Wrap(err, "decoding upload state")
+	}
+	if state.ChunkSize <= 0 {
+		return nil, errors.New("upload state has an invalid part size")
+	}
+	return &state, nil
+}
+
+// restoreState continues the upload of state, after the file was inspected by Init
+func (u *Uploader) restoreState(state *UploadState) error {
+	if state.FileSize != u.Meta.FileSize || state.Parts != u.Parts {
+		return errors.New("upload state doesn't match the file being uploaded")
+	}
+	u.FileID = state.FileID
+	for _, part := range state.Uploaded {
+		if part < 0 || part >= u.Parts || u.uploaded[part] {
+			continue
+		}
+		u.uploaded[part] = true
+		u.totalDone++
+		u.sent += min(int64(u.ChunkSize), u.Meta.FileSize-int64(part)*int64(u.ChunkSize))
+	}
+	u.Client.Log.Debug("resuming upload of ", u.Meta.FileName, ", ", len(u.uploaded), " of ", u.Parts, " parts already uploaded")
+	return nil
+}
+
+func (u *Uploader) isUploaded(part int32) bool {
+	u.progressMutex.Lock()
+	defer u.progressMutex.Unlock()
+	return u.uploaded[part]
+}
+
+// saveState writes the upload state to the resume file, the caller holds progressMutex
+func (u *Uploader) saveState() error {
+	state := UploadState{
+		FileID:    u.FileID,
+		FileName:  u.Meta.FileName,
+		FileSize:  u.Meta.FileSize,
+		ChunkSize: u.ChunkSize,
+		Parts:     u.Parts,
+		Uploaded:  make([]int32, 0, len(u.uploaded)),
+	}
+	for part := range u.uploaded {
+		state.Uploaded = append(state.Uploaded, part)
+	}
+	sort.Slice(state.Uploaded, func(i, j int) bool { return state.Uploaded[i] < state.Uploaded[j] })
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(u.resumeFile+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(u.resumeFile+".tmp", u.resumeFile)
+}
@@ -0,0 +1,97 @@
+package telegram
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/roj1512/gogram/internal/utils"
+)
+
+func TestResumeUpload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.bin")
+	if err := os.WriteFile(path, make([]byte, 10*1024+100), 0600); err != nil {
+		t.Fatal(err)
+	}
+	resumeFile := filepath.Join(dir, "file.upload")
+	c := &Client{Log: utils.NewLogger("test").SetLevel("error")}
+
+	var (
+		mu   sync.Mutex
+		sent []int32
+	)
+	newUploader := func(failAt int32) *Uploader {
+		return &Uploader{
+			Client:     c,
+			Source:     path,
+			ChunkSize:  1024,
+			Worker:     1,
+			Workers:    []*Client{c},
+			resumeFile: resumeFile,
+			savePart: func(_ *Client, part int32, _ []byte) error {
+				if part == failAt {
+					return errors.New("connection lost")
+				}
+				mu.Lock()
+				sent = append(sent, part)
+				mu.Unlock()
+				return nil
+			},
+		}
+	}
+
+	first := newUploader(4)
+	if _, err := first.Upload(); err == nil {
+		t.Fatal("expected the upload to fail at part 4")
+	}
+	if len(sent) != 4 {
+		t.Fatalf("expected parts 0-3 to be sent, got %v", sent)
+	}
+
+	sent = nil
+	second := newUploader(-1)
+	second.requireState = true
+	second.ChunkSize = 0 // taken from the resume file
+	if _, err := second.Upload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 7 || sent[0] != 4 || sent[6] != 10 {
+		t.Fatalf("expected only parts 4-10 to be re-sent, got %v", sent)
+	}
+	if second.FileID != first.FileID {
+		t.Fatal("resumed upload used a different file id")
+	}
+	if _, err := os.Stat(resumeFile); !os.IsNotExist(err) {
+		t.Fatal("resume file not removed after completion")
+	}
+}
+
+// benchmarkUpload uploads a 200MB buffer with a simulated round trip per part
+func benchmarkUpload(b *testing.B, workers int) {
+	data := make([]byte, 200*1024*1024)
+	c := &Client{Log: utils.NewLogger("bench").SetLevel("error")}
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		u := &Uploader{
+			Client:  c,
+			Source:  data,
+			Worker:  workers,
+			Workers: []*Client{c},
+			savePart: func(*Client, int32, []byte) error {
+				time.Sleep(2 * time.Millisecond)
+				return nil
+			},
+		}
+		if _, err := u.Upload(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUploadSequential(b *testing.B) { benchmarkUpload(b, 1) }
+func BenchmarkUpload4Workers(b *testing.B)   { benchmarkUpload(b, 4) }
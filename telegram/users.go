@@ -2,11 +2,12 @@ package telegram
 
 import (
 	"reflect"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
-// GetMe returns the current user
+// GetMe fetches the current user from telegram, see Me for the cached one
 func (c *Client) GetMe() (*UserObj, error) {
 	resp, err := c.UsersGetFullUser(&InputUserSelf{})
 	if err != nil {
@@ -16,9 +17,53 @@ func (c *Client) GetMe() (*UserObj, error) {
 	if !ok {
 		return nil, errors.New("got wrong response: " + reflect.TypeOf(resp).String())
 	}
+	c.setMe(user)
 	return user, nil
 }
 
+func (c *Client) setMe(user *UserObj) {
+	c.meMutex.Lock()
+	c.me = user
+	c.meMutex.Unlock()
+}
+
+// Me returns the logged in user, fetched once with GetMe and cached afterwards
+func (c *Client) Me() (*UserObj, error) {
+	c.meMutex.Lock()
+	me := c.me
+	c.meMutex.Unlock()
+	if me != nil {
+		return me, nil
+	}
+	return c.GetMe()
+}
+
+// selfUsernameRetry is how long selfUsername waits after a failed lookup before asking again
+const selfUsernameRetry = time.Minute
+
+// selfUsername returns the username of the logged in user, set at login or fetched once.
+// It's called while dispatching updates, so a failed lookup isn't retried for selfUsernameRetry.
+func (c *Client) selfUsername() string {
+	c.meMutex.Lock()
+	me, failed := c.me, c.meFailed
+	c.meMutex.Unlock()
+	if me != nil {
+		return me.Username
+	}
+	if time.Since(failed) < selfUsernameRetry {
+		return ""
+	}
+	me, err := c.GetMe()
+	if err != nil {
+		c.meMutex.Lock()
+		c.meFailed = time.Now()
+		c.meMutex.Unlock()
+		c.Log.Debug("getting self username: ", err)
+		return ""
+	}
+	return me.Username
+}
+
 type PhotosOptions struct {
 	MaxID  int64 `json:"max_id,omitempty"`
 	Offset int32 `json:"offset,omitempty"`
@@ -135,7 +180,6 @@ type DialogOptions struct {
 	Hash          int64     `json:"hash,omitempty"`
 }
 
-type CustomDialog struct{} // TODO
 // GetDialogs returns the dialogs of the user
 //
 //	Params:
@@ -208,6 +252,40 @@ func (c *Client) GetCommonChats(userID interface{}) ([]Chat, error) {
 	}
 }
 
+// GetFullUser returns the full info of a user, like their bio and common chats count,
+// cached for ClientConfig.FullInfoTTL or until an update about the user arrives
+//
+//	Params:
+//	 - userID: The user Identifier
+func (c *Client) GetFullUser(userID interface{}) (*UserFull, error) {
+	peer, err := c.GetSendablePeer(userID)
+	if err != nil {
+		return nil, err
+	}
+	var input InputUser
+	switch p := peer.(type) {
+	case *InputPeerUser:
+		if full, ok := c.Cache.getUserFull(p.UserID, time.Now()); ok {
+			return full, nil
+		}
+		input = &InputUserObj{UserID: p.UserID, AccessHash: p.AccessHash}
+	case *InputPeerSelf:
+		input = &InputUserSelf{}
+	default:
+		return nil, errors.New("peer is not a user")
+	}
+	resp, err := c.UsersGetFullUser(input)
+	if err != nil {
+		return nil, err
+	}
+	c.Cache.UpdatePeersToCache(resp.Users, resp.Chats)
+	if resp.FullUser == nil {
+		return nil, errors.New("empty full user")
+	}
+	c.Cache.setUserFull(resp.FullUser, time.Now())
+	return resp.FullUser, nil
+}
+
 // SetEmojiStatus sets the emoji status of the user
 //
 //	Params:
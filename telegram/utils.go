@@ -3,8 +3,10 @@
 package telegram
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"math/rand"
 	"net/http"
 	"net/url"
@@ -18,6 +20,7 @@ import (
 
 	"github.com/pkg/errors"
 	mtproto "github.com/roj1512/gogram"
+	"github.com/roj1512/gogram/internal/encoding/tl"
 )
 
 type Mime struct {
@@ -53,7 +56,17 @@ var (
 		{".xhtml", "application/xhtml+xml"}, {".xls", "application/vnd.ms-excel"}, {".xlsx", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
 		{".xml", "application/xml"}, {".xul", "application/vnd.mozilla.xul+xml"}, {".zip", "application/zip"},
 		{".3gp", "video/3gpp"}, {".3g2", "video/3gpp2"}, {".7z", "application/x-7z-compressed"}, {".tgs", "application/x-tgsticker"}, {".apk", "application/vnd.android.package-archive"},
+		{".mp4", "video/mp4"}, {".mov", "video/quicktime"}, {".mkv", "video/x-matroska"}, {".ogg", "audio/ogg"}, {".m4a", "audio/mp4"},
+		{".heic", "image/heic"}, {".heif", "image/heif"}, {".avif", "image/avif"},
 	}
+
+	// MimeSniffSize is the number of bytes read from a file to detect its mime type,
+	// when it can't be resolved from the file extension
+	MimeSniffSize = 512
+
+	// WebpAsPhoto sends webp images as photos, by default they're sent as documents
+	// so animated webp stickers keep their animation
+	WebpAsPhoto = false
 )
 
 func getErrorCode(err error) (int, int) {
@@ -78,15 +91,56 @@ func matchError(err error, str string) bool {
 }
 
 func matchRPCError(err error, str string) bool {
-	if err != nil {
-		e, isRpc := (err).(*mtproto.ErrResponseCode)
-		if isRpc {
-			return strings.Contains(e.Message, str)
-		}
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return strings.Contains(rpcErr.Message, str)
 	}
 	return false
 }
 
+// RPCError is the error returned by requests failing with an rpc_error,
+// use errors.As to get it from the errors returned by client methods
+type RPCError = mtproto.RPCError
+
+// ErrConnectionLost is returned by requests still waiting for a response when the
+// connection dropped, retry them once the client reconnected
+var ErrConnectionLost = mtproto.ErrConnectionLost
+
+// ErrRequestTimeout is returned by requests telegram did not answer within ClientConfig.RequestTimeout
+var ErrRequestTimeout = mtproto.ErrRequestTimeout
+
+// Metrics observes the requests made by a client, see ClientConfig.Metrics
+type Metrics = mtproto.Metrics
+
+// RateLimit limits the requests sent by a client, see ClientConfig.RateLimit
+type RateLimit = mtproto.RateLimit
+
+// Object is a TL object, like the Params of a request
+type Object = tl.Object
+
+// BatchError is returned by Client.Batch when some of the requests failed
+type BatchError = mtproto.BatchError
+
+// ConnectionState is the state of the connection to telegram, see Client.OnConnectionState
+type ConnectionState = mtproto.ConnectionState
+
+const (
+	Disconnected = mtproto.Disconnected
+	Connecting   = mtproto.Connecting
+	Connected    = mtproto.Connected
+	Reconnecting = mtproto.Reconnecting
+)
+
+// IsFloodWait reports whether err is a FLOOD_WAIT_X error, returning how long to wait
+func IsFloodWait(err error) (time.Duration, bool) {
+	return mtproto.IsFloodWait(err)
+}
+
+// IsMigrate reports whether err is a *_MIGRATE_X error, returning the DC to migrate to
+func IsMigrate(err error) (int, bool) {
+	return mtproto.IsMigrate(err)
+}
+
 func resolveMimeType(filePath string) (string, bool) {
 	if IsURL(filePath) {
 		if req, err := http.NewRequest("GET", filePath, nil); err == nil {
@@ -97,10 +151,10 @@ func resolveMimeType(filePath string) (string, bool) {
 					if resp.Header.Get("Content-Type") != "" {
 						return resp.Header.Get("Content-Type"), mimeIsPhoto(resp.Header.Get("Content-Type"))
 					}
-					var b = make([]byte, 512)
-					_, err = resp.Body.Read(b)
-					if err == nil {
-						mime := http.DetectContentType(b)
+					var b = make([]byte, mimeSniffSize())
+					n, err := io.ReadFull(resp.Body, b)
+					if n > 0 && (err == nil || err == io.ErrUnexpectedEOF) {
+						mime := sniffMimeType(b[:n])
 						return mime, mimeIsPhoto(mime)
 					}
 				}
@@ -115,25 +169,76 @@ func resolveMimeType(filePath string) (string, bool) {
 		return "", false
 	}
 	defer file.Close()
-	buffer := make([]byte, 512)
-	_, err = file.Read(buffer)
-	if err != nil {
+	buffer := make([]byte, mimeSniffSize())
+	n, err := io.ReadFull(file, buffer)
+	if n == 0 || (err != nil && err != io.ErrUnexpectedEOF) {
 		return "", false
 	}
-	mime := http.DetectContentType(buffer)
+	mime := sniffMimeType(buffer[:n])
 	return mime, mimeIsPhoto(mime)
 }
 
-func resolveExt(mime string) string {
+func mimeSniffSize() int {
+	if MimeSniffSize <= 0 {
+		return 512
+	}
+	return MimeSniffSize
+}
+
+// sniffMimeType detects the mime type from the file header, checking the container
+// formats http.DetectContentType gets wrong before falling back to it
+func sniffMimeType(b []byte) string {
+	switch {
+	case len(b) >= 12 && string(b[4:8]) == "ftyp":
+		switch string(b[8:12]) {
+		case "qt  ":
+			return "video/quicktime"
+		case "M4A ", "M4B ":
+			return "audio/mp4"
+		case "isom", "iso2", "iso5", "iso6", "avc1", "mp41", "mp42", "M4V ", "dash", "3gp5":
+			return "video/mp4"
+		case "heic", "heix", "heim", "heis":
+			return "image/heic"
+		case "mif1", "msf1", "heif":
+			return "image/heif"
+		case "avif", "avis":
+			return "image/avif"
+		}
+	case len(b) >= 12 && string(b[0:4]) == "RIFF" && string(b[8:12]) == "WEBP":
+		return "image/webp"
+	case len(b) >= 4 && string(b[0:4]) == "OggS":
+		if bytes.Contains(b, []byte("theora")) {
+			return "video/ogg"
+		}
+		return "audio/ogg"
+	case len(b) >= 4 && bytes.Equal(b[0:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		if bytes.Contains(b, []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	}
+	return http.DetectContentType(b)
+}
+
+// ExtensionFromMime returns the file extension of a mime type from MimeTypes, with the
+// leading dot, or an empty string when the mime type is unknown. Jpeg images get ".jpg".
+func ExtensionFromMime(mime string) string {
+	mime = strings.ToLower(strings.TrimSpace(strings.Split(mime, ";")[0]))
+	if mime == "image/jpeg" {
+		return ".jpg"
+	}
 	for _, mt := range MimeTypes {
-		if mt.Mime == mime {
-			return mt.Extension
+		for _, m := range strings.Fields(mt.Mime) {
+			if m == mime {
+				return mt.Extension
+			}
 		}
 	}
 	return ""
 }
 
 func matchMimeType(filePath string) string {
+	filePath = strings.ToLower(filePath)
 	for _, mt := range MimeTypes {
 		if strings.HasSuffix(filePath, mt.Extension) {
 			return mt.Mime
@@ -143,11 +248,23 @@ func matchMimeType(filePath string) string {
 }
 
 func mimeIsPhoto(mime string) bool {
-	return strings.HasPrefix(mime, "image/") && !strings.Contains(mime, "image/webp")
+	if strings.Contains(mime, "image/webp") {
+		return WebpAsPhoto
+	}
+	return strings.HasPrefix(mime, "image/")
 }
 
+// ErrNoDownloadableMedia is returned when downloading a message without a file, like a text or a poll
+var ErrNoDownloadableMedia = errors.New("message has no downloadable media")
+
 // GetFileLocation returns file location, datacenter, file size and file name
 func GetFileLocation(file interface{}) (InputFileLocation, int32, int64, string, error) {
+	return fileLocation(file, false, "")
+}
+
+// fileLocation is GetFileLocation, returning the location of the thumbnail of the media if
+// thumb is set, of type thumbSize when there is one
+func fileLocation(file interface{}, thumb bool, thumbSize string) (InputFileLocation, int32, int64, string, error) {
 	var (
 		location   interface{}
 		dataCenter int32 = 4
@@ -169,7 +286,7 @@ mediaMessageSwitch:
 		location = f.Photo
 	case *NewMessage:
 		if !f.IsMedia() {
-			return nil, 0, 0, "", errors.New("message is not media")
+			return nil, 0, 0, "", ErrNoDownloadableMedia
 		}
 		file = f.Media()
 		goto mediaMessageSwitch
@@ -191,11 +308,16 @@ mediaMessageSwitch:
 				}
 			}
 		}
+	case MessageMedia:
+		return nil, 0, 0, "", ErrNoDownloadableMedia
 	default:
 		return nil, 0, 0, "", errors.New("unsupported file type")
 	}
 	switch l := location.(type) {
 	case *DocumentObj:
+		if thumb {
+			return documentThumbLocation(l, thumbSize)
+		}
 		return &InputDocumentFileLocation{
 			ID:            l.ID,
 			AccessHash:    l.AccessHash,
@@ -203,7 +325,16 @@ mediaMessageSwitch:
 			ThumbSize:     "",
 		}, l.DcID, l.Size, getFileName(l), nil
 	case *PhotoObj:
-		size, sizeType := getPhotoSize(l.Sizes[len(l.Sizes)-1])
+		s := largestPhotoSize(l.Sizes)
+		if t := photoSizeOfType(l.Sizes, thumbSize); thumb && t != nil {
+			s = t
+		} else if thumb && thumbSize == "" {
+			s = smallestPhotoSize(l.Sizes)
+		}
+		if s == nil {
+			return nil, 0, 0, "", ErrNoDownloadableMedia
+		}
+		size, sizeType := getPhotoSize(s)
 		return &InputPhotoFileLocation{
 			ID:            l.ID,
 			AccessHash:    l.AccessHash,
@@ -212,11 +343,106 @@ mediaMessageSwitch:
 		}, l.DcID, size, getFileName(l), nil
 	case *InputPhotoFileLocation:
 		return l, dataCenter, fileSize, "", nil
+	case nil, *PhotoEmpty, *DocumentEmpty:
+		return nil, 0, 0, "", ErrNoDownloadableMedia
 	default:
 		return nil, 0, 0, "", errors.New("unsupported file type")
 	}
 }
 
+// downloadablePhotoSizes are the sizes of a photo stored on the servers, the stripped,
+// cached and path sizes are sent inline and can't be downloaded
+func downloadablePhotoSizes(sizes []PhotoSize) []PhotoSize {
+	var d []PhotoSize
+	for _, s := range sizes {
+		switch s.(type) {
+		case *PhotoSizeObj, *PhotoSizeProgressive:
+			d = append(d, s)
+		}
+	}
+	return d
+}
+
+// LargestPhotoSize returns the largest size of a photo that can be downloaded, progressive
+// sizes counting their full size. Stripped and cached sizes are sent inline with the
+// photo and skipped, nil is returned for a photo without a downloadable size.
+func LargestPhotoSize(photo Photo) PhotoSize {
+	if p, ok := photo.(*PhotoObj); ok {
+		return largestPhotoSize(p.Sizes)
+	}
+	return nil
+}
+
+// largestPhotoSize returns the downloadable size with the most bytes, nil if there is none
+func largestPhotoSize(sizes []PhotoSize) PhotoSize {
+	var largest PhotoSize
+	var max int64 = -1
+	for _, s := range downloadablePhotoSizes(sizes) {
+		if size, _ := getPhotoSize(s); size > max {
+			largest, max = s, size
+		}
+	}
+	return largest
+}
+
+// smallestPhotoSize returns the downloadable size with the fewest bytes, nil if there is none
+func smallestPhotoSize(sizes []PhotoSize) PhotoSize {
+	var smallest PhotoSize
+	var min int64 = -1
+	for _, s := range downloadablePhotoSizes(sizes) {
+		if size, _ := getPhotoSize(s); min < 0 || size < min {
+			smallest, min = s, size
+		}
+	}
+	return smallest
+}
+
+// photoSizeOfType returns the downloadable size of a type, nil if there is none
+func photoSizeOfType(sizes []PhotoSize, sizeType string) PhotoSize {
+	if sizeType == "" {
+		return nil
+	}
+	for _, s := range downloadablePhotoSizes(sizes) {
+		if _, t := getPhotoSize(s); t == sizeType {
+			return s
+		}
+	}
+	return nil
+}
+
+// documentThumbLocation returns the location of the thumbnail of a document of type
+// thumbSize, a photo size or the type of a video thumbnail, or else its largest photo thumbnail
+func documentThumbLocation(doc *DocumentObj, thumbSize string) (InputFileLocation, int32, int64, string, error) {
+	location := &InputDocumentFileLocation{
+		ID:            doc.ID,
+		AccessHash:    doc.AccessHash,
+		FileReference: doc.FileReference,
+	}
+	if thumbSize != "" {
+		for _, v := range doc.VideoThumbs {
+			if v, ok := v.(*VideoSizeObj); ok && v.Type == thumbSize {
+				location.ThumbSize = v.Type
+				return location, doc.DcID, int64(v.Size), thumbFileName(getFileName(doc), ".mp4"), nil
+			}
+		}
+	}
+	t := photoSizeOfType(doc.Thumbs, thumbSize)
+	if t == nil {
+		t = largestPhotoSize(doc.Thumbs)
+	}
+	if t == nil {
+		return nil, 0, 0, "", ErrNoDownloadableMedia
+	}
+	size, sizeType := getPhotoSize(t)
+	location.ThumbSize = sizeType
+	return location, doc.DcID, size, thumbFileName(getFileName(doc), ".jpg"), nil
+}
+
+// thumbFileName is the name of the thumbnail of a file, a jpeg image or a mp4 video
+func thumbFileName(name, ext string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "_thumb" + ext
+}
+
 func getPhotoSize(sizes PhotoSize) (int64, string) {
 	switch s := sizes.(type) {
 	case *PhotoSizeObj:
@@ -276,6 +502,9 @@ func getFileName(f interface{}) string {
 				return fmt.Sprintf("sticker_%s_%d.webp", time.Now().Format("2006-01-02_15-04-05"), rand.Intn(1000))
 			}
 		}
+		if ext := ExtensionFromMime(doc.MimeType); ext != "" {
+			return fmt.Sprintf("file_%s_%d%s", time.Now().Format("2006-01-02_15-04-05"), rand.Intn(1000), ext)
+		}
 		if doc.MimeType != "" {
 			return fmt.Sprintf("file_%s_%d.%s", time.Now().Format("2006-01-02_15-04-05"), rand.Intn(1000), strings.Split(doc.MimeType, "/")[1])
 		}
@@ -311,15 +540,11 @@ func getFileSize(f interface{}) int64 {
 	case *MessageMediaDocument:
 		return f.Document.(*DocumentObj).Size
 	case *MessageMediaPhoto:
-		if photo, p := f.Photo.(*PhotoObj); p {
-			if len(photo.Sizes) == 0 {
-				return 0
-			}
-			s, _ := getPhotoSize(photo.Sizes[len(photo.Sizes)-1])
+		if size := LargestPhotoSize(f.Photo); size != nil {
+			s, _ := getPhotoSize(size)
 			return s
-		} else {
-			return 0
 		}
+		return 0
 	default:
 		return 0
 	}
@@ -335,7 +560,7 @@ func getFileExt(f interface{}) string {
 	switch f := f.(type) {
 	case *MessageMediaDocument:
 		doc := f.Document.(*DocumentObj)
-		if e := resolveExt(doc.MimeType); e != "" {
+		if e := ExtensionFromMime(doc.MimeType); e != "" {
 			return e
 		}
 		for _, attr := range doc.Attributes {
@@ -388,6 +613,41 @@ func getPeerUser(userID int64) *PeerUser {
 	}
 }
 
+// channelIDOffset is the offset bot-api style ids apply to channel ids (the -100 prefix)
+const channelIDOffset int64 = 1000000000000
+
+// ChannelIDToPeerID converts a raw channel id to its bot-api style (-100) peer id
+func ChannelIDToPeerID(id int64) int64 {
+	if id <= 0 {
+		return id
+	}
+	return -(channelIDOffset + id)
+}
+
+// PeerIDToChannelID converts a bot-api style (-100) peer id to the raw channel id,
+// ids which are not channel peer ids are returned as is
+func PeerIDToChannelID(id int64) int64 {
+	if !IsChannelID(id) {
+		return id
+	}
+	return -id - channelIDOffset
+}
+
+// IsChannelID returns true if the id is a bot-api style (-100) channel peer id
+func IsChannelID(id int64) bool {
+	return id < -channelIDOffset
+}
+
+// IsChatID returns true if the id is a bot-api style (negative) basic group peer id
+func IsChatID(id int64) bool {
+	return id < 0 && id > -channelIDOffset
+}
+
+// IsUserID returns true if the id is a user peer id
+func IsUserID(id int64) bool {
+	return id > 0
+}
+
 func IsURL(str string) bool {
 	u, err := url.Parse(str)
 	return err == nil && u.Scheme != "" && u.Host != ""
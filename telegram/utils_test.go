@@ -0,0 +1,185 @@
+package telegram
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestPeerIDConversions(t *testing.T) {
+	tests := []struct {
+		peerID    int64
+		channelID int64
+		isChannel bool
+		isChat    bool
+		isUser    bool
+	}{
+		{peerID: -1001234567890, channelID: 1234567890, isChannel: true},
+		{peerID: -123456, channelID: -123456, isChat: true},
+		{peerID: 777000, channelID: 777000, isUser: true},
+	}
+	for _, tt := range tests {
+		if got := PeerIDToChannelID(tt.peerID); got != tt.channelID {
+			t.Errorf("PeerIDToChannelID(%d) = %d, want %d", tt.peerID, got, tt.channelID)
+		}
+		if tt.isChannel {
+			if got := ChannelIDToPeerID(tt.channelID); got != tt.peerID {
+				t.Errorf("ChannelIDToPeerID(%d) = %d, want %d", tt.channelID, got, tt.peerID)
+			}
+		}
+		if IsChannelID(tt.peerID) != tt.isChannel || IsChatID(tt.peerID) != tt.isChat || IsUserID(tt.peerID) != tt.isUser {
+			t.Errorf("unexpected classification for %d", tt.peerID)
+		}
+	}
+}
+
+func TestResolveMimeTypeMissingFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	if mime, isPhoto := resolveMimeType(missing + ".mp4"); mime != "video/mp4" || isPhoto {
+		t.Errorf("got %q, %v for a missing .mp4", mime, isPhoto)
+	}
+	if mime, isPhoto := resolveMimeType(missing + ".jpg"); mime != "image/jpeg" || !isPhoto {
+		t.Errorf("got %q, %v for a missing .jpg", mime, isPhoto)
+	}
+	if mime, _ := resolveMimeType(missing); mime != "" {
+		t.Errorf("got %q for a missing file without extension", mime)
+	}
+}
+
+func TestModernImageMimeTypes(t *testing.T) {
+	for path, want := range map[string]string{"a.heic": "image/heic", "IMG_0001.HEIC": "image/heic", "a.heif": "image/heif", "a.avif": "image/avif"} {
+		if mime, isPhoto := resolveMimeType(path); mime != want || !isPhoto {
+			t.Errorf("%s: got %q, %v", path, mime, isPhoto)
+		}
+	}
+	heic := append([]byte{0, 0, 0, 24}, "ftypheic"...)
+	if mime := sniffMimeType(append(heic, make([]byte, 16)...)); mime != "image/heic" {
+		t.Errorf("sniffed %q for a heic header", mime)
+	}
+
+	if mimeIsPhoto("image/webp") {
+		t.Error("webp is sent as a photo by default")
+	}
+	WebpAsPhoto = true
+	defer func() { WebpAsPhoto = false }()
+	if !mimeIsPhoto("image/webp") {
+		t.Error("webp isn't sent as a photo with WebpAsPhoto")
+	}
+}
+
+func TestResolvedEntity(t *testing.T) {
+	resp := &ContactsResolvedPeer{
+		Peer:  &PeerChannel{ChannelID: 2},
+		Users: []User{&UserObj{ID: 1}},
+		Chats: []Chat{&Channel{ID: 2, AccessHash: 3}},
+	}
+	entity, err := resolvedEntity(resp, "chan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch, ok := entity.(*Channel); !ok || ch.ID != 2 {
+		t.Errorf("got %#v, want the channel", entity)
+	}
+
+	_, err = resolvedEntity(&ContactsResolvedPeer{Peer: &PeerUser{UserID: 5}}, "nobody")
+	if !errors.Is(err, ErrUsernameNotFound) {
+		t.Errorf("got %v, want ErrUsernameNotFound", err)
+	}
+}
+
+func TestSelfPeer(t *testing.T) {
+	c := &Client{me: &UserObj{ID: 42, Username: "bot"}}
+	for _, s := range []string{"me", "self", "Me"} {
+		peer, err := c.GetSendablePeer(s)
+		if _, ok := peer.(*InputPeerSelf); !ok || err != nil {
+			t.Errorf("%q resolved to %v, %v", s, peer, err)
+		}
+		if peer, err := c.ResolvePeer(s); err != nil || peer == nil {
+			t.Errorf("ResolvePeer(%q): %v, %v", s, peer, err)
+		}
+	}
+	// the cached user is returned without a request
+	if me, err := c.Me(); err != nil || me.ID != 42 {
+		t.Errorf("Me() = %v, %v", me, err)
+	}
+}
+
+func TestPeerFromMessage(t *testing.T) {
+	c := &Client{Cache: NewCache()}
+	c.Cache.UpdateChannel(&Channel{ID: 5, AccessHash: 55})
+	// as dispatchUpdates does with a message of a min user
+	c.Cache.rememberOrigins(&MessageObj{ID: 10, PeerID: &PeerChannel{ChannelID: 5}, FromID: &PeerUser{UserID: 7}})
+	c.Cache.UpdatePeersToCache([]User{&UserObj{ID: 7, Min: true, AccessHash: 77}}, nil)
+
+	peer, err := c.GetSendablePeer(&PeerUser{UserID: 7})
+	fromMessage, ok := peer.(*InputPeerUserFromMessage)
+	if err != nil || !ok || fromMessage.MsgID != 10 || fromMessage.UserID != 7 {
+		t.Fatalf("expected the user from message 10, got %#v, %v", peer, err)
+	}
+	if channel, ok := fromMessage.Peer.(*InputPeerChannel); !ok || channel.AccessHash != 55 {
+		t.Errorf("expected the message in channel 5, got %#v", fromMessage.Peer)
+	}
+
+	// the full user replaces the message once learned
+	c.Cache.UpdateUser(&UserObj{ID: 7, AccessHash: 777})
+	if peer, _ := c.GetSendablePeer(int64(7)); peer.(*InputPeerUser).AccessHash != 777 {
+		t.Errorf("expected the full access hash, got %#v", peer)
+	}
+}
+
+func TestFileLocation(t *testing.T) {
+	photo := &MessageMediaPhoto{Photo: &PhotoObj{ID: 1, DcID: 2, Sizes: []PhotoSize{
+		&PhotoStrippedSize{Type: "i", Bytes: []byte{1, 2, 3}},
+		&PhotoSizeObj{Type: "m", Size: 100},
+		&PhotoSizeProgressive{Type: "y", Sizes: []int32{1000, 5000}},
+		&PhotoSizeObj{Type: "x", Size: 2000},
+	}}}
+	location, _, size, _, err := fileLocation(photo, false, "")
+	if err != nil || location.(*InputPhotoFileLocation).ThumbSize != "y" || size != 5000 {
+		t.Errorf("largest size: got %v, %d, %v", location, size, err)
+	}
+	location, _, size, _, err = fileLocation(photo, true, "")
+	if err != nil || location.(*InputPhotoFileLocation).ThumbSize != "m" || size != 100 {
+		t.Errorf("thumbnail: got %v, %d, %v", location, size, err)
+	}
+
+	doc := &MessageMediaDocument{Document: &DocumentObj{ID: 1, Size: 9000, Attributes: []DocumentAttribute{&DocumentAttributeFilename{FileName: "clip.mp4"}}}}
+	if _, _, _, _, err := fileLocation(doc, true, ""); !errors.Is(err, ErrNoDownloadableMedia) {
+		t.Errorf("document without thumbnails: got %v", err)
+	}
+	doc.Document.(*DocumentObj).Thumbs = []PhotoSize{&PhotoSizeObj{Type: "s", Size: 10}, &PhotoSizeObj{Type: "m", Size: 30}}
+	location, _, size, name, err := fileLocation(doc, true, "")
+	if err != nil || location.(*InputDocumentFileLocation).ThumbSize != "m" || size != 30 || name != "clip_thumb.jpg" {
+		t.Errorf("document thumbnail: got %v, %d, %q, %v", location, size, name, err)
+	}
+	location, _, size, _, err = fileLocation(doc, true, "s")
+	if err != nil || location.(*InputDocumentFileLocation).ThumbSize != "s" || size != 10 {
+		t.Errorf("document thumbnail of type s: got %v, %d, %v", location, size, err)
+	}
+	doc.Document.(*DocumentObj).VideoThumbs = []VideoSize{&VideoSizeObj{Type: "v", Size: 500}}
+	location, _, size, name, err = fileLocation(doc, true, "v")
+	if err != nil || location.(*InputDocumentFileLocation).ThumbSize != "v" || size != 500 || name != "clip_thumb.mp4" {
+		t.Errorf("video thumbnail: got %v, %d, %q, %v", location, size, name, err)
+	}
+
+	for _, file := range []interface{}{&NewMessage{Message: &MessageObj{}}, &MessageMediaGeo{}, &MessageMediaPhoto{Photo: &PhotoEmpty{}}} {
+		if _, _, _, _, err := fileLocation(file, false, ""); !errors.Is(err, ErrNoDownloadableMedia) {
+			t.Errorf("%T: got %v", file, err)
+		}
+	}
+}
+
+func TestExtensionFromMime(t *testing.T) {
+	for mime, want := range map[string]string{"image/jpeg": ".jpg", "video/mp4": ".mp4", "text/plain; charset=utf-8": ".txt", "audio/x-midi": ".mid", "application/x-unknown": ""} {
+		if ext := ExtensionFromMime(mime); ext != want {
+			t.Errorf("%s: got %q, want %q", mime, ext, want)
+		}
+	}
+	if LargestPhotoSize(&PhotoObj{Sizes: []PhotoSize{&PhotoStrippedSize{Type: "i", Bytes: []byte{1}}}}) != nil {
+		t.Error("a stripped size can't be downloaded")
+	}
+	if LargestPhotoSize(&PhotoEmpty{}) != nil {
+		t.Error("an empty photo has no size")
+	}
+}